@@ -15,6 +15,7 @@ import (
 	"github.com/fleetdm/fleet/v4/server/service"
 
 	eewebhooks "github.com/fleetdm/fleet/v4/ee/server/webhooks"
+	"github.com/fleetdm/fleet/v4/pkg/download"
 	"github.com/fleetdm/fleet/v4/server"
 	"github.com/fleetdm/fleet/v4/server/config"
 	"github.com/fleetdm/fleet/v4/server/contexts/ctxerr"
@@ -335,6 +336,21 @@ func checkOvalVulnerabilities(
 	return results
 }
 
+// splitFeedHosts splits the comma-separated list of allowed feed hosts.
+func splitFeedHosts(hosts string) []string {
+	var res []string
+	for _, h := range strings.Split(hosts, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// minEPSSCoverage is the fraction of the stored CVEs with an EPSS probability below which the EPSS feed is reported
+// as likely stale or broken.
+const minEPSSCoverage = 0.5
+
 func checkNVDVulnerabilities(
 	ctx context.Context,
 	ds fleet.Datastore,
@@ -344,25 +360,73 @@ func checkNVDVulnerabilities(
 	collectVulns bool,
 ) []fleet.SoftwareVulnerability {
 	if !config.DisableDataSync {
-		opts := nvd.SyncOptions{
-			VulnPath:           config.DatabasesPath,
-			CPEDBURL:           config.CPEDatabaseURL,
-			CPETranslationsURL: config.CPETranslationsURL,
-			CVEFeedPrefixURL:   config.CVEFeedPrefixURL,
-		}
-		err := nvd.Sync(opts)
+		// the feeds are not downloaded over connections less secure than configured
+		minTLSVersion, err := nvd.ParseTLSVersion(config.MinFeedTLSVersion)
 		if err != nil {
-			errHandler(ctx, logger, "syncing vulnerability database", err)
+			errHandler(ctx, logger, "parsing min_feed_tls_version", err)
 			// don't return, continue on ...
 		}
+		// the feeds are not downloaded unverified if the key is invalid
+		var signatureKey *download.MinisignPublicKey
+		if err == nil && config.FeedSignatureKey != "" {
+			signatureKey, err = download.ParseMinisignPublicKey(config.FeedSignatureKey)
+			if err != nil {
+				errHandler(ctx, logger, "parsing feed_signature_key", err)
+				// don't return, continue on ...
+			}
+		}
+		if err == nil {
+			opts := nvd.SyncOptions{
+				VulnPath:           config.DatabasesPath,
+				CPEDBURL:           config.CPEDatabaseURL,
+				CPETranslationsURL: config.CPETranslationsURL,
+				CVEFeedPrefixURL:   config.CVEFeedPrefixURL,
+				CreateVulnPath:     true,
+				URLPolicy: nvd.URLPolicy{
+					AllowHTTP:    config.AllowInsecureFeedURLs,
+					AllowedHosts: splitFeedHosts(config.AllowedFeedHosts),
+				},
+				MinTLSVersion:       minTLSVersion,
+				ValidateCISACatalog: true,
+				SignatureKey:        signatureKey,
+			}
+			if err := nvd.SyncAndRecord(ctx, ds, opts); err != nil {
+				errHandler(ctx, logger, "syncing vulnerability database", err)
+				// don't return, continue on ...
+			}
+		}
 	}
 
-	if err := nvd.LoadCVEMeta(ctx, logger, vulnPath, ds); err != nil {
+	// skip the load rather than interleaving with the load of another instance, or waiting for it indefinitely
+	loadOpts := []nvd.LoadCVEMetaOption{nvd.WithReport(), nvd.WithCWEs(), nvd.WithLoadLock(false)}
+	if config.RecordCVETrend {
+		loadOpts = append(loadOpts, nvd.WithFleetCVETrend())
+	}
+	if config.PruneCVEMeta {
+		loadOpts = append(loadOpts, nvd.WithPrune())
+	}
+	result, err := nvd.LoadCVEMetaWithResult(ctx, logger, vulnPath, ds, loadOpts...)
+	if errors.Is(err, fleet.ErrCVEMetaLoadInProgress) {
+		level.Info(logger).Log("msg", "skipping cve meta load", "err", err)
+		// don't return, continue on ...
+	} else if err != nil {
 		errHandler(ctx, logger, "load cve meta", err)
 		// don't return, continue on ...
+	} else if result.Pruned > 0 {
+		level.Debug(logger).Log("msg", "pruned cve meta", "count", result.Pruned)
+	}
+
+	if coverage, err := ds.EPSSCoverage(ctx); err != nil {
+		errHandler(ctx, logger, "get epss coverage", err)
+		// don't return, continue on ...
+	} else if coverage.CVECount > 0 && coverage.Ratio() < minEPSSCoverage {
+		errHandler(ctx, logger, "checking epss coverage", fmt.Errorf(
+			"only %d of %d cves have an epss score, the epss feed may be stale", coverage.EPSSCount, coverage.CVECount,
+		))
+		// don't return, continue on ...
 	}
 
-	err := nvd.TranslateSoftwareToCPE(ctx, ds, vulnPath, logger)
+	err = nvd.TranslateSoftwareToCPE(ctx, ds, vulnPath, logger)
 	if err != nil {
 		errHandler(ctx, logger, "analyzing vulnerable software: Software->CPE", err)
 		return nil
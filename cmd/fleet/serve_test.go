@@ -268,7 +268,25 @@ func TestCronVulnerabilitiesCreatesDatabasesPath(t *testing.T) {
 			Features: fleet.Features{EnableSoftwareInventory: true},
 		}, nil
 	}
-	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta) error {
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		return nil
+	}
+	ds.InsertCVECWEsFunc = func(ctx context.Context, cwes []fleet.CVECWE) error {
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+	ds.LockCVEMetaLoadFunc = func(ctx context.Context, wait bool) (func(), error) {
+		return func() {}, nil
+	}
+	ds.EPSSCoverageFunc = func(ctx context.Context) (*fleet.EPSSCoverage, error) {
+		return &fleet.EPSSCoverage{}, nil
+	}
+	ds.InsertEPSSSnapshotsFunc = func(ctx context.Context, x []fleet.EPSSSnapshot) error {
 		return nil
 	}
 	ds.AllSoftwareWithoutCPEIteratorFunc = func(ctx context.Context, excludedPlatforms []string) (fleet.SoftwareIterator, error) {
@@ -384,7 +402,25 @@ func TestScanVulnerabilities(t *testing.T) {
 	}
 
 	ds := new(mock.Store)
-	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta) error {
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		return nil
+	}
+	ds.InsertCVECWEsFunc = func(ctx context.Context, cwes []fleet.CVECWE) error {
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+	ds.LockCVEMetaLoadFunc = func(ctx context.Context, wait bool) (func(), error) {
+		return func() {}, nil
+	}
+	ds.EPSSCoverageFunc = func(ctx context.Context) (*fleet.EPSSCoverage, error) {
+		return &fleet.EPSSCoverage{}, nil
+	}
+	ds.InsertEPSSSnapshotsFunc = func(ctx context.Context, x []fleet.EPSSSnapshot) error {
 		return nil
 	}
 	ds.AllSoftwareWithoutCPEIteratorFunc = func(ctx context.Context, excludedPlatforms []string) (fleet.SoftwareIterator, error) {
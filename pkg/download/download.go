@@ -2,8 +2,11 @@
 package download
 
 import (
+	"bufio"
 	"compress/bzip2"
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -11,23 +14,103 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ulikunitz/xz"
 )
 
+const (
+	// maxRateLimitRetries is the number of times a rate limited request is retried before giving up.
+	maxRateLimitRetries = 3
+	// maxRetryAfter caps the wait requested by the server in the Retry-After header.
+	maxRetryAfter = 5 * time.Minute
+	// defaultBufferSize is the size of the buffer the body is read into, the same as io.Copy's.
+	defaultBufferSize = 32 * 1024
+)
+
+// defaultRateLimitCooldown is the wait before retrying a rate limited request when the server doesn't send a
+// Retry-After header.
+var defaultRateLimitCooldown = 30 * time.Second
+
+// ErrRateLimited is returned when the server is still rate limiting the requests after all the retries.
+var ErrRateLimited = errors.New("rate limited by server")
+
+// ErrContentLengthMismatch is returned when the number of bytes received doesn't match the Content-Length header of
+// the response, e.g. because a proxy truncated it.
+var ErrContentLengthMismatch = errors.New("downloaded size doesn't match content length")
+
+// ProgressFunc is called with the number of bytes downloaded so far and the total size of the download, which is -1
+// if the server didn't send it. The bytes are counted as received, before any extraction.
+type ProgressFunc func(downloaded, total int64)
+
+type options struct {
+	ctx              context.Context
+	progress         ProgressFunc
+	progressInterval time.Duration
+	bufferSize       int
+	publicKey        *MinisignPublicKey
+}
+
+// Option configures Download and DownloadAndExtract.
+type Option func(o *options)
+
+// WithContext makes the download use ctx for its requests and for the waits before retrying a rate limited request,
+// so that canceling ctx stops the download. The download isn't canceled by default.
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithProgress makes the download report its progress to fn, at most once per interval so that long transfers don't
+// flood the logs, and once more when the download completes.
+func WithProgress(fn ProgressFunc, interval time.Duration) Option {
+	return func(o *options) {
+		o.progress = fn
+		o.progressInterval = interval
+	}
+}
+
+// WithBufferSize makes the download read the body in chunks of up to size bytes instead of defaultBufferSize.
+// Larger buffers need fewer reads, which improves the throughput of large downloads over high-latency links. A size
+// of zero or less keeps the default.
+func WithBufferSize(size int) Option {
+	return func(o *options) {
+		o.bufferSize = size
+	}
+}
+
+// WithSignature makes the download verify the resource against its detached minisign signature, fetched from the
+// URL of the resource with a .minisig suffix. The signature covers the bytes as downloaded, before any extraction.
+// The download fails with ErrInvalidSignature if the signature is missing, invalid or not made with publicKey. Only
+// the prehashed signatures (the default since minisign 0.8) are supported, the legacy ones are rejected.
+func WithSignature(publicKey *MinisignPublicKey) Option {
+	return func(o *options) {
+		o.publicKey = publicKey
+	}
+}
+
 // Download downloads a file from a URL and writes it to path.
-func Download(client *http.Client, u *url.URL, path string) error {
-	return download(client, u, path, false)
+func Download(client *http.Client, u *url.URL, path string, opts ...Option) error {
+	return download(client, u, path, false, opts)
 }
 
 // DownloadAndExtract downloads and extracts a file from a URL and writes it to path.
 // The compression method is determined using extension from the url path. Only .gz, .bz2, or .xz extensions are supported.
-func DownloadAndExtract(client *http.Client, u *url.URL, path string) error {
-	return download(client, u, path, true)
+func DownloadAndExtract(client *http.Client, u *url.URL, path string, opts ...Option) error {
+	return download(client, u, path, true, opts)
 }
 
-func download(client *http.Client, u *url.URL, path string, extract bool) error {
+func download(client *http.Client, u *url.URL, path string, extract bool, opts []Option) error {
+	o := options{ctx: context.Background(), bufferSize: defaultBufferSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.bufferSize <= 0 {
+		o.bufferSize = defaultBufferSize
+	}
 
 	// atomically write to file
 	dir, file := filepath.Split(path)
@@ -57,32 +140,48 @@ func download(client *http.Client, u *url.URL, path string, extract bool) error
 		}
 	}()
 
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
-	if err != nil {
-		return err
+	var check *signatureCheck
+	if o.publicKey != nil {
+		check, err = fetchSignature(o.ctx, client, u, o.publicKey)
+		if err != nil {
+			return err
+		}
 	}
 
-	resp, err := client.Do(req)
+	resp, err := get(o.ctx, client, u)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
-	r := io.Reader(resp.Body)
+	raw := io.Reader(resp.Body)
+	if check != nil {
+		raw = io.TeeReader(resp.Body, check)
+	}
+	counter := &countingReader{r: raw}
+	body := io.Reader(counter)
+	var pr *progressReader
+	if o.progress != nil {
+		pr = &progressReader{r: counter, total: resp.ContentLength, fn: o.progress, interval: o.progressInterval}
+		body = pr
+	}
+	r := body
 
 	// extract (optional)
 	if extract {
+		// the decompressors read in small chunks, buffer the body so that it's still read in bufferSize chunks
+		br := bufio.NewReaderSize(body, o.bufferSize)
 		switch {
 		case strings.HasSuffix(u.Path, "gz"):
-			gr, err := gzip.NewReader(resp.Body)
+			gr, err := gzip.NewReader(br)
 			if err != nil {
 				return err
 			}
 			r = gr
 		case strings.HasSuffix(u.Path, "bz2"):
-			r = bzip2.NewReader(resp.Body)
+			r = bzip2.NewReader(br)
 		case strings.HasSuffix(u.Path, "xz"):
-			xzr, err := xz.NewReader(resp.Body)
+			xzr, err := xz.NewReader(br)
 			if err != nil {
 				return err
 			}
@@ -92,9 +191,32 @@ func download(client *http.Client, u *url.URL, path string, extract bool) error
 		}
 	}
 
-	if _, err := io.Copy(tmpFile, r); err != nil {
+	// the writers are wrapped to hide their ReadFrom, which would copy with its own buffer
+	buf := make([]byte, o.bufferSize)
+	if _, err := io.CopyBuffer(struct{ io.Writer }{tmpFile}, r, buf); err != nil {
+		// a body shorter than its Content-Length ends early
+		if errors.Is(err, io.ErrUnexpectedEOF) && resp.ContentLength >= 0 && counter.n < resp.ContentLength {
+			return contentLengthMismatch(resp.ContentLength, counter.n)
+		}
 		return err
 	}
+	if resp.ContentLength >= 0 || check != nil {
+		// the extraction can stop before the end of the body, the whole body is counted and verified
+		if _, err := io.CopyBuffer(struct{ io.Writer }{io.Discard}, body, buf); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return err
+		}
+	}
+	if resp.ContentLength >= 0 && counter.n != resp.ContentLength {
+		return contentLengthMismatch(resp.ContentLength, counter.n)
+	}
+	if check != nil {
+		if err := check.verify(); err != nil {
+			return err
+		}
+	}
+	if pr != nil {
+		pr.done()
+	}
 
 	// Writes are not synchronous. Handle errors from writes returned by Close.
 	if err := tmpFile.Close(); err != nil {
@@ -109,3 +231,144 @@ func download(client *http.Client, u *url.URL, path string, extract bool) error
 
 	return nil
 }
+
+// fetchSignature downloads the detached signature of the resource at u and prepares its verification against key.
+func fetchSignature(ctx context.Context, client *http.Client, u *url.URL, key *MinisignPublicKey) (*signatureCheck, error) {
+	sigURL := *u
+	sigURL.Path += minisignSignatureSuffix
+	sigURL.RawPath = ""
+
+	resp, err := get(ctx, client, &sigURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: fetch signature: %s", ErrInvalidSignature, err)
+	}
+	defer resp.Body.Close()
+
+	b, err := io.ReadAll(io.LimitReader(resp.Body, maxMinisignSignatureSize))
+	if err != nil {
+		return nil, fmt.Errorf("read signature: %w", err)
+	}
+	return newSignatureCheck(key, b)
+}
+
+func contentLengthMismatch(expected, actual int64) error {
+	return fmt.Errorf("%w: expected %d bytes, got %d", ErrContentLengthMismatch, expected, actual)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// progressReader counts the bytes read from r and reports them to fn, at most once per interval.
+type progressReader struct {
+	r          io.Reader
+	total      int64
+	fn         ProgressFunc
+	interval   time.Duration
+	downloaded int64
+	// reportedAt and reported are when the progress was last reported and the bytes downloaded at that time
+	reportedAt time.Time
+	reported   int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.downloaded += int64(n)
+	if n > 0 && time.Since(p.reportedAt) >= p.interval {
+		p.report()
+	}
+	return n, err
+}
+
+// done reports the final progress, unless it was already reported.
+func (p *progressReader) done() {
+	if p.reportedAt.IsZero() || p.reported != p.downloaded {
+		p.report()
+	}
+}
+
+func (p *progressReader) report() {
+	p.reportedAt, p.reported = time.Now(), p.downloaded
+	p.fn(p.downloaded, p.total)
+}
+
+// get requests u, waiting and retrying if the server rate limits the request. Any other non-200 response is an
+// error. It gives up waiting with the error of ctx if ctx is done.
+func get(ctx context.Context, client *http.Client, u *url.URL) (*http.Response, error) {
+	for retries := 0; ; retries++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		// only the beginning of the body is needed to tell a throttle from other errors
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+
+		if !isRateLimited(resp, body) {
+			return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		if retries == maxRateLimitRetries {
+			return nil, fmt.Errorf("%w: status code %d after %d retries", ErrRateLimited, resp.StatusCode, retries)
+		}
+
+		timer := time.NewTimer(retryAfter(resp.Header.Get("Retry-After"), time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// isRateLimited returns whether the response is the server throttling the requests. Some servers (e.g. NVD) use
+// 403 Forbidden for this, so a 403 is only considered a throttle if it says so.
+func isRateLimited(resp *http.Response, body []byte) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("Retry-After") != "" ||
+			strings.Contains(strings.ToLower(string(body)), "rate limit")
+	default:
+		return false
+	}
+}
+
+// retryAfter returns the wait requested by the value of a Retry-After header, which is either a number of seconds
+// or an HTTP date. It returns defaultRateLimitCooldown if the value is missing or invalid.
+func retryAfter(v string, now time.Time) time.Duration {
+	var d time.Duration
+	if secs, err := strconv.Atoi(v); err == nil {
+		d = time.Duration(secs) * time.Second
+	} else if t, err := http.ParseTime(v); err == nil {
+		d = t.Sub(now)
+	} else {
+		return defaultRateLimitCooldown
+	}
+
+	if d < 0 {
+		return 0
+	}
+	if d > maxRetryAfter {
+		return maxRetryAfter
+	}
+	return d
+}
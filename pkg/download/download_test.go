@@ -0,0 +1,337 @@
+package download
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadRateLimited(t *testing.T) {
+	download := func(t *testing.T, srv *httptest.Server) (string, error) {
+		u, err := url.Parse(srv.URL + "/feed.json")
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "feed.json")
+		return path, Download(http.DefaultClient, u, path)
+	}
+
+	t.Run("honors Retry-After", func(t *testing.T) {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			if requests == 1 {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.Write([]byte("feed")) //nolint:errcheck
+		}))
+		defer srv.Close()
+
+		start := time.Now()
+		path, err := download(t, srv)
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(start), time.Second)
+		require.Equal(t, 2, requests)
+
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, "feed", string(b))
+	})
+
+	t.Run("gives up after retries", func(t *testing.T) {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Rate limit exceeded")) //nolint:errcheck
+		}))
+		defer srv.Close()
+
+		path, err := download(t, srv)
+		require.Error(t, err)
+		require.True(t, errors.Is(err, ErrRateLimited))
+		require.Contains(t, err.Error(), "rate limited")
+		require.Equal(t, maxRateLimitRetries+1, requests)
+		require.NoFileExists(t, path)
+	})
+
+	t.Run("forbidden is not retried", func(t *testing.T) {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("Forbidden")) //nolint:errcheck
+		}))
+		defer srv.Close()
+
+		path, err := download(t, srv)
+		require.Error(t, err)
+		require.False(t, errors.Is(err, ErrRateLimited))
+		require.Equal(t, 1, requests)
+		require.NoFileExists(t, path)
+	})
+
+	t.Run("stops waiting when canceled", func(t *testing.T) {
+		var requests int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests++
+			w.Header().Set("Retry-After", "60")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer srv.Close()
+
+		u, err := url.Parse(srv.URL + "/feed.json")
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "feed.json")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err = Download(http.DefaultClient, u, path, WithContext(ctx))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Less(t, time.Since(start), 10*time.Second)
+		require.Equal(t, 1, requests)
+		require.NoFileExists(t, path)
+	})
+}
+
+func TestDownloadProgress(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024) // 1MiB
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err := gw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := content
+		if r.URL.Path == "/feed.json.gz" {
+			body = compressed.Bytes()
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		// in several chunks, so that the download takes several reads
+		for len(body) > 0 {
+			n := 32 * 1024
+			if n > len(body) {
+				n = len(body)
+			}
+			w.Write(body[:n]) //nolint:errcheck
+			w.(http.Flusher).Flush()
+			body = body[n:]
+		}
+	}))
+	defer srv.Close()
+
+	type progress struct{ downloaded, total int64 }
+	download := func(t *testing.T, name string, interval time.Duration) []progress {
+		var calls []progress
+		u, err := url.Parse(srv.URL + "/" + name)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "feed.json")
+		fn := func(downloaded, total int64) {
+			calls = append(calls, progress{downloaded, total})
+		}
+		if filepath.Ext(name) == ".gz" {
+			require.NoError(t, DownloadAndExtract(http.DefaultClient, u, path, WithProgress(fn, interval)))
+		} else {
+			require.NoError(t, Download(http.DefaultClient, u, path, WithProgress(fn, interval)))
+		}
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, content, b)
+		return calls
+	}
+
+	t.Run("increasing byte counts", func(t *testing.T) {
+		calls := download(t, "feed.json", 0)
+		require.Greater(t, len(calls), 1)
+		for i, c := range calls {
+			require.Equal(t, int64(len(content)), c.total)
+			if i > 0 {
+				require.Greater(t, c.downloaded, calls[i-1].downloaded)
+			}
+		}
+		require.Equal(t, int64(len(content)), calls[len(calls)-1].downloaded)
+	})
+
+	t.Run("throttled", func(t *testing.T) {
+		// the first read and the completion
+		calls := download(t, "feed.json", time.Hour)
+		require.Len(t, calls, 2)
+		require.Less(t, calls[0].downloaded, int64(len(content)))
+		require.Equal(t, progress{int64(len(content)), int64(len(content))}, calls[1])
+	})
+
+	t.Run("compressed bytes", func(t *testing.T) {
+		calls := download(t, "feed.json.gz", 0)
+		require.NotEmpty(t, calls)
+		require.Equal(t, progress{int64(compressed.Len()), int64(compressed.Len())}, calls[len(calls)-1])
+	})
+
+	t.Run("optional", func(t *testing.T) {
+		u, err := url.Parse(srv.URL + "/feed.json")
+		require.NoError(t, err)
+		require.NoError(t, Download(http.DefaultClient, u, filepath.Join(t.TempDir(), "feed.json")))
+	})
+}
+
+func TestDownloadContentLengthMismatch(t *testing.T) {
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err := gw.Write([]byte(`{"vulnerabilities": []}`))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/truncated.json":
+			// advertises more than it sends, like a truncating proxy
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte(`{"vulnerabilities": [`)) //nolint:errcheck
+		case "/truncated.json.gz":
+			// the compressed stream is complete, but the body isn't
+			w.Header().Set("Content-Length", strconv.Itoa(compressed.Len()+10))
+			w.Write(compressed.Bytes()) //nolint:errcheck
+		default:
+			w.Write([]byte(`{"vulnerabilities": []}`)) //nolint:errcheck
+		}
+	}))
+	defer srv.Close()
+
+	download := func(t *testing.T, name string) (string, error) {
+		u, err := url.Parse(srv.URL + "/" + name)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "feed.json")
+		if filepath.Ext(name) == ".gz" {
+			return path, DownloadAndExtract(http.DefaultClient, u, path)
+		}
+		return path, Download(http.DefaultClient, u, path)
+	}
+
+	path, err := download(t, "truncated.json")
+	require.ErrorIs(t, err, ErrContentLengthMismatch)
+	require.Contains(t, err.Error(), "expected 100 bytes, got 21")
+	require.NoFileExists(t, path)
+
+	path, err = download(t, "truncated.json.gz")
+	require.ErrorIs(t, err, ErrContentLengthMismatch)
+	require.Contains(t, err.Error(), fmt.Sprintf("expected %d bytes, got %d", compressed.Len()+10, compressed.Len()))
+	require.NoFileExists(t, path)
+
+	// a complete body is accepted
+	path, err = download(t, "feed.json")
+	require.NoError(t, err)
+	require.FileExists(t, path)
+}
+
+// readSizeRecorder records the largest buffer r is read into.
+type readSizeRecorder struct {
+	r   io.Reader
+	max int
+}
+
+func (rr *readSizeRecorder) Read(b []byte) (int, error) {
+	if len(b) > rr.max {
+		rr.max = len(b)
+	}
+	return rr.r.Read(b)
+}
+
+func (rr *readSizeRecorder) Close() error { return nil }
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestDownloadBufferSize(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 64*1024) // 1MiB
+
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err := gw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	// maxRead downloads name and returns the largest read of the response body
+	maxRead := func(t *testing.T, name string, opts ...Option) int {
+		var body *readSizeRecorder
+		client := &http.Client{Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+			b := content
+			if filepath.Ext(r.URL.Path) == ".gz" {
+				b = compressed.Bytes()
+			}
+			body = &readSizeRecorder{r: bytes.NewReader(b)}
+			return &http.Response{StatusCode: http.StatusOK, ContentLength: int64(len(b)), Body: body}, nil
+		})}
+
+		u, err := url.Parse("https://example.com/" + name)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "feed.json")
+		if filepath.Ext(name) == ".gz" {
+			require.NoError(t, DownloadAndExtract(client, u, path, opts...))
+		} else {
+			require.NoError(t, Download(client, u, path, opts...))
+		}
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, content, b)
+		return body.max
+	}
+
+	require.Equal(t, defaultBufferSize, maxRead(t, "feed.json"))
+	require.Equal(t, defaultBufferSize, maxRead(t, "feed.json", WithBufferSize(0)))
+	require.Equal(t, 256*1024, maxRead(t, "feed.json", WithBufferSize(256*1024)))
+	require.Equal(t, 4*1024, maxRead(t, "feed.json", WithBufferSize(4*1024)))
+	require.Equal(t, 256*1024, maxRead(t, "feed.json.gz", WithBufferSize(256*1024)))
+}
+
+func BenchmarkDownloadBufferSize(b *testing.B) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1024*1024) // 16MiB
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	u, err := url.Parse(srv.URL + "/feed.json")
+	require.NoError(b, err)
+	path := filepath.Join(b.TempDir(), "feed.json")
+
+	for _, size := range []int{4 * 1024, defaultBufferSize, 256 * 1024, 1024 * 1024} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			b.SetBytes(int64(len(content)))
+			for i := 0; i < b.N; i++ {
+				if err := Download(http.DefaultClient, u, path, WithBufferSize(size)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2023, 3, 21, 10, 0, 0, 0, time.UTC)
+
+	require.Equal(t, 5*time.Second, retryAfter("5", now))
+	require.Equal(t, 30*time.Second, retryAfter(now.Add(30*time.Second).Format(http.TimeFormat), now))
+	require.Equal(t, time.Duration(0), retryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+	require.Equal(t, maxRetryAfter, retryAfter("86400", now))
+	require.Equal(t, defaultRateLimitCooldown, retryAfter("", now))
+	require.Equal(t, defaultRateLimitCooldown, retryAfter("soon", now))
+}
@@ -0,0 +1,153 @@
+package download
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// ErrInvalidSignature is returned when the detached signature of a download is missing, malformed or doesn't match
+// the downloaded bytes.
+var ErrInvalidSignature = errors.New("invalid signature")
+
+const (
+	// minisignSignatureSuffix is appended to the URL of a resource to get the URL of its detached signature.
+	minisignSignatureSuffix = ".minisig"
+	// maxMinisignSignatureSize caps the size of a signature file, which is a few hundred bytes.
+	maxMinisignSignatureSize = 4096
+
+	trustedCommentPrefix = "trusted comment: "
+)
+
+var (
+	// minisignAlgorithm is the signature algorithm of the keys and of the legacy signatures, which sign the content.
+	// The legacy signatures are rejected: verifying them requires the whole content in memory.
+	minisignAlgorithm = [2]byte{'E', 'd'}
+	// minisignPrehashedAlgorithm is the signature algorithm of the signatures of the BLAKE2b-512 hash of the content,
+	// the default since minisign 0.8 and the only one supported.
+	minisignPrehashedAlgorithm = [2]byte{'E', 'D'}
+)
+
+// MinisignPublicKey is a minisign public key, used to verify the signatures of downloads, see WithSignature.
+type MinisignPublicKey struct {
+	keyID [8]byte
+	key   ed25519.PublicKey
+}
+
+// ParseMinisignPublicKey parses a minisign public key, either the contents of a public key file (with its untrusted
+// comment line) or just the base64-encoded key.
+func ParseMinisignPublicKey(s string) (*MinisignPublicKey, error) {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return nil, fmt.Errorf("decode minisign public key: %w", err)
+	}
+	if len(b) != 2+8+ed25519.PublicKeySize || !bytes.Equal(b[:2], minisignAlgorithm[:]) {
+		return nil, errors.New("invalid minisign public key")
+	}
+
+	var pk MinisignPublicKey
+	copy(pk.keyID[:], b[2:10])
+	pk.key = ed25519.PublicKey(b[10:])
+	return &pk, nil
+}
+
+// minisignSignature is a parsed minisign signature file.
+type minisignSignature struct {
+	algorithm      [2]byte
+	keyID          [8]byte
+	signature      []byte
+	trustedComment string
+	globalSig      []byte
+}
+
+func parseMinisignSignature(b []byte) (*minisignSignature, error) {
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		lines = append(lines, strings.TrimRight(sc.Text(), "\r"))
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	// untrusted comment, signature, trusted comment and global signature
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], trustedCommentPrefix) {
+		return nil, errors.New("malformed signature file")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil {
+		return nil, fmt.Errorf("decode signature: %w", err)
+	}
+	if len(sig) != 2+8+ed25519.SignatureSize {
+		return nil, errors.New("malformed signature")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil {
+		return nil, fmt.Errorf("decode global signature: %w", err)
+	}
+	if len(globalSig) != ed25519.SignatureSize {
+		return nil, errors.New("malformed global signature")
+	}
+
+	s := minisignSignature{
+		signature:      sig[10:],
+		trustedComment: strings.TrimPrefix(lines[2], trustedCommentPrefix),
+		globalSig:      globalSig,
+	}
+	copy(s.algorithm[:], sig[:2])
+	copy(s.keyID[:], sig[2:10])
+	switch s.algorithm {
+	case minisignPrehashedAlgorithm:
+	case minisignAlgorithm:
+		return nil, errors.New("legacy signatures are not supported, sign with a prehashed signature (minisign -H)")
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %q", s.algorithm[:])
+	}
+	return &s, nil
+}
+
+// signatureCheck verifies a prehashed minisign signature against the hash of the bytes written to it.
+type signatureCheck struct {
+	key *MinisignPublicKey
+	sig *minisignSignature
+	h   hash.Hash
+}
+
+func newSignatureCheck(key *MinisignPublicKey, sigFile []byte) (*signatureCheck, error) {
+	sig, err := parseMinisignSignature(sigFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	if sig.keyID != key.keyID {
+		return nil, fmt.Errorf("%w: signed with key %X, expected %X", ErrInvalidSignature, sig.keyID, key.keyID)
+	}
+
+	h, err := blake2b.New512(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &signatureCheck{key: key, sig: sig, h: h}, nil
+}
+
+func (c *signatureCheck) Write(b []byte) (int, error) {
+	return c.h.Write(b)
+}
+
+// verify checks the signature of the bytes written so far, and the global signature of the trusted comment.
+func (c *signatureCheck) verify() error {
+	if !ed25519.Verify(c.key.key, c.h.Sum(nil), c.sig.signature) {
+		return fmt.Errorf("%w: signature doesn't match the content", ErrInvalidSignature)
+	}
+	if !ed25519.Verify(c.key.key, append(append([]byte{}, c.sig.signature...), c.sig.trustedComment...), c.sig.globalSig) {
+		return fmt.Errorf("%w: global signature doesn't match the trusted comment", ErrInvalidSignature)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package download
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisignKey is a test minisign key pair.
+type minisignKey struct {
+	keyID [8]byte
+	priv  ed25519.PrivateKey
+	pub   ed25519.PublicKey
+}
+
+func newMinisignKey(t *testing.T) *minisignKey {
+	var k minisignKey
+	_, err := rand.Read(k.keyID[:])
+	require.NoError(t, err)
+	k.pub, k.priv, err = ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	return &k
+}
+
+// publicKey returns the contents of the public key file.
+func (k *minisignKey) publicKey() string {
+	b := append(append(minisignAlgorithm[:], k.keyID[:]...), k.pub...)
+	return "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(b) + "\n"
+}
+
+// sign returns the contents of the signature file of content, prehashed unless legacy is set.
+func (k *minisignKey) sign(content []byte, legacy bool) []byte {
+	alg, msg := minisignPrehashedAlgorithm, content
+	if legacy {
+		alg = minisignAlgorithm
+	} else {
+		h := blake2b.Sum512(content)
+		msg = h[:]
+	}
+	sig := ed25519.Sign(k.priv, msg)
+	trustedComment := "timestamp:1679400000\tfile:feed.json"
+	globalSig := ed25519.Sign(k.priv, append(append([]byte{}, sig...), trustedComment...))
+
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\n%s%s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append(alg[:], k.keyID[:]...), sig...)),
+		trustedCommentPrefix, trustedComment,
+		base64.StdEncoding.EncodeToString(globalSig),
+	))
+}
+
+func TestDownloadSignature(t *testing.T) {
+	key := newMinisignKey(t)
+	otherKey := newMinisignKey(t)
+
+	content := []byte(`{"vulnerabilities": []}`)
+	var compressed bytes.Buffer
+	gw := gzip.NewWriter(&compressed)
+	_, err := gw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	files := map[string][]byte{
+		// correctly signed
+		"/signed.json":         content,
+		"/signed.json.minisig": key.sign(content, false),
+		// the signature covers the compressed bytes
+		"/signed.json.gz":         compressed.Bytes(),
+		"/signed.json.gz.minisig": key.sign(compressed.Bytes(), false),
+		// incorrectly signed
+		"/tampered.json":          []byte(`{"vulnerabilities": [{}]}`),
+		"/tampered.json.minisig":  key.sign(content, false),
+		"/other_key.json":         content,
+		"/other_key.json.minisig": otherKey.sign(content, false),
+		"/garbage.json":           content,
+		"/garbage.json.minisig":   []byte("not a signature"),
+		"/unsigned.json":          content,
+		// legacy signatures would need the whole content in memory
+		"/legacy.json":         content,
+		"/legacy.json.minisig": key.sign(content, true),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(b) //nolint:errcheck
+	}))
+	defer srv.Close()
+
+	publicKey, err := ParseMinisignPublicKey(key.publicKey())
+	require.NoError(t, err)
+
+	download := func(t *testing.T, name string, opts ...Option) (string, error) {
+		u, err := url.Parse(srv.URL + "/" + name)
+		require.NoError(t, err)
+		path := filepath.Join(t.TempDir(), "feed.json")
+		if filepath.Ext(name) == ".gz" {
+			return path, DownloadAndExtract(http.DefaultClient, u, path, opts...)
+		}
+		return path, Download(http.DefaultClient, u, path, opts...)
+	}
+
+	for _, name := range []string{"signed.json", "signed.json.gz"} {
+		path, err := download(t, name, WithSignature(publicKey))
+		require.NoError(t, err, name)
+		b, err := os.ReadFile(path)
+		require.NoError(t, err, name)
+		require.Equal(t, content, b, name)
+	}
+
+	for _, name := range []string{"tampered.json", "other_key.json", "garbage.json", "unsigned.json", "legacy.json"} {
+		path, err := download(t, name, WithSignature(publicKey))
+		require.ErrorIs(t, err, ErrInvalidSignature, name)
+		require.NoFileExists(t, path, name)
+	}
+
+	// verification is opt-in
+	_, err = download(t, "unsigned.json")
+	require.NoError(t, err)
+
+	// the key can be given without its comment
+	publicKey, err = ParseMinisignPublicKey(base64.StdEncoding.EncodeToString(append(append(minisignAlgorithm[:], key.keyID[:]...), key.pub...)))
+	require.NoError(t, err)
+	_, err = download(t, "signed.json", WithSignature(publicKey))
+	require.NoError(t, err)
+
+	_, err = ParseMinisignPublicKey("not a key")
+	require.Error(t, err)
+}
@@ -0,0 +1,10 @@
+// Package schema gives access to Fleet's osquery tables documentation from Go code.
+package schema
+
+import _ "embed"
+
+// OsqueryFleetSchemaJSON is the osquery schema, with Fleet's overrides, in JSON. It lists every osquery table along
+// with its columns.
+//
+//go:embed osquery_fleet_schema.json
+var OsqueryFleetSchemaJSON []byte
@@ -331,6 +331,12 @@ type VulnerabilitiesConfig struct {
 	DisableDataSync             bool          `json:"disable_data_sync" yaml:"disable_data_sync"`
 	RecentVulnerabilityMaxAge   time.Duration `json:"recent_vulnerability_max_age" yaml:"recent_vulnerability_max_age"`
 	DisableWinOSVulnerabilities bool          `json:"disable_win_os_vulnerabilities" yaml:"disable_win_os_vulnerabilities"`
+	AllowInsecureFeedURLs       bool          `json:"allow_insecure_feed_urls" yaml:"allow_insecure_feed_urls"`
+	AllowedFeedHosts            string        `json:"allowed_feed_hosts" yaml:"allowed_feed_hosts"`
+	MinFeedTLSVersion           string        `json:"min_feed_tls_version" yaml:"min_feed_tls_version"`
+	FeedSignatureKey            string        `json:"feed_signature_key" yaml:"feed_signature_key"`
+	PruneCVEMeta                bool          `json:"prune_cve_meta" yaml:"prune_cve_meta"`
+	RecordCVETrend              bool          `json:"record_cve_trend" yaml:"record_cve_trend"`
 }
 
 // UpgradesConfig defines configs related to fleet server upgrades.
@@ -992,6 +998,18 @@ func (man Manager) addConfigs() {
 		false,
 		"Don't sync installed Windows updates nor perform Windows OS vulnerability processing.",
 	)
+	man.addConfigBool("vulnerabilities.allow_insecure_feed_urls", false,
+		"Allow http URLs in cpe_database_url, cpe_translations_url and cve_feed_prefix_url.")
+	man.addConfigString("vulnerabilities.allowed_feed_hosts", "",
+		"Comma-separated list of the hosts allowed in cpe_database_url, cpe_translations_url and cve_feed_prefix_url. If empty, any host is allowed.")
+	man.addConfigString("vulnerabilities.min_feed_tls_version", "1.2",
+		"Minimum TLS version (1.0, 1.1, 1.2 or 1.3) of the connections to download the vulnerability feeds.")
+	man.addConfigString("vulnerabilities.feed_signature_key", "",
+		"Minisign public key that the vulnerability feeds must be signed with. If empty, the signatures are not verified.")
+	man.addConfigBool("vulnerabilities.prune_cve_meta", false,
+		"Delete the stored metadata of the CVEs that are no longer in the vulnerability feeds.")
+	man.addConfigBool("vulnerabilities.record_cve_trend", false,
+		"Record a daily snapshot of the number of CVEs affecting the fleet and each host, to chart their trend.")
 
 	// Upgrades
 	man.addConfigBool("upgrades.allow_missing_migrations", false,
@@ -1269,6 +1287,12 @@ func (man Manager) LoadConfig() FleetConfig {
 			DisableDataSync:             man.getConfigBool("vulnerabilities.disable_data_sync"),
 			RecentVulnerabilityMaxAge:   man.getConfigDuration("vulnerabilities.recent_vulnerability_max_age"),
 			DisableWinOSVulnerabilities: man.getConfigBool("vulnerabilities.disable_win_os_vulnerabilities"),
+			AllowInsecureFeedURLs:       man.getConfigBool("vulnerabilities.allow_insecure_feed_urls"),
+			AllowedFeedHosts:            man.getConfigString("vulnerabilities.allowed_feed_hosts"),
+			MinFeedTLSVersion:           man.getConfigString("vulnerabilities.min_feed_tls_version"),
+			FeedSignatureKey:            man.getConfigString("vulnerabilities.feed_signature_key"),
+			PruneCVEMeta:                man.getConfigBool("vulnerabilities.prune_cve_meta"),
+			RecordCVETrend:              man.getConfigBool("vulnerabilities.record_cve_trend"),
 		},
 		Upgrades: UpgradesConfig{
 			AllowMissingMigrations: man.getConfigBool("upgrades.allow_missing_migrations"),
@@ -96,17 +96,18 @@ func (ds *Datastore) ApplyEnrollSecrets(ctx context.Context, teamID *uint, secre
 func applyEnrollSecretsDB(ctx context.Context, q sqlx.ExtContext, teamID *uint, secrets []*fleet.EnrollSecret) error {
 	// NOTE: this is called from within a transaction (either from
 	// ApplyEnrollSecrets or saveTeamSecretsDB). We don't do a simple DELETE then
-	// INSERT as we need to keep the existing created_at timestamps of
-	// already-existing secrets. We also can't do a DELETE unused ones and then
-	// UPSERT new ones, because we need to fail the INSERT if the secret already
-	// exists for a different team or globally (i.e. the `secret` column is
-	// unique across all values of team_id, NULL or not). An "ON DUPLICATE KEY
-	// UPDATE" clause would silence such errors.
+	// INSERT as we need to keep the existing secrets untouched: their created_at
+	// timestamps, and their ids that the hosts enrolled with them reference (see
+	// host_enroll_secrets). We also can't UPSERT the new ones, because we need to
+	// fail the INSERT if the secret already exists for a different team or
+	// globally (i.e. the `secret` column is unique across all values of team_id,
+	// NULL or not). An "ON DUPLICATE KEY UPDATE" clause would silence such
+	// errors.
 	//
-	// For this reason, we first read the existing secrets to have their
-	// created_at timestamps, then we delete and re-insert them, failing the call
-	// if the insert failed (due to a secret existing at a different team/global
-	// level).
+	// For this reason, we first read the existing secrets, then we delete the
+	// ones that are no longer set and insert the ones that are new, failing the
+	// call if the insert failed (due to a secret existing at a different
+	// team/global level).
 
 	var args []interface{}
 	teamWhere := "team_id IS NULL"
@@ -115,44 +116,52 @@ func applyEnrollSecretsDB(ctx context.Context, q sqlx.ExtContext, teamID *uint,
 		args = append(args, *teamID)
 	}
 
-	// first, load the existing secrets and their created_at timestamp
-	const loadStmt = `SELECT secret, created_at FROM enroll_secrets WHERE `
-	var existingSecrets []*fleet.EnrollSecret
+	// first, load the existing secrets
+	const loadStmt = `SELECT secret FROM enroll_secrets WHERE `
+	var existingSecrets []string
 	if err := sqlx.SelectContext(ctx, q, &existingSecrets, loadStmt+teamWhere, args...); err != nil {
 		return ctxerr.Wrap(ctx, err, "load existing secrets")
 	}
-	secretsCreatedAt := make(map[string]*time.Time, len(existingSecrets))
+	existing := make(map[string]bool, len(existingSecrets))
 	for _, es := range existingSecrets {
-		secretsCreatedAt[es.Secret] = &es.CreatedAt
+		existing[es] = true
 	}
 
-	// next, remove all existing secrets for that team or global
-	const delStmt = `DELETE FROM enroll_secrets WHERE `
-	if _, err := q.ExecContext(ctx, delStmt+teamWhere, args...); err != nil {
-		return ctxerr.Wrap(ctx, err, "clear before insert")
+	newSecrets := make(map[string]bool, len(secrets))
+	for _, s := range secrets {
+		newSecrets[s.Secret] = true
 	}
 
-	newSecrets := make([]string, len(secrets))
-	for i, s := range secrets {
-		newSecrets[i] = s.Secret
+	// next, remove the existing secrets for that team or global that are no
+	// longer set
+	var removed []string
+	for _, es := range existingSecrets {
+		if !newSecrets[es] {
+			removed = append(removed, es)
+		}
+	}
+	if len(removed) > 0 {
+		delStmt, delArgs, err := sqlx.In(`DELETE FROM enroll_secrets WHERE `+teamWhere+` AND secret IN (?)`, append(args, removed)...)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "build delete secrets statement")
+		}
+		if _, err := q.ExecContext(ctx, delStmt, delArgs...); err != nil {
+			return ctxerr.Wrap(ctx, err, "delete removed secrets")
+		}
 	}
 
-	// finally, insert the new secrets, using the existing created_at timestamp
-	// if available.
+	// finally, insert the new secrets.
 	const insStmt = `INSERT INTO enroll_secrets (secret, team_id, created_at) VALUES %s`
-	if len(newSecrets) > 0 {
-		var args []interface{}
-		defaultCreatedAt := time.Now()
-		sql := fmt.Sprintf(insStmt, strings.TrimSuffix(strings.Repeat(`(?,?,?),`, len(newSecrets)), ","))
-
-		for _, s := range secrets {
-			secretCreatedAt := defaultCreatedAt
-			if ts := secretsCreatedAt[s.Secret]; ts != nil {
-				secretCreatedAt = *ts
-			}
-			args = append(args, s.Secret, teamID, secretCreatedAt)
+	var insArgs []interface{}
+	createdAt := time.Now()
+	for _, s := range secrets {
+		if !existing[s.Secret] {
+			insArgs = append(insArgs, s.Secret, teamID, createdAt)
 		}
-		if _, err := q.ExecContext(ctx, sql, args...); err != nil {
+	}
+	if len(insArgs) > 0 {
+		sql := fmt.Sprintf(insStmt, strings.TrimSuffix(strings.Repeat(`(?,?,?),`, len(insArgs)/3), ","))
+		if _, err := q.ExecContext(ctx, sql, insArgs...); err != nil {
 			return ctxerr.Wrap(ctx, err, "insert secrets")
 		}
 	}
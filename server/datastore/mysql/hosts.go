@@ -2,6 +2,7 @@ package mysql
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -11,11 +12,13 @@ import (
 	"time"
 	"unicode/utf8"
 
+	"github.com/Masterminds/semver"
 	"github.com/cenkalti/backoff/v4"
 	"github.com/doug-martin/goqu/v9"
 	"github.com/fleetdm/fleet/v4/server/config"
 	"github.com/fleetdm/fleet/v4/server/contexts/ctxerr"
 	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/fleetdm/fleet/v4/server/ptr"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 	"github.com/jmoiron/sqlx"
@@ -116,6 +119,208 @@ func (ds *Datastore) NewHost(ctx context.Context, host *fleet.Host) (*fleet.Host
 	return host, nil
 }
 
+// BulkUpsertHosts inserts new hosts and updates existing ones, matched by UUID,
+// using batched statements in a single transaction. The ID of each provided
+// host is set, and the IDs of the created and updated hosts are returned.
+func (ds *Datastore) BulkUpsertHosts(ctx context.Context, hosts []*fleet.Host) (created, updated []uint, err error) {
+	if len(hosts) == 0 {
+		return nil, nil, nil
+	}
+
+	uuids := make([]string, 0, len(hosts))
+	seen := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		if h.UUID == "" {
+			return nil, nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("uuid", "host uuid must not be empty"))
+		}
+		if seen[h.UUID] {
+			return nil, nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("uuid", fmt.Sprintf("duplicate host uuid %q", h.UUID)))
+		}
+		seen[h.UUID] = true
+		uuids = append(uuids, h.UUID)
+	}
+
+	const batchSize = 500
+	hostColumns := []string{
+		"osquery_host_id", "detail_updated_at", "label_updated_at", "policy_updated_at", "node_key", "hostname",
+		"computer_name", "uuid", "platform", "osquery_version", "os_version", "uptime", "memory", "team_id",
+		"distributed_interval", "logger_tls_period", "config_tls_refresh", "refetch_requested", "hardware_serial",
+	}
+	hostArgs := func(h *fleet.Host) []interface{} {
+		return []interface{}{
+			h.OsqueryHostID, h.DetailUpdatedAt, h.LabelUpdatedAt, h.PolicyUpdatedAt, h.NodeKey, h.Hostname,
+			h.ComputerName, h.UUID, h.Platform, h.OsqueryVersion, h.OSVersion, h.Uptime, h.Memory, h.TeamID,
+			h.DistributedInterval, h.LoggerTLSPeriod, h.ConfigTLSRefresh, h.RefetchRequested, h.HardwareSerial,
+		}
+	}
+	hostPlaceholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(hostColumns)), ", ") + ")"
+
+	// the updated values are joined by id, so that an update can't touch another host (e.g. one with the same
+	// node key), it fails on the unique keys instead
+	updateRow := "SELECT ? AS id"
+	var updateSet []string
+	for _, col := range hostColumns {
+		updateRow += ", ? AS " + col
+		if col != "uuid" {
+			updateSet = append(updateSet, fmt.Sprintf("h.%s = v.%s", col, col))
+		}
+	}
+
+	err = ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
+		created, updated = nil, nil
+
+		idsByUUID, err := hostIDsByUUIDDB(ctx, tx, uuids)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "load existing hosts")
+		}
+
+		var toInsert, toUpdate []*fleet.Host
+		for _, h := range hosts {
+			if id, ok := idsByUUID[h.UUID]; ok {
+				h.ID = id
+				toUpdate = append(toUpdate, h)
+			} else {
+				toInsert = append(toInsert, h)
+			}
+		}
+
+		for i := 0; i < len(toInsert); i += batchSize {
+			end := i + batchSize
+			if end > len(toInsert) {
+				end = len(toInsert)
+			}
+			batch := toInsert[i:end]
+
+			var args []interface{}
+			for _, h := range batch {
+				args = append(args, hostArgs(h)...)
+			}
+			stmt := fmt.Sprintf(`INSERT INTO hosts (%s) VALUES %s`,
+				strings.Join(hostColumns, ", "), strings.TrimSuffix(strings.Repeat(hostPlaceholders+",", len(batch)), ","))
+			if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+				return ctxerr.Wrap(ctx, err, "insert hosts")
+			}
+		}
+
+		if len(toInsert) > 0 {
+			insertedUUIDs := make([]string, 0, len(toInsert))
+			for _, h := range toInsert {
+				insertedUUIDs = append(insertedUUIDs, h.UUID)
+			}
+			idsByUUID, err := hostIDsByUUIDDB(ctx, tx, insertedUUIDs)
+			if err != nil {
+				return ctxerr.Wrap(ctx, err, "load inserted hosts")
+			}
+			for _, h := range toInsert {
+				h.ID = idsByUUID[h.UUID]
+				created = append(created, h.ID)
+			}
+		}
+
+		for i := 0; i < len(toUpdate); i += batchSize {
+			end := i + batchSize
+			if end > len(toUpdate) {
+				end = len(toUpdate)
+			}
+			batch := toUpdate[i:end]
+
+			rows := make([]string, 0, len(batch))
+			var args []interface{}
+			for j, h := range batch {
+				if j == 0 {
+					rows = append(rows, updateRow)
+				} else {
+					rows = append(rows, "SELECT "+strings.TrimSuffix(strings.Repeat("?, ", len(hostColumns)+1), ", "))
+				}
+				args = append(args, h.ID)
+				args = append(args, hostArgs(h)...)
+				updated = append(updated, h.ID)
+			}
+			stmt := fmt.Sprintf(`UPDATE hosts h JOIN (%s) v ON v.id = h.id SET %s`,
+				strings.Join(rows, " UNION ALL "), strings.Join(updateSet, ", "))
+			if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+				return ctxerr.Wrap(ctx, err, "update hosts")
+			}
+		}
+
+		// keep the associated tables in sync, as NewHost and EnrollHost do.
+		for i := 0; i < len(hosts); i += batchSize {
+			end := i + batchSize
+			if end > len(hosts) {
+				end = len(hosts)
+			}
+			batch := hosts[i:end]
+
+			var seenArgs, nameArgs, labelArgs []interface{}
+			for _, h := range batch {
+				// the seen time of the updated hosts is only replaced if set
+				if _, isUpdate := idsByUUID[h.UUID]; !isUpdate || !h.SeenTime.IsZero() {
+					seenArgs = append(seenArgs, h.ID, h.SeenTime)
+				}
+				nameArgs = append(nameArgs, h.ID, h.DisplayName())
+				labelArgs = append(labelArgs, h.ID)
+			}
+
+			if len(seenArgs) > 0 {
+				if _, err := tx.ExecContext(ctx, `
+					INSERT INTO host_seen_times (host_id, seen_time) VALUES `+strings.TrimSuffix(strings.Repeat("(?, ?),", len(seenArgs)/2), ",")+`
+					ON DUPLICATE KEY UPDATE seen_time = VALUES(seen_time)`, seenArgs...); err != nil {
+					return ctxerr.Wrap(ctx, err, "upsert host seen times")
+				}
+			}
+			if _, err := tx.ExecContext(ctx, `
+				INSERT INTO host_display_names (host_id, display_name) VALUES `+strings.TrimSuffix(strings.Repeat("(?, ?),", len(batch)), ",")+`
+				ON DUPLICATE KEY UPDATE display_name = VALUES(display_name)`, nameArgs...); err != nil {
+				return ctxerr.Wrap(ctx, err, "upsert host display names")
+			}
+
+			stmt, args, err := sqlx.In(`
+				INSERT IGNORE INTO label_membership (host_id, label_id)
+				SELECT h.id, l.id FROM hosts h, labels l
+				WHERE h.id IN (?) AND l.name = 'All Hosts' AND l.label_type = ?`, labelArgs, fleet.LabelTypeBuiltIn)
+			if err != nil {
+				return ctxerr.Wrap(ctx, err, "build all hosts label membership")
+			}
+			if _, err := tx.ExecContext(ctx, stmt, args...); err != nil {
+				return ctxerr.Wrap(ctx, err, "insert hosts into all hosts label")
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return created, updated, nil
+}
+
+func hostIDsByUUIDDB(ctx context.Context, q sqlx.QueryerContext, uuids []string) (map[string]uint, error) {
+	const batchSize = 500
+
+	ids := make(map[string]uint, len(uuids))
+	for i := 0; i < len(uuids); i += batchSize {
+		end := i + batchSize
+		if end > len(uuids) {
+			end = len(uuids)
+		}
+
+		stmt, args, err := sqlx.In(`SELECT id, uuid FROM hosts WHERE uuid IN (?)`, uuids[i:end])
+		if err != nil {
+			return nil, ctxerr.Wrap(ctx, err, "build select hosts by uuid")
+		}
+		var rows []struct {
+			ID   uint   `db:"id"`
+			UUID string `db:"uuid"`
+		}
+		if err := sqlx.SelectContext(ctx, q, &rows, stmt, args...); err != nil {
+			return nil, ctxerr.Wrap(ctx, err, "select hosts by uuid")
+		}
+		for _, r := range rows {
+			ids[r.UUID] = r.ID
+		}
+	}
+	return ids, nil
+}
+
 func (ds *Datastore) SerialUpdateHost(ctx context.Context, host *fleet.Host) error {
 	errCh := make(chan error, 1)
 	defer close(errCh)
@@ -331,36 +536,107 @@ var hostRefs = []string{
 	"operating_system_vulnerabilities",
 	"host_updates",
 	"host_disk_encryption_keys",
+	"host_enroll_secrets",
+	"host_additional_queries",
+	"host_cve_count_snapshots",
 }
 
 func (ds *Datastore) DeleteHost(ctx context.Context, hid uint) error {
-	delHostRef := func(tx sqlx.ExtContext, table string) error {
+	return ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
+		return deleteHostDB(ctx, tx, hid)
+	})
+}
+
+// deleteHostDB deletes the host row along with all the rows that reference it.
+func deleteHostDB(ctx context.Context, tx sqlx.ExtContext, hid uint) error {
+	_, err := tx.ExecContext(ctx, `DELETE FROM hosts WHERE id = ?`, hid)
+	if err != nil {
+		return ctxerr.Wrapf(ctx, err, "delete host")
+	}
+
+	for _, table := range hostRefs {
 		_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE host_id=?`, table), hid)
 		if err != nil {
 			return ctxerr.Wrapf(ctx, err, "deleting %s for host %d", table, hid)
 		}
-		return nil
 	}
 
-	return ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
-		_, err := tx.ExecContext(ctx, `DELETE FROM hosts WHERE id = ?`, hid)
-		if err != nil {
-			return ctxerr.Wrapf(ctx, err, "delete host")
-		}
+	_, err = tx.ExecContext(ctx, `DELETE FROM pack_targets WHERE type = ? AND target_id = ?`, fleet.TargetHost, hid)
+	if err != nil {
+		return ctxerr.Wrapf(ctx, err, "deleting pack_targets for host %d", hid)
+	}
+
+	return nil
+}
+
+// MergeHosts moves the associations of host mergeID to host keepID and deletes mergeID. The kept host keeps the
+// oldest creation date and the most recent seen time of both hosts.
+func (ds *Datastore) MergeHosts(ctx context.Context, keepID, mergeID uint) error {
+	if keepID == mergeID {
+		return ctxerr.Errorf(ctx, "cannot merge host %d into itself", keepID)
+	}
 
-		for _, table := range hostRefs {
-			err := delHostRef(tx, table)
+	return ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
+		var createdAt time.Time
+		for _, id := range []uint{keepID, mergeID} {
+			err := sqlx.GetContext(ctx, tx, &createdAt, `SELECT created_at FROM hosts WHERE id = ? FOR UPDATE`, id)
 			if err != nil {
-				return err
+				if err == sql.ErrNoRows {
+					return ctxerr.Wrap(ctx, notFound("Host").WithID(id))
+				}
+				return ctxerr.Wrap(ctx, err, "select host for merge")
 			}
 		}
 
-		_, err = tx.ExecContext(ctx, `DELETE FROM pack_targets WHERE type = ? AND target_id = ?`, fleet.TargetHost, hid)
-		if err != nil {
-			return ctxerr.Wrapf(ctx, err, "deleting pack_targets for host %d", hid)
+		// createdAt holds the creation date of the merged host
+		if _, err := tx.ExecContext(ctx,
+			`UPDATE hosts SET created_at = LEAST(created_at, ?) WHERE id = ?`,
+			createdAt, keepID,
+		); err != nil {
+			return ctxerr.Wrap(ctx, err, "update host created_at")
 		}
 
-		return nil
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO host_seen_times (host_id, seen_time)
+			SELECT ?, seen_time FROM host_seen_times WHERE host_id = ?
+			ON DUPLICATE KEY UPDATE seen_time = GREATEST(host_seen_times.seen_time, VALUES(seen_time))`,
+			keepID, mergeID,
+		); err != nil {
+			return ctxerr.Wrap(ctx, err, "merge host seen time")
+		}
+
+		// existing memberships of the kept host win over the ones of the merged host
+		if _, err := tx.ExecContext(ctx, `
+			INSERT IGNORE INTO label_membership (host_id, label_id, updated_at)
+			SELECT ?, label_id, updated_at FROM label_membership WHERE host_id = ?`,
+			keepID, mergeID,
+		); err != nil {
+			return ctxerr.Wrap(ctx, err, "merge label membership")
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT IGNORE INTO pack_targets (pack_id, type, target_id)
+			SELECT pack_id, type, ? FROM pack_targets WHERE type = ? AND target_id = ?`,
+			keepID, fleet.TargetHost, mergeID,
+		); err != nil {
+			return ctxerr.Wrap(ctx, err, "merge pack targets")
+		}
+
+		if _, err := tx.ExecContext(ctx, `
+			INSERT IGNORE INTO scheduled_query_stats (
+				host_id, scheduled_query_id, average_memory, denylisted, executions, schedule_interval,
+				last_executed, output_size, system_time, user_time, wall_time
+			)
+			SELECT
+				?, scheduled_query_id, average_memory, denylisted, executions, schedule_interval,
+				last_executed, output_size, system_time, user_time, wall_time
+			FROM scheduled_query_stats WHERE host_id = ?`,
+			keepID, mergeID,
+		); err != nil {
+			return ctxerr.Wrap(ctx, err, "merge scheduled query stats")
+		}
+
+		return deleteHostDB(ctx, tx, mergeID)
 	})
 }
 
@@ -647,7 +923,14 @@ func (ds *Datastore) ListHosts(ctx context.Context, filter fleet.TeamFilter, opt
 		    `
 	}
 
-	sql, params = ds.applyHostFilters(opt, sql, filter, params)
+	osIDs, err := ds.operatingSystemIDsInVersionRange(ctx, opt)
+	if err != nil {
+		return nil, err
+	}
+	sql, params, err = ds.applyHostFilters(opt, sql, filter, params, osIDs)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list hosts")
+	}
 
 	hosts := []*fleet.Host{}
 	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, sql, params...); err != nil {
@@ -657,7 +940,9 @@ func (ds *Datastore) ListHosts(ctx context.Context, filter fleet.TeamFilter, opt
 	return hosts, nil
 }
 
-func (ds *Datastore) applyHostFilters(opt fleet.HostListOptions, sql string, filter fleet.TeamFilter, params []interface{}) (string, []interface{}) {
+// applyHostFilters adds the filters of opt to the sql statement. osIDs are the operating systems matched by the OS
+// version range filter, if any (see operatingSystemIDsInVersionRange).
+func (ds *Datastore) applyHostFilters(opt fleet.HostListOptions, sql string, filter fleet.TeamFilter, params []interface{}, osIDs []uint) (string, []interface{}, error) {
 	opt.OrderKey = defaultHostColumnTableAlias(opt.OrderKey)
 
 	deviceMappingJoin := `LEFT JOIN (
@@ -694,7 +979,7 @@ func (ds *Datastore) applyHostFilters(opt fleet.HostListOptions, sql string, fil
 	}
 
 	operatingSystemJoin := ""
-	if opt.OSIDFilter != nil || (opt.OSNameFilter != nil && opt.OSVersionFilter != nil) {
+	if opt.OSIDFilter != nil || (opt.OSNameFilter != nil && opt.OSVersionFilter != nil) || hasOSVersionRangeFilter(opt) {
 		operatingSystemJoin = `JOIN host_operating_system hos ON h.id = hos.host_id`
 	}
 
@@ -749,16 +1034,19 @@ func (ds *Datastore) applyHostFilters(opt fleet.HostListOptions, sql string, fil
 	)
 
 	now := ds.clock.Now()
-	sql, params = filterHostsByStatus(now, sql, opt, params)
+	sql, params, err := filterHostsByStatus(now, sql, opt, params)
+	if err != nil {
+		return "", nil, err
+	}
 	sql, params = filterHostsByTeam(sql, opt, params)
 	sql, params = filterHostsByPolicy(sql, opt, params)
 	sql, params = filterHostsByMDM(sql, opt, params)
 	sql, params = filterHostsByMacOSSettingsStatus(sql, opt, params)
-	sql, params = filterHostsByOS(sql, opt, params)
+	sql, params = filterHostsByOS(sql, opt, params, osIDs)
 	sql, params = hostSearchLike(sql, params, opt.MatchQuery, hostSearchColumns...)
 	sql, params = appendListOptionsWithCursorToSQL(sql, params, &opt.ListOptions)
 
-	return sql, params
+	return sql, params, nil
 }
 
 func filterHostsByTeam(sql string, opt fleet.HostListOptions, params []interface{}) (string, []interface{}) {
@@ -802,17 +1090,93 @@ func filterHostsByMDM(sql string, opt fleet.HostListOptions, params []interface{
 	return sql, params
 }
 
-func filterHostsByOS(sql string, opt fleet.HostListOptions, params []interface{}) (string, []interface{}) {
+func filterHostsByOS(sql string, opt fleet.HostListOptions, params []interface{}, osIDs []uint) (string, []interface{}) {
 	if opt.OSIDFilter != nil {
 		sql += ` AND hos.os_id = ?`
 		params = append(params, *opt.OSIDFilter)
 	} else if opt.OSNameFilter != nil && opt.OSVersionFilter != nil {
 		sql += ` AND hos.os_id IN (SELECT id FROM operating_systems WHERE name = ? AND version = ?)`
 		params = append(params, *opt.OSNameFilter, *opt.OSVersionFilter)
+	} else if hasOSVersionRangeFilter(opt) {
+		if len(osIDs) == 0 {
+			sql += ` AND FALSE`
+			return sql, params
+		}
+		sql += ` AND hos.os_id IN (?` + strings.Repeat(", ?", len(osIDs)-1) + `)`
+		for _, id := range osIDs {
+			params = append(params, id)
+		}
 	}
 	return sql, params
 }
 
+// hasOSVersionRangeFilter returns whether the hosts are filtered by a range of versions of an operating system.
+func hasOSVersionRangeFilter(opt fleet.HostListOptions) bool {
+	return opt.OSNameFilter != nil && opt.OSVersionFilter == nil &&
+		(opt.OSVersionMinFilter != nil || opt.OSVersionMaxFilter != nil)
+}
+
+// operatingSystemIDsInVersionRange returns the IDs of the operating systems selected by the OS version range filter
+// of opt. Versions are compared as semantic versions since they can't be compared in SQL, and the versions that
+// can't be parsed are only included if opt.OSVersionExcludeUnparseable is false. It returns nil if the filter
+// doesn't apply, and an invalid argument error if the range is set without an OS name or along with an exact version.
+func (ds *Datastore) operatingSystemIDsInVersionRange(ctx context.Context, opt fleet.HostListOptions) ([]uint, error) {
+	if opt.OSVersionMinFilter == nil && opt.OSVersionMaxFilter == nil {
+		return nil, nil
+	}
+	if opt.OSNameFilter == nil {
+		return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("os_name", "must be set to filter by a range of os versions"))
+	}
+	if opt.OSVersionFilter != nil {
+		return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("os_version", "can't be used along with os_version_min or os_version_max"))
+	}
+
+	var minVersion, maxVersion *semver.Version
+	if opt.OSVersionMinFilter != nil {
+		v, err := semver.NewVersion(*opt.OSVersionMinFilter)
+		if err != nil {
+			return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("os_version_min", "must be a semantic version"))
+		}
+		minVersion = v
+	}
+	if opt.OSVersionMaxFilter != nil {
+		v, err := semver.NewVersion(*opt.OSVersionMaxFilter)
+		if err != nil {
+			return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("os_version_max", "must be a semantic version"))
+		}
+		maxVersion = v
+	}
+
+	var oses []struct {
+		ID      uint   `db:"id"`
+		Version string `db:"version"`
+	}
+	if err := sqlx.SelectContext(ctx, ds.reader, &oses,
+		`SELECT id, version FROM operating_systems WHERE name = ?`, *opt.OSNameFilter,
+	); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select operating system versions")
+	}
+
+	ids := []uint{}
+	for _, o := range oses {
+		v, err := semver.NewVersion(o.Version)
+		if err != nil {
+			if !opt.OSVersionExcludeUnparseable {
+				ids = append(ids, o.ID)
+			}
+			continue
+		}
+		if minVersion != nil && v.LessThan(minVersion) {
+			continue
+		}
+		if maxVersion != nil && !v.LessThan(maxVersion) {
+			continue
+		}
+		ids = append(ids, o.ID)
+	}
+	return ids, nil
+}
+
 func filterHostsByPolicy(sql string, opt fleet.HostListOptions, params []interface{}) (string, []interface{}) {
 	if opt.PolicyIDFilter != nil && opt.PolicyResponseFilter != nil {
 		sql += ` AND pm.policy_id = ? AND pm.passes = ?`
@@ -824,22 +1188,38 @@ func filterHostsByPolicy(sql string, opt fleet.HostListOptions, params []interfa
 	return sql, params
 }
 
-func filterHostsByStatus(now time.Time, sql string, opt fleet.HostListOptions, params []interface{}) (string, []interface{}) {
-	switch opt.StatusFilter {
-	case fleet.StatusNew:
-		sql += "AND DATE_ADD(h.created_at, INTERVAL 1 DAY) >= ?"
-		params = append(params, now)
-	case fleet.StatusOnline:
-		sql += fmt.Sprintf("AND DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL LEAST(h.distributed_interval, h.config_tls_refresh) + %d SECOND) > ?", fleet.OnlineIntervalBuffer)
-		params = append(params, now)
-	case fleet.StatusOffline:
-		sql += fmt.Sprintf("AND DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL LEAST(h.distributed_interval, h.config_tls_refresh) + %d SECOND) <= ?", fleet.OnlineIntervalBuffer)
-		params = append(params, now)
-	case fleet.StatusMIA, fleet.StatusMissing:
-		sql += "AND DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL 30 DAY) <= ?"
+func filterHostsByStatus(now time.Time, sql string, opt fleet.HostListOptions, params []interface{}) (string, []interface{}, error) {
+	statuses := opt.StatusesFilter
+	if opt.StatusFilter != "" {
+		statuses = append([]fleet.HostStatus{opt.StatusFilter}, statuses...)
+	}
+
+	// the hosts match if they have any of the statuses
+	var conds []string
+	for _, status := range statuses {
+		switch status {
+		case fleet.StatusNew:
+			conds = append(conds, "DATE_ADD(h.created_at, INTERVAL 1 DAY) >= ?")
+		case fleet.StatusOnline:
+			conds = append(conds, fmt.Sprintf("DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL LEAST(h.distributed_interval, h.config_tls_refresh) + %d SECOND) > ?", fleet.OnlineIntervalBuffer))
+		case fleet.StatusOffline:
+			conds = append(conds, fmt.Sprintf("DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL LEAST(h.distributed_interval, h.config_tls_refresh) + %d SECOND) <= ?", fleet.OnlineIntervalBuffer))
+		case fleet.StatusMIA, fleet.StatusMissing:
+			conds = append(conds, "DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL 30 DAY) <= ?")
+		default:
+			return "", nil, fleet.NewInvalidArgumentError("status", fmt.Sprintf("unknown status %q", status))
+		}
 		params = append(params, now)
 	}
-	return sql, params
+
+	switch len(conds) {
+	case 0:
+	case 1:
+		sql += "AND " + conds[0]
+	default:
+		sql += "AND (" + strings.Join(conds, " OR ") + ")"
+	}
+	return sql, params, nil
 }
 
 func filterHostsByMacOSSettingsStatus(sql string, opt fleet.HostListOptions, params []interface{}) (string, []interface{}) {
@@ -882,8 +1262,16 @@ func (ds *Datastore) CountHosts(ctx context.Context, filter fleet.TeamFilter, op
 	opt.Page = 0
 	opt.PerPage = 0
 
+	osIDs, err := ds.operatingSystemIDsInVersionRange(ctx, opt)
+	if err != nil {
+		return 0, err
+	}
+
 	var params []interface{}
-	sql, params = ds.applyHostFilters(opt, sql, filter, params)
+	sql, params, err = ds.applyHostFilters(opt, sql, filter, params, osIDs)
+	if err != nil {
+		return 0, ctxerr.Wrap(ctx, err, "count hosts")
+	}
 
 	var count int
 	if err := sqlx.GetContext(ctx, ds.reader, &count, sql, params...); err != nil {
@@ -1014,6 +1402,113 @@ func (ds *Datastore) GenerateHostStatusStatistics(ctx context.Context, filter fl
 	return &summary, nil
 }
 
+func (ds *Datastore) GenerateHostStatusStatisticsByTeam(ctx context.Context, filter fleet.TeamFilter, teamIDs []uint, now time.Time, platform *string, lowDiskSpace *int) (map[uint]*fleet.HostSummary, error) {
+	// The logic in this function should remain synchronized with
+	// GenerateHostStatusStatistics, the counts of each team must be the same.
+
+	summaries := make(map[uint]*fleet.HostSummary, len(teamIDs))
+	if len(teamIDs) == 0 {
+		return summaries, nil
+	}
+	for _, teamID := range teamIDs {
+		teamID := teamID
+		summary := &fleet.HostSummary{TeamID: &teamID}
+		if lowDiskSpace != nil {
+			summary.LowDiskSpaceCount = ptr.Uint(0)
+		}
+		summaries[teamID] = summary
+	}
+
+	args := []interface{}{now, now, now, now, now}
+	hostDisksJoin := ``
+	lowDiskSelect := `0 low_disk_space`
+	if lowDiskSpace != nil {
+		hostDisksJoin = `LEFT JOIN host_disks hd ON (h.id = hd.host_id)`
+		lowDiskSelect = `COALESCE(SUM(CASE WHEN hd.gigs_disk_space_available <= ? THEN 1 ELSE 0 END), 0) low_disk_space`
+		args = append(args, *lowDiskSpace)
+	}
+
+	// the teams are restricted with the team IDs, not the filter
+	filter.TeamID = nil
+	whereClause := ds.whereFilterHostsByTeams(filter, "h") + " AND h.team_id IN (?) "
+	whereArgs := []interface{}{teamIDs}
+	if platform != nil {
+		whereClause += " AND h.platform IN (?) "
+		whereArgs = append(whereArgs, fleet.ExpandPlatform(*platform))
+	}
+	args = append(args, whereArgs...)
+
+	sqlStatement := fmt.Sprintf(`
+			SELECT
+				h.team_id,
+				COUNT(*) total,
+				COALESCE(SUM(CASE WHEN DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL 30 DAY) <= ? THEN 1 ELSE 0 END), 0) mia,
+				COALESCE(SUM(CASE WHEN DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL 30 DAY) <= ? THEN 1 ELSE 0 END), 0) missing_30_days_count,
+				COALESCE(SUM(CASE WHEN DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL LEAST(distributed_interval, config_tls_refresh) + %d SECOND) <= ? THEN 1 ELSE 0 END), 0) offline,
+				COALESCE(SUM(CASE WHEN DATE_ADD(COALESCE(hst.seen_time, h.created_at), INTERVAL LEAST(distributed_interval, config_tls_refresh) + %d SECOND) > ? THEN 1 ELSE 0 END), 0) online,
+				COALESCE(SUM(CASE WHEN DATE_ADD(h.created_at, INTERVAL 1 DAY) >= ? THEN 1 ELSE 0 END), 0) new,
+				%s
+			FROM hosts h
+			LEFT JOIN host_seen_times hst ON (h.id = hst.host_id)
+			%s
+			WHERE %s
+			GROUP BY h.team_id
+		`, fleet.OnlineIntervalBuffer, fleet.OnlineIntervalBuffer, lowDiskSelect, hostDisksJoin, whereClause)
+
+	stmt, args, err := sqlx.In(sqlStatement, args...)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "generating host statistics by team statement")
+	}
+	var rows []struct {
+		fleet.HostSummary
+		HostTeamID uint `db:"team_id"`
+	}
+	if err := sqlx.SelectContext(ctx, ds.reader, &rows, stmt, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "generating host statistics by team")
+	}
+	for _, row := range rows {
+		summary := summaries[row.HostTeamID]
+		summary.TotalsHostsCount = row.TotalsHostsCount
+		summary.OnlineCount = row.OnlineCount
+		summary.OfflineCount = row.OfflineCount
+		summary.MIACount = row.MIACount
+		summary.Missing30DaysCount = row.Missing30DaysCount
+		summary.NewCount = row.NewCount
+		if lowDiskSpace != nil {
+			summary.LowDiskSpaceCount = row.LowDiskSpaceCount
+		}
+	}
+
+	// get the counts per platform and team
+	sqlStatement = fmt.Sprintf(`
+			SELECT
+			  COUNT(*) total,
+			  h.platform,
+			  h.team_id
+			FROM hosts h
+			WHERE %s
+			GROUP BY h.team_id, h.platform
+		`, whereClause)
+
+	stmt, args, err = sqlx.In(sqlStatement, whereArgs...)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "generating host platforms by team statement")
+	}
+	var platforms []struct {
+		fleet.HostSummaryPlatform
+		TeamID uint `db:"team_id"`
+	}
+	if err := sqlx.SelectContext(ctx, ds.reader, &platforms, stmt, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "generating host platforms statistics by team")
+	}
+	for _, p := range platforms {
+		p := p
+		summaries[p.TeamID].Platforms = append(summaries[p.TeamID].Platforms, &p.HostSummaryPlatform)
+	}
+
+	return summaries, nil
+}
+
 // Attempts to find the matching host ID by osqueryID, host UUID or serial
 // number. Any of those fields can be left empty if not available, and it will
 // use the best match in this order:
@@ -1187,7 +1682,7 @@ func (ds *Datastore) EnrollOrbit(ctx context.Context, isMDMEnabled bool, hostInf
 }
 
 // EnrollHost enrolls a host
-func (ds *Datastore) EnrollHost(ctx context.Context, isMDMEnabled bool, osqueryHostID, hardwareUUID, hardwareSerial, nodeKey string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
+func (ds *Datastore) EnrollHost(ctx context.Context, isMDMEnabled bool, osqueryHostID, hardwareUUID, hardwareSerial, nodeKey, enrollSecret string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
 	if osqueryHostID == "" {
 		return nil, ctxerr.New(ctx, "missing osquery host identifier")
 	}
@@ -1270,6 +1765,20 @@ func (ds *Datastore) EnrollHost(ctx context.Context, isMDMEnabled bool, osqueryH
 			return ctxerr.Wrap(ctx, err, "new host seen time")
 		}
 
+		if enrollSecret != "" {
+			// the secret replaces the one the host previously enrolled with, if any
+			if _, err := tx.ExecContext(ctx, `DELETE FROM host_enroll_secrets WHERE host_id = ?`, matchedID); err != nil {
+				return ctxerr.Wrap(ctx, err, "delete host enroll secret")
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO host_enroll_secrets (host_id, secret_sha256, enroll_secret_id)
+				VALUES (?, ?, (SELECT id FROM enroll_secrets WHERE secret = ?))`,
+				matchedID, enrollSecretSHA256(enrollSecret), enrollSecret)
+			if err != nil {
+				return ctxerr.Wrap(ctx, err, "insert host enroll secret")
+			}
+		}
+
 		sqlSelect := `
       SELECT
         h.id,
@@ -1336,6 +1845,214 @@ func (ds *Datastore) EnrollHost(ctx context.Context, isMDMEnabled bool, osqueryH
 	return &host, nil
 }
 
+func (ds *Datastore) HostsByEnrollSecret(ctx context.Context, secret string, opt fleet.ListOptions) ([]fleet.Host, error) {
+	stmt := `
+		SELECT
+			h.id,
+			h.osquery_host_id,
+			h.created_at,
+			h.updated_at,
+			h.detail_updated_at,
+			h.node_key,
+			h.hostname,
+			h.uuid,
+			h.platform,
+			h.osquery_version,
+			h.os_version,
+			h.build,
+			h.platform_like,
+			h.code_name,
+			h.uptime,
+			h.memory,
+			h.cpu_type,
+			h.cpu_subtype,
+			h.cpu_brand,
+			h.cpu_physical_cores,
+			h.cpu_logical_cores,
+			h.hardware_vendor,
+			h.hardware_model,
+			h.hardware_version,
+			h.hardware_serial,
+			h.computer_name,
+			h.primary_ip_id,
+			h.distributed_interval,
+			h.logger_tls_period,
+			h.config_tls_refresh,
+			h.primary_ip,
+			h.primary_mac,
+			h.label_updated_at,
+			h.last_enrolled_at,
+			h.refetch_requested,
+			h.team_id,
+			h.policy_updated_at,
+			h.public_ip,
+			h.orbit_node_key
+		FROM hosts h
+		JOIN host_enroll_secrets hes ON hes.host_id = h.id
+		WHERE hes.secret_sha256 = ?
+	`
+	opt.OrderKey = defaultHostColumnTableAlias(opt.OrderKey)
+	stmt = appendListOptionsToSQL(stmt, &opt)
+
+	hosts := []fleet.Host{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, stmt, enrollSecretSHA256(secret)); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list hosts by enroll secret")
+	}
+	return hosts, nil
+}
+
+func (ds *Datastore) HostCountByEnrollSecret(ctx context.Context) (map[string]int, error) {
+	var counts []struct {
+		Secret string `db:"secret"`
+		Count  int    `db:"count"`
+	}
+	// only the hashes of the secrets are stored, the hosts enrolled with a secret that was since removed can't be
+	// keyed by it (SHA2 matches the hex of enrollSecretSHA256)
+	stmt := `
+		SELECT s.secret, COUNT(h.id) AS count
+		FROM enroll_secrets s
+		LEFT JOIN host_enroll_secrets hes ON hes.secret_sha256 = SHA2(s.secret, 256)
+		LEFT JOIN hosts h ON h.id = hes.host_id
+		GROUP BY s.secret
+	`
+	if err := sqlx.SelectContext(ctx, ds.reader, &counts, stmt); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "count hosts by enroll secret")
+	}
+
+	result := make(map[string]int, len(counts))
+	for _, c := range counts {
+		result[c.Secret] = c.Count
+	}
+	return result, nil
+}
+
+// enrollSecretSHA256 returns the hex sha256 of the enroll secret, as stored in host_enroll_secrets.
+func enrollSecretSHA256(secret string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(secret)))
+}
+
+// placeholderHardwareSerials are (lowercased) hardware serials reported by machines whose vendor didn't set a real
+// one, and thus don't identify a machine.
+var placeholderHardwareSerials = []string{
+	"",
+	"0",
+	"none",
+	"n/a",
+	"default string",
+	"not specified",
+	"not applicable",
+	"system serial number",
+	"to be filled by o.e.m.",
+	"0123456789",
+}
+
+func (ds *Datastore) DuplicateHostsBySerial(ctx context.Context) ([][]*fleet.Host, error) {
+	stmt, args, err := sqlx.In(`
+		SELECT
+			h.id,
+			h.osquery_host_id,
+			h.created_at,
+			h.updated_at,
+			h.hostname,
+			h.uuid,
+			h.platform,
+			h.hardware_serial,
+			h.computer_name,
+			h.team_id,
+			h.last_enrolled_at,
+			COALESCE(hst.seen_time, h.created_at) AS seen_time
+		FROM hosts h
+		LEFT JOIN host_seen_times hst ON hst.host_id = h.id
+		WHERE h.hardware_serial IN (
+			SELECT hardware_serial
+			FROM hosts
+			WHERE LOWER(TRIM(hardware_serial)) NOT IN (?)
+			GROUP BY hardware_serial
+			HAVING COUNT(*) > 1
+		)
+		ORDER BY h.hardware_serial, h.id
+	`, placeholderHardwareSerials)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "build duplicate hosts by serial query")
+	}
+
+	var hosts []*fleet.Host
+	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, stmt, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select duplicate hosts by serial")
+	}
+
+	var groups [][]*fleet.Host
+	for i, h := range hosts {
+		if i == 0 || !strings.EqualFold(h.HardwareSerial, hosts[i-1].HardwareSerial) {
+			groups = append(groups, nil)
+		}
+		groups[len(groups)-1] = append(groups[len(groups)-1], h)
+	}
+	return groups, nil
+}
+
+func (ds *Datastore) StaleHosts(ctx context.Context, since time.Time, opt fleet.StaleHostsOptions) ([]*fleet.Host, error) {
+	stmt := `
+		SELECT
+			h.id,
+			h.osquery_host_id,
+			h.created_at,
+			h.updated_at,
+			h.detail_updated_at,
+			h.node_key,
+			h.hostname,
+			h.uuid,
+			h.platform,
+			h.osquery_version,
+			h.os_version,
+			h.build,
+			h.platform_like,
+			h.code_name,
+			h.uptime,
+			h.memory,
+			h.cpu_type,
+			h.cpu_subtype,
+			h.cpu_brand,
+			h.cpu_physical_cores,
+			h.cpu_logical_cores,
+			h.hardware_vendor,
+			h.hardware_model,
+			h.hardware_version,
+			h.hardware_serial,
+			h.computer_name,
+			h.primary_ip_id,
+			h.distributed_interval,
+			h.logger_tls_period,
+			h.config_tls_refresh,
+			h.primary_ip,
+			h.primary_mac,
+			h.label_updated_at,
+			h.last_enrolled_at,
+			h.refetch_requested,
+			h.team_id,
+			h.policy_updated_at,
+			h.public_ip,
+			h.orbit_node_key,
+			COALESCE(hst.seen_time, h.created_at) AS seen_time
+		FROM hosts h
+		LEFT JOIN host_seen_times hst ON hst.host_id = h.id
+		WHERE COALESCE(hst.seen_time, h.created_at) < ?
+	`
+	args := []interface{}{since}
+	if opt.LabelID != nil {
+		stmt += ` AND EXISTS (SELECT 1 FROM label_membership lm WHERE lm.host_id = h.id AND lm.label_id = ?)`
+		args = append(args, *opt.LabelID)
+	}
+	opt.OrderKey = defaultHostColumnTableAlias(opt.OrderKey)
+	stmt = appendListOptionsToSQL(stmt, &opt.ListOptions)
+
+	hosts := []*fleet.Host{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, stmt, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list stale hosts")
+	}
+	return hosts, nil
+}
+
 // getContextTryStmt will attempt to run sqlx.GetContext on a cached statement if available, resorting to ds.reader.
 func (ds *Datastore) getContextTryStmt(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
 	var err error
@@ -1393,11 +2110,14 @@ func (ds *Datastore) LoadHostByNodeKey(ctx context.Context, nodeKey string) (*fl
       h.public_ip,
       h.orbit_node_key,
       COALESCE(hd.gigs_disk_space_available, 0) as gigs_disk_space_available,
-      COALESCE(hd.percent_disk_space_available, 0) as percent_disk_space_available
+      COALESCE(hd.percent_disk_space_available, 0) as percent_disk_space_available,
+      haq.queries as additional_queries
     FROM
       hosts h
     LEFT OUTER JOIN
       host_disks hd ON hd.host_id = h.id
+    LEFT OUTER JOIN
+      host_additional_queries haq ON haq.host_id = h.id
     WHERE node_key = ?`
 
 	var host fleet.Host
@@ -1602,6 +2322,12 @@ func (ds *Datastore) SetOrUpdateDeviceAuthToken(ctx context.Context, hostID uint
 }
 
 func (ds *Datastore) MarkHostsSeen(ctx context.Context, hostIDs []uint, t time.Time) error {
+	return ds.markHostsSeen(ctx, hostIDs, t, fleet.DefaultMarkHostsSeenBatchSize)
+}
+
+// markHostsSeen updates the seen time of the hosts with one statement per batch of batchSize hosts, all in a single
+// transaction.
+func (ds *Datastore) markHostsSeen(ctx context.Context, hostIDs []uint, t time.Time, batchSize int) error {
 	if len(hostIDs) == 0 {
 		return nil
 	}
@@ -1612,18 +2338,26 @@ func (ds *Datastore) MarkHostsSeen(ctx context.Context, hostIDs []uint, t time.T
 	sort.Slice(hostIDs, func(i, j int) bool { return hostIDs[i] < hostIDs[j] })
 
 	if err := ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
-		var insertArgs []interface{}
-		for _, hostID := range hostIDs {
-			insertArgs = append(insertArgs, hostID, t)
-		}
-		insertValues := strings.TrimSuffix(strings.Repeat("(?, ?),", len(hostIDs)), ",")
-		query := fmt.Sprintf(`
-			INSERT INTO host_seen_times (host_id, seen_time) VALUES %s
-			ON DUPLICATE KEY UPDATE seen_time = VALUES(seen_time)`,
-			insertValues,
-		)
-		if _, err := tx.ExecContext(ctx, query, insertArgs...); err != nil {
-			return ctxerr.Wrap(ctx, err, "exec update")
+		for i := 0; i < len(hostIDs); i += batchSize {
+			end := i + batchSize
+			if end > len(hostIDs) {
+				end = len(hostIDs)
+			}
+			batch := hostIDs[i:end]
+
+			insertArgs := make([]interface{}, 0, 2*len(batch))
+			for _, hostID := range batch {
+				insertArgs = append(insertArgs, hostID, t)
+			}
+			insertValues := strings.TrimSuffix(strings.Repeat("(?, ?),", len(batch)), ",")
+			query := fmt.Sprintf(`
+				INSERT INTO host_seen_times (host_id, seen_time) VALUES %s
+				ON DUPLICATE KEY UPDATE seen_time = VALUES(seen_time)`,
+				insertValues,
+			)
+			if _, err := tx.ExecContext(ctx, query, insertArgs...); err != nil {
+				return ctxerr.Wrap(ctx, err, "exec update")
+			}
 		}
 		return nil
 	}); err != nil {
@@ -1855,6 +2589,52 @@ func saveHostAdditionalDB(ctx context.Context, exec sqlx.ExecerContext, hostID u
 	return nil
 }
 
+func (ds *Datastore) SetAdditionalQueriesForHosts(ctx context.Context, hostIDs []uint, queries map[string]string) error {
+	if len(hostIDs) == 0 {
+		return nil
+	}
+
+	if queries == nil {
+		stmt, args, err := sqlx.In(`DELETE FROM host_additional_queries WHERE host_id IN (?)`, hostIDs)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "building delete host additional queries statement")
+		}
+		if _, err := ds.writer.ExecContext(ctx, stmt, args...); err != nil {
+			return ctxerr.Wrap(ctx, err, "delete host additional queries")
+		}
+		return nil
+	}
+
+	b, err := json.Marshal(queries)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "marshal additional queries")
+	}
+
+	batchSize := 500
+	for i := 0; i < len(hostIDs); i += batchSize {
+		end := i + batchSize
+		if end > len(hostIDs) {
+			end = len(hostIDs)
+		}
+		batch := hostIDs[i:end]
+
+		values := strings.TrimSuffix(strings.Repeat("(?, ?), ", len(batch)), ", ")
+		args := make([]interface{}, 0, 2*len(batch))
+		for _, hostID := range batch {
+			args = append(args, hostID, b)
+		}
+		stmt := `
+			INSERT INTO host_additional_queries (host_id, queries)
+			VALUES ` + values + `
+			ON DUPLICATE KEY UPDATE queries = VALUES(queries)
+		`
+		if _, err := ds.writer.ExecContext(ctx, stmt, args...); err != nil {
+			return ctxerr.Wrap(ctx, err, "insert host additional queries")
+		}
+	}
+	return nil
+}
+
 func (ds *Datastore) SaveHostUsers(ctx context.Context, hostID uint, users []fleet.HostUser) error {
 	return ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
 		return saveHostUsersDB(ctx, tx, hostID, users)
@@ -79,6 +79,7 @@ func TestHosts(t *testing.T) {
 		{"HostListOptionsTeamFilter", testHostListOptionsTeamFilter},
 		{"ListFilterAdditional", testHostsListFilterAdditional},
 		{"ListStatus", testHostsListStatus},
+		{"ListMultipleStatuses", testHostsListMultipleStatuses},
 		{"ListQuery", testHostsListQuery},
 		{"ListMDM", testHostsListMDM},
 		{"SelectHostMDM", testHostMDMSelect},
@@ -89,11 +90,14 @@ func TestHosts(t *testing.T) {
 		{"Search", testHostsSearch},
 		{"SearchLimit", testHostsSearchLimit},
 		{"GenerateStatusStatistics", testHostsGenerateStatusStatistics},
+		{"GenerateStatusStatisticsByTeam", testHostsGenerateStatusStatisticsByTeam},
 		{"MarkSeen", testHostsMarkSeen},
 		{"MarkSeenMany", testHostsMarkSeenMany},
+		{"MarkSeenBatched", testHostsMarkSeenBatched},
 		{"CleanupIncoming", testHostsCleanupIncoming},
 		{"IDsByName", testHostsIDsByName},
 		{"Additional", testHostsAdditional},
+		{"SetAdditionalQueriesForHosts", testHostsSetAdditionalQueriesForHosts},
 		{"ByIdentifier", testHostsByIdentifier},
 		{"AddToTeam", testHostsAddToTeam},
 		{"SaveUsers", testHostsSaveUsers},
@@ -109,6 +113,7 @@ func TestHosts(t *testing.T) {
 		{"HostsListBySoftwareChangedAt", testHostsListBySoftwareChangedAt},
 		{"HostsListByOperatingSystemID", testHostsListByOperatingSystemID},
 		{"HostsListByOSNameAndVersion", testHostsListByOSNameAndVersion},
+		{"HostsListByOSVersionRange", testHostsListByOSVersionRange},
 		{"HostsListFailingPolicies", printReadsInTest(testHostsListFailingPolicies)},
 		{"HostsExpiration", testHostsExpiration},
 		{"HostsAllPackStats", testHostsAllPackStats},
@@ -145,6 +150,12 @@ func TestHosts(t *testing.T) {
 		{"EnrollOrbit", testHostsEnrollOrbit},
 		{"EnrollUpdatesMissingInfo", testHostsEnrollUpdatesMissingInfo},
 		{"EncryptionKeyRawDecryption", testHostsEncryptionKeyRawDecryption},
+		{"BulkUpsert", testHostsBulkUpsert},
+		{"HostsByEnrollSecret", testHostsByEnrollSecret},
+		{"HostCountByEnrollSecret", testHostsHostCountByEnrollSecret},
+		{"StaleHosts", testHostsStaleHosts},
+		{"DuplicateHostsBySerial", testHostsDuplicateHostsBySerial},
+		{"MergeHosts", testHostsMergeHosts},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -809,6 +820,67 @@ func testHostsListStatus(t *testing.T, ds *Datastore) {
 	assert.Equal(t, 7, len(hosts))
 }
 
+func testHostsListMultipleStatuses(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	now := time.Now()
+
+	newHost := func(name string, createdAt, seenTime time.Time) *fleet.Host {
+		h, err := ds.NewHost(ctx, &fleet.Host{
+			DetailUpdatedAt: now,
+			LabelUpdatedAt:  now,
+			PolicyUpdatedAt: now,
+			SeenTime:        seenTime,
+			OsqueryHostID:   ptr.String(name),
+			NodeKey:         ptr.String(name),
+			UUID:            name,
+			Hostname:        name,
+		})
+		require.NoError(t, err)
+		_, err = ds.writer.ExecContext(ctx, `UPDATE hosts SET created_at = ? WHERE id = ?`, createdAt, h.ID)
+		require.NoError(t, err)
+		return h
+	}
+	onlineNew := newHost("online_new", now, now)
+	offlineNew := newHost("offline_new", now, now.Add(-time.Hour))
+	online := newHost("online", now.Add(-48*time.Hour), now)
+	offline := newHost("offline", now.Add(-48*time.Hour), now.Add(-time.Hour))
+	mia := newHost("mia", now.Add(-40*24*time.Hour), now.Add(-40*24*time.Hour))
+
+	filter := fleet.TeamFilter{User: test.UserAdmin}
+	cases := []struct {
+		opts fleet.HostListOptions
+		want []*fleet.Host
+	}{
+		{fleet.HostListOptions{StatusesFilter: []fleet.HostStatus{fleet.StatusOnline}}, []*fleet.Host{onlineNew, online}},
+		{fleet.HostListOptions{StatusesFilter: []fleet.HostStatus{fleet.StatusOnline, fleet.StatusNew}}, []*fleet.Host{onlineNew, offlineNew, online}},
+		{fleet.HostListOptions{StatusesFilter: []fleet.HostStatus{fleet.StatusNew, fleet.StatusMIA}}, []*fleet.Host{onlineNew, offlineNew, mia}},
+		{fleet.HostListOptions{StatusesFilter: []fleet.HostStatus{fleet.StatusOnline, fleet.StatusOffline}}, []*fleet.Host{onlineNew, offlineNew, online, offline, mia}},
+		// the single status is combined with the set
+		{fleet.HostListOptions{StatusFilter: fleet.StatusMIA, StatusesFilter: []fleet.HostStatus{fleet.StatusOnline}}, []*fleet.Host{onlineNew, online, mia}},
+		{fleet.HostListOptions{StatusFilter: fleet.StatusOffline}, []*fleet.Host{offlineNew, offline, mia}},
+	}
+	for _, c := range cases {
+		c.opts.ListOptions = fleet.ListOptions{OrderKey: "h.id"}
+		hosts := listHostsCheckCount(t, ds, filter, c.opts, len(c.want))
+		var got, want []string
+		for _, h := range hosts {
+			got = append(got, h.Hostname)
+		}
+		for _, h := range c.want {
+			want = append(want, h.Hostname)
+		}
+		assert.Equal(t, want, got, "%+v", c.opts)
+	}
+
+	// an unknown status is rejected
+	opts := fleet.HostListOptions{StatusesFilter: []fleet.HostStatus{fleet.StatusOnline, "away"}}
+	_, err := ds.ListHosts(context.Background(), filter, opts)
+	var iae *fleet.InvalidArgumentError
+	require.ErrorAs(t, err, &iae)
+	_, err = ds.CountHosts(context.Background(), filter, opts)
+	require.ErrorAs(t, err, &iae)
+}
+
 func testHostsListQuery(t *testing.T, ds *Datastore) {
 	hosts := []*fleet.Host{}
 	for i := 0; i < 10; i++ {
@@ -1357,7 +1429,7 @@ func testHostsEnroll(t *testing.T, ds *Datastore) {
 	}
 
 	for _, tt := range enrollTests {
-		h, err := ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey, &team.ID, 0)
+		h, err := ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey, "", &team.ID, 0)
 		require.NoError(t, err)
 		assert.NotZero(t, h.LastEnrolledAt)
 
@@ -1365,12 +1437,12 @@ func testHostsEnroll(t *testing.T, ds *Datastore) {
 		assert.Equal(t, tt.nodeKey, *h.NodeKey)
 
 		// This host should be allowed to re-enroll immediately if cooldown is disabled
-		_, err = ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey+"new", nil, 0)
+		_, err = ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey+"new", "", nil, 0)
 		require.NoError(t, err)
 		assert.NotZero(t, h.LastEnrolledAt)
 
 		// This host should not be allowed to re-enroll immediately if cooldown is enabled
-		_, err = ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey+"new", nil, 10*time.Second)
+		_, err = ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey+"new", "", nil, 10*time.Second)
 		require.Error(t, err)
 		assert.NotZero(t, h.LastEnrolledAt)
 	}
@@ -1386,7 +1458,7 @@ func testHostsEnroll(t *testing.T, ds *Datastore) {
 func testHostsLoadHostByNodeKey(t *testing.T, ds *Datastore) {
 	test.AddAllHostsLabel(t, ds)
 	for _, tt := range enrollTests {
-		h, err := ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey, nil, 0)
+		h, err := ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey, "", nil, 0)
 		require.NoError(t, err)
 
 		returned, err := ds.LoadHostByNodeKey(context.Background(), *h.NodeKey)
@@ -1404,7 +1476,7 @@ func testHostsLoadHostByNodeKey(t *testing.T, ds *Datastore) {
 func testHostsLoadHostByNodeKeyCaseSensitive(t *testing.T, ds *Datastore) {
 	test.AddAllHostsLabel(t, ds)
 	for _, tt := range enrollTests {
-		h, err := ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey, nil, 0)
+		h, err := ds.EnrollHost(context.Background(), false, tt.uuid, "", "", tt.nodeKey, "", nil, 0)
 		require.NoError(t, err)
 
 		_, err = ds.LoadHostByNodeKey(context.Background(), strings.ToUpper(*h.NodeKey))
@@ -1768,6 +1840,101 @@ func testHostsGenerateStatusStatistics(t *testing.T, ds *Datastore) {
 	assert.Equal(t, uint(1), *summary.LowDiskSpaceCount)
 }
 
+func testHostsGenerateStatusStatisticsByTeam(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	team1, err := ds.NewTeam(ctx, &fleet.Team{Name: "team1"})
+	require.NoError(t, err)
+	team2, err := ds.NewTeam(ctx, &fleet.Team{Name: "team2"})
+	require.NoError(t, err)
+	// no host in team3
+	team3, err := ds.NewTeam(ctx, &fleet.Team{Name: "team3"})
+	require.NoError(t, err)
+
+	var hostID uint
+	newHost := func(teamID *uint, seenTime time.Time, platform string, diskSpace float64) {
+		hostID++
+		h, err := ds.NewHost(ctx, &fleet.Host{
+			OsqueryHostID:   ptr.String(fmt.Sprint(hostID)),
+			NodeKey:         ptr.String(fmt.Sprint(hostID)),
+			UUID:            fmt.Sprint(hostID),
+			Hostname:        fmt.Sprintf("host%d", hostID),
+			DetailUpdatedAt: seenTime,
+			LabelUpdatedAt:  seenTime,
+			PolicyUpdatedAt: seenTime,
+			SeenTime:        seenTime,
+			Platform:        platform,
+		})
+		require.NoError(t, err)
+		h.DistributedInterval = 15
+		h.ConfigTLSRefresh = 30
+		require.NoError(t, ds.UpdateHost(ctx, h))
+		require.NoError(t, ds.SetOrUpdateHostDisksSpace(ctx, h.ID, diskSpace, diskSpace))
+		require.NoError(t, ds.AddHostsToTeam(ctx, teamID, []uint{h.ID}))
+	}
+
+	// team1: one online, one offline and one missing host
+	newHost(&team1.ID, now.Add(-10*time.Second), "debian", 5)
+	newHost(&team1.ID, now.Add(-time.Hour), "ubuntu", 50)
+	newHost(&team1.ID, now.Add(-40*24*time.Hour), "darwin", 5)
+	// team2: two online hosts
+	newHost(&team2.ID, now.Add(-10*time.Second), "windows", 50)
+	newHost(&team2.ID, now.Add(-20*time.Second), "windows", 50)
+	// no team, never counted
+	newHost(nil, now.Add(-10*time.Second), "darwin", 5)
+
+	filter := fleet.TeamFilter{User: test.UserAdmin}
+	teamIDs := []uint{team1.ID, team2.ID, team3.ID}
+
+	summaries, err := ds.GenerateHostStatusStatisticsByTeam(ctx, filter, teamIDs, now, nil, ptr.Int(10))
+	require.NoError(t, err)
+	require.Len(t, summaries, 3)
+
+	require.Equal(t, uint(3), summaries[team1.ID].TotalsHostsCount)
+	require.Equal(t, uint(1), summaries[team1.ID].OnlineCount)
+	require.Equal(t, uint(2), summaries[team1.ID].OfflineCount)
+	require.Equal(t, uint(1), summaries[team1.ID].MIACount)
+	require.Equal(t, uint(1), summaries[team1.ID].Missing30DaysCount)
+	require.Equal(t, uint(2), *summaries[team1.ID].LowDiskSpaceCount)
+	require.Equal(t, uint(2), summaries[team2.ID].TotalsHostsCount)
+	require.Equal(t, uint(2), summaries[team2.ID].OnlineCount)
+	require.Equal(t, uint(0), *summaries[team2.ID].LowDiskSpaceCount)
+	require.Equal(t, uint(0), summaries[team3.ID].TotalsHostsCount)
+
+	// the statistics of each team match the single team version
+	for _, platform := range []*string{nil, ptr.String("linux")} {
+		for _, lowDiskSpace := range []*int{nil, ptr.Int(10)} {
+			summaries, err := ds.GenerateHostStatusStatisticsByTeam(ctx, filter, teamIDs, now, platform, lowDiskSpace)
+			require.NoError(t, err)
+			for _, teamID := range teamIDs {
+				teamFilter := filter
+				teamFilter.TeamID = ptr.Uint(teamID)
+				expected, err := ds.GenerateHostStatusStatistics(ctx, teamFilter, now, platform, lowDiskSpace)
+				require.NoError(t, err)
+
+				got := summaries[teamID]
+				require.NotNil(t, got)
+				require.ElementsMatch(t, expected.Platforms, got.Platforms)
+				expected.Platforms, got.Platforms = nil, nil
+				require.Equal(t, expected, got)
+			}
+		}
+	}
+
+	// the hosts of the teams the user can't see aren't counted
+	summaries, err = ds.GenerateHostStatusStatisticsByTeam(ctx, fleet.TeamFilter{User: &fleet.User{
+		Teams: []fleet.UserTeam{{Team: fleet.Team{ID: team1.ID}, Role: fleet.RoleAdmin}},
+	}}, teamIDs, now, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, uint(3), summaries[team1.ID].TotalsHostsCount)
+	require.Equal(t, uint(0), summaries[team2.ID].TotalsHostsCount)
+
+	summaries, err = ds.GenerateHostStatusStatisticsByTeam(ctx, filter, nil, now, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, summaries)
+}
+
 func testHostsMarkSeen(t *testing.T, ds *Datastore) {
 	mockClock := clock.NewMockClock()
 
@@ -1804,6 +1971,42 @@ func testHostsMarkSeen(t *testing.T, ds *Datastore) {
 	}
 }
 
+func testHostsMarkSeenBatched(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	aDayAgo := time.Now().Add(-24 * time.Hour).UTC()
+	var hostIDs []uint
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprintf("host%d", i)
+		h := test.NewHost(t, ds, name, "", name, name, aDayAgo)
+		hostIDs = append(hostIDs, h.ID)
+	}
+	untouched := test.NewHost(t, ds, "untouched", "", "untouched", "untouched", aDayAgo)
+
+	// more hosts than the batch size, with a partial last batch
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, ds.markHostsSeen(ctx, hostIDs, now, 3))
+
+	for _, id := range hostIDs {
+		h, err := ds.Host(ctx, id)
+		require.NoError(t, err)
+		assert.WithinDuration(t, now, h.SeenTime, time.Second)
+	}
+	h, err := ds.Host(ctx, untouched.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, aDayAgo, h.SeenTime, time.Second)
+
+	// a slice that would exceed the placeholders limit in a single statement
+	manyIDs := make([]uint, 0, 40000)
+	for i := uint(1); i <= 40000; i++ {
+		manyIDs = append(manyIDs, i)
+	}
+	require.NoError(t, ds.MarkHostsSeen(ctx, manyIDs, now))
+	h, err = ds.Host(ctx, untouched.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now, h.SeenTime, time.Second)
+}
+
 func testHostsMarkSeenMany(t *testing.T, ds *Datastore) {
 	mockClock := clock.NewMockClock()
 
@@ -2043,6 +2246,60 @@ func testLoadHostByNodeKeyUsesStmt(t *testing.T, ds *Datastore) {
 	require.Equal(t, "foobar2.local", h.Hostname)
 }
 
+func testHostsSetAdditionalQueriesForHosts(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	hosts := make([]*fleet.Host, 3)
+	for i := range hosts {
+		name := fmt.Sprintf("host%d", i)
+		hosts[i] = test.NewHost(t, ds, name, "", name, name, time.Now())
+	}
+
+	// the additional queries of the host are loaded along with it on check-in
+	additionalQueries := func(h *fleet.Host) map[string]string {
+		loaded, err := ds.LoadHostByNodeKey(ctx, *h.NodeKey)
+		require.NoError(t, err)
+		if loaded.AdditionalQueries == nil {
+			return nil
+		}
+		var queries map[string]string
+		require.NoError(t, json.Unmarshal(*loaded.AdditionalQueries, &queries))
+		return queries
+	}
+
+	// no host has additional queries of its own by default
+	for _, h := range hosts {
+		require.Nil(t, additionalQueries(h))
+	}
+
+	// only the targeted hosts get the queries
+	phase1 := map[string]string{"time": "SELECT * FROM time"}
+	require.NoError(t, ds.SetAdditionalQueriesForHosts(ctx, []uint{hosts[0].ID, hosts[1].ID}, phase1))
+	require.Equal(t, phase1, additionalQueries(hosts[0]))
+	require.Equal(t, phase1, additionalQueries(hosts[1]))
+	require.Nil(t, additionalQueries(hosts[2]))
+
+	// setting them again replaces them
+	phase2 := map[string]string{"time": "SELECT * FROM time", "uptime": "SELECT * FROM uptime"}
+	require.NoError(t, ds.SetAdditionalQueriesForHosts(ctx, []uint{hosts[1].ID}, phase2))
+	require.Equal(t, phase1, additionalQueries(hosts[0]))
+	require.Equal(t, phase2, additionalQueries(hosts[1]))
+	require.Nil(t, additionalQueries(hosts[2]))
+
+	// an empty set of queries disables the additional queries of the host
+	require.NoError(t, ds.SetAdditionalQueriesForHosts(ctx, []uint{hosts[2].ID}, map[string]string{}))
+	require.Equal(t, map[string]string{}, additionalQueries(hosts[2]))
+
+	// nil removes them
+	require.NoError(t, ds.SetAdditionalQueriesForHosts(ctx, []uint{hosts[0].ID, hosts[2].ID}, nil))
+	require.Nil(t, additionalQueries(hosts[0]))
+	require.Equal(t, phase2, additionalQueries(hosts[1]))
+	require.Nil(t, additionalQueries(hosts[2]))
+
+	// nothing to do without hosts
+	require.NoError(t, ds.SetAdditionalQueriesForHosts(ctx, nil, phase1))
+}
+
 func testHostsAdditional(t *testing.T, ds *Datastore) {
 	h, err := ds.NewHost(context.Background(), &fleet.Host{
 		DetailUpdatedAt: time.Now(),
@@ -2691,6 +2948,79 @@ func testHostsListByOSNameAndVersion(t *testing.T, ds *Datastore) {
 	}
 }
 
+func testHostsListByOSVersionRange(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	// one host per operating system
+	oses := []fleet.OperatingSystem{
+		{Name: "macOS", Version: "12.6", Arch: "x86_64", Platform: "darwin", KernelVersion: "21.6.0"},
+		{Name: "macOS", Version: "13.0.1", Arch: "x86_64", Platform: "darwin", KernelVersion: "22.1.0"},
+		{Name: "macOS", Version: "13.4.1", Arch: "arm64", Platform: "darwin", KernelVersion: "22.5.0"},
+		{Name: "macOS", Version: "13.5", Arch: "arm64", Platform: "darwin", KernelVersion: "22.6.0"},
+		{Name: "macOS", Version: "13.10", Arch: "arm64", Platform: "darwin", KernelVersion: "22.6.0"},
+		{Name: "macOS", Version: "unknown", Arch: "arm64", Platform: "darwin", KernelVersion: "22.6.0"},
+		{Name: "Ubuntu", Version: "13.04", Arch: "x86_64", Platform: "ubuntu", KernelVersion: "5.15.0"},
+	}
+	hostIDByVersion := make(map[string]uint)
+	for i, os := range oses {
+		h, err := ds.NewHost(ctx, &fleet.Host{
+			DetailUpdatedAt: time.Now(),
+			LabelUpdatedAt:  time.Now(),
+			PolicyUpdatedAt: time.Now(),
+			SeenTime:        time.Now(),
+			OsqueryHostID:   ptr.String(strconv.Itoa(i)),
+			NodeKey:         ptr.String(strconv.Itoa(i)),
+			UUID:            strconv.Itoa(i),
+			Hostname:        fmt.Sprintf("foo.local%d", i),
+		})
+		require.NoError(t, err)
+		require.NoError(t, ds.UpdateHostOperatingSystem(ctx, h.ID, os))
+		hostIDByVersion[os.Name+" "+os.Version] = h.ID
+	}
+
+	listIDs := func(opt fleet.HostListOptions, expected ...string) {
+		opt.OSNameFilter = ptr.String("macOS")
+		hosts := listHostsCheckCount(t, ds, fleet.TeamFilter{User: test.UserAdmin}, opt, len(expected))
+		var got, want []uint
+		for _, h := range hosts {
+			got = append(got, h.ID)
+		}
+		for _, v := range expected {
+			want = append(want, hostIDByVersion["macOS "+v])
+		}
+		require.ElementsMatch(t, want, got)
+	}
+
+	// all macOS before 13.5, the max bound is excluded
+	listIDs(fleet.HostListOptions{OSVersionMaxFilter: ptr.String("13.5")}, "12.6", "13.0.1", "13.4.1", "unknown")
+	listIDs(fleet.HostListOptions{OSVersionMaxFilter: ptr.String("13.5"), OSVersionExcludeUnparseable: true}, "12.6", "13.0.1", "13.4.1")
+
+	// the min bound is included, versions are not compared as strings
+	listIDs(fleet.HostListOptions{OSVersionMinFilter: ptr.String("13.4.1"), OSVersionExcludeUnparseable: true}, "13.4.1", "13.5", "13.10")
+	listIDs(fleet.HostListOptions{
+		OSVersionMinFilter:          ptr.String("13.0.1"),
+		OSVersionMaxFilter:          ptr.String("13.4.2"),
+		OSVersionExcludeUnparseable: true,
+	}, "13.0.1", "13.4.1")
+
+	// empty range
+	listIDs(fleet.HostListOptions{OSVersionMinFilter: ptr.String("14"), OSVersionExcludeUnparseable: true})
+
+	// invalid bounds, or bounds that can't apply
+	for _, opt := range []fleet.HostListOptions{
+		{OSNameFilter: ptr.String("macOS"), OSVersionMinFilter: ptr.String("not a version")},
+		{OSNameFilter: ptr.String("macOS"), OSVersionFilter: ptr.String("13.5"), OSVersionMaxFilter: ptr.String("13")},
+		{OSVersionMinFilter: ptr.String("13")},
+	} {
+		_, err := ds.ListHosts(ctx, fleet.TeamFilter{User: test.UserAdmin}, opt)
+		var invalid *fleet.InvalidArgumentError
+		require.ErrorAs(t, err, &invalid)
+
+		_, err = ds.CountHosts(ctx, fleet.TeamFilter{User: test.UserAdmin}, opt)
+		require.ErrorAs(t, err, &invalid)
+	}
+}
+
 func testHostsListFailingPolicies(t *testing.T, ds *Datastore) {
 	user1 := test.NewUser(t, ds, "Alice", "alice@example.com", true)
 	for i := 0; i < 10; i++ {
@@ -3956,7 +4286,7 @@ func testHostsNoSeenTime(t *testing.T, ds *Datastore) {
 	require.Zero(t, count[0])
 
 	// Enroll existing host.
-	_, err = ds.EnrollHost(context.Background(), false, "1", "", "", "1", nil, 0)
+	_, err = ds.EnrollHost(context.Background(), false, "1", "", "", "1", "", nil, 0)
 	require.NoError(t, err)
 
 	var seenTime1 []time.Time
@@ -3968,7 +4298,7 @@ func testHostsNoSeenTime(t *testing.T, ds *Datastore) {
 	time.Sleep(1 * time.Second)
 
 	// Enroll again to trigger an update of host_seen_times.
-	_, err = ds.EnrollHost(context.Background(), false, "1", "", "", "1", nil, 0)
+	_, err = ds.EnrollHost(context.Background(), false, "1", "", "", "1", "", nil, 0)
 	require.NoError(t, err)
 
 	var seenTime2 []time.Time
@@ -5373,6 +5703,14 @@ func testHostsDeleteHosts(t *testing.T, ds *Datastore) {
 	// set an encryption key
 	err = ds.SetOrUpdateHostDiskEncryptionKey(context.Background(), host.ID, "TESTKEY")
 	require.NoError(t, err)
+	// record the enroll secret used by the host
+	err = ds.ApplyEnrollSecrets(context.Background(), nil, []*fleet.EnrollSecret{{Secret: "secret"}})
+	require.NoError(t, err)
+	_, err = ds.writer.Exec(`INSERT INTO host_enroll_secrets (host_id, secret_sha256) VALUES (?, ?)`, host.ID, enrollSecretSHA256("secret"))
+	require.NoError(t, err)
+	// set additional queries for the host
+	err = ds.SetAdditionalQueriesForHosts(context.Background(), []uint{host.ID}, map[string]string{"time": "SELECT * FROM time"})
+	require.NoError(t, err)
 
 	// Operating system vulnerabilities
 	_, err = ds.writer.Exec(
@@ -5380,6 +5718,9 @@ func testHostsDeleteHosts(t *testing.T, ds *Datastore) {
 		host.ID, 1, "cve-1",
 	)
 	require.NoError(t, err)
+	// record a cve count snapshot for the host
+	err = ds.RecordHostCVECountSnapshot(context.Background(), host.ID, time.Now(), 1)
+	require.NoError(t, err)
 
 	// Check there's an entry for the host in all the associated tables.
 	for _, hostRef := range hostRefs {
@@ -6014,7 +6355,7 @@ func testHostsLoadHostByOrbitNodeKey(t *testing.T, ds *Datastore) {
 	ctx := context.Background()
 
 	for _, tt := range enrollTests {
-		h, err := ds.EnrollHost(ctx, false, tt.uuid, tt.uuid, "", tt.nodeKey, nil, 0)
+		h, err := ds.EnrollHost(ctx, false, tt.uuid, tt.uuid, "", tt.nodeKey, "", nil, 0)
 		require.NoError(t, err)
 
 		orbitKey := uuid.New().String()
@@ -6463,7 +6804,7 @@ func testHostsEnrollUpdatesMissingInfo(t *testing.T, ds *Datastore) {
 	require.Equal(t, "darwin", got.Platform)
 
 	// enroll with osquery using uuid identifier, team
-	_, err = ds.EnrollHost(ctx, true, "uuid", "uuid", "different-serial", "osquery", &tm.ID, 0)
+	_, err = ds.EnrollHost(ctx, true, "uuid", "uuid", "different-serial", "osquery", "", &tm.ID, 0)
 	require.NoError(t, err)
 	got, err = ds.LoadHostByOrbitNodeKey(ctx, "orbit")
 	require.NoError(t, err)
@@ -6533,3 +6874,411 @@ func testHostsEncryptionKeyRawDecryption(t *testing.T, ds *Datastore) {
 	require.NotNil(t, got.MDM.TestGetRawDecryptable())
 	require.Equal(t, 1, *got.MDM.TestGetRawDecryptable())
 }
+
+func testHostsBulkUpsert(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	test.AddAllHostsLabel(t, ds)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	existing, err := ds.NewHost(ctx, &fleet.Host{
+		OsqueryHostID:   ptr.String("existing"),
+		NodeKey:         ptr.String("existing"),
+		UUID:            "uuid-existing",
+		Hostname:        "old.local",
+		DetailUpdatedAt: now,
+		LabelUpdatedAt:  now,
+		PolicyUpdatedAt: now,
+		SeenTime:        now.Add(-time.Hour),
+	})
+	require.NoError(t, err)
+
+	hosts := []*fleet.Host{
+		{
+			OsqueryHostID:   ptr.String("existing"),
+			NodeKey:         ptr.String("existing"),
+			UUID:            "uuid-existing",
+			Hostname:        "new.local",
+			Platform:        "darwin",
+			DetailUpdatedAt: now,
+			LabelUpdatedAt:  now,
+			PolicyUpdatedAt: now,
+			SeenTime:        now,
+		},
+	}
+	for i := 0; i < 3; i++ {
+		hosts = append(hosts, &fleet.Host{
+			OsqueryHostID:   ptr.String(fmt.Sprintf("new%d", i)),
+			NodeKey:         ptr.String(fmt.Sprintf("new%d", i)),
+			UUID:            fmt.Sprintf("uuid-new%d", i),
+			Hostname:        fmt.Sprintf("new%d.local", i),
+			Platform:        "ubuntu",
+			DetailUpdatedAt: now,
+			LabelUpdatedAt:  now,
+			PolicyUpdatedAt: now,
+			SeenTime:        now,
+		})
+	}
+
+	created, updated, err := ds.BulkUpsertHosts(ctx, hosts)
+	require.NoError(t, err)
+	require.Equal(t, []uint{existing.ID}, updated)
+	require.Len(t, created, 3)
+	require.Equal(t, existing.ID, hosts[0].ID)
+
+	for i, h := range hosts {
+		require.NotZero(t, h.ID)
+		if i > 0 {
+			require.Equal(t, created[i-1], h.ID)
+		}
+
+		got, err := ds.Host(ctx, h.ID)
+		require.NoError(t, err)
+		assert.Equal(t, h.UUID, got.UUID)
+		assert.Equal(t, h.Hostname, got.Hostname)
+		assert.Equal(t, h.Platform, got.Platform)
+		assert.WithinDuration(t, now, got.SeenTime, time.Second)
+		assert.Equal(t, h.Hostname, got.DisplayName())
+
+		labels, err := ds.ListLabelsForHost(ctx, h.ID)
+		require.NoError(t, err)
+		require.Len(t, labels, 1)
+		assert.Equal(t, "All Hosts", labels[0].Name)
+	}
+
+	count, err := ds.CountEnrolledHosts(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+
+	// upserting the same set again only updates
+	created, updated, err = ds.BulkUpsertHosts(ctx, hosts)
+	require.NoError(t, err)
+	require.Empty(t, created)
+	require.Len(t, updated, 4)
+
+	// the seen time of an updated host is kept if not set
+	hosts[0].SeenTime = time.Time{}
+	_, updated, err = ds.BulkUpsertHosts(ctx, hosts[:1])
+	require.NoError(t, err)
+	require.Equal(t, []uint{existing.ID}, updated)
+	got, err := ds.Host(ctx, existing.ID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now, got.SeenTime, time.Second)
+
+	// an update can't take over the node key of another host
+	_, _, err = ds.BulkUpsertHosts(ctx, []*fleet.Host{{
+		OsqueryHostID: ptr.String("existing"),
+		NodeKey:       hosts[1].NodeKey,
+		UUID:          "uuid-existing",
+		Hostname:      "new.local",
+	}})
+	require.Error(t, err)
+	got, err = ds.Host(ctx, hosts[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, hosts[1].Hostname, got.Hostname)
+	assert.Equal(t, "uuid-new0", got.UUID)
+
+	// hosts must be identifiable by UUID
+	_, _, err = ds.BulkUpsertHosts(ctx, []*fleet.Host{{Hostname: "no-uuid"}})
+	require.Error(t, err)
+
+	// and be listed once
+	_, _, err = ds.BulkUpsertHosts(ctx, []*fleet.Host{{UUID: "uuid-dup", Hostname: "a"}, {UUID: "uuid-dup", Hostname: "b"}})
+	var iae *fleet.InvalidArgumentError
+	require.ErrorAs(t, err, &iae)
+	count, err = ds.CountEnrolledHosts(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+}
+
+func testHostsByEnrollSecret(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	require.NoError(t, ds.ApplyEnrollSecrets(ctx, nil, []*fleet.EnrollSecret{{Secret: "secret1"}, {Secret: "secret2"}}))
+	enroll := func(name, secret string) *fleet.Host {
+		h, err := ds.EnrollHost(ctx, false, name, "uuid-"+name, "", "nodekey-"+name, secret, nil, 0)
+		require.NoError(t, err)
+		return h
+	}
+	h1 := enroll("h1", "secret1")
+	h2 := enroll("h2", "secret2")
+	h3 := enroll("h3", "secret1")
+
+	hostIDs := func(hosts []fleet.Host) []uint {
+		ids := make([]uint, 0, len(hosts))
+		for _, h := range hosts {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	hosts, err := ds.HostsByEnrollSecret(ctx, "secret1", fleet.ListOptions{OrderKey: "id"})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h1.ID, h3.ID}, hostIDs(hosts))
+
+	hosts, err = ds.HostsByEnrollSecret(ctx, "secret2", fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h2.ID}, hostIDs(hosts))
+
+	hosts, err = ds.HostsByEnrollSecret(ctx, "no-such-secret", fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, hosts)
+
+	// re-enrolling with a different secret replaces the recorded one
+	require.Equal(t, h3.ID, enroll("h3", "secret2").ID)
+	hosts, err = ds.HostsByEnrollSecret(ctx, "secret1", fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h1.ID}, hostIDs(hosts))
+	hosts, err = ds.HostsByEnrollSecret(ctx, "secret2", fleet.ListOptions{OrderKey: "id"})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h2.ID, h3.ID}, hostIDs(hosts))
+
+	// re-applying the secrets keeps the records
+	require.NoError(t, ds.ApplyEnrollSecrets(ctx, nil, []*fleet.EnrollSecret{{Secret: "secret1"}, {Secret: "secret2"}}))
+	hosts, err = ds.HostsByEnrollSecret(ctx, "secret1", fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h1.ID}, hostIDs(hosts))
+
+	// deleting the host removes the record
+	require.NoError(t, ds.DeleteHost(ctx, h1.ID))
+	hosts, err = ds.HostsByEnrollSecret(ctx, "secret1", fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, hosts)
+
+	// the hosts are still listed once the secret is rotated out
+	require.NoError(t, ds.ApplyEnrollSecrets(ctx, nil, []*fleet.EnrollSecret{{Secret: "secret3"}}))
+	hosts, err = ds.HostsByEnrollSecret(ctx, "secret2", fleet.ListOptions{OrderKey: "id"})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h2.ID, h3.ID}, hostIDs(hosts))
+
+	// only the hashes of the secrets are stored
+	var stored []string
+	require.NoError(t, sqlx.SelectContext(ctx, ds.reader, &stored, `SELECT secret_sha256 FROM host_enroll_secrets`))
+	require.ElementsMatch(t, []string{enrollSecretSHA256("secret2"), enrollSecretSHA256("secret2")}, stored)
+}
+
+func testHostsHostCountByEnrollSecret(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	counts, err := ds.HostCountByEnrollSecret(ctx)
+	require.NoError(t, err)
+	require.Empty(t, counts)
+
+	team, err := ds.NewTeam(ctx, &fleet.Team{Name: "team"})
+	require.NoError(t, err)
+	require.NoError(t, ds.ApplyEnrollSecrets(ctx, nil, []*fleet.EnrollSecret{{Secret: "global1"}, {Secret: "global2"}}))
+	require.NoError(t, ds.ApplyEnrollSecrets(ctx, &team.ID, []*fleet.EnrollSecret{{Secret: "team1"}}))
+
+	// secrets without hosts are counted as zero
+	counts, err = ds.HostCountByEnrollSecret(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"global1": 0, "global2": 0, "team1": 0}, counts)
+
+	enroll := func(name, secret string) *fleet.Host {
+		h, err := ds.EnrollHost(ctx, false, name, "uuid-"+name, "", "nodekey-"+name, secret, nil, 0)
+		require.NoError(t, err)
+		return h
+	}
+	h1 := enroll("h1", "global1")
+	enroll("h2", "global1")
+	enroll("h3", "team1")
+	h4 := enroll("h4", "team1")
+	enroll("h5", "team1")
+
+	counts, err = ds.HostCountByEnrollSecret(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"global1": 2, "global2": 0, "team1": 3}, counts)
+
+	// re-enrolling with another secret moves the host, deleting it removes it
+	require.Equal(t, h4.ID, enroll("h4", "global2").ID)
+	require.NoError(t, ds.DeleteHost(ctx, h1.ID))
+	counts, err = ds.HostCountByEnrollSecret(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"global1": 1, "global2": 1, "team1": 2}, counts)
+
+	// the removed secrets aren't counted, the hosts are counted again if the secret is re-added
+	require.NoError(t, ds.ApplyEnrollSecrets(ctx, &team.ID, []*fleet.EnrollSecret{{Secret: "team2"}}))
+	counts, err = ds.HostCountByEnrollSecret(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"global1": 1, "global2": 1, "team2": 0}, counts)
+	require.NoError(t, ds.ApplyEnrollSecrets(ctx, &team.ID, []*fleet.EnrollSecret{{Secret: "team1"}, {Secret: "team2"}}))
+	counts, err = ds.HostCountByEnrollSecret(ctx)
+	require.NoError(t, err)
+	require.Equal(t, map[string]int{"global1": 1, "global2": 1, "team1": 2, "team2": 0}, counts)
+}
+
+func testHostsStaleHosts(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	threshold := now.Add(-7 * 24 * time.Hour)
+
+	newHost := func(name string, seen time.Time) *fleet.Host {
+		h, err := ds.NewHost(ctx, &fleet.Host{
+			DetailUpdatedAt: now,
+			LabelUpdatedAt:  now,
+			PolicyUpdatedAt: now,
+			SeenTime:        seen,
+			OsqueryHostID:   ptr.String(name),
+			NodeKey:         ptr.String(name),
+			UUID:            name,
+			Hostname:        name,
+		})
+		require.NoError(t, err)
+		return h
+	}
+	h1 := newHost("h1", now.Add(-30*24*time.Hour))
+	h2 := newHost("h2", threshold.Add(-time.Second))
+	newHost("h3", threshold) // seen exactly at the threshold, not stale
+	newHost("h4", threshold.Add(time.Second))
+	newHost("h5", now)
+
+	hostIDs := func(hosts []fleet.Host) []uint {
+		ids := make([]uint, 0, len(hosts))
+		for _, h := range hosts {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	hosts, err := ds.StaleHosts(ctx, threshold, fleet.StaleHostsOptions{ListOptions: fleet.ListOptions{OrderKey: "id"}})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h1.ID, h2.ID}, hostIDs(hosts))
+	require.True(t, hosts[0].SeenTime.Before(threshold))
+
+	hosts, err = ds.StaleHosts(ctx, now.Add(-365*24*time.Hour), fleet.StaleHostsOptions{})
+	require.NoError(t, err)
+	require.Empty(t, hosts)
+
+	// pagination
+	hosts, err = ds.StaleHosts(ctx, threshold, fleet.StaleHostsOptions{ListOptions: fleet.ListOptions{OrderKey: "id", PerPage: 1}})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h1.ID}, hostIDs(hosts))
+	hosts, err = ds.StaleHosts(ctx, threshold, fleet.StaleHostsOptions{ListOptions: fleet.ListOptions{OrderKey: "id", PerPage: 1, Page: 1}})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h2.ID}, hostIDs(hosts))
+
+	// label scoping
+	label, err := ds.NewLabel(ctx, &fleet.Label{Name: "stale", Query: "select 1"})
+	require.NoError(t, err)
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, h2, map[uint]*bool{label.ID: ptr.Bool(true)}, now, false))
+
+	hosts, err = ds.StaleHosts(ctx, threshold, fleet.StaleHostsOptions{LabelID: &label.ID})
+	require.NoError(t, err)
+	require.Equal(t, []uint{h2.ID}, hostIDs(hosts))
+}
+
+func testHostsDuplicateHostsBySerial(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	groups, err := ds.DuplicateHostsBySerial(ctx)
+	require.NoError(t, err)
+	require.Empty(t, groups)
+
+	newHost := func(name, serial string) *fleet.Host {
+		h, err := ds.NewHost(ctx, &fleet.Host{
+			DetailUpdatedAt: time.Now(),
+			LabelUpdatedAt:  time.Now(),
+			PolicyUpdatedAt: time.Now(),
+			SeenTime:        time.Now(),
+			OsqueryHostID:   ptr.String(name),
+			NodeKey:         ptr.String(name),
+			UUID:            name,
+			Hostname:        name,
+			HardwareSerial:  serial,
+		})
+		require.NoError(t, err)
+		return h
+	}
+	dup1 := newHost("dup1", "C02ABC123")
+	newHost("unique", "C02XYZ789")
+	dup2 := newHost("dup2", "C02ABC123")
+	// empty and placeholder serials are not duplicates
+	newHost("empty1", "")
+	newHost("empty2", "")
+	newHost("placeholder1", "To Be Filled By O.E.M.")
+	newHost("placeholder2", "To Be Filled By O.E.M.")
+
+	groups, err = ds.DuplicateHostsBySerial(ctx)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Len(t, groups[0], 2)
+	require.Equal(t, dup1.ID, groups[0][0].ID)
+	require.Equal(t, dup2.ID, groups[0][1].ID)
+	require.Equal(t, "C02ABC123", groups[0][0].HardwareSerial)
+	require.Equal(t, "dup2", groups[0][1].Hostname)
+}
+
+func testHostsMergeHosts(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	keep := test.NewHost(t, ds, "keep", "10.0.0.1", "keep", "keep", time.Now().Add(-time.Hour))
+	merge := test.NewHost(t, ds, "merge", "10.0.0.2", "merge", "merge", time.Now())
+
+	oldest := time.Now().Add(-48 * time.Hour).UTC().Truncate(time.Second)
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `UPDATE hosts SET created_at = ? WHERE id = ?`, oldest, merge.ID)
+		return err
+	})
+
+	l1, err := ds.NewLabel(ctx, &fleet.Label{Name: "label1", Query: "select 1"})
+	require.NoError(t, err)
+	l2, err := ds.NewLabel(ctx, &fleet.Label{Name: "label2", Query: "select 2"})
+	require.NoError(t, err)
+	// both hosts are members of label1, only the merged host is a member of label2
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, keep, map[uint]*bool{l1.ID: ptr.Bool(true)}, time.Now(), false))
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, merge, map[uint]*bool{l1.ID: ptr.Bool(true), l2.ID: ptr.Bool(true)}, time.Now(), false))
+
+	pack, err := ds.NewPack(ctx, &fleet.Pack{Name: "pack1", HostIDs: []uint{merge.ID}})
+	require.NoError(t, err)
+
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `INSERT INTO scheduled_query_stats (host_id, scheduled_query_id, executions) VALUES (?, 1, 5), (?, 2, 3)`, keep.ID, merge.ID)
+		return err
+	})
+
+	require.Error(t, ds.MergeHosts(ctx, keep.ID, keep.ID))
+	err = ds.MergeHosts(ctx, keep.ID, 999999)
+	require.Error(t, err)
+	require.True(t, fleet.IsNotFound(err))
+
+	require.NoError(t, ds.MergeHosts(ctx, keep.ID, merge.ID))
+
+	_, err = ds.Host(ctx, merge.ID)
+	require.True(t, fleet.IsNotFound(err))
+
+	h, err := ds.Host(ctx, keep.ID)
+	require.NoError(t, err)
+	require.Equal(t, oldest, h.CreatedAt.UTC())
+	require.WithinDuration(t, merge.SeenTime, h.SeenTime, time.Second)
+
+	labels, err := ds.ListLabelsForHost(ctx, keep.ID)
+	require.NoError(t, err)
+	var labelIDs []uint
+	for _, l := range labels {
+		labelIDs = append(labelIDs, l.ID)
+	}
+	require.ElementsMatch(t, []uint{l1.ID, l2.ID}, labelIDs)
+
+	packs, err := ds.ListPacksForHost(ctx, keep.ID)
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+	require.Equal(t, pack.ID, packs[0].ID)
+
+	var statsCount int
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		return sqlx.GetContext(ctx, q, &statsCount, `SELECT COUNT(*) FROM scheduled_query_stats WHERE host_id = ?`, keep.ID)
+	})
+	require.Equal(t, 2, statsCount)
+
+	for _, table := range append(hostRefs, "pack_targets") {
+		col := "host_id"
+		if table == "pack_targets" {
+			col = "target_id"
+		}
+		var count int
+		ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+			return sqlx.GetContext(ctx, q, &count, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE %s = ?`, table, col), merge.ID)
+		})
+		require.Zero(t, count, table)
+	}
+}
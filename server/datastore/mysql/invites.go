@@ -3,8 +3,10 @@ package mysql
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/fleetdm/fleet/v4/server/contexts/ctxerr"
 	"github.com/fleetdm/fleet/v4/server/fleet"
@@ -20,45 +22,87 @@ func (ds *Datastore) NewInvite(ctx context.Context, i *fleet.Invite) (*fleet.Inv
 	}
 
 	err := ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
-		sqlStmt := `
-	INSERT INTO invites ( invited_by, email, name, position, token, sso_enabled, global_role )
-	  VALUES ( ?, ?, ?, ?, ?, ?, ?)
-	`
-
-		result, err := tx.ExecContext(ctx, sqlStmt, i.InvitedBy, i.Email,
-			i.Name, i.Position, i.Token, i.SSOEnabled, i.GlobalRole)
-		if err != nil && isDuplicate(err) {
-			return ctxerr.Wrap(ctx, alreadyExists("Invite", i.Email))
-		} else if err != nil {
-			return ctxerr.Wrap(ctx, err, "create invite")
-		}
-
-		id, _ := result.LastInsertId()
-		i.ID = uint(id)
+		return newInviteDB(ctx, tx, i)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return i, nil
+}
 
-		if len(i.Teams) == 0 {
-			i.Teams = []fleet.UserTeam{}
-			return nil
-		}
+// BulkCreateInvites creates the invites in a single transaction. The invites that can't be created because they're
+// invalid or their email is already invited are reported in a fleet.BulkInviteError, the others are created anyway.
+func (ds *Datastore) BulkCreateInvites(ctx context.Context, invites []fleet.Invite) ([]fleet.Invite, error) {
+	var created []fleet.Invite
+	var bulkErr fleet.BulkInviteError
+	err := ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
+		// reset in case the transaction is retried
+		created = make([]fleet.Invite, 0, len(invites))
+		bulkErr.Errors = make(map[int]error)
 
-		// Bulk insert teams
-		const valueStr = "(?,?,?),"
-		var args []interface{}
-		for _, userTeam := range i.Teams {
-			args = append(args, i.ID, userTeam.Team.ID, userTeam.Role)
-		}
-		sql := "INSERT INTO invite_teams (invite_id, team_id, role) VALUES " +
-			strings.Repeat(valueStr, len(i.Teams))
-		sql = strings.TrimSuffix(sql, ",")
-		if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
-			return ctxerr.Wrap(ctx, err, "insert teams")
+		for idx := range invites {
+			i := invites[idx]
+			if err := fleet.ValidateRole(i.GlobalRole.Ptr(), i.Teams); err != nil {
+				bulkErr.Errors[idx] = err
+				continue
+			}
+			// a failed statement doesn't abort the transaction, the duplicates are just skipped
+			if err := newInviteDB(ctx, tx, &i); err != nil {
+				var existsErr *existsError
+				if errors.As(err, &existsErr) {
+					bulkErr.Errors[idx] = err
+					continue
+				}
+				return err
+			}
+			created = append(created, i)
 		}
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
-	return i, nil
+	if len(bulkErr.Errors) > 0 {
+		return created, ctxerr.Wrap(ctx, &bulkErr)
+	}
+	return created, nil
+}
+
+func newInviteDB(ctx context.Context, tx sqlx.ExtContext, i *fleet.Invite) error {
+	sqlStmt := `
+	INSERT INTO invites ( invited_by, email, name, position, token, sso_enabled, global_role, expires_at )
+	  VALUES ( ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := tx.ExecContext(ctx, sqlStmt, i.InvitedBy, i.Email,
+		i.Name, i.Position, i.Token, i.SSOEnabled, i.GlobalRole, i.ExpiresAt)
+	if err != nil && isDuplicate(err) {
+		return ctxerr.Wrap(ctx, alreadyExists("Invite", i.Email))
+	} else if err != nil {
+		return ctxerr.Wrap(ctx, err, "create invite")
+	}
+
+	id, _ := result.LastInsertId()
+	i.ID = uint(id)
+
+	if len(i.Teams) == 0 {
+		i.Teams = []fleet.UserTeam{}
+		return nil
+	}
+
+	// Bulk insert teams
+	const valueStr = "(?,?,?),"
+	var args []interface{}
+	for _, userTeam := range i.Teams {
+		args = append(args, i.ID, userTeam.Team.ID, userTeam.Role)
+	}
+	sql := "INSERT INTO invite_teams (invite_id, team_id, role) VALUES " +
+		strings.Repeat(valueStr, len(i.Teams))
+	sql = strings.TrimSuffix(sql, ",")
+	if _, err := tx.ExecContext(ctx, sql, args...); err != nil {
+		return ctxerr.Wrap(ctx, err, "insert teams")
+	}
+	return nil
 }
 
 // ListInvites lists all invites in the Fleet database. Supply query options
@@ -83,6 +127,28 @@ func (ds *Datastore) ListInvites(ctx context.Context, opt fleet.ListOptions) ([]
 	return invites, nil
 }
 
+// InvitesExpiringBefore lists the invites whose expiry is before the given time, ordered by expiry unless another
+// order is requested.
+func (ds *Datastore) InvitesExpiringBefore(ctx context.Context, before time.Time, opt fleet.ListOptions) ([]*fleet.Invite, error) {
+	if opt.OrderKey == "" {
+		opt.OrderKey = "expires_at"
+	}
+
+	invites := []*fleet.Invite{}
+	query := "SELECT * FROM invites WHERE expires_at IS NOT NULL AND expires_at < ?"
+	query = appendListOptionsToSQL(query, &opt)
+
+	if err := sqlx.SelectContext(ctx, ds.reader, &invites, query, before); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select invites expiring before")
+	}
+
+	if err := ds.loadTeamsForInvites(ctx, invites); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "load teams")
+	}
+
+	return invites, nil
+}
+
 // Invite returns Invite identified by id.
 func (ds *Datastore) Invite(ctx context.Context, id uint) (*fleet.Invite, error) {
 	var invite fleet.Invite
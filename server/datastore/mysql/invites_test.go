@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"testing"
+	"time"
 
 	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/fleetdm/fleet/v4/server/ptr"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/guregu/null.v3"
@@ -20,12 +22,14 @@ func TestInvites(t *testing.T) {
 		fn   func(t *testing.T, ds *Datastore)
 	}{
 		{"Create", testInvitesCreate},
+		{"BulkCreate", testInvitesBulkCreate},
 		{"List", testInvitesList},
 		{"Delete", testInvitesDelete},
 		{"ByToken", testInvitesByToken},
 		{"ByEmail", testInvitesByEmail},
 		{"Invite", testInvitesInvite},
 		{"Update", testInvitesUpdate},
+		{"ExpiringBefore", testInvitesExpiringBefore},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -71,6 +75,70 @@ func testInvitesCreate(t *testing.T, ds *Datastore) {
 	require.NoError(t, err)
 }
 
+func testInvitesBulkCreate(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	team, err := ds.NewTeam(ctx, &fleet.Team{Name: "team"})
+	require.NoError(t, err)
+
+	_, err = ds.NewInvite(ctx, &fleet.Invite{Email: "existing@foo.com", Name: "existing", Token: "existing", GlobalRole: null.StringFrom(fleet.RoleObserver)})
+	require.NoError(t, err)
+
+	created, err := ds.BulkCreateInvites(ctx, []fleet.Invite{
+		{Email: "user1@foo.com", Name: "user1", Token: "user1", GlobalRole: null.StringFrom(fleet.RoleObserver)},
+		{Email: "existing@foo.com", Name: "existing", Token: "existing2", GlobalRole: null.StringFrom(fleet.RoleObserver)},
+		{Email: "user2@foo.com", Name: "user2", Token: "user2", Teams: []fleet.UserTeam{
+			{Role: fleet.RoleMaintainer, Team: fleet.Team{ID: team.ID}},
+		}},
+		{Email: "user1@foo.com", Name: "user1 again", Token: "user1again", GlobalRole: null.StringFrom(fleet.RoleObserver)},
+		{Email: "invalid@foo.com", Name: "invalid", Token: "invalid", GlobalRole: null.StringFrom(fleet.RoleAdmin), Teams: []fleet.UserTeam{
+			{Role: fleet.RoleMaintainer, Team: fleet.Team{ID: team.ID}},
+		}},
+	})
+	var bulkErr *fleet.BulkInviteError
+	require.ErrorAs(t, err, &bulkErr)
+	require.Len(t, bulkErr.Errors, 3)
+	for _, idx := range []int{1, 3} {
+		var existsErr *existsError
+		require.ErrorAs(t, bulkErr.Errors[idx], &existsErr, idx)
+	}
+	require.Error(t, bulkErr.Errors[4])
+
+	// the valid invites are created regardless, with their tokens
+	require.Len(t, created, 2)
+	require.Equal(t, "user1@foo.com", created[0].Email)
+	require.Equal(t, "user1", created[0].Token)
+	require.Equal(t, "user2@foo.com", created[1].Email)
+	require.Equal(t, "user2", created[1].Token)
+	for _, i := range created {
+		invite, err := ds.Invite(ctx, i.ID)
+		require.NoError(t, err)
+		require.Equal(t, i.Email, invite.Email)
+		require.Equal(t, i.Name, invite.Name)
+		require.Len(t, invite.Teams, len(i.Teams))
+	}
+
+	// the duplicates didn't replace the existing invites
+	invite, err := ds.InviteByEmail(ctx, "existing@foo.com")
+	require.NoError(t, err)
+	require.Equal(t, "existing", invite.Token)
+	invite, err = ds.InviteByEmail(ctx, "user1@foo.com")
+	require.NoError(t, err)
+	require.Equal(t, "user1", invite.Name)
+
+	invites, err := ds.ListInvites(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, invites, 3)
+
+	// a batch without errors
+	created, err = ds.BulkCreateInvites(ctx, []fleet.Invite{
+		{Email: "user3@foo.com", Name: "user3", Token: "user3", GlobalRole: null.StringFrom(fleet.RoleObserver)},
+	})
+	require.NoError(t, err)
+	require.Len(t, created, 1)
+	require.NotZero(t, created[0].ID)
+}
+
 func setupTestInvites(t *testing.T, ds fleet.Datastore) {
 	admin := &fleet.Invite{
 		Email:      "admin@foo.com",
@@ -290,3 +358,50 @@ func testInvitesUpdate(t *testing.T, ds *Datastore) {
 	assert.Equal(t, fleet.RoleAdmin, verify.Teams[0].Role)
 
 }
+
+func testInvitesExpiringBefore(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	invites, err := ds.InvitesExpiringBefore(ctx, now, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, invites)
+
+	newInvite := func(name string, expiresAt *time.Time) {
+		_, err := ds.NewInvite(ctx, &fleet.Invite{
+			Email:     name + "@example.com",
+			Name:      name,
+			Token:     name,
+			ExpiresAt: expiresAt,
+		})
+		require.NoError(t, err)
+	}
+	newInvite("expired", ptr.Time(now.Add(-time.Hour)))
+	newInvite("soon", ptr.Time(now.Add(time.Hour)))
+	newInvite("boundary", ptr.Time(now.Add(24*time.Hour)))
+	newInvite("later", ptr.Time(now.Add(48*time.Hour)))
+	newInvite("unknown", nil)
+
+	names := func(invites []*fleet.Invite) []string {
+		var names []string
+		for _, i := range invites {
+			names = append(names, i.Name)
+		}
+		return names
+	}
+
+	// the boundary is excluded
+	invites, err = ds.InvitesExpiringBefore(ctx, now.Add(24*time.Hour), fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"expired", "soon"}, names(invites))
+	require.True(t, now.Add(-time.Hour).Equal(*invites[0].ExpiresAt))
+	require.NotNil(t, invites[0].Teams)
+
+	invites, err = ds.InvitesExpiringBefore(ctx, now.Add(24*time.Hour+time.Second), fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"expired", "soon", "boundary"}, names(invites))
+
+	invites, err = ds.InvitesExpiringBefore(ctx, now.Add(72*time.Hour), fleet.ListOptions{OrderKey: "name", PerPage: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"boundary", "expired"}, names(invites))
+}
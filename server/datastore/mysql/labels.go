@@ -255,6 +255,24 @@ func (ds *Datastore) DeleteLabel(ctx context.Context, name string) error {
 	})
 }
 
+func (ds *Datastore) CleanupOrphanedLabelMemberships(ctx context.Context) (int, error) {
+	const stmt = `
+		DELETE lm FROM label_membership lm
+		LEFT JOIN hosts h ON h.id = lm.host_id
+		LEFT JOIN labels l ON l.id = lm.label_id
+		WHERE h.id IS NULL OR l.id IS NULL
+	`
+	res, err := ds.writer.ExecContext(ctx, stmt)
+	if err != nil {
+		return 0, ctxerr.Wrap(ctx, err, "delete orphaned label_membership")
+	}
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, ctxerr.Wrap(ctx, err, "rows affected by orphaned label_membership delete")
+	}
+	return int(deleted), nil
+}
+
 // Label returns a fleet.Label identified by lid if one exists.
 func (ds *Datastore) Label(ctx context.Context, lid uint) (*fleet.Label, error) {
 	return labelDB(ctx, lid, ds.reader)
@@ -303,6 +321,26 @@ func (ds *Datastore) ListLabels(ctx context.Context, filter fleet.TeamFilter, op
 	return labels, nil
 }
 
+func (ds *Datastore) ListLabelsWithCounts(ctx context.Context, filter fleet.TeamFilter, opt fleet.ListOptions) ([]*fleet.Label, error) {
+	// the team filter is part of the join so that labels without visible hosts are still listed
+	query := fmt.Sprintf(`
+			SELECT l.*, COUNT(h.id) AS host_count
+			FROM labels l
+			LEFT JOIN label_membership lm ON lm.label_id = l.id
+			LEFT JOIN hosts h ON h.id = lm.host_id AND %s
+			GROUP BY l.id
+		`, ds.whereFilterHostsByTeams(filter, "h"),
+	)
+
+	query = appendListOptionsToSQL(query, &opt)
+	labels := []*fleet.Label{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &labels, query); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "selecting labels with counts")
+	}
+
+	return labels, nil
+}
+
 func platformForHost(host *fleet.Host) string {
 	if host.Platform != "rhel" {
 		return host.Platform
@@ -457,6 +495,25 @@ func (ds *Datastore) ListLabelsForHost(ctx context.Context, hid uint) ([]*fleet.
 	return labels, nil
 }
 
+func (ds *Datastore) LabelsNotForHost(ctx context.Context, hostID uint, opts fleet.ListOptions) ([]fleet.Label, error) {
+	// dynamic labels are left out, their membership is determined by their query
+	stmt := `
+		SELECT l.* FROM labels l
+		WHERE l.label_membership_type = ?
+		AND NOT EXISTS (SELECT 1 FROM label_membership lm WHERE lm.label_id = l.id AND lm.host_id = ?)
+	`
+	if opts.OrderKey == "" {
+		opts.OrderKey = "name"
+	}
+	stmt = appendListOptionsToSQL(stmt, &opts)
+
+	labels := []fleet.Label{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &labels, stmt, fleet.LabelMembershipTypeManual, hostID); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "selecting labels not for host")
+	}
+	return labels, nil
+}
+
 // ListHostsInLabel returns a list of fleet.Host that are associated
 // with fleet.Label referened by Label ID
 func (ds *Datastore) ListHostsInLabel(ctx context.Context, filter fleet.TeamFilter, lid uint, opt fleet.HostListOptions) ([]*fleet.Host, error) {
@@ -531,10 +588,13 @@ func (ds *Datastore) ListHostsInLabel(ctx context.Context, filter fleet.TeamFilt
 
 	query := fmt.Sprintf(queryFmt, hostMDMSelect, failingPoliciesSelect, hostMDMJoin, failingPoliciesJoin)
 
-	query, params := ds.applyHostLabelFilters(filter, lid, query, opt)
+	query, params, err := ds.applyHostLabelFilters(filter, lid, query, opt)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list hosts in label")
+	}
 
 	hosts := []*fleet.Host{}
-	err := sqlx.SelectContext(ctx, ds.reader, &hosts, query, params...)
+	err = sqlx.SelectContext(ctx, ds.reader, &hosts, query, params...)
 	if err != nil {
 		return nil, ctxerr.Wrap(ctx, err, "selecting label query executions")
 	}
@@ -542,7 +602,7 @@ func (ds *Datastore) ListHostsInLabel(ctx context.Context, filter fleet.TeamFilt
 }
 
 // NOTE: the hosts table must be aliased to `h` in the query passed to this function.
-func (ds *Datastore) applyHostLabelFilters(filter fleet.TeamFilter, lid uint, query string, opt fleet.HostListOptions) (string, []interface{}) {
+func (ds *Datastore) applyHostLabelFilters(filter fleet.TeamFilter, lid uint, query string, opt fleet.HostListOptions) (string, []interface{}, error) {
 	params := []interface{}{lid}
 
 	if opt.ListOptions.OrderKey == "display_name" {
@@ -555,14 +615,17 @@ func (ds *Datastore) applyHostLabelFilters(filter fleet.TeamFilter, lid uint, qu
 		params = append(params, *opt.LowDiskSpaceFilter)
 	}
 
-	query, params = filterHostsByStatus(ds.clock.Now(), query, opt, params)
+	query, params, err := filterHostsByStatus(ds.clock.Now(), query, opt, params)
+	if err != nil {
+		return "", nil, err
+	}
 	query, params = filterHostsByTeam(query, opt, params)
 	query, params = filterHostsByMDM(query, opt, params)
 	query, params = filterHostsByMacOSSettingsStatus(query, opt, params)
 	query, params = searchLike(query, params, opt.MatchQuery, hostSearchColumns...)
 
 	query = appendListOptionsToSQL(query, &opt.ListOptions)
-	return query, params
+	return query, params, nil
 }
 
 func (ds *Datastore) CountHostsInLabel(ctx context.Context, filter fleet.TeamFilter, lid uint, opt fleet.HostListOptions) (int, error) {
@@ -577,7 +640,10 @@ func (ds *Datastore) CountHostsInLabel(ctx context.Context, filter fleet.TeamFil
 		query += ` LEFT JOIN host_disks hd ON (h.id=hd.host_id) `
 	}
 
-	query, params := ds.applyHostLabelFilters(filter, lid, query, opt)
+	query, params, err := ds.applyHostLabelFilters(filter, lid, query, opt)
+	if err != nil {
+		return 0, ctxerr.Wrap(ctx, err, "count hosts in label")
+	}
 
 	var count int
 	if err := sqlx.GetContext(ctx, ds.reader, &count, query, params...); err != nil {
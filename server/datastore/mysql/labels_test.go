@@ -62,6 +62,9 @@ func TestLabels(t *testing.T) {
 		{"RecordNonExistentQueryLabelExecution", testLabelsRecordNonexistentQueryLabelExecution},
 		{"DeleteLabel", testDeleteLabel},
 		{"LabelsSummary", testLabelsSummary},
+		{"ListLabelsWithCounts", testLabelsListLabelsWithCounts},
+		{"LabelsNotForHost", testLabelsNotForHost},
+		{"CleanupOrphanedLabelMemberships", testLabelsCleanupOrphanedLabelMemberships},
 		{"ListHostsInLabelFailingPolicies", testListHostsInLabelFailingPolicies},
 	}
 	for _, c := range cases {
@@ -78,7 +81,7 @@ func testLabelsAddAllHosts(deferred bool, t *testing.T, db *Datastore) {
 	var host *fleet.Host
 	var err error
 	for i := 0; i < 10; i++ {
-		host, err = db.EnrollHost(context.Background(), false, fmt.Sprint(i), "", "", fmt.Sprint(i), nil, 0)
+		host, err = db.EnrollHost(context.Background(), false, fmt.Sprint(i), "", "", fmt.Sprint(i), "", nil, 0)
 		require.Nil(t, err, "enrollment should succeed")
 		hosts = append(hosts, *host)
 	}
@@ -767,7 +770,7 @@ func testLabelsSave(t *testing.T, db *Datastore) {
 }
 
 func testLabelsQueriesForCentOSHost(t *testing.T, db *Datastore) {
-	host, err := db.EnrollHost(context.Background(), false, "0", "", "", "0", nil, 0)
+	host, err := db.EnrollHost(context.Background(), false, "0", "", "", "0", "", nil, 0)
 	require.NoError(t, err, "enrollment should succeed")
 
 	host.Platform = "rhel"
@@ -995,3 +998,153 @@ func checkLabelHostIssues(t *testing.T, ds *Datastore, hosts []*fleet.Host, lid
 	assert.Equal(t, expected, hostById.HostIssues.FailingPoliciesCount)
 	assert.Equal(t, expected, hostById.HostIssues.TotalIssuesCount)
 }
+
+func testLabelsListLabelsWithCounts(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	team, err := ds.NewTeam(ctx, &fleet.Team{Name: "team1"})
+	require.NoError(t, err)
+
+	var hosts []*fleet.Host
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("host%d", i)
+		hosts = append(hosts, test.NewHost(t, ds, name, "", name, name, time.Now()))
+	}
+	require.NoError(t, ds.AddHostsToTeam(ctx, &team.ID, []uint{hosts[0].ID}))
+
+	dynamic, err := ds.NewLabel(ctx, &fleet.Label{Name: "dynamic", Query: "select 1"})
+	require.NoError(t, err)
+	_, err = ds.NewLabel(ctx, &fleet.Label{Name: "empty", Query: "select 2"})
+	require.NoError(t, err)
+	for _, h := range hosts[:2] {
+		require.NoError(t, ds.RecordLabelQueryExecutions(ctx, h, map[uint]*bool{dynamic.ID: ptr.Bool(true)}, time.Now(), false))
+	}
+	// a host that doesn't match the label is not counted
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, hosts[2], map[uint]*bool{dynamic.ID: ptr.Bool(false)}, time.Now(), false))
+
+	require.NoError(t, ds.ApplyLabelSpecs(ctx, []*fleet.LabelSpec{{
+		Name:                "manual",
+		LabelMembershipType: fleet.LabelMembershipTypeManual,
+		Hosts:               []string{"host0", "host1", "host2"},
+	}}))
+
+	countsByName := func(filter fleet.TeamFilter) map[string]int {
+		labels, err := ds.ListLabelsWithCounts(ctx, filter, fleet.ListOptions{})
+		require.NoError(t, err)
+		counts := make(map[string]int)
+		for _, l := range labels {
+			counts[l.Name] = l.HostCount
+		}
+		return counts
+	}
+
+	admin := fleet.TeamFilter{User: &fleet.User{GlobalRole: ptr.String(fleet.RoleAdmin)}}
+	require.Equal(t, map[string]int{"dynamic": 2, "empty": 0, "manual": 3}, countsByName(admin))
+
+	// only the hosts visible to the user are counted
+	teamUser := fleet.TeamFilter{User: &fleet.User{Teams: []fleet.UserTeam{{Team: *team, Role: fleet.RoleAdmin}}}}
+	require.Equal(t, map[string]int{"dynamic": 1, "empty": 0, "manual": 1}, countsByName(teamUser))
+
+	// counts match those of ListLabels
+	counts := countsByName(admin)
+	labels, err := ds.ListLabels(ctx, admin, fleet.ListOptions{})
+	require.NoError(t, err)
+	for _, l := range labels {
+		require.Equal(t, counts[l.Name], l.HostCount, l.Name)
+	}
+}
+
+func testLabelsNotForHost(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	var hosts []*fleet.Host
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprintf("host%d", i)
+		hosts = append(hosts, test.NewHost(t, ds, name, "", name, name, time.Now()))
+	}
+
+	// a dynamic label that host0 is not in can't be listed, whatever its membership
+	dynamic, err := ds.NewLabel(ctx, &fleet.Label{Name: "dynamic", Query: "select 1"})
+	require.NoError(t, err)
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, hosts[1], map[uint]*bool{dynamic.ID: ptr.Bool(true)}, time.Now(), false))
+
+	require.NoError(t, ds.ApplyLabelSpecs(ctx, []*fleet.LabelSpec{
+		{Name: "manual-a", LabelMembershipType: fleet.LabelMembershipTypeManual, Hosts: []string{"host0", "host1"}},
+		{Name: "manual-b", LabelMembershipType: fleet.LabelMembershipTypeManual, Hosts: []string{"host1"}},
+		{Name: "manual-c", LabelMembershipType: fleet.LabelMembershipTypeManual},
+	}))
+
+	labelNames := func(hostID uint, opts fleet.ListOptions) []string {
+		labels, err := ds.LabelsNotForHost(ctx, hostID, opts)
+		require.NoError(t, err)
+		names := make([]string, 0, len(labels))
+		for _, l := range labels {
+			names = append(names, l.Name)
+		}
+		return names
+	}
+
+	require.Equal(t, []string{"manual-b", "manual-c"}, labelNames(hosts[0].ID, fleet.ListOptions{}))
+	require.Equal(t, []string{"manual-c"}, labelNames(hosts[1].ID, fleet.ListOptions{}))
+	require.Equal(t, []string{"manual-a", "manual-b", "manual-c"}, labelNames(hosts[2].ID, fleet.ListOptions{}))
+
+	// the options apply
+	require.Equal(t, []string{"manual-c", "manual-b", "manual-a"}, labelNames(hosts[2].ID, fleet.ListOptions{
+		OrderKey:       "name",
+		OrderDirection: fleet.OrderDescending,
+	}))
+	require.Equal(t, []string{"manual-b"}, labelNames(hosts[2].ID, fleet.ListOptions{Page: 1, PerPage: 1}))
+}
+
+func testLabelsCleanupOrphanedLabelMemberships(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	h1 := test.NewHost(t, ds, "h1", "", "h1", "h1", time.Now())
+	h2 := test.NewHost(t, ds, "h2", "", "h2", "h2", time.Now())
+	l1, err := ds.NewLabel(ctx, &fleet.Label{Name: "l1", Query: "select 1"})
+	require.NoError(t, err)
+	l2, err := ds.NewLabel(ctx, &fleet.Label{Name: "l2", Query: "select 1"})
+	require.NoError(t, err)
+
+	// nothing to clean up
+	n, err := ds.CleanupOrphanedLabelMemberships(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	require.NoError(t, ds.AsyncBatchInsertLabelMembership(ctx, [][2]uint{
+		{l1.ID, h1.ID},
+		{l1.ID, h2.ID},
+		{l2.ID, h2.ID},
+		// the host doesn't exist
+		{l2.ID, h2.ID + 100},
+		// the label doesn't exist
+		{l2.ID + 100, h1.ID},
+	}))
+	// delete h2 without cleaning up its memberships
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `DELETE FROM hosts WHERE id = ?`, h2.ID)
+		return err
+	})
+
+	n, err = ds.CleanupOrphanedLabelMemberships(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	var memberships [][2]uint
+	rows := []struct {
+		LabelID uint `db:"label_id"`
+		HostID  uint `db:"host_id"`
+	}{}
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &rows, `SELECT label_id, host_id FROM label_membership`)
+	})
+	for _, r := range rows {
+		memberships = append(memberships, [2]uint{r.LabelID, r.HostID})
+	}
+	require.Equal(t, [][2]uint{{l1.ID, h1.ID}}, memberships)
+
+	// running it again is a no-op
+	n, err = ds.CleanupOrphanedLabelMemberships(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
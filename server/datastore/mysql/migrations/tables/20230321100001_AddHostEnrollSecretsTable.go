@@ -0,0 +1,45 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100001, Down_20230321100001)
+}
+
+func Up_20230321100001(tx *sql.Tx) error {
+	// the hosts reference the enroll secret they used by id, and keep the hex sha256 of the secret so that they can
+	// still be listed by it once it's removed (e.g. when it's rotated out because it leaked), without storing it
+	if _, err := tx.Exec(`
+    ALTER TABLE enroll_secrets
+      ADD COLUMN id int unsigned NOT NULL AUTO_INCREMENT,
+      ADD UNIQUE KEY idx_enroll_secrets_id (id)`,
+	); err != nil {
+		return errors.Wrap(err, "add id column to enroll_secrets")
+	}
+
+	_, err := tx.Exec(`
+    CREATE TABLE host_enroll_secrets (
+      host_id          int unsigned NOT NULL,
+      secret_sha256    char(64) COLLATE utf8mb4_unicode_ci NOT NULL,
+      enroll_secret_id int unsigned DEFAULT NULL,
+      created_at       timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+      updated_at       timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+      PRIMARY KEY (host_id),
+      KEY idx_host_enroll_secrets_secret_sha256 (secret_sha256),
+      KEY idx_host_enroll_secrets_enroll_secret_id (enroll_secret_id),
+      CONSTRAINT fk_host_enroll_secrets_enroll_secret_id FOREIGN KEY (enroll_secret_id) REFERENCES enroll_secrets (id) ON DELETE SET NULL
+    )`)
+	if err != nil {
+		return errors.Wrap(err, "create host_enroll_secrets table")
+	}
+	return nil
+}
+
+func Down_20230321100001(tx *sql.Tx) error {
+	return nil
+}
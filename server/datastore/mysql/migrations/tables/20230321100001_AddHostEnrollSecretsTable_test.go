@@ -0,0 +1,50 @@
+package tables
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100001(t *testing.T) {
+	db := applyUpToPrev(t)
+	execNoErr(t, db, `INSERT INTO enroll_secrets (secret) VALUES (?), (?)`, "abc", "def")
+	applyNext(t, db)
+
+	var abcID, defID uint
+	require.NoError(t, db.Get(&abcID, `SELECT id FROM enroll_secrets WHERE secret = ?`, "abc"))
+	require.NoError(t, db.Get(&defID, `SELECT id FROM enroll_secrets WHERE secret = ?`, "def"))
+	require.NotEqual(t, abcID, defID)
+
+	abcHash := fmt.Sprintf("%x", sha256.Sum256([]byte("abc")))
+	defHash := fmt.Sprintf("%x", sha256.Sum256([]byte("def")))
+	insertStmt := `INSERT INTO host_enroll_secrets (host_id, secret_sha256, enroll_secret_id) VALUES (?, ?, ?)`
+	execNoErr(t, db, insertStmt, 1, abcHash, abcID)
+	execNoErr(t, db, insertStmt, 2, abcHash, abcID)
+	execNoErr(t, db, insertStmt, 3, defHash, defID)
+
+	// host_id is the primary key, a host has a single enroll secret
+	_, err := db.Exec(insertStmt, 1, defHash, defID)
+	require.Error(t, err)
+
+	// the secrets are referenced by id
+	_, err = db.Exec(insertStmt, 4, abcHash, abcID+100)
+	require.Error(t, err)
+
+	// removing a secret keeps the records of the hosts that used it
+	execNoErr(t, db, `DELETE FROM enroll_secrets WHERE secret = ?`, "abc")
+	var rows []struct {
+		HostID         uint   `db:"host_id"`
+		SecretSHA256   string `db:"secret_sha256"`
+		EnrollSecretID *uint  `db:"enroll_secret_id"`
+	}
+	err = db.Select(&rows, `SELECT host_id, secret_sha256, enroll_secret_id FROM host_enroll_secrets ORDER BY host_id`)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	require.Equal(t, abcHash, rows[0].SecretSHA256)
+	require.Nil(t, rows[0].EnrollSecretID)
+	require.Equal(t, defHash, rows[2].SecretSHA256)
+	require.Equal(t, &defID, rows[2].EnrollSecretID)
+}
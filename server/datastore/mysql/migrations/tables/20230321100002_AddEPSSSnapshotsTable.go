@@ -0,0 +1,31 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100002, Down_20230321100002)
+}
+
+func Up_20230321100002(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE epss_snapshots (
+      cve           varchar(20) NOT NULL,
+      snapshot_date date NOT NULL,
+      score         double NOT NULL,
+      percentile    double NOT NULL,
+
+      PRIMARY KEY (cve, snapshot_date)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create epss_snapshots table")
+	}
+	return nil
+}
+
+func Down_20230321100002(tx *sql.Tx) error {
+	return nil
+}
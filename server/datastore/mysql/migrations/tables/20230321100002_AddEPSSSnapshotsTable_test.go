@@ -0,0 +1,25 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100002(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	insertStmt := `INSERT INTO epss_snapshots (cve, snapshot_date, score, percentile) VALUES (?, ?, ?, ?)`
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "2022-06-01", 0.1, 0.5)
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "2022-06-02", 0.2, 0.6)
+
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM epss_snapshots WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// a single snapshot per cve and date
+	_, err = db.Exec(insertStmt, "CVE-2022-0001", "2022-06-02", 0.3, 0.7)
+	require.Error(t, err)
+}
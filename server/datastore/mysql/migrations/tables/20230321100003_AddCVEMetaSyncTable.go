@@ -0,0 +1,31 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100003, Down_20230321100003)
+}
+
+func Up_20230321100003(tx *sql.Tx) error {
+	// single row table, the id is always 1
+	_, err := tx.Exec(`
+    CREATE TABLE cve_meta_sync (
+      id        tinyint(1) unsigned NOT NULL DEFAULT 1,
+      synced_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+      cve_count int(10) unsigned NOT NULL DEFAULT 0,
+
+      PRIMARY KEY (id)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create cve_meta_sync table")
+	}
+	return nil
+}
+
+func Down_20230321100003(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100003(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	execNoErr(t, db, `INSERT INTO cve_meta_sync (id, synced_at, cve_count) VALUES (1, '2023-03-21 10:00:00', 10)`)
+
+	var count int
+	err := db.Get(&count, `SELECT cve_count FROM cve_meta_sync WHERE id = 1`)
+	require.NoError(t, err)
+	require.Equal(t, 10, count)
+
+	// a single row is stored
+	_, err = db.Exec(`INSERT INTO cve_meta_sync (id, synced_at, cve_count) VALUES (1, '2023-03-22 10:00:00', 20)`)
+	require.Error(t, err)
+}
@@ -0,0 +1,31 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100004, Down_20230321100004)
+}
+
+func Up_20230321100004(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE cve_meta_provenance (
+      cve       varchar(20) NOT NULL,
+      field     varchar(50) NOT NULL,
+      source    varchar(255) NOT NULL,
+      loaded_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+      PRIMARY KEY (cve, field)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create cve_meta_provenance table")
+	}
+	return nil
+}
+
+func Down_20230321100004(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100004(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	insertStmt := `INSERT INTO cve_meta_provenance (cve, field, source, loaded_at) VALUES (?, ?, ?, ?)`
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "cvss_score", "nvdcve-1.1-2022.json.gz", "2023-03-21 10:00:00")
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "epss_probability", "epss_scores-current.csv", "2023-03-21 10:00:00")
+
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM cve_meta_provenance WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// a single source per cve field
+	_, err = db.Exec(insertStmt, "CVE-2022-0001", "cvss_score", "nvdcve-1.1-modified.json.gz", "2023-03-22 10:00:00")
+	require.Error(t, err)
+}
@@ -0,0 +1,27 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100005, Down_20230321100005)
+}
+
+func Up_20230321100005(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE cve_meta
+      ADD COLUMN cvss_exploitability_score double DEFAULT NULL,
+      ADD COLUMN cvss_impact_score double DEFAULT NULL,
+      ADD COLUMN cvss_vector varchar(100) COLLATE utf8mb4_unicode_ci DEFAULT NULL`)
+	if err != nil {
+		return errors.Wrap(err, "adding cvss subscore columns to cve_meta")
+	}
+	return nil
+}
+
+func Down_20230321100005(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+package tables
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100005(t *testing.T) {
+	db := applyUpToPrev(t)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cvss_score) VALUES (?, ?)`, "CVE-2022-0001", 9.8)
+
+	applyNext(t, db)
+
+	// existing rows have no subscores
+	var exploitability sql.NullFloat64
+	err := db.Get(&exploitability, `SELECT cvss_exploitability_score FROM cve_meta WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.False(t, exploitability.Valid)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cvss_score, cvss_exploitability_score, cvss_impact_score, cvss_vector) VALUES (?, ?, ?, ?, ?)`,
+		"CVE-2022-0002", 9.8, 3.9, 5.9, "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H")
+
+	var vector string
+	err = db.Get(&vector, `SELECT cvss_vector FROM cve_meta WHERE cve = ?`, "CVE-2022-0002")
+	require.NoError(t, err)
+	require.Equal(t, "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", vector)
+}
@@ -0,0 +1,32 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100006, Down_20230321100006)
+}
+
+func Up_20230321100006(tx *sql.Tx) error {
+	// single row table, the id is always 1
+	_, err := tx.Exec(`
+    CREATE TABLE cisa_catalog_version (
+      id              tinyint(1) unsigned NOT NULL DEFAULT 1,
+      catalog_version varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+      date_released   timestamp NULL DEFAULT NULL,
+      loaded_at       timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+      PRIMARY KEY (id)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create cisa_catalog_version table")
+	}
+	return nil
+}
+
+func Down_20230321100006(tx *sql.Tx) error {
+	return nil
+}
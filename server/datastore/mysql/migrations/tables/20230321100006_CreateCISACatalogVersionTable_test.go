@@ -0,0 +1,23 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100006(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	execNoErr(t, db, `INSERT INTO cisa_catalog_version (id, catalog_version, date_released) VALUES (1, '2022.06.02', '2022-06-02 17:48:15')`)
+
+	var version string
+	err := db.Get(&version, `SELECT catalog_version FROM cisa_catalog_version WHERE id = 1`)
+	require.NoError(t, err)
+	require.Equal(t, "2022.06.02", version)
+
+	// a single row is stored
+	_, err = db.Exec(`INSERT INTO cisa_catalog_version (id, catalog_version) VALUES (1, '2022.06.03')`)
+	require.Error(t, err)
+}
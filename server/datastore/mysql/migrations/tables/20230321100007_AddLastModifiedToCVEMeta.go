@@ -0,0 +1,23 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100007, Down_20230321100007)
+}
+
+func Up_20230321100007(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE cve_meta ADD COLUMN last_modified timestamp NULL DEFAULT NULL`)
+	if err != nil {
+		return errors.Wrap(err, "adding last_modified column to cve_meta")
+	}
+	return nil
+}
+
+func Down_20230321100007(tx *sql.Tx) error {
+	return nil
+}
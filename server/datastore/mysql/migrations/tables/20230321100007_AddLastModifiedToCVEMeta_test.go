@@ -0,0 +1,31 @@
+package tables
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100007(t *testing.T) {
+	db := applyUpToPrev(t)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cvss_score) VALUES (?, ?)`, "CVE-2022-0001", 9.8)
+
+	applyNext(t, db)
+
+	// existing rows have no last modified date
+	var lastModified sql.NullTime
+	err := db.Get(&lastModified, `SELECT last_modified FROM cve_meta WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.False(t, lastModified.Valid)
+
+	modified := time.Date(2022, 6, 2, 14, 47, 0, 0, time.UTC)
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cvss_score, last_modified) VALUES (?, ?, ?)`, "CVE-2022-0002", 9.8, modified)
+
+	err = db.Get(&lastModified, `SELECT last_modified FROM cve_meta WHERE cve = ?`, "CVE-2022-0002")
+	require.NoError(t, err)
+	require.True(t, lastModified.Valid)
+	require.True(t, modified.Equal(lastModified.Time))
+}
@@ -0,0 +1,27 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100008, Down_20230321100008)
+}
+
+func Up_20230321100008(tx *sql.Tx) error {
+	// the expiry of the existing invites depends on the configured validity period, so it is left unset for them
+	_, err := tx.Exec(`
+    ALTER TABLE invites
+      ADD COLUMN expires_at timestamp NULL DEFAULT NULL,
+      ADD INDEX idx_invites_expires_at (expires_at)`)
+	if err != nil {
+		return errors.Wrap(err, "adding expires_at column to invites")
+	}
+	return nil
+}
+
+func Down_20230321100008(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,31 @@
+package tables
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100008(t *testing.T) {
+	db := applyUpToPrev(t)
+
+	execNoErr(t, db, `INSERT INTO invites (invited_by, email, token) VALUES (?, ?, ?)`, 1, "a@example.com", "token-a")
+
+	applyNext(t, db)
+
+	// existing invites have no expiry
+	var expiresAt sql.NullTime
+	err := db.Get(&expiresAt, `SELECT expires_at FROM invites WHERE email = ?`, "a@example.com")
+	require.NoError(t, err)
+	require.False(t, expiresAt.Valid)
+
+	expiry := time.Date(2023, 3, 26, 10, 0, 0, 0, time.UTC)
+	execNoErr(t, db, `INSERT INTO invites (invited_by, email, token, expires_at) VALUES (?, ?, ?, ?)`, 1, "b@example.com", "token-b", expiry)
+
+	err = db.Get(&expiresAt, `SELECT expires_at FROM invites WHERE email = ?`, "b@example.com")
+	require.NoError(t, err)
+	require.True(t, expiresAt.Valid)
+	require.True(t, expiry.Equal(expiresAt.Time))
+}
@@ -0,0 +1,30 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100009, Down_20230321100009)
+}
+
+func Up_20230321100009(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE epss_model_scores (
+      cve           varchar(20) NOT NULL,
+      model_version varchar(20) NOT NULL,
+      score         double NOT NULL,
+
+      PRIMARY KEY (cve, model_version)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create epss_model_scores table")
+	}
+	return nil
+}
+
+func Down_20230321100009(tx *sql.Tx) error {
+	return nil
+}
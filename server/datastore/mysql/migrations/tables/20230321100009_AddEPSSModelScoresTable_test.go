@@ -0,0 +1,25 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100009(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	insertStmt := `INSERT INTO epss_model_scores (cve, model_version, score) VALUES (?, ?, ?)`
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "v2022.01.01", 0.1)
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "v2023.03.01", 0.2)
+
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM epss_model_scores WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// a single score per cve and model version
+	_, err = db.Exec(insertStmt, "CVE-2022-0001", "v2023.03.01", 0.3)
+	require.Error(t, err)
+}
@@ -0,0 +1,30 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100010, Down_20230321100010)
+}
+
+func Up_20230321100010(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE cve_cwes (
+      cve varchar(20) NOT NULL,
+      cwe varchar(20) NOT NULL,
+
+      PRIMARY KEY (cve, cwe),
+      KEY idx_cve_cwes_cwe (cwe)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create cve_cwes table")
+	}
+	return nil
+}
+
+func Down_20230321100010(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100010(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	insertStmt := `INSERT INTO cve_cwes (cve, cwe) VALUES (?, ?)`
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "CWE-79")
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "CWE-89")
+	execNoErr(t, db, insertStmt, "CVE-2022-0002", "CWE-79")
+
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM cve_cwes WHERE cwe = ?`, "CWE-79")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// a CVE has a CWE at most once
+	_, err = db.Exec(insertStmt, "CVE-2022-0001", "CWE-79")
+	require.Error(t, err)
+}
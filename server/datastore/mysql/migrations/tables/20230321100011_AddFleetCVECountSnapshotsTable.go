@@ -0,0 +1,29 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100011, Down_20230321100011)
+}
+
+func Up_20230321100011(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE fleet_cve_count_snapshots (
+      snapshot_date date NOT NULL,
+      cve_count int unsigned NOT NULL,
+
+      PRIMARY KEY (snapshot_date)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create fleet_cve_count_snapshots table")
+	}
+	return nil
+}
+
+func Down_20230321100011(tx *sql.Tx) error {
+	return nil
+}
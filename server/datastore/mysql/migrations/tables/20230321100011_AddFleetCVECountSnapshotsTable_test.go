@@ -0,0 +1,25 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100011(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	insertStmt := `INSERT INTO fleet_cve_count_snapshots (snapshot_date, cve_count) VALUES (?, ?)`
+	execNoErr(t, db, insertStmt, "2023-03-14", 10)
+	execNoErr(t, db, insertStmt, "2023-03-21", 12)
+
+	var count int
+	err := db.Get(&count, `SELECT cve_count FROM fleet_cve_count_snapshots WHERE snapshot_date = ?`, "2023-03-21")
+	require.NoError(t, err)
+	require.Equal(t, 12, count)
+
+	// a date has a single snapshot
+	_, err = db.Exec(insertStmt, "2023-03-21", 13)
+	require.Error(t, err)
+}
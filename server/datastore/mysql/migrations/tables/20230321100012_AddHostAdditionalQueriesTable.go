@@ -0,0 +1,31 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100012, Down_20230321100012)
+}
+
+func Up_20230321100012(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE host_additional_queries (
+      host_id int unsigned NOT NULL,
+      queries json NOT NULL,
+      created_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+      updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+
+      PRIMARY KEY (host_id)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create host_additional_queries table")
+	}
+	return nil
+}
+
+func Down_20230321100012(tx *sql.Tx) error {
+	return nil
+}
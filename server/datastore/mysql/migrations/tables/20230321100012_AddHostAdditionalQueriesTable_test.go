@@ -0,0 +1,24 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100012(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	insertStmt := `INSERT INTO host_additional_queries (host_id, queries) VALUES (?, ?)`
+	execNoErr(t, db, insertStmt, 1, `{"time": "SELECT * FROM time"}`)
+
+	var queries string
+	err := db.Get(&queries, `SELECT queries FROM host_additional_queries WHERE host_id = ?`, 1)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"time": "SELECT * FROM time"}`, queries)
+
+	// a host has a single set of additional queries
+	_, err = db.Exec(insertStmt, 1, `{}`)
+	require.Error(t, err)
+}
@@ -0,0 +1,25 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100013, Down_20230321100013)
+}
+
+func Up_20230321100013(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE cve_meta
+      ADD COLUMN cvss_source varchar(10) COLLATE utf8mb4_unicode_ci DEFAULT NULL`)
+	if err != nil {
+		return errors.Wrap(err, "adding cvss_source column to cve_meta")
+	}
+	return nil
+}
+
+func Down_20230321100013(tx *sql.Tx) error {
+	return nil
+}
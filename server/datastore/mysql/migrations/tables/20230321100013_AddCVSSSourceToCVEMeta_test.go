@@ -0,0 +1,28 @@
+package tables
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100013(t *testing.T) {
+	db := applyUpToPrev(t)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cvss_score) VALUES (?, ?)`, "CVE-2022-0001", 9.8)
+
+	applyNext(t, db)
+
+	// the source of existing scores is unknown
+	var source sql.NullString
+	err := db.Get(&source, `SELECT cvss_source FROM cve_meta WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.False(t, source.Valid)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cvss_score, cvss_source) VALUES (?, ?, ?)`, "CVE-2022-0002", 7.5, "cna")
+
+	err = db.Get(&source, `SELECT cvss_source FROM cve_meta WHERE cve = ?`, "CVE-2022-0002")
+	require.NoError(t, err)
+	require.Equal(t, "cna", source.String)
+}
@@ -0,0 +1,27 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100014, Down_20230321100014)
+}
+
+func Up_20230321100014(tx *sql.Tx) error {
+	// updated_at only changes when the values of the row do, not when a load saves the same values again
+	_, err := tx.Exec(`
+    ALTER TABLE cve_meta
+      ADD COLUMN updated_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+      ADD KEY idx_cve_meta_updated_at (updated_at)`)
+	if err != nil {
+		return errors.Wrap(err, "adding updated_at column to cve_meta")
+	}
+	return nil
+}
+
+func Down_20230321100014(tx *sql.Tx) error {
+	return nil
+}
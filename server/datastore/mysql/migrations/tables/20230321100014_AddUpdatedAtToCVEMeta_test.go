@@ -0,0 +1,35 @@
+package tables
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100014(t *testing.T) {
+	db := applyUpToPrev(t)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cvss_score) VALUES (?, ?)`, "CVE-2022-0001", 9.8)
+
+	applyNext(t, db)
+
+	// existing rows are stamped with the time of the migration
+	var updatedAt time.Time
+	err := db.Get(&updatedAt, `SELECT updated_at FROM cve_meta WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.False(t, updatedAt.IsZero())
+
+	// saving the same values doesn't change it, but changing them does
+	old := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	execNoErr(t, db, `UPDATE cve_meta SET updated_at = ? WHERE cve = ?`, old, "CVE-2022-0001")
+	execNoErr(t, db, `UPDATE cve_meta SET cvss_score = ? WHERE cve = ?`, 9.8, "CVE-2022-0001")
+	err = db.Get(&updatedAt, `SELECT updated_at FROM cve_meta WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.True(t, old.Equal(updatedAt))
+
+	execNoErr(t, db, `UPDATE cve_meta SET cvss_score = ? WHERE cve = ?`, 7.5, "CVE-2022-0001")
+	err = db.Get(&updatedAt, `SELECT updated_at FROM cve_meta WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.True(t, updatedAt.After(old))
+}
@@ -0,0 +1,30 @@
+package tables
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100015(t *testing.T) {
+	db := applyUpToPrev(t)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cisa_known_exploit) VALUES (?, ?)`, "CVE-2022-0001", true)
+
+	applyNext(t, db)
+
+	// the due date of existing known exploits is unknown until the catalog is loaded again
+	var dueDate sql.NullTime
+	err := db.Get(&dueDate, `SELECT cisa_due_date FROM cve_meta WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.False(t, dueDate.Valid)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cisa_known_exploit, cisa_due_date) VALUES (?, ?, ?)`, "CVE-2022-0002", true, "2022-05-03")
+
+	err = db.Get(&dueDate, `SELECT cisa_due_date FROM cve_meta WHERE cve = ?`, "CVE-2022-0002")
+	require.NoError(t, err)
+	require.True(t, dueDate.Valid)
+	require.Equal(t, time.Date(2022, 5, 3, 0, 0, 0, 0, time.UTC), dueDate.Time)
+}
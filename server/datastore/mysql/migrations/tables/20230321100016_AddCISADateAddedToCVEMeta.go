@@ -0,0 +1,25 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100016, Down_20230321100016)
+}
+
+func Up_20230321100016(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    ALTER TABLE cve_meta
+      ADD COLUMN cisa_date_added date DEFAULT NULL`)
+	if err != nil {
+		return errors.Wrap(err, "adding cisa_date_added column to cve_meta")
+	}
+	return nil
+}
+
+func Down_20230321100016(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,30 @@
+package tables
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100016(t *testing.T) {
+	db := applyUpToPrev(t)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cisa_known_exploit) VALUES (?, ?)`, "CVE-2022-0001", true)
+
+	applyNext(t, db)
+
+	// the date existing known exploits were added is unknown until the catalog is loaded again
+	var dateAdded sql.NullTime
+	err := db.Get(&dateAdded, `SELECT cisa_date_added FROM cve_meta WHERE cve = ?`, "CVE-2022-0001")
+	require.NoError(t, err)
+	require.False(t, dateAdded.Valid)
+
+	execNoErr(t, db, `INSERT INTO cve_meta (cve, cisa_known_exploit, cisa_date_added) VALUES (?, ?, ?)`, "CVE-2022-0002", true, "2022-01-28")
+
+	err = db.Get(&dateAdded, `SELECT cisa_date_added FROM cve_meta WHERE cve = ?`, "CVE-2022-0002")
+	require.NoError(t, err)
+	require.True(t, dateAdded.Valid)
+	require.Equal(t, time.Date(2022, 1, 28, 0, 0, 0, 0, time.UTC), dateAdded.Time)
+}
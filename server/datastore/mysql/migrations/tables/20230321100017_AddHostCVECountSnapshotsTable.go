@@ -0,0 +1,32 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100017, Down_20230321100017)
+}
+
+func Up_20230321100017(tx *sql.Tx) error {
+	// the snapshots older than the retention are deleted by date, for all the hosts at once
+	_, err := tx.Exec(`
+    CREATE TABLE host_cve_count_snapshots (
+      host_id int unsigned NOT NULL,
+      snapshot_date date NOT NULL,
+      cve_count int unsigned NOT NULL,
+
+      PRIMARY KEY (host_id, snapshot_date),
+      KEY idx_host_cve_count_snapshots_snapshot_date (snapshot_date)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create host_cve_count_snapshots table")
+	}
+	return nil
+}
+
+func Down_20230321100017(tx *sql.Tx) error {
+	return nil
+}
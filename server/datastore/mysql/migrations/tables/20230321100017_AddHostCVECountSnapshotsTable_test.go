@@ -0,0 +1,33 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100017(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	insertStmt := `INSERT INTO host_cve_count_snapshots (host_id, snapshot_date, cve_count) VALUES (?, ?, ?)`
+	execNoErr(t, db, insertStmt, 1, "2023-03-14", 10)
+	execNoErr(t, db, insertStmt, 1, "2023-03-21", 12)
+	execNoErr(t, db, insertStmt, 2, "2023-03-21", 3)
+
+	var count int
+	err := db.Get(&count, `SELECT cve_count FROM host_cve_count_snapshots WHERE host_id = ? AND snapshot_date = ?`, 1, "2023-03-21")
+	require.NoError(t, err)
+	require.Equal(t, 12, count)
+
+	// a host has a single snapshot per date
+	_, err = db.Exec(insertStmt, 1, "2023-03-21", 13)
+	require.Error(t, err)
+
+	var keyName string
+	err = db.Get(&keyName, `
+		SELECT INDEX_NAME FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = 'host_cve_count_snapshots' AND COLUMN_NAME = 'snapshot_date' AND SEQ_IN_INDEX = 1`)
+	require.NoError(t, err)
+	require.Equal(t, "idx_host_cve_count_snapshots_snapshot_date", keyName)
+}
@@ -0,0 +1,31 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100018, Down_20230321100018)
+}
+
+func Up_20230321100018(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE cve_products (
+      cve varchar(20) NOT NULL,
+      vendor varchar(255) NOT NULL,
+      product varchar(255) NOT NULL,
+
+      PRIMARY KEY (cve, vendor, product),
+      KEY idx_cve_products_vendor_product (vendor, product)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create cve_products table")
+	}
+	return nil
+}
+
+func Down_20230321100018(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100018(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	insertStmt := `INSERT INTO cve_products (cve, vendor, product) VALUES (?, ?, ?)`
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "apache", "http_server")
+	execNoErr(t, db, insertStmt, "CVE-2022-0001", "apache", "tomcat")
+	execNoErr(t, db, insertStmt, "CVE-2022-0002", "apache", "http_server")
+
+	var count int
+	err := db.Get(&count, `SELECT COUNT(*) FROM cve_products WHERE vendor = ? AND product = ?`, "apache", "http_server")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	// a CVE affects a product at most once
+	_, err = db.Exec(insertStmt, "CVE-2022-0001", "apache", "tomcat")
+	require.Error(t, err)
+}
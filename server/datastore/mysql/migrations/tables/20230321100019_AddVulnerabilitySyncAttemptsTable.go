@@ -0,0 +1,34 @@
+package tables
+
+import (
+	"database/sql"
+
+	"github.com/pkg/errors"
+)
+
+func init() {
+	MigrationClient.AddMigration(Up_20230321100019, Down_20230321100019)
+}
+
+func Up_20230321100019(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+    CREATE TABLE vulnerability_sync_attempts (
+      id int unsigned NOT NULL AUTO_INCREMENT,
+      started_at timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP,
+      duration_ms bigint unsigned NOT NULL DEFAULT 0,
+      success tinyint(1) NOT NULL,
+      error text,
+      sources json,
+
+      PRIMARY KEY (id),
+      KEY idx_vulnerability_sync_attempts_started_at (started_at)
+    ) DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci`)
+	if err != nil {
+		return errors.Wrap(err, "create vulnerability_sync_attempts table")
+	}
+	return nil
+}
+
+func Down_20230321100019(tx *sql.Tx) error {
+	return nil
+}
@@ -0,0 +1,21 @@
+package tables
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUp_20230321100019(t *testing.T) {
+	db := applyUpToPrev(t)
+	applyNext(t, db)
+
+	insertStmt := `INSERT INTO vulnerability_sync_attempts (started_at, duration_ms, success, error, sources) VALUES (?, ?, ?, ?, ?)`
+	execNoErr(t, db, insertStmt, "2023-03-21 10:00:00", 1500, false, "sync NVD CVE feed: timeout", `[{"source": "nvd", "success": false}]`)
+	execNoErr(t, db, insertStmt, "2023-03-21 11:00:00", 1200, true, nil, `[{"source": "nvd", "success": true}]`)
+
+	var successes []bool
+	err := db.Select(&successes, `SELECT success FROM vulnerability_sync_attempts ORDER BY started_at`)
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, true}, successes)
+}
@@ -1036,6 +1036,8 @@ func isChildForeignKeyError(err error) bool {
 
 // likePattern returns a pattern to match m with LIKE.
 func likePattern(m string) string {
+	// the escape character itself must be escaped first
+	m = strings.Replace(m, "\\", "\\\\", -1)
 	m = strings.Replace(m, "_", "\\_", -1)
 	m = strings.Replace(m, "%", "\\%", -1)
 	return "%" + m + "%"
@@ -13,6 +13,16 @@ import (
 
 func (ds *Datastore) ApplyPackSpecs(ctx context.Context, specs []*fleet.PackSpec) (err error) {
 	err = ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
+		if err := validatePackSpecsDB(ctx, tx, specs); err != nil {
+			return err
+		}
+
+		for _, spec := range specs {
+			if err := applyPackQuerySpecsDB(ctx, tx, spec.QuerySpecs); err != nil {
+				return ctxerr.Wrapf(ctx, err, "applying queries of pack '%s'", spec.Name)
+			}
+		}
+
 		for _, spec := range specs {
 			if err := applyPackSpecDB(ctx, tx, spec); err != nil {
 				return ctxerr.Wrapf(ctx, err, "applying pack '%s'", spec.Name)
@@ -25,11 +35,78 @@ func (ds *Datastore) ApplyPackSpecs(ctx context.Context, specs []*fleet.PackSpec
 	return err
 }
 
-func applyPackSpecDB(ctx context.Context, tx sqlx.ExtContext, spec *fleet.PackSpec) error {
-	if spec.Name == "" {
-		return ctxerr.New(ctx, "pack name must not be empty")
+// validatePackSpecsDB checks all the provided specs before any of them is applied, and returns a
+// *fleet.InvalidArgumentError listing every problem found (missing pack and query names, and unknown queries). The
+// queries defined in the specs' query specs are known.
+func validatePackSpecsDB(ctx context.Context, tx sqlx.ExtContext, specs []*fleet.PackSpec) error {
+	var queryNames []string
+	existing := make(map[string]bool)
+	for _, spec := range specs {
+		for _, q := range spec.Queries {
+			queryNames = append(queryNames, q.QueryName)
+		}
+		for _, q := range spec.QuerySpecs {
+			if q.Name != "" {
+				existing[q.Name] = true
+			}
+		}
 	}
 
+	if len(queryNames) > 0 {
+		stmt, args, err := sqlx.In(`SELECT name FROM queries WHERE name IN (?)`, queryNames)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "building query names statement")
+		}
+		var names []string
+		if err := sqlx.SelectContext(ctx, tx, &names, stmt, args...); err != nil {
+			return ctxerr.Wrap(ctx, err, "select query names")
+		}
+		for _, name := range names {
+			existing[name] = true
+		}
+	}
+
+	invalid := &fleet.InvalidArgumentError{}
+	for i, spec := range specs {
+		if spec.Name == "" {
+			invalid.Append(fmt.Sprintf("specs[%d].name", i), "pack name must not be empty")
+		}
+		for j, q := range spec.QuerySpecs {
+			if q.Name == "" {
+				invalid.Append(fmt.Sprintf("specs[%d].query_specs[%d].name", i, j), "query name must not be empty")
+			}
+		}
+		for j, q := range spec.Queries {
+			if !existing[q.QueryName] {
+				invalid.Appendf(fmt.Sprintf("specs[%d].queries[%d].query", i, j), "cannot schedule unknown query '%s'", q.QueryName)
+			}
+		}
+	}
+	if invalid.HasErrors() {
+		return ctxerr.Wrap(ctx, invalid, "validate pack specs")
+	}
+	return nil
+}
+
+// applyPackQuerySpecsDB creates the queries defined in the query specs, or updates them if they already exist.
+func applyPackQuerySpecsDB(ctx context.Context, tx sqlx.ExtContext, specs []fleet.QuerySpec) error {
+	query := `
+		INSERT INTO queries (name, description, query, saved)
+		VALUES (?, ?, ?, true)
+		ON DUPLICATE KEY UPDATE
+			description = VALUES(description),
+			query = VALUES(query),
+			saved = VALUES(saved)
+	`
+	for _, q := range specs {
+		if _, err := tx.ExecContext(ctx, query, q.Name, q.Description, q.Query); err != nil {
+			return ctxerr.Wrapf(ctx, err, "insert/update query %s", q.Name)
+		}
+	}
+	return nil
+}
+
+func applyPackSpecDB(ctx context.Context, tx sqlx.ExtContext, spec *fleet.PackSpec) error {
 	// Insert/update pack
 	query := `
 		INSERT INTO packs (name, description, platform, disabled)
@@ -184,45 +261,91 @@ func (ds *Datastore) GetPackSpec(ctx context.Context, name string) (*fleet.PackS
 			return ctxerr.Wrap(ctx, err, "get packs")
 		}
 
-		// Load label targets
-		query = `
+		return loadPackSpecDB(ctx, tx, spec)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return spec, nil
+}
+
+func (ds *Datastore) ExportPackSpec(ctx context.Context, packID uint) (*fleet.PackSpec, error) {
+	spec := &fleet.PackSpec{}
+	err := ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
+		query := "SELECT id, name, description, platform, disabled FROM packs WHERE id = ?"
+		if err := sqlx.GetContext(ctx, tx, spec, query, packID); err != nil {
+			if err == sql.ErrNoRows {
+				return ctxerr.Wrap(ctx, notFound("Pack").WithID(packID))
+			}
+			return ctxerr.Wrap(ctx, err, "get pack")
+		}
+
+		if err := loadPackSpecDB(ctx, tx, spec); err != nil {
+			return err
+		}
+
+		spec.QuerySpecs = nil
+		if len(spec.Queries) == 0 {
+			return nil
+		}
+		var names []string
+		for _, q := range spec.Queries {
+			names = append(names, q.QueryName)
+		}
+		query, args, err := sqlx.In(`SELECT DISTINCT name, description, query FROM queries WHERE name IN (?) ORDER BY name`, names)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "build pack queries statement")
+		}
+		if err := sqlx.SelectContext(ctx, tx, &spec.QuerySpecs, query, args...); err != nil {
+			return ctxerr.Wrap(ctx, err, "get pack query specs")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the ID is specific to this instance
+	spec.ID = 0
+	return spec, nil
+}
+
+// loadPackSpecDB loads the targets and the scheduled queries of the pack spec, whose ID must be set.
+func loadPackSpecDB(ctx context.Context, tx sqlx.QueryerContext, spec *fleet.PackSpec) error {
+	// Load label targets
+	query := `
 SELECT l.name
 FROM labels l JOIN pack_targets pt
 WHERE pack_id = ? AND pt.type = ? AND pt.target_id = l.id
 `
-		if err := sqlx.SelectContext(ctx, tx, &spec.Targets.Labels, query, spec.ID, fleet.TargetLabel); err != nil {
-			return ctxerr.Wrap(ctx, err, "get pack label targets")
-		}
+	if err := sqlx.SelectContext(ctx, tx, &spec.Targets.Labels, query, spec.ID, fleet.TargetLabel); err != nil {
+		return ctxerr.Wrap(ctx, err, "get pack label targets")
+	}
 
-		// Load team targets
-		query = `
+	// Load team targets
+	query = `
 SELECT t.name
 FROM teams t JOIN pack_targets pt
 WHERE pack_id = ? AND pt.type = ? AND pt.target_id = t.id
 `
-		if err := sqlx.SelectContext(ctx, tx, &spec.Targets.Teams, query, spec.ID, fleet.TargetTeam); err != nil {
-			return ctxerr.Wrap(ctx, err, "get pack team targets")
-		}
+	if err := sqlx.SelectContext(ctx, tx, &spec.Targets.Teams, query, spec.ID, fleet.TargetTeam); err != nil {
+		return ctxerr.Wrap(ctx, err, "get pack team targets")
+	}
 
-		// Load queries
-		query = `
+	// Load queries
+	query = `
 SELECT
 query_name, name, description, ` + "`interval`" + `,
 snapshot, removed, shard, platform, version, denylist
 FROM scheduled_queries
 WHERE pack_id = ?
 `
-		if err := sqlx.SelectContext(ctx, tx, &spec.Queries, query, spec.ID); err != nil {
-			return ctxerr.Wrap(ctx, err, "get pack queries")
-		}
-
-		return nil
-	})
-	if err != nil {
-		return nil, err
+	if err := sqlx.SelectContext(ctx, tx, &spec.Queries, query, spec.ID); err != nil {
+		return ctxerr.Wrap(ctx, err, "get pack queries")
 	}
 
-	return spec, nil
+	return nil
 }
 
 func (ds *Datastore) PackByName(ctx context.Context, name string, opts ...fleet.OptionalArg) (*fleet.Pack, bool, error) {
@@ -564,10 +687,212 @@ func (ds *Datastore) ListPacks(ctx context.Context, opt fleet.PackListOptions) (
 	return packs, nil
 }
 
+func (ds *Datastore) ListPacksWithoutTargets(ctx context.Context) ([]fleet.Pack, error) {
+	query := `
+		SELECT p.* FROM packs p
+		WHERE (p.pack_type IS NULL OR p.pack_type = '')
+		AND NOT EXISTS (
+			SELECT 1 FROM pack_targets pt
+			JOIN label_membership lm ON lm.label_id = pt.target_id
+			WHERE pt.pack_id = p.id AND pt.type = ?
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM pack_targets pt
+			JOIN hosts h ON h.id = pt.target_id
+			WHERE pt.pack_id = p.id AND pt.type = ?
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM pack_targets pt
+			JOIN hosts h ON h.team_id = pt.target_id
+			WHERE pt.pack_id = p.id AND pt.type = ?
+		)
+		ORDER BY p.id
+	`
+	var packs []fleet.Pack
+	if err := sqlx.SelectContext(ctx, ds.reader, &packs, query, fleet.TargetLabel, fleet.TargetHost, fleet.TargetTeam); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "listing packs without targets")
+	}
+
+	for i := range packs {
+		if err := loadPackTargetsDB(ctx, ds.reader, &packs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return packs, nil
+}
+
+func (ds *Datastore) PacksByLabel(ctx context.Context, labelID uint) ([]fleet.Pack, error) {
+	query := `
+		SELECT p.* FROM packs p
+		WHERE EXISTS (
+			SELECT 1 FROM pack_targets pt
+			WHERE pt.pack_id = p.id AND pt.type = ? AND pt.target_id = ?
+		)
+		ORDER BY p.id
+	`
+	var packs []fleet.Pack
+	if err := sqlx.SelectContext(ctx, ds.reader, &packs, query, fleet.TargetLabel, labelID); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "listing packs by label")
+	}
+
+	for i := range packs {
+		if err := loadPackTargetsDB(ctx, ds.reader, &packs[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	return packs, nil
+}
+
+func (ds *Datastore) AuditPackQueryReferences(ctx context.Context) ([]fleet.PackQueryReference, error) {
+	query := `
+		SELECT
+			p.id AS pack_id,
+			p.name AS pack_name,
+			sq.id AS scheduled_query_id,
+			sq.name AS scheduled_query_name,
+			sq.query_id,
+			sq.query_name
+		FROM scheduled_queries sq
+		JOIN packs p ON p.id = sq.pack_id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM queries q WHERE q.name = sq.query_name
+		)
+		OR (sq.query_id IS NOT NULL AND NOT EXISTS (
+			SELECT 1 FROM queries q WHERE q.id = sq.query_id
+		))
+		ORDER BY p.id, sq.id
+	`
+	var refs []fleet.PackQueryReference
+	if err := sqlx.SelectContext(ctx, ds.reader, &refs, query); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "auditing pack query references")
+	}
+	return refs, nil
+}
+
 func (ds *Datastore) ListPacksForHost(ctx context.Context, hid uint) ([]*fleet.Pack, error) {
 	return listPacksForHost(ctx, ds.reader, hid)
 }
 
+// hostTargetedByPackCondition returns the condition for the host h to be targeted by the pack, directly or via a
+// label or team, and its arguments.
+func hostTargetedByPackCondition(pid uint) (string, []interface{}) {
+	cond := `(
+			EXISTS (
+				SELECT 1 FROM pack_targets pt
+				JOIN label_membership lm ON lm.label_id = pt.target_id
+				WHERE pt.pack_id = ? AND pt.type = ? AND lm.host_id = h.id
+			)
+			OR EXISTS (SELECT 1 FROM pack_targets pt WHERE pt.pack_id = ? AND pt.type = ? AND pt.target_id = h.id)
+			OR EXISTS (SELECT 1 FROM pack_targets pt WHERE pt.pack_id = ? AND pt.type = ? AND pt.target_id = h.team_id)
+		)`
+	return cond, []interface{}{pid, fleet.TargetLabel, pid, fleet.TargetHost, pid, fleet.TargetTeam}
+}
+
+func (ds *Datastore) ListHostsInPack(ctx context.Context, pid uint, opt fleet.ListOptions) ([]*fleet.HostShort, int, error) {
+	targetedCond, whereArgs := hostTargetedByPackCondition(pid)
+	whereSQL := ` WHERE ` + targetedCond + ` `
+	whereSQL, whereArgs = hostSearchLike(whereSQL, whereArgs, opt.MatchQuery, hostSearchColumns...)
+
+	var count int
+	if err := sqlx.GetContext(ctx, ds.reader, &count, `SELECT COUNT(*) FROM hosts h `+whereSQL, whereArgs...); err != nil {
+		return nil, 0, ctxerr.Wrap(ctx, err, "count hosts in pack")
+	}
+
+	if opt.OrderKey == "" {
+		opt.OrderKey = "h.id"
+	}
+	opt.OrderKey = defaultHostColumnTableAlias(opt.OrderKey)
+	stmt, args := appendListOptionsWithCursorToSQL(`
+		SELECT
+			h.id,
+			h.hostname,
+			IF(h.computer_name = '', h.hostname, h.computer_name) AS display_name
+		FROM hosts h `+whereSQL, whereArgs, &opt)
+
+	hosts := []*fleet.HostShort{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, stmt, args...); err != nil {
+		return nil, 0, ctxerr.Wrap(ctx, err, "list hosts in pack")
+	}
+	return hosts, count, nil
+}
+
+func (ds *Datastore) ResolvePackTargets(ctx context.Context, packID uint) ([]uint, error) {
+	var exists bool
+	if err := sqlx.GetContext(ctx, ds.reader, &exists, `SELECT EXISTS (SELECT 1 FROM packs WHERE id = ?)`, packID); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "check pack exists")
+	}
+	if !exists {
+		return nil, ctxerr.Wrap(ctx, notFound("Pack").WithID(packID))
+	}
+
+	// UNION removes the hosts targeted more than once
+	stmt := `
+		SELECT lm.host_id FROM pack_targets pt
+		JOIN label_membership lm ON lm.label_id = pt.target_id
+		WHERE pt.pack_id = ? AND pt.type = ?
+		UNION
+		SELECT h.id FROM pack_targets pt
+		JOIN hosts h ON h.id = pt.target_id
+		WHERE pt.pack_id = ? AND pt.type = ?
+		UNION
+		SELECT h.id FROM pack_targets pt
+		JOIN hosts h ON h.team_id = pt.target_id
+		WHERE pt.pack_id = ? AND pt.type = ?
+		ORDER BY host_id
+	`
+	hostIDs := []uint{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &hostIDs, stmt,
+		packID, fleet.TargetLabel, packID, fleet.TargetHost, packID, fleet.TargetTeam,
+	); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "resolve pack targets")
+	}
+	return hostIDs, nil
+}
+
+func (ds *Datastore) HostsMissingPack(ctx context.Context, labelID, packID uint, opts fleet.ListOptions) ([]fleet.Host, error) {
+	if _, err := ds.Pack(ctx, packID); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "get pack")
+	}
+	if _, err := ds.Label(ctx, labelID); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "get label")
+	}
+
+	targetedCond, targetedArgs := hostTargetedByPackCondition(packID)
+	stmt := `
+		SELECT
+			h.id,
+			h.osquery_host_id,
+			h.created_at,
+			h.updated_at,
+			h.hostname,
+			h.uuid,
+			h.platform,
+			h.hardware_serial,
+			h.computer_name,
+			h.team_id,
+			h.last_enrolled_at,
+			COALESCE(hst.seen_time, h.created_at) AS seen_time
+		FROM hosts h
+		JOIN label_membership lm ON lm.host_id = h.id AND lm.label_id = ?
+		LEFT JOIN host_seen_times hst ON hst.host_id = h.id
+		WHERE NOT ` + targetedCond
+	args := append([]interface{}{labelID}, targetedArgs...)
+
+	if opts.OrderKey == "" {
+		opts.OrderKey = "id"
+	}
+	opts.OrderKey = defaultHostColumnTableAlias(opts.OrderKey)
+	stmt = appendListOptionsToSQL(stmt, &opts)
+
+	hosts := []fleet.Host{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, stmt, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list hosts missing pack")
+	}
+	return hosts, nil
+}
+
 // listPacksForHost returns all the packs that are configured to run on the given host.
 func listPacksForHost(ctx context.Context, db sqlx.QueryerContext, hid uint) ([]*fleet.Pack, error) {
 	query := `
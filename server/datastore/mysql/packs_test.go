@@ -11,6 +11,7 @@ import (
 	"github.com/fleetdm/fleet/v4/server/fleet"
 	"github.com/fleetdm/fleet/v4/server/ptr"
 	"github.com/fleetdm/fleet/v4/server/test"
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -28,9 +29,17 @@ func TestPacks(t *testing.T) {
 		{"List", testPacksList},
 		{"ApplySpecRoundtrip", testPacksApplySpecRoundtrip},
 		{"GetSpec", testPacksGetSpec},
+		{"ExportSpec", testPacksExportSpec},
 		{"ApplySpecMissingQueries", testPacksApplySpecMissingQueries},
 		{"ApplySpecMissingName", testPacksApplySpecMissingName},
+		{"ApplySpecMultipleProblems", testPacksApplySpecMultipleProblems},
 		{"ListForHost", testPacksListForHost},
+		{"ListHostsInPack", testPacksListHostsInPack},
+		{"ResolvePackTargets", testPacksResolvePackTargets},
+		{"HostsMissingPack", testPacksHostsMissingPack},
+		{"ListWithoutTargets", testPacksListWithoutTargets},
+		{"PacksByLabel", testPacksPacksByLabel},
+		{"AuditPackQueryReferences", testPacksAuditPackQueryReferences},
 		{"EnsureGlobal", testPacksEnsureGlobal},
 		{"EnsureTeam", testPacksEnsureTeam},
 		{"TeamNameChangesTeamSchedule", testPacksTeamNameChangesTeamSchedule},
@@ -285,6 +294,52 @@ func testPacksGetSpec(t *testing.T, ds *Datastore) {
 	}
 }
 
+func testPacksExportSpec(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	expectedSpecs := setupPackSpecsTest(t, ds)
+	expected := expectedSpecs[0]
+
+	exported, err := ds.ExportPackSpec(ctx, expected.ID)
+	require.NoError(t, err)
+	require.Zero(t, exported.ID)
+	assert.Equal(t, expected.Name, exported.Name)
+	assert.Equal(t, expected.Targets, exported.Targets)
+	assert.Equal(t, expected.Queries, exported.Queries)
+	assert.Equal(t, []fleet.QuerySpec{
+		{Name: "bar", Description: "do some bars", Query: "select baz from bar"},
+		{Name: "foo", Description: "get the foos", Query: "select * from foo"},
+	}, exported.QuerySpecs)
+
+	// simulate another instance by removing the pack and its queries
+	require.NoError(t, ds.DeletePack(ctx, expected.Name))
+	require.NoError(t, ds.DeletePack(ctx, expectedSpecs[1].Name))
+	require.NoError(t, ds.DeleteQuery(ctx, "foo"))
+	require.NoError(t, ds.DeleteQuery(ctx, "bar"))
+
+	require.NoError(t, ds.ApplyPackSpecs(ctx, []*fleet.PackSpec{exported}))
+
+	applied, err := ds.GetPackSpec(ctx, expected.Name)
+	require.NoError(t, err)
+	assert.Equal(t, expected.Targets, applied.Targets)
+	assert.Equal(t, expected.Queries, applied.Queries)
+
+	for _, qs := range exported.QuerySpecs {
+		q, err := ds.QueryByName(ctx, qs.Name)
+		require.NoError(t, err)
+		assert.Equal(t, qs.Description, q.Description)
+		assert.Equal(t, qs.Query, q.Query)
+		assert.True(t, q.Saved)
+	}
+
+	// exporting again returns the same spec
+	reexported, err := ds.ExportPackSpec(ctx, applied.ID)
+	require.NoError(t, err)
+	assert.Equal(t, exported, reexported)
+
+	_, err = ds.ExportPackSpec(ctx, applied.ID+1000)
+	require.True(t, fleet.IsNotFound(err))
+}
+
 func testPacksApplySpecMissingQueries(t *testing.T, ds *Datastore) {
 	// Do not define queries mentioned in spec
 	specs := []*fleet.PackSpec{
@@ -336,6 +391,41 @@ func testPacksApplySpecMissingName(t *testing.T, ds *Datastore) {
 	assert.Equal(t, "foo", spec.Queries[0].Name)
 }
 
+func testPacksApplySpecMultipleProblems(t *testing.T, ds *Datastore) {
+	setupPackSpecsTest(t, ds)
+
+	specs := []*fleet.PackSpec{
+		{
+			Name: "",
+			Queries: []fleet.PackSpecQuery{
+				{QueryName: "foo", Interval: 600},
+				{QueryName: "missing1", Interval: 600},
+			},
+		},
+		{
+			Name: "valid_pack",
+			Queries: []fleet.PackSpecQuery{
+				{QueryName: "bar", Interval: 600},
+				{QueryName: "missing2", Interval: 600},
+			},
+		},
+	}
+
+	err := ds.ApplyPackSpecs(context.Background(), specs)
+	require.Error(t, err)
+	var invalid *fleet.InvalidArgumentError
+	require.ErrorAs(t, err, &invalid)
+	require.Equal(t, []map[string]string{
+		{"name": "specs[0].name", "reason": "pack name must not be empty"},
+		{"name": "specs[0].queries[1].query", "reason": "cannot schedule unknown query 'missing1'"},
+		{"name": "specs[1].queries[1].query", "reason": "cannot schedule unknown query 'missing2'"},
+	}, invalid.Invalid())
+
+	// nothing was applied
+	_, err = ds.GetPackSpec(context.Background(), "valid_pack")
+	require.True(t, fleet.IsNotFound(err))
+}
+
 func testPacksListForHost(t *testing.T, ds *Datastore) {
 	mockClock := clock.NewMockClock()
 
@@ -420,6 +510,120 @@ func testPacksListForHost(t *testing.T, ds *Datastore) {
 	}
 }
 
+func testPacksPacksByLabel(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	host := test.NewHost(t, ds, "host.local", "", "host", "host", time.Now())
+
+	l1, err := ds.NewLabel(ctx, &fleet.Label{Name: "l1", Query: "select 1"})
+	require.NoError(t, err)
+	l2, err := ds.NewLabel(ctx, &fleet.Label{Name: "l2", Query: "select 1"})
+	require.NoError(t, err)
+	l3, err := ds.NewLabel(ctx, &fleet.Label{Name: "l3", Query: "select 1"})
+	require.NoError(t, err)
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, host, map[uint]*bool{l1.ID: ptr.Bool(true)}, time.Now(), false))
+
+	p1, err := ds.NewPack(ctx, &fleet.Pack{Name: "p1", LabelIDs: []uint{l1.ID}})
+	require.NoError(t, err)
+	p2, err := ds.NewPack(ctx, &fleet.Pack{Name: "p2", LabelIDs: []uint{l1.ID, l2.ID}})
+	require.NoError(t, err)
+	_, err = ds.NewPack(ctx, &fleet.Pack{Name: "p3", LabelIDs: []uint{l2.ID}})
+	require.NoError(t, err)
+	// targets a host of l1, but not l1 itself
+	_, err = ds.NewPack(ctx, &fleet.Pack{Name: "p4", HostIDs: []uint{host.ID}})
+	require.NoError(t, err)
+
+	packNames := func(labelID uint) []string {
+		packs, err := ds.PacksByLabel(ctx, labelID)
+		require.NoError(t, err)
+		names := make([]string, 0, len(packs))
+		for _, p := range packs {
+			names = append(names, p.Name)
+		}
+		return names
+	}
+
+	require.Equal(t, []string{"p1", "p2"}, packNames(l1.ID))
+	require.Equal(t, []string{"p2", "p3"}, packNames(l2.ID))
+	require.Empty(t, packNames(l3.ID))
+	require.Empty(t, packNames(l3.ID+100))
+
+	// the targets of the packs are loaded
+	packs, err := ds.PacksByLabel(ctx, l1.ID)
+	require.NoError(t, err)
+	require.Equal(t, p1.ID, packs[0].ID)
+	require.Equal(t, []uint{l1.ID}, packs[0].LabelIDs)
+	require.Equal(t, p2.ID, packs[1].ID)
+	require.ElementsMatch(t, []uint{l1.ID, l2.ID}, packs[1].LabelIDs)
+
+	// a pack no longer targeting the label isn't listed
+	p1.LabelIDs = []uint{l3.ID}
+	require.NoError(t, ds.SavePack(ctx, p1))
+	require.Equal(t, []string{"p2"}, packNames(l1.ID))
+	require.Equal(t, []string{"p1"}, packNames(l3.ID))
+}
+
+func testPacksAuditPackQueryReferences(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	q1 := test.NewQuery(t, ds, "q1", "select 1", 0, true)
+	q2 := test.NewQuery(t, ds, "q2", "select 2", 0, true)
+	q3 := test.NewQuery(t, ds, "q3", "select 3", 0, true)
+	p1 := test.NewPack(t, ds, "p1")
+	p2 := test.NewPack(t, ds, "p2")
+	test.NewScheduledQuery(t, ds, p1.ID, q1.ID, 60, false, false, "sq1")
+	sq2 := test.NewScheduledQuery(t, ds, p1.ID, q2.ID, 60, false, false, "sq2")
+	sq3 := test.NewScheduledQuery(t, ds, p2.ID, q3.ID, 60, false, false, "sq3")
+
+	refs, err := ds.AuditPackQueryReferences(ctx)
+	require.NoError(t, err)
+	require.Empty(t, refs)
+
+	// deleting a query deletes its scheduled queries
+	require.NoError(t, ds.DeleteQuery(ctx, q1.Name))
+	refs, err = ds.AuditPackQueryReferences(ctx)
+	require.NoError(t, err)
+	require.Empty(t, refs)
+
+	// a query deleted without the foreign key checks leaves its scheduled query dangling
+	require.NoError(t, ds.withTx(ctx, func(tx sqlx.ExtContext) error {
+		if _, err := tx.ExecContext(ctx, `SET FOREIGN_KEY_CHECKS=0`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM queries WHERE id = ?`, q2.ID); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, `SET FOREIGN_KEY_CHECKS=1`)
+		return err
+	}))
+	// and the query ID of a scheduled query isn't constrained
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `UPDATE scheduled_queries SET query_id = ? WHERE id = ?`, q3.ID+100, sq3.ID)
+		return err
+	})
+
+	refs, err = ds.AuditPackQueryReferences(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []fleet.PackQueryReference{
+		{
+			PackID:             p1.ID,
+			PackName:           "p1",
+			ScheduledQueryID:   sq2.ID,
+			ScheduledQueryName: "sq2",
+			QueryID:            &q2.ID,
+			QueryName:          "q2",
+		},
+		{
+			PackID:             p2.ID,
+			PackName:           "p2",
+			ScheduledQueryID:   sq3.ID,
+			ScheduledQueryName: "sq3",
+			QueryID:            ptr.Uint(q3.ID + 100),
+			QueryName:          "q3",
+		},
+	}, refs)
+}
+
 func testPacksEnsureGlobal(t *testing.T, ds *Datastore) {
 	test.AddAllHostsLabel(t, ds)
 
@@ -683,3 +887,252 @@ func testPacksApplyStatsNotLockingTryTwo(t *testing.T, ds *Datastore) {
 
 	cancelFunc()
 }
+
+func testPacksListHostsInPack(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	now := time.Now()
+
+	hosts := make([]*fleet.Host, 6)
+	for i := range hosts {
+		name := fmt.Sprintf("host%d.local", i)
+		hosts[i] = test.NewHost(t, ds, name, "", name, name, now)
+	}
+
+	label, err := ds.NewLabel(ctx, &fleet.Label{Name: "label", Query: "select 1"})
+	require.NoError(t, err)
+	team, err := ds.NewTeam(ctx, &fleet.Team{Name: "team"})
+	require.NoError(t, err)
+
+	// host0 and host1 are in the label, host1 and host2 are in the team, host3 is targeted directly, host4 and
+	// host5 are not targeted.
+	for _, h := range hosts[:2] {
+		require.NoError(t, ds.RecordLabelQueryExecutions(ctx, h, map[uint]*bool{label.ID: ptr.Bool(true)}, now, false))
+	}
+	require.NoError(t, ds.AddHostsToTeam(ctx, &team.ID, []uint{hosts[1].ID, hosts[2].ID}))
+
+	pack, err := ds.NewPack(ctx, &fleet.Pack{
+		Name:     "pack",
+		LabelIDs: []uint{label.ID},
+		TeamIDs:  []uint{team.ID},
+		HostIDs:  []uint{hosts[3].ID},
+	})
+	require.NoError(t, err)
+
+	hostIDs := func(hosts []*fleet.HostShort) []uint {
+		ids := make([]uint, 0, len(hosts))
+		for _, h := range hosts {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	page, count, err := ds.ListHostsInPack(ctx, pack.ID, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+	require.Equal(t, []uint{hosts[0].ID, hosts[1].ID, hosts[2].ID, hosts[3].ID}, hostIDs(page))
+	require.Equal(t, "host0.local", page[0].Hostname)
+
+	// the pages add up to the total
+	var all []uint
+	for p := uint(0); p < 3; p++ {
+		page, count, err = ds.ListHostsInPack(ctx, pack.ID, fleet.ListOptions{Page: p, PerPage: 3})
+		require.NoError(t, err)
+		require.Equal(t, 4, count)
+		all = append(all, hostIDs(page)...)
+	}
+	require.Equal(t, []uint{hosts[0].ID, hosts[1].ID, hosts[2].ID, hosts[3].ID}, all)
+
+	// the count respects the filter
+	page, count, err = ds.ListHostsInPack(ctx, pack.ID, fleet.ListOptions{MatchQuery: "host2", PerPage: 1})
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.Equal(t, []uint{hosts[2].ID}, hostIDs(page))
+
+	page, count, err = ds.ListHostsInPack(ctx, pack.ID, fleet.ListOptions{MatchQuery: "host5"})
+	require.NoError(t, err)
+	require.Zero(t, count)
+	require.Empty(t, page)
+
+	// a pack without targets
+	emptyPack, err := ds.NewPack(ctx, &fleet.Pack{Name: "empty"})
+	require.NoError(t, err)
+	page, count, err = ds.ListHostsInPack(ctx, emptyPack.ID, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Zero(t, count)
+	require.Empty(t, page)
+}
+
+func testPacksResolvePackTargets(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	now := time.Now()
+
+	hosts := make([]*fleet.Host, 5)
+	for i := range hosts {
+		name := fmt.Sprintf("host%d.local", i)
+		hosts[i] = test.NewHost(t, ds, name, "", name, name, now)
+	}
+
+	label1, err := ds.NewLabel(ctx, &fleet.Label{Name: "label1", Query: "select 1"})
+	require.NoError(t, err)
+	label2, err := ds.NewLabel(ctx, &fleet.Label{Name: "label2", Query: "select 1"})
+	require.NoError(t, err)
+
+	// host0 and host1 are in label1, host1 and host2 are in label2, host2 and host3 are also targeted directly,
+	// host4 is not targeted.
+	for _, h := range hosts[:2] {
+		require.NoError(t, ds.RecordLabelQueryExecutions(ctx, h, map[uint]*bool{label1.ID: ptr.Bool(true)}, now, false))
+	}
+	for _, h := range hosts[1:3] {
+		require.NoError(t, ds.RecordLabelQueryExecutions(ctx, h, map[uint]*bool{label2.ID: ptr.Bool(true)}, now, false))
+	}
+
+	pack, err := ds.NewPack(ctx, &fleet.Pack{
+		Name:     "pack",
+		LabelIDs: []uint{label1.ID, label2.ID},
+		HostIDs:  []uint{hosts[2].ID, hosts[3].ID},
+	})
+	require.NoError(t, err)
+
+	hostIDs, err := ds.ResolvePackTargets(ctx, pack.ID)
+	require.NoError(t, err)
+	require.Equal(t, []uint{hosts[0].ID, hosts[1].ID, hosts[2].ID, hosts[3].ID}, hostIDs)
+
+	// team targets are expanded too
+	team, err := ds.NewTeam(ctx, &fleet.Team{Name: "team"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AddHostsToTeam(ctx, &team.ID, []uint{hosts[3].ID, hosts[4].ID}))
+	teamPack, err := ds.NewPack(ctx, &fleet.Pack{Name: "team", TeamIDs: []uint{team.ID}})
+	require.NoError(t, err)
+	hostIDs, err = ds.ResolvePackTargets(ctx, teamPack.ID)
+	require.NoError(t, err)
+	require.Equal(t, []uint{hosts[3].ID, hosts[4].ID}, hostIDs)
+
+	// a pack without targets
+	emptyPack, err := ds.NewPack(ctx, &fleet.Pack{Name: "empty"})
+	require.NoError(t, err)
+	hostIDs, err = ds.ResolvePackTargets(ctx, emptyPack.ID)
+	require.NoError(t, err)
+	require.Empty(t, hostIDs)
+
+	_, err = ds.ResolvePackTargets(ctx, 999)
+	require.True(t, fleet.IsNotFound(err))
+}
+
+func testPacksHostsMissingPack(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	now := time.Now()
+
+	hosts := make([]*fleet.Host, 6)
+	for i := range hosts {
+		name := fmt.Sprintf("host%d.local", i)
+		hosts[i] = test.NewHost(t, ds, name, "", name, name, now)
+	}
+
+	production, err := ds.NewLabel(ctx, &fleet.Label{Name: "production", Query: "select 1"})
+	require.NoError(t, err)
+	linux, err := ds.NewLabel(ctx, &fleet.Label{Name: "linux", Query: "select 2"})
+	require.NoError(t, err)
+	team, err := ds.NewTeam(ctx, &fleet.Team{Name: "team"})
+	require.NoError(t, err)
+
+	// host0 to host4 are in production, host5 is not. The pack reaches host0 via the linux label, host1 directly and
+	// host2 via its team; host3, host4 and host5 are not targeted.
+	for _, h := range hosts[:5] {
+		require.NoError(t, ds.RecordLabelQueryExecutions(ctx, h, map[uint]*bool{production.ID: ptr.Bool(true)}, now, false))
+	}
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, hosts[0], map[uint]*bool{linux.ID: ptr.Bool(true)}, now, false))
+	require.NoError(t, ds.AddHostsToTeam(ctx, &team.ID, []uint{hosts[2].ID}))
+
+	pack, err := ds.NewPack(ctx, &fleet.Pack{
+		Name:     "required",
+		LabelIDs: []uint{linux.ID},
+		TeamIDs:  []uint{team.ID},
+		HostIDs:  []uint{hosts[1].ID},
+	})
+	require.NoError(t, err)
+
+	hostIDs := func(hosts []fleet.Host) []uint {
+		ids := make([]uint, 0, len(hosts))
+		for _, h := range hosts {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	missing, err := ds.HostsMissingPack(ctx, production.ID, pack.ID, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uint{hosts[3].ID, hosts[4].ID}, hostIDs(missing))
+	require.Equal(t, "host3.local", missing[0].Hostname)
+
+	missing, err = ds.HostsMissingPack(ctx, production.ID, pack.ID, fleet.ListOptions{
+		OrderKey:       "hostname",
+		OrderDirection: fleet.OrderDescending,
+		PerPage:        1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []uint{hosts[4].ID}, hostIDs(missing))
+
+	// all the hosts of the label are covered once the pack targets it
+	pack.LabelIDs = append(pack.LabelIDs, production.ID)
+	require.NoError(t, ds.SavePack(ctx, pack))
+	missing, err = ds.HostsMissingPack(ctx, production.ID, pack.ID, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, missing)
+
+	_, err = ds.HostsMissingPack(ctx, production.ID, 999, fleet.ListOptions{})
+	require.True(t, fleet.IsNotFound(err))
+	_, err = ds.HostsMissingPack(ctx, 999, pack.ID, fleet.ListOptions{})
+	require.True(t, fleet.IsNotFound(err))
+}
+
+func testPacksListWithoutTargets(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	now := time.Now()
+
+	host := test.NewHost(t, ds, "host.local", "", "host", "host", now)
+
+	emptyLabel, err := ds.NewLabel(ctx, &fleet.Label{Name: "empty", Query: "select 1"})
+	require.NoError(t, err)
+	label, err := ds.NewLabel(ctx, &fleet.Label{Name: "populated", Query: "select 1"})
+	require.NoError(t, err)
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, host, map[uint]*bool{label.ID: ptr.Bool(true)}, now, false))
+
+	emptyPack, err := ds.NewPack(ctx, &fleet.Pack{Name: "empty", LabelIDs: []uint{emptyLabel.ID}})
+	require.NoError(t, err)
+	_, err = ds.NewPack(ctx, &fleet.Pack{Name: "populated", LabelIDs: []uint{label.ID}})
+	require.NoError(t, err)
+
+	// system packs are never listed
+	_, err = ds.EnsureGlobalPack(ctx)
+	require.NoError(t, err)
+
+	packs, err := ds.ListPacksWithoutTargets(ctx)
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+	require.Equal(t, emptyPack.ID, packs[0].ID)
+	require.Equal(t, []uint{emptyLabel.ID}, packs[0].LabelIDs)
+
+	// once the label has a member, the pack targets a host
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, host, map[uint]*bool{emptyLabel.ID: ptr.Bool(true)}, now, false))
+	packs, err = ds.ListPacksWithoutTargets(ctx)
+	require.NoError(t, err)
+	require.Empty(t, packs)
+
+	// packs targeting a host directly or a team with hosts are not listed, but a team without hosts is
+	team, err := ds.NewTeam(ctx, &fleet.Team{Name: "team"})
+	require.NoError(t, err)
+	_, err = ds.NewPack(ctx, &fleet.Pack{Name: "host", HostIDs: []uint{host.ID}})
+	require.NoError(t, err)
+	teamPack, err := ds.NewPack(ctx, &fleet.Pack{Name: "team", TeamIDs: []uint{team.ID}})
+	require.NoError(t, err)
+
+	packs, err = ds.ListPacksWithoutTargets(ctx)
+	require.NoError(t, err)
+	require.Len(t, packs, 1)
+	require.Equal(t, teamPack.ID, packs[0].ID)
+
+	require.NoError(t, ds.AddHostsToTeam(ctx, &team.ID, []uint{host.ID}))
+	packs, err = ds.ListPacksWithoutTargets(ctx)
+	require.NoError(t, err)
+	require.Empty(t, packs)
+}
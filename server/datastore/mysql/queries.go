@@ -4,9 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 
 	"github.com/fleetdm/fleet/v4/server/contexts/ctxerr"
 	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/fleetdm/fleet/v4/server/osquerysql"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -90,6 +92,10 @@ func (ds *Datastore) QueryByName(ctx context.Context, name string, opts ...fleet
 
 // NewQuery creates a New Query.
 func (ds *Datastore) NewQuery(ctx context.Context, query *fleet.Query, opts ...fleet.OptionalArg) (*fleet.Query, error) {
+	if err := validateQuerySQL(ctx, query.Query, opts); err != nil {
+		return nil, err
+	}
+
 	sqlStatement := `
 		INSERT INTO queries (
 			name,
@@ -115,7 +121,11 @@ func (ds *Datastore) NewQuery(ctx context.Context, query *fleet.Query, opts ...f
 }
 
 // SaveQuery saves changes to a Query.
-func (ds *Datastore) SaveQuery(ctx context.Context, q *fleet.Query) error {
+func (ds *Datastore) SaveQuery(ctx context.Context, q *fleet.Query, opts ...fleet.OptionalArg) error {
+	if err := validateQuerySQL(ctx, q.Query, opts); err != nil {
+		return err
+	}
+
 	sql := `
 		UPDATE queries
 			SET name = ?, description = ?, query = ?, author_id = ?, saved = ?, observer_can_run = ?
@@ -136,15 +146,97 @@ func (ds *Datastore) SaveQuery(ctx context.Context, q *fleet.Query) error {
 	return nil
 }
 
+// validateQuerySQL checks that the query is valid osquery SQL if the validation was requested with
+// fleet.WithQuerySQLValidation.
+func validateQuerySQL(ctx context.Context, query string, opts []fleet.OptionalArg) error {
+	for _, opt := range opts {
+		if _, ok := opt().(fleet.ValidateQuerySQL); !ok {
+			continue
+		}
+		if err := osquerysql.Validate(query); err != nil {
+			return ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("query", fmt.Sprintf("invalid osquery SQL: %s", err)))
+		}
+		return nil
+	}
+	return nil
+}
+
 // DeleteQuery deletes Query identified by Query.ID.
 func (ds *Datastore) DeleteQuery(ctx context.Context, name string) error {
 	return ds.deleteEntityByName(ctx, queriesTable, name)
 }
 
 // DeleteQueries deletes the existing query objects with the provided IDs. The
-// number of deleted queries is returned along with any error.
-func (ds *Datastore) DeleteQueries(ctx context.Context, ids []uint) (uint, error) {
-	return ds.deleteEntities(ctx, queriesTable, ids)
+// number of deleted queries is returned along with the IDs of the scheduled
+// queries that were kept, and any error.
+func (ds *Datastore) DeleteQueries(ctx context.Context, ids []uint, opts ...fleet.OptionalArg) (uint, []uint, error) {
+	for _, opt := range opts {
+		if _, ok := opt().(fleet.ForceQueryDeletion); ok {
+			deleted, err := ds.deleteEntities(ctx, queriesTable, ids)
+			return deleted, nil, err
+		}
+	}
+
+	if len(ids) == 0 {
+		return 0, nil, nil
+	}
+
+	var deleted uint
+	var blocked []uint
+	err := ds.withRetryTxx(ctx, func(tx sqlx.ExtContext) error {
+		deleted, blocked = 0, nil
+
+		// lock all the candidates, so that they can't get scheduled before they are deleted
+		stmt, args, err := sqlx.In(`
+			SELECT
+				q.id,
+				EXISTS (SELECT 1 FROM scheduled_queries sq WHERE sq.query_name = q.name) AS scheduled
+			FROM queries q
+			WHERE q.id IN (?)
+			ORDER BY q.id
+			FOR UPDATE`, ids)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "build select queries to delete")
+		}
+		var candidates []struct {
+			ID        uint `db:"id"`
+			Scheduled bool `db:"scheduled"`
+		}
+		if err := sqlx.SelectContext(ctx, tx, &candidates, stmt, args...); err != nil {
+			return ctxerr.Wrap(ctx, err, "select queries to delete")
+		}
+
+		var toDelete []uint
+		for _, c := range candidates {
+			if c.Scheduled {
+				blocked = append(blocked, c.ID)
+				continue
+			}
+			toDelete = append(toDelete, c.ID)
+		}
+		if len(toDelete) == 0 {
+			return nil
+		}
+
+		stmt, args, err = sqlx.In(`DELETE FROM queries WHERE id IN (?)`, toDelete)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "build delete queries")
+		}
+		res, err := tx.ExecContext(ctx, stmt, args...)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "delete queries")
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "rows affected by delete queries")
+		}
+		deleted = uint(n)
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	return deleted, blocked, nil
 }
 
 // Query returns a single Query identified by id, if such exists.
@@ -207,6 +299,27 @@ func (ds *Datastore) ListQueries(ctx context.Context, opt fleet.ListQueryOptions
 	return results, nil
 }
 
+// SearchQueriesByBody returns the saved queries whose SQL contains the given substring, ignoring case.
+func (ds *Datastore) SearchQueriesByBody(ctx context.Context, substring string, opt fleet.ListOptions) ([]*fleet.Query, error) {
+	sql := `
+		SELECT
+		       q.*,
+		       COALESCE(u.name, '<deleted>') AS author_name,
+		       COALESCE(u.email, '') AS author_email
+		FROM queries q
+		LEFT JOIN users u ON (q.author_id = u.id)
+		WHERE saved = true AND q.query LIKE ?
+	`
+	sql = appendListOptionsToSQL(sql, &opt)
+
+	results := []*fleet.Query{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &results, sql, likePattern(substring)); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "searching queries by body")
+	}
+
+	return results, nil
+}
+
 // loadPacksForQueries loads the packs associated with the provided queries
 func (ds *Datastore) loadPacksForQueries(ctx context.Context, queries []*fleet.Query) error {
 	if len(queries) == 0 {
@@ -268,3 +381,72 @@ func (ds *Datastore) ObserverCanRunQuery(ctx context.Context, queryID uint) (boo
 
 	return observerCanRun, nil
 }
+
+// FindDuplicateQueryBodies returns groups of saved queries that share the same
+// normalized SQL body. Only groups with more than one query are returned.
+func (ds *Datastore) FindDuplicateQueryBodies(ctx context.Context) ([][]*fleet.Query, error) {
+	stmt := `
+		SELECT *
+		FROM queries
+		WHERE saved = true
+		ORDER BY id
+	`
+	var queries []*fleet.Query
+	if err := sqlx.SelectContext(ctx, ds.reader, &queries, stmt); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "selecting queries")
+	}
+
+	var order []string
+	groups := make(map[string][]*fleet.Query)
+	for _, q := range queries {
+		key := osquerysql.Normalize(q.Query)
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], q)
+	}
+
+	var dups [][]*fleet.Query
+	for _, key := range order {
+		if len(groups[key]) > 1 {
+			dups = append(dups, groups[key])
+		}
+	}
+	return dups, nil
+}
+
+// ValidateQueriesAgainstSchema returns the saved queries that read tables
+// missing from schema, along with these tables. Like FindDuplicateQueryBodies,
+// it loads all the saved queries at once, without pagination.
+func (ds *Datastore) ValidateQueriesAgainstSchema(ctx context.Context, schema fleet.OsquerySchema) ([]fleet.QueryMissingTables, error) {
+	stmt := `
+		SELECT *
+		FROM queries
+		WHERE saved = true
+		ORDER BY id
+	`
+	var queries []*fleet.Query
+	if err := sqlx.SelectContext(ctx, ds.reader, &queries, stmt); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "selecting queries")
+	}
+
+	// osquery table names are case insensitive
+	tables := make(map[string]bool, len(schema))
+	for _, table := range schema {
+		tables[strings.ToLower(table.Name)] = true
+	}
+
+	var invalid []fleet.QueryMissingTables
+	for _, q := range queries {
+		var missing []string
+		for _, table := range osquerysql.Tables(q.Query) {
+			if !tables[table] {
+				missing = append(missing, table)
+			}
+		}
+		if len(missing) > 0 {
+			invalid = append(invalid, fleet.QueryMissingTables{Query: q, MissingTables: missing})
+		}
+	}
+	return invalid, nil
+}
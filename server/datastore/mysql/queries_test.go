@@ -23,12 +23,17 @@ func TestQueries(t *testing.T) {
 		{"Delete", testQueriesDelete},
 		{"GetByName", testQueriesGetByName},
 		{"DeleteMany", testQueriesDeleteMany},
+		{"DeleteScheduled", testQueriesDeleteScheduled},
 		{"Save", testQueriesSave},
+		{"SQLValidation", testQueriesSQLValidation},
 		{"List", testQueriesList},
 		{"LoadPacksForQueries", testQueriesLoadPacksForQueries},
 		{"DuplicateNew", testQueriesDuplicateNew},
 		{"ListFiltersObservers", testQueriesListFiltersObservers},
 		{"ObserverCanRunQuery", testObserverCanRunQuery},
+		{"FindDuplicateQueryBodies", testQueriesFindDuplicateQueryBodies},
+		{"ValidateQueriesAgainstSchema", testQueriesValidateQueriesAgainstSchema},
+		{"SearchQueriesByBody", testQueriesSearchQueriesByBody},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -148,7 +153,7 @@ func testQueriesDeleteMany(t *testing.T, ds *Datastore) {
 	require.Nil(t, err)
 	assert.Len(t, queries, 4)
 
-	deleted, err := ds.DeleteQueries(context.Background(), []uint{q1.ID, q3.ID})
+	deleted, blocked, err := ds.DeleteQueries(context.Background(), []uint{q1.ID, q3.ID})
 	require.Nil(t, err)
 	assert.Equal(t, uint(2), deleted)
 
@@ -156,7 +161,7 @@ func testQueriesDeleteMany(t *testing.T, ds *Datastore) {
 	require.Nil(t, err)
 	assert.Len(t, queries, 2)
 
-	deleted, err = ds.DeleteQueries(context.Background(), []uint{q2.ID})
+	deleted, blocked, err = ds.DeleteQueries(context.Background(), []uint{q2.ID})
 	require.Nil(t, err)
 	assert.Equal(t, uint(1), deleted)
 
@@ -164,15 +169,79 @@ func testQueriesDeleteMany(t *testing.T, ds *Datastore) {
 	require.Nil(t, err)
 	assert.Len(t, queries, 1)
 
-	deleted, err = ds.DeleteQueries(context.Background(), []uint{q2.ID, q4.ID})
+	deleted, blocked, err = ds.DeleteQueries(context.Background(), []uint{q2.ID, q4.ID})
 	require.Nil(t, err)
 	assert.Equal(t, uint(1), deleted)
+	assert.Empty(t, blocked)
 
 	queries, err = ds.ListQueries(context.Background(), fleet.ListQueryOptions{})
 	require.Nil(t, err)
 	assert.Len(t, queries, 0)
 }
 
+func testQueriesDeleteScheduled(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
+
+	q1 := test.NewQuery(t, ds, "q1", "select * from time", user.ID, true)
+	q2 := test.NewQuery(t, ds, "q2", "select * from processes", user.ID, true)
+	q3 := test.NewQuery(t, ds, "q3", "select 1", user.ID, true)
+	q4 := test.NewQuery(t, ds, "q4", "select * from osquery_info", user.ID, true)
+
+	p1 := test.NewPack(t, ds, "p1")
+	p2 := test.NewPack(t, ds, "p2")
+	test.NewScheduledQuery(t, ds, p1.ID, q1.ID, 60, false, false, "q1-p1")
+	test.NewScheduledQuery(t, ds, p2.ID, q1.ID, 60, false, false, "q1-p2")
+	sq2 := test.NewScheduledQuery(t, ds, p2.ID, q2.ID, 60, false, false, "q2-p2")
+
+	listIDs := func() []uint {
+		queries, err := ds.ListQueries(ctx, fleet.ListQueryOptions{})
+		require.NoError(t, err)
+		var ids []uint
+		for _, q := range queries {
+			ids = append(ids, q.ID)
+		}
+		return ids
+	}
+
+	deleted, blocked, err := ds.DeleteQueries(ctx, nil)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	assert.Empty(t, blocked)
+
+	// the scheduled queries are kept and reported
+	deleted, blocked, err = ds.DeleteQueries(ctx, []uint{q1.ID, q2.ID, q3.ID})
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), deleted)
+	assert.Equal(t, []uint{q1.ID, q2.ID}, blocked)
+	assert.ElementsMatch(t, []uint{q1.ID, q2.ID, q4.ID}, listIDs())
+
+	// only scheduled queries, nothing is deleted
+	deleted, blocked, err = ds.DeleteQueries(ctx, []uint{q1.ID})
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+	assert.Equal(t, []uint{q1.ID}, blocked)
+
+	// a query can be deleted once it's no longer scheduled
+	require.NoError(t, ds.DeleteScheduledQuery(ctx, sq2.ID))
+	deleted, blocked, err = ds.DeleteQueries(ctx, []uint{q1.ID, q2.ID})
+	require.NoError(t, err)
+	assert.Equal(t, uint(1), deleted)
+	assert.Equal(t, []uint{q1.ID}, blocked)
+	assert.ElementsMatch(t, []uint{q1.ID, q4.ID}, listIDs())
+
+	// forced deletion removes the scheduled queries and their schedules
+	deleted, blocked, err = ds.DeleteQueries(ctx, []uint{q1.ID, q4.ID}, fleet.WithForcedQueryDeletion())
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), deleted)
+	assert.Empty(t, blocked)
+	assert.Empty(t, listIDs())
+
+	scheduled, err := ds.ListScheduledQueriesInPack(ctx, p1.ID)
+	require.NoError(t, err)
+	assert.Empty(t, scheduled)
+}
+
 func testQueriesSave(t *testing.T, ds *Datastore) {
 	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
 
@@ -201,6 +270,41 @@ func testQueriesSave(t *testing.T, ds *Datastore) {
 	assert.True(t, queryVerify.ObserverCanRun)
 }
 
+func testQueriesSQLValidation(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
+
+	// the SQL is not validated by default, e.g. for templated queries
+	query, err := ds.NewQuery(ctx, &fleet.Query{Name: "templated", Query: "SELECT * FROM {{ .Table }}", AuthorID: &user.ID})
+	require.NoError(t, err)
+
+	// valid query
+	valid, err := ds.NewQuery(ctx, &fleet.Query{Name: "valid", Query: "SELECT name, version FROM os_version;", AuthorID: &user.ID},
+		fleet.WithQuerySQLValidation())
+	require.NoError(t, err)
+
+	var invalid *fleet.InvalidArgumentError
+	for _, sql := range []string{
+		"SELEC name FROM os_version",  // syntax error
+		"SELECT * FROM no_such_table", // unknown table
+	} {
+		_, err = ds.NewQuery(ctx, &fleet.Query{Name: "invalid", Query: sql, AuthorID: &user.ID}, fleet.WithQuerySQLValidation())
+		require.ErrorAs(t, err, &invalid, sql)
+
+		valid.Query = sql
+		err = ds.SaveQuery(ctx, valid, fleet.WithQuerySQLValidation())
+		require.ErrorAs(t, err, &invalid, sql)
+	}
+	_, err = ds.QueryByName(ctx, "invalid")
+	require.True(t, fleet.IsNotFound(err))
+	stored, err := ds.Query(ctx, valid.ID)
+	require.NoError(t, err)
+	require.Equal(t, "SELECT name, version FROM os_version;", stored.Query)
+
+	query.Query = "SELECT * FROM {{ .OtherTable }}"
+	require.NoError(t, ds.SaveQuery(ctx, query))
+}
+
 func testQueriesList(t *testing.T, ds *Datastore) {
 	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
 
@@ -463,3 +567,107 @@ func testObserverCanRunQuery(t *testing.T, ds *Datastore) {
 		require.Equal(t, q.ObserverCanRun, canRun)
 	}
 }
+
+func testQueriesFindDuplicateQueryBodies(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
+
+	q1 := test.NewQuery(t, ds, "q1", "select * from time;", user.ID, true)
+	q2 := test.NewQuery(t, ds, "q2", "SELECT * FROM osquery_info", user.ID, true)
+	q3 := test.NewQuery(t, ds, "q3", "select *\n  from time -- current time\n", user.ID, true)
+	q4 := test.NewQuery(t, ds, "q4", "/* same as q2 */ SELECT * FROM   osquery_info;", user.ID, true)
+	test.NewQuery(t, ds, "q5", "select * from processes", user.ID, true)
+	// comment markers in literals are not comments
+	test.NewQuery(t, ds, "q7", "select * from file where path = '/tmp/--a'", user.ID, true)
+	test.NewQuery(t, ds, "q8", "select * from file where path = '/tmp/--b'", user.ID, true)
+	// unsaved queries are not part of the library
+	test.NewQuery(t, ds, "q6", "select * from time", user.ID, false)
+
+	dups, err := ds.FindDuplicateQueryBodies(ctx)
+	require.NoError(t, err)
+	require.Len(t, dups, 2)
+
+	ids := func(qs []*fleet.Query) []uint {
+		var res []uint
+		for _, q := range qs {
+			res = append(res, q.ID)
+		}
+		return res
+	}
+	assert.Equal(t, []uint{q1.ID, q3.ID}, ids(dups[0]))
+	assert.Equal(t, []uint{q2.ID, q4.ID}, ids(dups[1]))
+}
+
+func testQueriesValidateQueriesAgainstSchema(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
+
+	schema := fleet.OsquerySchema{{Name: "osquery_info"}, {Name: "processes"}, {Name: "Users"}}
+
+	invalid, err := ds.ValidateQueriesAgainstSchema(ctx, schema)
+	require.NoError(t, err)
+	require.Empty(t, invalid)
+
+	test.NewQuery(t, ds, "q1", "SELECT * FROM osquery_info", user.ID, true)
+	q2 := test.NewQuery(t, ds, "q2", "SELECT * FROM processes p JOIN process_events e USING (pid)", user.ID, true)
+	test.NewQuery(t, ds, "q3", "WITH u AS (SELECT * FROM users) SELECT * FROM u", user.ID, true)
+	q4 := test.NewQuery(t, ds, "q4", "SELECT * FROM removed_table, other_removed_table -- from processes", user.ID, true)
+	// unsaved queries are not part of the library
+	test.NewQuery(t, ds, "q5", "SELECT * FROM removed_table", user.ID, false)
+
+	invalid, err = ds.ValidateQueriesAgainstSchema(ctx, schema)
+	require.NoError(t, err)
+	require.Len(t, invalid, 2)
+	assert.Equal(t, q2.ID, invalid[0].Query.ID)
+	assert.Equal(t, []string{"process_events"}, invalid[0].MissingTables)
+	assert.Equal(t, q4.ID, invalid[1].Query.ID)
+	assert.Equal(t, []string{"removed_table", "other_removed_table"}, invalid[1].MissingTables)
+
+	// every table is missing from an empty schema
+	invalid, err = ds.ValidateQueriesAgainstSchema(ctx, nil)
+	require.NoError(t, err)
+	require.Len(t, invalid, 4)
+}
+
+func testQueriesSearchQueriesByBody(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
+
+	q1 := test.NewQuery(t, ds, "q1", "SELECT * FROM processes", user.ID, true)
+	q2 := test.NewQuery(t, ds, "q2", "select name from launchd", user.ID, true)
+	q3 := test.NewQuery(t, ds, "q3", "select pid from Processes where name like 'fleet%'", user.ID, true)
+	q4 := test.NewQuery(t, ds, "q4", "select * from users where uid = 501", user.ID, true)
+	// unsaved queries are not part of the library
+	test.NewQuery(t, ds, "q5", "select * from processes", user.ID, false)
+
+	ids := func(qs []*fleet.Query) []uint {
+		var res []uint
+		for _, q := range qs {
+			res = append(res, q.ID)
+		}
+		return res
+	}
+	search := func(substring string, opt fleet.ListOptions) []uint {
+		qs, err := ds.SearchQueriesByBody(ctx, substring, opt)
+		require.NoError(t, err)
+		return ids(qs)
+	}
+
+	byID := fleet.ListOptions{OrderKey: "id"}
+	assert.Equal(t, []uint{q1.ID, q3.ID}, search("processes", byID))
+	assert.Equal(t, []uint{q1.ID, q3.ID}, search("PROCESSES", byID))
+	assert.Equal(t, []uint{q2.ID}, search("launchd", byID))
+	assert.Empty(t, search("mounts", byID))
+
+	// LIKE wildcards are matched literally
+	assert.Equal(t, []uint{q3.ID}, search("fleet%", byID))
+	assert.Empty(t, search("fl_et", byID))
+	assert.Empty(t, search(`\`, byID))
+
+	// an empty substring matches all the saved queries
+	assert.Equal(t, []uint{q1.ID, q2.ID, q3.ID, q4.ID}, search("", byID))
+
+	// paginated
+	assert.Equal(t, []uint{q1.ID, q2.ID}, search("select", fleet.ListOptions{OrderKey: "id", PerPage: 2}))
+	assert.Equal(t, []uint{q3.ID, q4.ID}, search("select", fleet.ListOptions{OrderKey: "id", PerPage: 2, Page: 1}))
+}
@@ -6,11 +6,13 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 
 	"github.com/fleetdm/fleet/v4/server/contexts/ctxerr"
 	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/fleetdm/fleet/v4/server/ptr"
 )
 
 // ListScheduledQueriesInPackWithStats loads a pack's scheduled queries and its aggregated stats.
@@ -81,6 +83,120 @@ func (ds *Datastore) ListScheduledQueriesInPack(ctx context.Context, id uint) (f
 	return results, nil
 }
 
+func (ds *Datastore) ScheduledQueriesDueForHost(ctx context.Context, hostID uint, at time.Time) ([]fleet.ScheduledQuery, error) {
+	packs, err := listPacksForHost(ctx, ds.reader, hostID)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list packs for host")
+	}
+	var packIDs []uint
+	for _, p := range packs {
+		packIDs = append(packIDs, p.ID)
+	}
+	if len(packIDs) == 0 {
+		return nil, nil
+	}
+
+	// the last execution is only known once the host reported the query's stats
+	query, args, err := sqlx.In(`
+		SELECT
+			sq.id,
+			sq.pack_id,
+			sq.name,
+			sq.query_name,
+			sq.description,
+			sq.interval,
+			sq.snapshot,
+			sq.removed,
+			sq.platform,
+			sq.version,
+			sq.shard,
+			sq.denylist,
+			q.query,
+			q.id AS query_id
+		FROM scheduled_queries sq
+		JOIN queries q ON (sq.query_name = q.name)
+		JOIN packs p ON (p.id = sq.pack_id)
+		LEFT JOIN scheduled_query_stats sqs ON (sqs.scheduled_query_id = sq.id AND sqs.host_id = ?)
+		WHERE sq.pack_id IN (?) AND NOT p.disabled AND (
+			sqs.last_executed IS NULL OR
+			sqs.last_executed <= DATE_SUB(?, INTERVAL sq.interval SECOND)
+		)
+		ORDER BY sq.id
+	`, hostID, packIDs, at)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "build scheduled queries due for host")
+	}
+
+	var results []fleet.ScheduledQuery
+	if err := sqlx.SelectContext(ctx, ds.reader, &results, query, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select scheduled queries due for host")
+	}
+	return results, nil
+}
+
+func (ds *Datastore) ScheduledQueriesNeverRun(ctx context.Context) ([]fleet.ScheduledQuery, error) {
+	query := `
+		SELECT
+			sq.id,
+			sq.pack_id,
+			sq.name,
+			sq.query_name,
+			sq.description,
+			sq.interval,
+			sq.snapshot,
+			sq.removed,
+			sq.platform,
+			sq.version,
+			sq.shard,
+			sq.denylist,
+			q.query,
+			q.id AS query_id
+		FROM scheduled_queries sq
+		JOIN queries q ON (sq.query_name = q.name)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM scheduled_query_stats sqs WHERE sqs.scheduled_query_id = sq.id
+		)
+		ORDER BY sq.id
+	`
+	var results []fleet.ScheduledQuery
+	if err := sqlx.SelectContext(ctx, ds.reader, &results, query); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select scheduled queries never run")
+	}
+	return results, nil
+}
+
+func (ds *Datastore) ScheduledQueryIntervalHistogram(ctx context.Context) ([]fleet.ScheduledQueryIntervalBucket, error) {
+	var counts []struct {
+		Interval uint `db:"interval"`
+		Count    int  `db:"count"`
+	}
+	if err := sqlx.SelectContext(ctx, ds.reader, &counts, `
+		SELECT sq.interval, COUNT(*) AS count
+		FROM scheduled_queries sq
+		JOIN packs p ON (p.id = sq.pack_id)
+		WHERE NOT p.disabled
+		GROUP BY sq.interval
+	`); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select scheduled queries intervals")
+	}
+
+	buckets := make([]fleet.ScheduledQueryIntervalBucket, 0, len(fleet.ScheduledQueryIntervalBounds)+1)
+	var lower uint
+	for _, bound := range fleet.ScheduledQueryIntervalBounds {
+		buckets = append(buckets, fleet.ScheduledQueryIntervalBucket{MinInterval: lower, MaxInterval: ptr.Uint(bound)})
+		lower = bound + 1
+	}
+	buckets = append(buckets, fleet.ScheduledQueryIntervalBucket{MinInterval: lower})
+
+	for _, c := range counts {
+		i := sort.Search(len(fleet.ScheduledQueryIntervalBounds), func(i int) bool {
+			return c.Interval <= fleet.ScheduledQueryIntervalBounds[i]
+		})
+		buckets[i].Count += c.Count
+	}
+	return buckets, nil
+}
+
 func (ds *Datastore) NewScheduledQuery(ctx context.Context, sq *fleet.ScheduledQuery, opts ...fleet.OptionalArg) (*fleet.ScheduledQuery, error) {
 	return insertScheduledQueryDB(ctx, ds.writer, sq)
 }
@@ -2,6 +2,7 @@ package mysql
 
 import (
 	"context"
+	"fmt"
 	"sort"
 	"testing"
 	"time"
@@ -29,6 +30,9 @@ func TestScheduledQueries(t *testing.T) {
 		{"CascadingDelete", testScheduledQueriesCascadingDelete},
 		{"ScheduledQueryIDsByName", testScheduledQueriesIDsByName},
 		{"AsyncBatchSaveHostsScheduledQueryStats", testScheduledQueriesAsyncBatchSaveStats},
+		{"DueForHost", testScheduledQueriesDueForHost},
+		{"NeverRun", testScheduledQueriesNeverRun},
+		{"IntervalHistogram", testScheduledQueriesIntervalHistogram},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -612,3 +616,172 @@ func testScheduledQueriesAsyncBatchSaveStats(t *testing.T, ds *Datastore) {
 	require.Equal(t, 4, execs)
 	assertStats(m)
 }
+
+func testScheduledQueriesDueForHost(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
+
+	host := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	otherHost := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+
+	at := time.Now().UTC().Truncate(time.Second)
+
+	// no packs target the host
+	due, err := ds.ScheduledQueriesDueForHost(ctx, host.ID, at)
+	require.NoError(t, err)
+	require.Empty(t, due)
+
+	q1 := test.NewQuery(t, ds, "q1", "select 1", user.ID, true)
+	q2 := test.NewQuery(t, ds, "q2", "select 2", user.ID, true)
+	q3 := test.NewQuery(t, ds, "q3", "select 3", user.ID, true)
+	q4 := test.NewQuery(t, ds, "q4", "select 4", user.ID, true)
+
+	pack, err := ds.NewPack(ctx, &fleet.Pack{Name: "pack", HostIDs: []uint{host.ID}})
+	require.NoError(t, err)
+	disabledPack, err := ds.NewPack(ctx, &fleet.Pack{Name: "disabled", HostIDs: []uint{host.ID}, Disabled: true})
+	require.NoError(t, err)
+	otherPack, err := ds.NewPack(ctx, &fleet.Pack{Name: "other", HostIDs: []uint{otherHost.ID}})
+	require.NoError(t, err)
+
+	hourly := test.NewScheduledQuery(t, ds, pack.ID, q1.ID, 3600, false, false, "hourly")
+	daily := test.NewScheduledQuery(t, ds, pack.ID, q2.ID, 86400, false, false, "daily")
+	minutely := test.NewScheduledQuery(t, ds, pack.ID, q3.ID, 60, false, false, "minutely")
+	neverRan := test.NewScheduledQuery(t, ds, pack.ID, q4.ID, 86400, false, false, "never-ran")
+	test.NewScheduledQuery(t, ds, disabledPack.ID, q1.ID, 60, false, false, "disabled")
+	test.NewScheduledQuery(t, ds, otherPack.ID, q1.ID, 60, false, false, "other")
+
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `
+			INSERT INTO scheduled_query_stats (host_id, scheduled_query_id, last_executed)
+			VALUES (?, ?, ?), (?, ?, ?), (?, ?, ?), (?, ?, ?)`,
+			host.ID, hourly.ID, at.Add(-2*time.Hour), // interval elapsed
+			host.ID, daily.ID, at.Add(-2*time.Hour), // interval not elapsed
+			host.ID, minutely.ID, at.Add(-time.Minute), // interval elapsed exactly
+			otherHost.ID, neverRan.ID, at, // ran on another host only
+		)
+		return err
+	})
+
+	ids := func(sqs []fleet.ScheduledQuery) []uint {
+		var res []uint
+		for _, sq := range sqs {
+			res = append(res, sq.ID)
+		}
+		return res
+	}
+
+	due, err = ds.ScheduledQueriesDueForHost(ctx, host.ID, at)
+	require.NoError(t, err)
+	require.Equal(t, []uint{hourly.ID, minutely.ID, neverRan.ID}, ids(due))
+	require.Equal(t, "q1", due[0].QueryName)
+	require.Equal(t, q1.ID, due[0].QueryID)
+	require.Equal(t, "select 1", due[0].Query)
+	require.Equal(t, uint(3600), due[0].Interval)
+
+	// a minute earlier, the minutely query had just run
+	due, err = ds.ScheduledQueriesDueForHost(ctx, host.ID, at.Add(-time.Second))
+	require.NoError(t, err)
+	require.Equal(t, []uint{hourly.ID, neverRan.ID}, ids(due))
+
+	// a day later, everything is due
+	due, err = ds.ScheduledQueriesDueForHost(ctx, host.ID, at.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, []uint{hourly.ID, daily.ID, minutely.ID, neverRan.ID}, ids(due))
+}
+
+func testScheduledQueriesNeverRun(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
+
+	host := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	otherHost := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+
+	neverRun, err := ds.ScheduledQueriesNeverRun(ctx)
+	require.NoError(t, err)
+	require.Empty(t, neverRun)
+
+	q1 := test.NewQuery(t, ds, "q1", "select 1", user.ID, true)
+	q2 := test.NewQuery(t, ds, "q2", "select 2", user.ID, true)
+
+	pack, err := ds.NewPack(ctx, &fleet.Pack{Name: "pack", HostIDs: []uint{host.ID, otherHost.ID}})
+	require.NoError(t, err)
+	disabledPack, err := ds.NewPack(ctx, &fleet.Pack{Name: "disabled", HostIDs: []uint{host.ID}, Disabled: true})
+	require.NoError(t, err)
+
+	ranEverywhere := test.NewScheduledQuery(t, ds, pack.ID, q1.ID, 3600, false, false, "ran-everywhere")
+	ranOnce := test.NewScheduledQuery(t, ds, pack.ID, q2.ID, 3600, false, false, "ran-once")
+	never := test.NewScheduledQuery(t, ds, pack.ID, q1.ID, 86400, false, false, "never")
+	disabled := test.NewScheduledQuery(t, ds, disabledPack.ID, q2.ID, 60, false, false, "disabled")
+
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `
+			INSERT INTO scheduled_query_stats (host_id, scheduled_query_id, executions)
+			VALUES (?, ?, 1), (?, ?, 3), (?, ?, 2)`,
+			host.ID, ranEverywhere.ID,
+			otherHost.ID, ranEverywhere.ID,
+			otherHost.ID, ranOnce.ID,
+		)
+		return err
+	})
+
+	neverRun, err = ds.ScheduledQueriesNeverRun(ctx)
+	require.NoError(t, err)
+	require.Len(t, neverRun, 2)
+	require.Equal(t, never.ID, neverRun[0].ID)
+	require.Equal(t, pack.ID, neverRun[0].PackID)
+	require.Equal(t, "never", neverRun[0].Name)
+	require.Equal(t, "q1", neverRun[0].QueryName)
+	require.Equal(t, q1.ID, neverRun[0].QueryID)
+	require.Equal(t, "select 1", neverRun[0].Query)
+	require.Equal(t, disabled.ID, neverRun[1].ID)
+
+	// once it ran on a host, a scheduled query is no longer listed
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `INSERT INTO scheduled_query_stats (host_id, scheduled_query_id, executions) VALUES (?, ?, 1)`,
+			host.ID, never.ID)
+		return err
+	})
+	neverRun, err = ds.ScheduledQueriesNeverRun(ctx)
+	require.NoError(t, err)
+	require.Len(t, neverRun, 1)
+	require.Equal(t, disabled.ID, neverRun[0].ID)
+}
+
+func testScheduledQueriesIntervalHistogram(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+	user := test.NewUser(t, ds, "Zach", "zwass@fleet.co", true)
+
+	counts := func() []int {
+		buckets, err := ds.ScheduledQueryIntervalHistogram(ctx)
+		require.NoError(t, err)
+		require.Len(t, buckets, len(fleet.ScheduledQueryIntervalBounds)+1)
+		var res []int
+		for _, b := range buckets {
+			res = append(res, b.Count)
+		}
+		return res
+	}
+
+	// all the buckets are returned, even without scheduled queries
+	require.Equal(t, []int{0, 0, 0, 0, 0, 0}, counts())
+
+	buckets, err := ds.ScheduledQueryIntervalHistogram(ctx)
+	require.NoError(t, err)
+	require.Equal(t, fleet.ScheduledQueryIntervalBucket{MinInterval: 0, MaxInterval: ptr.Uint(60)}, buckets[0])
+	require.Equal(t, fleet.ScheduledQueryIntervalBucket{MinInterval: 61, MaxInterval: ptr.Uint(300)}, buckets[1])
+	require.Equal(t, fleet.ScheduledQueryIntervalBucket{MinInterval: 86401}, buckets[5])
+
+	q1 := test.NewQuery(t, ds, "q1", "select 1", user.ID, true)
+	pack, err := ds.NewPack(ctx, &fleet.Pack{Name: "pack"})
+	require.NoError(t, err)
+	disabledPack, err := ds.NewPack(ctx, &fleet.Pack{Name: "disabled", Disabled: true})
+	require.NoError(t, err)
+
+	for i, interval := range []uint{10, 60, 60, 61, 300, 3600, 3600, 3600, 86400, 604800} {
+		test.NewScheduledQuery(t, ds, pack.ID, q1.ID, interval, false, false, fmt.Sprintf("sq%d", i))
+	}
+	// the queries of disabled packs don't run
+	test.NewScheduledQuery(t, ds, disabledPack.ID, q1.ID, 60, false, false, "disabled")
+
+	require.Equal(t, []int{3, 2, 0, 3, 1, 1}, counts())
+}
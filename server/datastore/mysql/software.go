@@ -13,6 +13,7 @@ import (
 	_ "github.com/doug-martin/goqu/v9/dialect/mysql"
 	"github.com/fleetdm/fleet/v4/server/contexts/ctxerr"
 	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/go-kit/kit/log/level"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -749,6 +750,21 @@ func (ds *Datastore) ListSoftwareCPEs(ctx context.Context) ([]fleet.SoftwareCPE,
 	return result, nil
 }
 
+func (ds *Datastore) ListHostSoftwareCPEs(ctx context.Context, hostID uint) ([]fleet.SoftwareCPE, error) {
+	stmt := `
+		SELECT cpe.id, cpe.software_id, cpe.cpe
+		FROM software_cpe cpe
+		JOIN host_software hs ON hs.software_id = cpe.software_id
+		WHERE hs.host_id = ?
+		ORDER BY cpe.software_id
+	`
+	var result []fleet.SoftwareCPE
+	if err := sqlx.SelectContext(ctx, ds.reader, &result, stmt, hostID); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list host software cpes")
+	}
+	return result, nil
+}
+
 func (ds *Datastore) ListSoftware(ctx context.Context, opt fleet.SoftwareListOptions) ([]fleet.Software, error) {
 	return listSoftwareDB(ctx, ds.reader, opt)
 }
@@ -1031,40 +1047,327 @@ func (ds *Datastore) HostsBySoftwareIDs(ctx context.Context, softwareIDs []uint)
 	return hosts, nil
 }
 
-func (ds *Datastore) HostsByCVE(ctx context.Context, cve string) ([]*fleet.HostShort, error) {
+func (ds *Datastore) HostsByCVE(ctx context.Context, cve string, opts fleet.HostsByCVEOptions) ([]*fleet.HostShort, error) {
+	direction := "ASC"
+	if opts.OrderDirection == fleet.OrderDescending {
+		direction = "DESC"
+	}
+
+	var orderBy string
+	switch opts.OrderKey {
+	case "", "id":
+		orderBy = "h.id " + direction
+	case "seen_time":
+		// h.id breaks the ties, so the order is stable
+		orderBy = "COALESCE(hst.seen_time, h.created_at) " + direction + ", h.id"
+	default:
+		return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("order_key", fmt.Sprintf("unsupported order key '%s'", opts.OrderKey)))
+	}
+
+	args := []interface{}{cve}
+	if opts.LabelID != nil {
+		orderBy = `EXISTS (
+        SELECT 1 FROM label_membership lm WHERE lm.host_id = h.id AND lm.label_id = ?
+    ) DESC, ` + orderBy
+		args = append(args, *opts.LabelID)
+	}
+
 	query := `
-SELECT DISTINCT
-    	(h.id),
+SELECT
+    	h.id,
     	h.hostname,
     	if(h.computer_name = '', h.hostname, h.computer_name) display_name
 FROM
     hosts h
-    INNER JOIN host_software hs ON h.id = hs.host_id
-    INNER JOIN software_cve scv ON scv.software_id = hs.software_id
+    LEFT JOIN host_seen_times hst ON h.id = hst.host_id
 WHERE
-    scv.cve = ?
+    EXISTS (
+        SELECT 1
+        FROM host_software hs
+        INNER JOIN software_cve scv ON scv.software_id = hs.software_id
+        WHERE hs.host_id = h.id AND scv.cve = ?
+    )
 ORDER BY
-    h.id
-`
+    ` + orderBy
 
 	var hosts []*fleet.HostShort
-	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, query, cve); err != nil {
+	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, query, args...); err != nil {
 		return nil, ctxerr.Wrap(ctx, err, "select hosts by cves")
 	}
 	return hosts, nil
 }
 
-func (ds *Datastore) InsertCVEMeta(ctx context.Context, cveMeta []fleet.CVEMeta) error {
-	query := `
-INSERT INTO cve_meta (cve, cvss_score, epss_probability, cisa_known_exploit, published)
-VALUES %s
-ON DUPLICATE KEY UPDATE
+// insertCVEMetaOnDuplicate returns the ON DUPLICATE KEY UPDATE clause of InsertCVEMeta for the given options, see
+// fleet.WithCVSSSubscoresLoaded and fleet.WithLastModifiedLoaded.
+func insertCVEMetaOnDuplicate(opts []fleet.OptionalArg) string {
+	// the CVSS subscores are only loaded on demand, a load without them keeps the stored ones unless they belong to a
+	// score that changed. They are set before cvss_score, as the assignments see the values set by the previous ones.
+	subscores := `
+    cvss_exploitability_score = IF(cvss_score <=> VALUES(cvss_score), COALESCE(VALUES(cvss_exploitability_score), cvss_exploitability_score), VALUES(cvss_exploitability_score)),
+    cvss_impact_score = IF(cvss_score <=> VALUES(cvss_score), COALESCE(VALUES(cvss_impact_score), cvss_impact_score), VALUES(cvss_impact_score)),
+    cvss_vector = IF(cvss_score <=> VALUES(cvss_score), COALESCE(VALUES(cvss_vector), cvss_vector), VALUES(cvss_vector)),`
+	// the last modified dates are only loaded on demand, a load without them keeps the stored ones
+	lastModified := `COALESCE(VALUES(last_modified), last_modified)`
+	for _, opt := range opts {
+		switch opt().(type) {
+		case fleet.CVSSSubscoresLoaded:
+			subscores = `
+    cvss_exploitability_score = VALUES(cvss_exploitability_score),
+    cvss_impact_score = VALUES(cvss_impact_score),
+    cvss_vector = VALUES(cvss_vector),`
+		case fleet.LastModifiedLoaded:
+			lastModified = `VALUES(last_modified)`
+		}
+	}
+
+	return subscores + `
     cvss_score = VALUES(cvss_score),
     epss_probability = VALUES(epss_probability),
     cisa_known_exploit = VALUES(cisa_known_exploit),
-    published = VALUES(published)
+    published = VALUES(published),
+    last_modified = ` + lastModified + `,
+    cvss_source = VALUES(cvss_source),
+    cisa_due_date = VALUES(cisa_due_date),
+    cisa_date_added = VALUES(cisa_date_added)
+`
+}
+
+const (
+	// NULL values are not part of the incremental update, keep the stored ones
+	upsertCVEMetaOnDuplicate = `
+    cvss_score = COALESCE(VALUES(cvss_score), cvss_score),
+    epss_probability = COALESCE(VALUES(epss_probability), epss_probability),
+    cisa_known_exploit = COALESCE(VALUES(cisa_known_exploit), cisa_known_exploit),
+    published = COALESCE(VALUES(published), published),
+    cvss_exploitability_score = COALESCE(VALUES(cvss_exploitability_score), cvss_exploitability_score),
+    cvss_impact_score = COALESCE(VALUES(cvss_impact_score), cvss_impact_score),
+    cvss_vector = COALESCE(VALUES(cvss_vector), cvss_vector),
+    last_modified = COALESCE(VALUES(last_modified), last_modified),
+    cvss_source = COALESCE(VALUES(cvss_source), cvss_source),
+    cisa_due_date = COALESCE(VALUES(cisa_due_date), cisa_due_date),
+    cisa_date_added = COALESCE(VALUES(cisa_date_added), cisa_date_added)
+`
+)
+
+func (ds *Datastore) InsertCVEMeta(ctx context.Context, cveMeta []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+	return insertCVEMetaDB(ctx, ds.writer, cveMeta, insertCVEMetaOnDuplicate(opts))
+}
+
+func (ds *Datastore) UpsertCVEMeta(ctx context.Context, cveMeta []fleet.CVEMeta) error {
+	return insertCVEMetaDB(ctx, ds.writer, cveMeta, upsertCVEMetaOnDuplicate)
+}
+
+// cveMetaCompanionTables are the tables holding data loaded along with the metadata of the CVEs, pruned with it.
+var cveMetaCompanionTables = []string{"cve_meta_provenance", "epss_model_scores", "cve_products", "cve_cwes"}
+
+func (ds *Datastore) PruneCVEMeta(ctx context.Context, current []string) (int, error) {
+	// The CVEs to keep are loaded in a temporary table, so that the orphans are found by an anti-join on the server
+	// rather than by reading all the stored CVEs. Temporary tables only exist on the connection that created them.
+	conn, err := ds.writer.Conn(ctx)
+	if err != nil {
+		return 0, ctxerr.Wrap(ctx, err, "get connection for cve meta prune")
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TEMPORARY TABLE cve_meta_prune_keep (
+			cve VARCHAR(20) COLLATE utf8mb4_unicode_ci NOT NULL PRIMARY KEY
+		)`,
+	); err != nil {
+		return 0, ctxerr.Wrap(ctx, err, "create cve meta prune table")
+	}
+	// the connection goes back to the pool on Close, so the table must be dropped explicitly
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), `DROP TEMPORARY TABLE IF EXISTS cve_meta_prune_keep`); err != nil {
+			level.Error(ds.logger).Log("msg", "drop cve meta prune table", "err", err)
+		}
+	}()
+
+	batchSize := 1000
+	for i := 0; i < len(current); i += batchSize {
+		end := i + batchSize
+		if end > len(current) {
+			end = len(current)
+		}
+		batch := current[i:end]
+
+		stmt := `INSERT IGNORE INTO cve_meta_prune_keep (cve) VALUES ` + strings.TrimSuffix(strings.Repeat("(?),", len(batch)), ",")
+		args := make([]interface{}, 0, len(batch))
+		for _, cve := range batch {
+			args = append(args, cve)
+		}
+		if _, err := conn.ExecContext(ctx, stmt, args...); err != nil {
+			return 0, ctxerr.Wrap(ctx, err, "insert cve meta prune table")
+		}
+	}
+
+	res, err := conn.ExecContext(ctx, `
+		DELETE cm FROM cve_meta cm
+		LEFT JOIN cve_meta_prune_keep k ON k.cve = cm.cve
+		WHERE k.cve IS NULL`,
+	)
+	if err != nil {
+		return 0, ctxerr.Wrap(ctx, err, "delete cve meta")
+	}
+	deleted, _ := res.RowsAffected()
+
+	for _, table := range cveMetaCompanionTables {
+		stmt := fmt.Sprintf(`
+			DELETE t FROM %s t
+			LEFT JOIN cve_meta_prune_keep k ON k.cve = t.cve
+			WHERE k.cve IS NULL`, table,
+		)
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return int(deleted), ctxerr.Wrapf(ctx, err, "delete %s", table)
+		}
+	}
+
+	return int(deleted), nil
+}
+
+// cveMetaLoadLockName is the name of the MySQL lock held by a load of CVE metadata, see LockCVEMetaLoad.
+const cveMetaLoadLockName = "fleet_cve_meta_load"
+
+func (ds *Datastore) LockCVEMetaLoad(ctx context.Context, wait bool) (func(), error) {
+	// GET_LOCK locks are owned by the MySQL session, so the lock must be acquired and released on the same connection
+	conn, err := ds.writer.Conn(ctx)
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "get connection for cve meta load lock")
+	}
+
+	// a negative timeout waits for the lock indefinitely (or until ctx is done)
+	timeout := 0
+	if wait {
+		timeout = -1
+	}
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, `SELECT GET_LOCK(?, ?)`, cveMetaLoadLockName, timeout).Scan(&acquired); err != nil {
+		conn.Close()
+		return nil, ctxerr.Wrap(ctx, err, "get cve meta load lock")
+	}
+	if !acquired.Valid || acquired.Int64 != 1 {
+		conn.Close()
+		return nil, ctxerr.Wrap(ctx, fleet.ErrCVEMetaLoadInProgress, "get cve meta load lock")
+	}
+
+	return func() {
+		// the connection goes back to the pool on Close, so the lock must be released explicitly
+		if _, err := conn.ExecContext(context.Background(), `SELECT RELEASE_LOCK(?)`, cveMetaLoadLockName); err != nil {
+			level.Error(ds.logger).Log("msg", "release cve meta load lock", "err", err)
+		}
+		conn.Close()
+	}, nil
+}
+
+func (ds *Datastore) WithCVEMetaTx(ctx context.Context, fn func(tx fleet.CVEMetaTx) error) error {
+	return ds.withTx(ctx, func(tx sqlx.ExtContext) error {
+		return fn(cveMetaTx{tx})
+	})
+}
+
+// cveMetaTx is the fleet.CVEMetaTx of a transaction.
+type cveMetaTx struct {
+	sqlx.ExtContext
+}
+
+func (tx cveMetaTx) InsertCVEMeta(ctx context.Context, cveMeta []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+	return insertCVEMetaDB(ctx, tx, cveMeta, insertCVEMetaOnDuplicate(opts))
+}
+
+func (tx cveMetaTx) UpsertCVEMeta(ctx context.Context, cveMeta []fleet.CVEMeta) error {
+	return insertCVEMetaDB(ctx, tx, cveMeta, upsertCVEMetaOnDuplicate)
+}
+
+func (tx cveMetaTx) InsertCVEMetaProvenance(ctx context.Context, provenance []fleet.CVEMetaProvenance) error {
+	return insertCVEMetaProvenanceDB(ctx, tx, provenance)
+}
+
+func (tx cveMetaTx) InsertEPSSModelScores(ctx context.Context, scores []fleet.EPSSModelScore) error {
+	return insertEPSSModelScoresDB(ctx, tx, scores)
+}
+
+func (tx cveMetaTx) RecordCVESync(ctx context.Context, syncedAt time.Time, cveCount int) error {
+	return recordCVESyncDB(ctx, tx, syncedAt, cveCount)
+}
+
+func (tx cveMetaTx) RecordCISACatalogVersion(ctx context.Context, version fleet.CISACatalogVersion) error {
+	return recordCISACatalogVersionDB(ctx, tx, version)
+}
+
+func (tx cveMetaTx) RecordFleetCVECountSnapshot(ctx context.Context, snapshotDate time.Time, cveCount int) error {
+	return recordFleetCVECountSnapshotDB(ctx, tx, snapshotDate, cveCount)
+}
+
+func (tx cveMetaTx) InsertCVEProducts(ctx context.Context, products []fleet.CVEProduct) error {
+	return insertCVEProductsDB(ctx, tx, products)
+}
+
+func (tx cveMetaTx) InsertCVECWEs(ctx context.Context, cwes []fleet.CVECWE) error {
+	return insertCVECWEsDB(ctx, tx, cwes)
+}
+
+func (ds *Datastore) InsertCVEMetaProvenance(ctx context.Context, provenance []fleet.CVEMetaProvenance) error {
+	return insertCVEMetaProvenanceDB(ctx, ds.writer, provenance)
+}
+
+func insertCVEMetaProvenanceDB(ctx context.Context, exec sqlx.ExecerContext, provenance []fleet.CVEMetaProvenance) error {
+	query := `
+INSERT INTO cve_meta_provenance (cve, field, source, loaded_at)
+VALUES %s
+ON DUPLICATE KEY UPDATE
+    source = VALUES(source),
+    loaded_at = VALUES(loaded_at)
 `
 
+	batchSize := 500
+	for i := 0; i < len(provenance); i += batchSize {
+		end := i + batchSize
+		if end > len(provenance) {
+			end = len(provenance)
+		}
+
+		batch := provenance[i:end]
+
+		valuesFrag := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?), ", len(batch)), ", ")
+		var args []interface{}
+		for _, p := range batch {
+			args = append(args, p.CVE, p.Field, p.Source, p.LoadedAt)
+		}
+
+		if _, err := exec.ExecContext(ctx, fmt.Sprintf(query, valuesFrag), args...); err != nil {
+			return ctxerr.Wrap(ctx, err, "insert cve meta provenance")
+		}
+	}
+
+	return nil
+}
+
+func (ds *Datastore) ListCVEMetaProvenance(ctx context.Context, cve string) ([]fleet.CVEMetaProvenance, error) {
+	var result []fleet.CVEMetaProvenance
+
+	stmt := `
+		SELECT cve, field, source, loaded_at
+		FROM cve_meta_provenance
+		WHERE cve = ?
+		ORDER BY field
+	`
+	if err := sqlx.SelectContext(ctx, ds.reader, &result, stmt, cve); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list cve meta provenance")
+	}
+
+	return result, nil
+}
+
+func insertCVEMetaDB(ctx context.Context, exec sqlx.ExecerContext, cveMeta []fleet.CVEMeta, onDuplicate string) error {
+	query := `
+INSERT INTO cve_meta (
+    cve, cvss_score, epss_probability, cisa_known_exploit, published,
+    cvss_exploitability_score, cvss_impact_score, cvss_vector, last_modified, cvss_source,
+    cisa_due_date, cisa_date_added
+)
+VALUES %s
+ON DUPLICATE KEY UPDATE` + onDuplicate
+
 	batchSize := 500
 	for i := 0; i < len(cveMeta); i += batchSize {
 		end := i + batchSize
@@ -1074,15 +1377,17 @@ ON DUPLICATE KEY UPDATE
 
 		batch := cveMeta[i:end]
 
-		valuesFrag := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?), ", len(batch)), ", ")
+		valuesFrag := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(batch)), ", ")
 		var args []interface{}
 		for _, meta := range batch {
-			args = append(args, meta.CVE, meta.CVSSScore, meta.EPSSProbability, meta.CISAKnownExploit, meta.Published)
+			args = append(args, meta.CVE, meta.CVSSScore, meta.EPSSProbability, meta.CISAKnownExploit, meta.Published,
+				meta.CVSSExploitabilityScore, meta.CVSSImpactScore, meta.CVSSVector, meta.LastModified, meta.CVSSSource,
+				meta.CISADueDate, meta.CISADateAdded)
 		}
 
 		query := fmt.Sprintf(query, valuesFrag)
 
-		_, err := ds.writer.ExecContext(ctx, query, args...)
+		_, err := exec.ExecContext(ctx, query, args...)
 		if err != nil {
 			return ctxerr.Wrap(ctx, err, "insert cve scores")
 		}
@@ -1091,6 +1396,117 @@ ON DUPLICATE KEY UPDATE
 	return nil
 }
 
+func (ds *Datastore) RecordCVESync(ctx context.Context, syncedAt time.Time, cveCount int) error {
+	return recordCVESyncDB(ctx, ds.writer, syncedAt, cveCount)
+}
+
+func recordCVESyncDB(ctx context.Context, exec sqlx.ExecerContext, syncedAt time.Time, cveCount int) error {
+	stmt := `
+		INSERT INTO cve_meta_sync (id, synced_at, cve_count)
+		VALUES (1, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			synced_at = VALUES(synced_at),
+			cve_count = VALUES(cve_count)
+	`
+	if _, err := exec.ExecContext(ctx, stmt, syncedAt, cveCount); err != nil {
+		return ctxerr.Wrap(ctx, err, "record cve sync")
+	}
+	return nil
+}
+
+func (ds *Datastore) LastCVESyncInfo(ctx context.Context) (*fleet.CVESyncInfo, error) {
+	var info fleet.CVESyncInfo
+	err := sqlx.GetContext(ctx, ds.reader, &info, `SELECT synced_at, cve_count FROM cve_meta_sync WHERE id = 1`)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ctxerr.Wrap(ctx, notFound("CVESyncInfo"))
+		}
+		return nil, ctxerr.Wrap(ctx, err, "get last cve sync info")
+	}
+	return &info, nil
+}
+
+// syncAttemptsRetention is how long the attempts at downloading the vulnerability feeds are kept.
+const syncAttemptsRetention = 30 * 24 * time.Hour
+
+func (ds *Datastore) RecordSyncAttempt(ctx context.Context, attempt *fleet.SyncAttempt) error {
+	stmt := `
+		INSERT INTO vulnerability_sync_attempts (started_at, duration_ms, success, error, sources)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	res, err := ds.writer.ExecContext(ctx, stmt, attempt.StartedAt, attempt.DurationMS, attempt.Success, attempt.Error, attempt.Sources)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "record sync attempt")
+	}
+	id, _ := res.LastInsertId()
+	attempt.ID = uint(id)
+
+	// a sync is attempted every run of the vulnerabilities cron, the old attempts are dropped as the new ones come in
+	if _, err := ds.writer.ExecContext(ctx,
+		`DELETE FROM vulnerability_sync_attempts WHERE started_at < ?`,
+		attempt.StartedAt.Add(-syncAttemptsRetention),
+	); err != nil {
+		return ctxerr.Wrap(ctx, err, "delete old sync attempts")
+	}
+	return nil
+}
+
+func (ds *Datastore) ListSyncAttempts(ctx context.Context, opts fleet.ListOptions) ([]fleet.SyncAttempt, error) {
+	stmt := `SELECT id, started_at, duration_ms, success, error, sources FROM vulnerability_sync_attempts`
+	if opts.OrderKey == "" {
+		opts.OrderKey = "started_at"
+		opts.OrderDirection = fleet.OrderDescending
+	}
+	stmt = appendListOptionsToSQL(stmt, &opts)
+
+	var attempts []fleet.SyncAttempt
+	if err := sqlx.SelectContext(ctx, ds.reader, &attempts, stmt); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list sync attempts")
+	}
+	return attempts, nil
+}
+
+func (ds *Datastore) EPSSCoverage(ctx context.Context) (*fleet.EPSSCoverage, error) {
+	var coverage fleet.EPSSCoverage
+	stmt := `SELECT COUNT(*) AS cve_count, COUNT(epss_probability) AS epss_count FROM cve_meta`
+	if err := sqlx.GetContext(ctx, ds.reader, &coverage, stmt); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "get epss coverage")
+	}
+	return &coverage, nil
+}
+
+func (ds *Datastore) RecordCISACatalogVersion(ctx context.Context, version fleet.CISACatalogVersion) error {
+	return recordCISACatalogVersionDB(ctx, ds.writer, version)
+}
+
+func recordCISACatalogVersionDB(ctx context.Context, exec sqlx.ExecerContext, version fleet.CISACatalogVersion) error {
+	stmt := `
+		INSERT INTO cisa_catalog_version (id, catalog_version, date_released, loaded_at)
+		VALUES (1, ?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			catalog_version = VALUES(catalog_version),
+			date_released = VALUES(date_released),
+			loaded_at = VALUES(loaded_at)
+	`
+	if _, err := exec.ExecContext(ctx, stmt, version.CatalogVersion, version.DateReleased, version.LoadedAt); err != nil {
+		return ctxerr.Wrap(ctx, err, "record cisa catalog version")
+	}
+	return nil
+}
+
+func (ds *Datastore) LastCISACatalogVersion(ctx context.Context) (*fleet.CISACatalogVersion, error) {
+	var version fleet.CISACatalogVersion
+	err := sqlx.GetContext(ctx, ds.reader, &version,
+		`SELECT catalog_version, date_released, loaded_at FROM cisa_catalog_version WHERE id = 1`)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ctxerr.Wrap(ctx, notFound("CISACatalogVersion"))
+		}
+		return nil, ctxerr.Wrap(ctx, err, "get last cisa catalog version")
+	}
+	return &version, nil
+}
+
 func (ds *Datastore) InsertSoftwareVulnerabilities(
 	ctx context.Context,
 	vulns []fleet.SoftwareVulnerability,
@@ -1218,6 +1634,13 @@ func (ds *Datastore) ListCVEs(ctx context.Context, maxAge time.Duration) ([]flee
 			goqu.C("epss_probability"),
 			goqu.C("cisa_known_exploit"),
 			goqu.C("published"),
+			goqu.C("cvss_exploitability_score"),
+			goqu.C("cvss_impact_score"),
+			goqu.C("cvss_vector"),
+			goqu.C("last_modified"),
+			goqu.C("cvss_source"),
+			goqu.C("cisa_due_date"),
+			goqu.C("cisa_date_added"),
 		).
 		Where(goqu.C("published").Gte(maxAgeDate))
 
@@ -1232,3 +1655,891 @@ func (ds *Datastore) ListCVEs(ctx context.Context, maxAge time.Duration) ([]flee
 
 	return result, nil
 }
+
+// NewCVEsSince returns the cve_meta rows published strictly after since, ordered by publication date unless
+// another order is requested. CVEs without a published date are excluded.
+func (ds *Datastore) NewCVEsSince(ctx context.Context, since time.Time, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	if opts.OrderKey == "" {
+		opts.OrderKey = "published"
+	}
+
+	stmt := dialect.From(goqu.T("cve_meta")).
+		Select(
+			goqu.C("cve"),
+			goqu.C("cvss_score"),
+			goqu.C("epss_probability"),
+			goqu.C("cisa_known_exploit"),
+			goqu.C("published"),
+			goqu.C("cvss_exploitability_score"),
+			goqu.C("cvss_impact_score"),
+			goqu.C("cvss_vector"),
+			goqu.C("last_modified"),
+			goqu.C("cvss_source"),
+			goqu.C("cisa_due_date"),
+			goqu.C("cisa_date_added"),
+		).
+		Where(
+			goqu.C("published").IsNotNull(),
+			goqu.C("published").Gt(since),
+		)
+	stmt = appendListOptionsToSelect(stmt, opts)
+
+	sql, args, err := stmt.ToSQL()
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "generate new cves since statement")
+	}
+
+	var result []fleet.CVEMeta
+	if err := sqlx.SelectContext(ctx, ds.reader, &result, sql, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select new cves since")
+	}
+	return result, nil
+}
+
+func (ds *Datastore) CVEMetaChangedSince(ctx context.Context, since time.Time, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	if opts.OrderKey == "" {
+		opts.OrderKey = "updated_at"
+	}
+
+	stmt := dialect.From(goqu.T("cve_meta")).
+		Select(
+			goqu.C("cve"),
+			goqu.C("cvss_score"),
+			goqu.C("epss_probability"),
+			goqu.C("cisa_known_exploit"),
+			goqu.C("published"),
+			goqu.C("cvss_exploitability_score"),
+			goqu.C("cvss_impact_score"),
+			goqu.C("cvss_vector"),
+			goqu.C("last_modified"),
+			goqu.C("cvss_source"),
+			goqu.C("updated_at"),
+		).
+		Where(goqu.C("updated_at").Gte(since))
+	stmt = appendListOptionsToSelect(stmt, opts)
+
+	sql, args, err := stmt.ToSQL()
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "generate cve meta changed since statement")
+	}
+
+	var result []fleet.CVEMeta
+	if err := sqlx.SelectContext(ctx, ds.reader, &result, sql, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select cve meta changed since")
+	}
+	return result, nil
+}
+
+func (ds *Datastore) CVEsWithoutCVSS(ctx context.Context, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	if opts.OrderKey == "" {
+		opts.OrderKey = "cve"
+	}
+
+	stmt := dialect.From(goqu.T("cve_meta")).
+		Select(
+			goqu.C("cve"),
+			goqu.C("cvss_score"),
+			goqu.C("epss_probability"),
+			goqu.C("cisa_known_exploit"),
+			goqu.C("published"),
+			goqu.C("cvss_exploitability_score"),
+			goqu.C("cvss_impact_score"),
+			goqu.C("cvss_vector"),
+			goqu.C("last_modified"),
+			goqu.C("cvss_source"),
+		).
+		Where(goqu.C("cvss_score").IsNull())
+	stmt = appendListOptionsToSelect(stmt, opts)
+
+	sql, args, err := stmt.ToSQL()
+	if err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "generate cves without cvss statement")
+	}
+
+	var result []fleet.CVEMeta
+	if err := sqlx.SelectContext(ctx, ds.reader, &result, sql, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select cves without cvss")
+	}
+	return result, nil
+}
+
+func (ds *Datastore) OverdueCVEs(ctx context.Context, asOf time.Time, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	stmt := `
+		SELECT
+			cm.cve,
+			cm.cvss_score,
+			cm.epss_probability,
+			cm.cisa_known_exploit,
+			cm.published,
+			cm.cvss_exploitability_score,
+			cm.cvss_impact_score,
+			cm.cvss_vector,
+			cm.last_modified,
+			cm.cvss_source,
+			cm.cisa_due_date
+		FROM cve_meta cm
+		WHERE cm.cisa_due_date < ?
+		AND (
+			EXISTS (
+				SELECT 1 FROM software_cve sc
+				JOIN host_software hs ON hs.software_id = sc.software_id
+				WHERE sc.cve = cm.cve
+			)
+			OR EXISTS (SELECT 1 FROM operating_system_vulnerabilities osv WHERE osv.cve = cm.cve)
+		)
+	`
+	if opts.OrderKey == "" {
+		opts.OrderKey = "cisa_due_date"
+	}
+	stmt = appendListOptionsToSQL(stmt, &opts)
+
+	// a cve is overdue the day after its due date
+	asOfDate := asOf.UTC().Format("2006-01-02")
+
+	var cves []fleet.CVEMeta
+	if err := sqlx.SelectContext(ctx, ds.reader, &cves, stmt, asOfDate); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select overdue cves")
+	}
+	return cves, nil
+}
+
+func (ds *Datastore) FleetKnownExploitedCVEs(ctx context.Context, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	stmt := `
+		SELECT
+			cm.cve,
+			cm.cvss_score,
+			cm.epss_probability,
+			cm.cisa_known_exploit,
+			cm.published,
+			cm.cvss_exploitability_score,
+			cm.cvss_impact_score,
+			cm.cvss_vector,
+			cm.last_modified,
+			cm.cvss_source,
+			cm.cisa_due_date,
+			cm.cisa_date_added
+		FROM cve_meta cm
+		WHERE cm.cisa_known_exploit = 1
+		AND (
+			EXISTS (
+				SELECT 1 FROM software_cve sc
+				JOIN host_software hs ON hs.software_id = sc.software_id
+				WHERE sc.cve = cm.cve
+			)
+			OR EXISTS (SELECT 1 FROM operating_system_vulnerabilities osv WHERE osv.cve = cm.cve)
+		)
+	`
+	if opts.OrderKey == "" {
+		opts.OrderKey = "cisa_date_added"
+		opts.OrderDirection = fleet.OrderDescending
+	}
+	stmt = appendListOptionsToSQL(stmt, &opts)
+
+	var cves []fleet.CVEMeta
+	if err := sqlx.SelectContext(ctx, ds.reader, &cves, stmt); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select fleet known exploited cves")
+	}
+	return cves, nil
+}
+
+// hostVulnerabilitySummaryColumns are the columns of a fleet.HostVulnerabilitySummary, aggregated over the cve_meta
+// rows (aliased cm) of the CVEs of a host.
+var hostVulnerabilitySummaryColumns = fmt.Sprintf(`
+			MAX(cm.cvss_score) AS max_cvss_score,
+			COALESCE(SUM(cm.cvss_score >= 9.0), 0) AS critical_count,
+			COALESCE(SUM(cm.cvss_score >= 7.0 AND cm.cvss_score < 9.0), 0) AS high_count,
+			COALESCE(SUM(cm.cvss_score >= 4.0 AND cm.cvss_score < 7.0), 0) AS medium_count,
+			COALESCE(SUM(cm.cvss_score < 4.0), 0) AS low_count,
+			COALESCE(SUM(cm.cvss_score IS NULL), 0) AS unscored_count,
+			COALESCE(MAX(cm.cisa_known_exploit), 0) AS cisa_known_exploit,
+			COALESCE(SUM(cm.cisa_known_exploit = 1), 0) AS known_exploit_count,
+			COALESCE(
+				%d * SUM(cm.cisa_known_exploit = 1) +
+				%d * SUM(cm.cvss_score >= 9.0) +
+				%d * SUM(cm.cvss_score >= 7.0 AND cm.cvss_score < 9.0) +
+				%d * SUM(cm.cvss_score >= 4.0 AND cm.cvss_score < 7.0),
+			0) AS risk_score`,
+	fleet.RiskScoreKnownExploitWeight, fleet.RiskScoreCriticalWeight, fleet.RiskScoreHighWeight, fleet.RiskScoreMediumWeight)
+
+func (ds *Datastore) HostVulnerabilitySummary(ctx context.Context, hostID uint) (*fleet.HostVulnerabilitySummary, error) {
+	// each CVE is counted once, even if it affects multiple software of the host or both its software and its
+	// operating system
+	stmt := `
+		SELECT ` + hostVulnerabilitySummaryColumns + `
+		FROM (
+			SELECT sc.cve
+			FROM host_software hs
+			JOIN software_cve sc ON sc.software_id = hs.software_id
+			WHERE hs.host_id = ?
+			UNION
+			SELECT osv.cve
+			FROM operating_system_vulnerabilities osv
+			WHERE osv.host_id = ?
+		) c
+		LEFT JOIN cve_meta cm ON cm.cve = c.cve
+	`
+
+	summary := fleet.HostVulnerabilitySummary{HostID: hostID}
+	if err := sqlx.GetContext(ctx, ds.reader, &summary, stmt, hostID, hostID); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "get host vulnerability summary")
+	}
+	return &summary, nil
+}
+
+func (ds *Datastore) MostVulnerableHosts(ctx context.Context, limit int, opts fleet.MostVulnerableHostsOptions) ([]fleet.HostVulnerabilitySummary, error) {
+	if limit <= 0 {
+		return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("limit", "must be positive"))
+	}
+
+	var args []interface{}
+	teamFilter := "TRUE"
+	if opts.TeamID != nil {
+		teamFilter = "h.team_id = ?"
+		// once for the software CVEs and once for the operating system ones
+		args = append(args, *opts.TeamID, *opts.TeamID)
+	}
+	args = append(args, limit)
+
+	// each CVE is counted once per host, even if it affects multiple software of the host or both its software and
+	// its operating system, like in HostVulnerabilitySummary
+	stmt := `
+		SELECT
+			c.host_id, ` + hostVulnerabilitySummaryColumns + `
+		FROM (
+			SELECT hs.host_id, sc.cve
+			FROM host_software hs
+			JOIN software_cve sc ON sc.software_id = hs.software_id
+			JOIN hosts h ON h.id = hs.host_id
+			WHERE ` + teamFilter + `
+			UNION
+			SELECT osv.host_id, osv.cve
+			FROM operating_system_vulnerabilities osv
+			JOIN hosts h ON h.id = osv.host_id
+			WHERE ` + teamFilter + `
+		) c
+		LEFT JOIN cve_meta cm ON cm.cve = c.cve
+		GROUP BY c.host_id
+		ORDER BY risk_score DESC, critical_count DESC, max_cvss_score DESC, c.host_id
+		LIMIT ?
+	`
+
+	var summaries []fleet.HostVulnerabilitySummary
+	if err := sqlx.SelectContext(ctx, ds.reader, &summaries, stmt, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select most vulnerable hosts")
+	}
+	return summaries, nil
+}
+
+func (ds *Datastore) CleanHosts(ctx context.Context, opts fleet.CleanHostsOptions) ([]*fleet.CleanHost, error) {
+	stmt := `
+		SELECT
+			h.id,
+			h.osquery_host_id,
+			h.created_at,
+			h.updated_at,
+			h.hostname,
+			h.uuid,
+			h.platform,
+			h.hardware_serial,
+			h.computer_name,
+			h.team_id,
+			h.last_enrolled_at,
+			COALESCE(hst.seen_time, h.created_at) AS seen_time,
+			NOT EXISTS (SELECT 1 FROM host_software hs WHERE hs.host_id = h.id) AS unscanned
+		FROM hosts h
+		LEFT JOIN host_seen_times hst ON hst.host_id = h.id
+		WHERE NOT EXISTS (
+			SELECT 1 FROM host_software hs
+			JOIN software_cve sc ON sc.software_id = hs.software_id
+			WHERE hs.host_id = h.id
+		)
+		AND NOT EXISTS (SELECT 1 FROM operating_system_vulnerabilities osv WHERE osv.host_id = h.id)
+	`
+	var args []interface{}
+	if opts.LabelID != nil {
+		stmt += ` AND EXISTS (SELECT 1 FROM label_membership lm WHERE lm.host_id = h.id AND lm.label_id = ?)`
+		args = append(args, *opts.LabelID)
+	}
+	if opts.OrderKey == "" {
+		opts.OrderKey = "id"
+	}
+	opts.OrderKey = defaultHostColumnTableAlias(opts.OrderKey)
+	stmt = appendListOptionsToSQL(stmt, &opts.ListOptions)
+
+	hosts := []*fleet.CleanHost{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, stmt, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select clean hosts")
+	}
+	return hosts, nil
+}
+
+func (ds *Datastore) HostsBySeverity(ctx context.Context, minSeverity string, opts fleet.ListOptions) ([]fleet.Host, error) {
+	minScore, ok := fleet.CVSSSeverityMinScore(minSeverity)
+	if !ok {
+		return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("min_severity", fmt.Sprintf("unknown severity %q", minSeverity)))
+	}
+
+	stmt := `
+		SELECT
+			h.id,
+			h.osquery_host_id,
+			h.created_at,
+			h.updated_at,
+			h.hostname,
+			h.uuid,
+			h.platform,
+			h.hardware_serial,
+			h.computer_name,
+			h.team_id,
+			h.last_enrolled_at,
+			COALESCE(hst.seen_time, h.created_at) AS seen_time
+		FROM hosts h
+		LEFT JOIN host_seen_times hst ON hst.host_id = h.id
+		WHERE EXISTS (
+			SELECT 1 FROM host_software hs
+			JOIN software_cve sc ON sc.software_id = hs.software_id
+			JOIN cve_meta cm ON cm.cve = sc.cve
+			WHERE hs.host_id = h.id AND cm.cvss_score >= ?
+		) OR EXISTS (
+			SELECT 1 FROM operating_system_vulnerabilities osv
+			JOIN cve_meta cm ON cm.cve = osv.cve
+			WHERE osv.host_id = h.id AND cm.cvss_score >= ?
+		)
+	`
+	if opts.OrderKey == "" {
+		opts.OrderKey = "id"
+	}
+	opts.OrderKey = defaultHostColumnTableAlias(opts.OrderKey)
+	stmt = appendListOptionsToSQL(stmt, &opts)
+
+	hosts := []fleet.Host{}
+	if err := sqlx.SelectContext(ctx, ds.reader, &hosts, stmt, minScore, minScore); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select hosts by severity")
+	}
+	return hosts, nil
+}
+
+func (ds *Datastore) ListSoftwareTitles(ctx context.Context, opts fleet.ListOptions) ([]fleet.SoftwareTitle, error) {
+	if opts.OrderKey == "" {
+		opts.OrderKey = "name"
+	}
+
+	stmt := `
+		SELECT
+			s.name,
+			s.source,
+			COUNT(DISTINCT s.id) AS versions_count,
+			COUNT(DISTINCT hs.host_id) AS hosts_count,
+			COUNT(DISTINCT sc.cve) AS vulnerabilities_count
+		FROM software s
+		JOIN host_software hs ON hs.software_id = s.id
+		LEFT JOIN software_cve sc ON sc.software_id = s.id
+		GROUP BY s.name, s.source
+	`
+	stmt = appendListOptionsToSQL(stmt, &opts)
+
+	var titles []fleet.SoftwareTitle
+	if err := sqlx.SelectContext(ctx, ds.reader, &titles, stmt); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select software titles")
+	}
+	return titles, nil
+}
+
+func (ds *Datastore) HostCVEs(ctx context.Context, hostID uint, opts fleet.ListOptions) ([]fleet.HostCVE, error) {
+	if opts.OrderKey == "" {
+		opts.OrderKey = "cve"
+	}
+
+	// the CVEs of the operating system are matched to it rather than to a software, see fleet.HostCVE
+	stmt := `
+		SELECT * FROM (
+			SELECT
+				sc.cve,
+				s.id AS software_id,
+				0 AS operating_system_id,
+				s.name AS software_name,
+				s.version AS software_version,
+				s.source AS software_source,
+				cm.cvss_score,
+				cm.epss_probability,
+				cm.cisa_known_exploit,
+				cm.published
+			FROM host_software hs
+			JOIN software s ON s.id = hs.software_id
+			JOIN software_cve sc ON sc.software_id = hs.software_id
+			LEFT JOIN cve_meta cm ON cm.cve = sc.cve
+			WHERE hs.host_id = ?
+			UNION ALL
+			SELECT
+				osv.cve,
+				0 AS software_id,
+				os.id AS operating_system_id,
+				os.name AS software_name,
+				os.version AS software_version,
+				'' AS software_source,
+				cm.cvss_score,
+				cm.epss_probability,
+				cm.cisa_known_exploit,
+				cm.published
+			FROM operating_system_vulnerabilities osv
+			JOIN operating_systems os ON os.id = osv.operating_system_id
+			LEFT JOIN cve_meta cm ON cm.cve = osv.cve
+			WHERE osv.host_id = ?
+		) c
+	`
+	stmt = appendListOptionsToSQL(stmt, &opts)
+
+	var cves []fleet.HostCVE
+	if err := sqlx.SelectContext(ctx, ds.reader, &cves, stmt, hostID, hostID); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select host cves")
+	}
+	return cves, nil
+}
+
+func (ds *Datastore) InsertEPSSSnapshots(ctx context.Context, snapshots []fleet.EPSSSnapshot) error {
+	query := `
+INSERT INTO epss_snapshots (cve, snapshot_date, score, percentile)
+VALUES %s
+ON DUPLICATE KEY UPDATE
+    score = VALUES(score),
+    percentile = VALUES(percentile)
+`
+
+	batchSize := 500
+	for i := 0; i < len(snapshots); i += batchSize {
+		end := i + batchSize
+		if end > len(snapshots) {
+			end = len(snapshots)
+		}
+
+		batch := snapshots[i:end]
+
+		valuesFrag := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?), ", len(batch)), ", ")
+		var args []interface{}
+		for _, snapshot := range batch {
+			args = append(args, snapshot.CVE, snapshot.SnapshotDate.Format("2006-01-02"), snapshot.Score, snapshot.Percentile)
+		}
+
+		query := fmt.Sprintf(query, valuesFrag)
+
+		_, err := ds.writer.ExecContext(ctx, query, args...)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "insert epss snapshots")
+		}
+	}
+
+	return nil
+}
+
+func (ds *Datastore) ListEPSSSnapshots(ctx context.Context, cve string) ([]fleet.EPSSSnapshot, error) {
+	var result []fleet.EPSSSnapshot
+
+	stmt := `
+		SELECT cve, snapshot_date, score, percentile
+		FROM epss_snapshots
+		WHERE cve = ?
+		ORDER BY snapshot_date
+	`
+	if err := sqlx.SelectContext(ctx, ds.reader, &result, stmt, cve); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list epss snapshots")
+	}
+
+	return result, nil
+}
+
+func (ds *Datastore) InsertEPSSModelScores(ctx context.Context, scores []fleet.EPSSModelScore) error {
+	return insertEPSSModelScoresDB(ctx, ds.writer, scores)
+}
+
+func insertEPSSModelScoresDB(ctx context.Context, exec sqlx.ExecerContext, scores []fleet.EPSSModelScore) error {
+	query := `
+INSERT INTO epss_model_scores (cve, model_version, score)
+VALUES %s
+ON DUPLICATE KEY UPDATE
+    score = VALUES(score)
+`
+
+	batchSize := 500
+	for i := 0; i < len(scores); i += batchSize {
+		end := i + batchSize
+		if end > len(scores) {
+			end = len(scores)
+		}
+
+		batch := scores[i:end]
+
+		valuesFrag := strings.TrimSuffix(strings.Repeat("(?, ?, ?), ", len(batch)), ", ")
+		var args []interface{}
+		for _, score := range batch {
+			args = append(args, score.CVE, score.ModelVersion, score.Score)
+		}
+
+		query := fmt.Sprintf(query, valuesFrag)
+
+		_, err := exec.ExecContext(ctx, query, args...)
+		if err != nil {
+			return ctxerr.Wrap(ctx, err, "insert epss model scores")
+		}
+	}
+
+	return nil
+}
+
+func (ds *Datastore) ListEPSSModelScores(ctx context.Context, cve string) ([]fleet.EPSSModelScore, error) {
+	var result []fleet.EPSSModelScore
+
+	stmt := `
+		SELECT cve, model_version, score
+		FROM epss_model_scores
+		WHERE cve = ?
+		ORDER BY model_version
+	`
+	if err := sqlx.SelectContext(ctx, ds.reader, &result, stmt, cve); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "list epss model scores")
+	}
+
+	return result, nil
+}
+
+func (ds *Datastore) CVEsByLabel(ctx context.Context, labelID uint, opts fleet.CVEsByLabelOptions) ([]fleet.CVEMeta, error) {
+	stmt := `
+		SELECT
+			v.cve,
+			cm.cvss_score,
+			cm.epss_probability,
+			cm.cisa_known_exploit,
+			cm.published,
+			cm.cvss_exploitability_score,
+			cm.cvss_impact_score,
+			cm.cvss_vector,
+			cm.last_modified,
+			cm.cvss_source
+		FROM (
+			SELECT sc.cve
+			FROM label_membership lm
+			JOIN host_software hs ON hs.host_id = lm.host_id
+			JOIN software_cve sc ON sc.software_id = hs.software_id
+			WHERE lm.label_id = ?
+			UNION
+			SELECT osv.cve
+			FROM label_membership lm
+			JOIN operating_system_vulnerabilities osv ON osv.host_id = lm.host_id
+			WHERE lm.label_id = ?
+		) v
+		LEFT JOIN cve_meta cm ON cm.cve = v.cve
+	`
+	args := []interface{}{labelID, labelID}
+	if opts.MinCVSSScore != nil {
+		stmt += ` WHERE cm.cvss_score >= ?`
+		args = append(args, *opts.MinCVSSScore)
+	}
+
+	if opts.OrderKey == "" {
+		opts.OrderKey = "cve"
+	}
+	stmt = appendListOptionsToSQL(stmt, &opts.ListOptions)
+
+	var cves []fleet.CVEMeta
+	if err := sqlx.SelectContext(ctx, ds.reader, &cves, stmt, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select cves by label")
+	}
+	return cves, nil
+}
+
+func (ds *Datastore) InsertCVECWEs(ctx context.Context, cwes []fleet.CVECWE) error {
+	return insertCVECWEsDB(ctx, ds.writer, cwes)
+}
+
+func insertCVECWEsDB(ctx context.Context, exec sqlx.ExecerContext, cwes []fleet.CVECWE) error {
+	query := `INSERT IGNORE INTO cve_cwes (cve, cwe) VALUES %s`
+
+	batchSize := 500
+	for i := 0; i < len(cwes); i += batchSize {
+		end := i + batchSize
+		if end > len(cwes) {
+			end = len(cwes)
+		}
+
+		batch := cwes[i:end]
+
+		valuesFrag := strings.TrimSuffix(strings.Repeat("(?, ?), ", len(batch)), ", ")
+		var args []interface{}
+		for _, cwe := range batch {
+			args = append(args, cwe.CVE, cwe.CWE)
+		}
+
+		if _, err := exec.ExecContext(ctx, fmt.Sprintf(query, valuesFrag), args...); err != nil {
+			return ctxerr.Wrap(ctx, err, "insert cve cwes")
+		}
+	}
+
+	return nil
+}
+
+func (ds *Datastore) CVEsByCWE(ctx context.Context, cweID string, opts fleet.CVEsByCWEOptions) ([]fleet.CVEMeta, error) {
+	if cweID == "" {
+		return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("cwe", "must not be empty"))
+	}
+
+	stmt := `
+		SELECT
+			cm.cve,
+			cm.cvss_score,
+			cm.epss_probability,
+			cm.cisa_known_exploit,
+			cm.published,
+			cm.cvss_exploitability_score,
+			cm.cvss_impact_score,
+			cm.cvss_vector,
+			cm.last_modified,
+			cm.cvss_source
+		FROM cve_cwes cc
+		JOIN cve_meta cm ON cm.cve = cc.cve
+		WHERE cc.cwe = ?
+	`
+	if opts.AffectingHostsOnly {
+		stmt += ` AND (
+			EXISTS (
+				SELECT 1 FROM software_cve sc
+				JOIN host_software hs ON hs.software_id = sc.software_id
+				WHERE sc.cve = cc.cve
+			)
+			OR EXISTS (SELECT 1 FROM operating_system_vulnerabilities osv WHERE osv.cve = cc.cve)
+		)`
+	}
+
+	if opts.OrderKey == "" {
+		opts.OrderKey = "cve"
+	}
+	stmt = appendListOptionsToSQL(stmt, &opts.ListOptions)
+
+	var cves []fleet.CVEMeta
+	if err := sqlx.SelectContext(ctx, ds.reader, &cves, stmt, cweID); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select cves by cwe")
+	}
+	return cves, nil
+}
+
+func (ds *Datastore) InsertCVEProducts(ctx context.Context, products []fleet.CVEProduct) error {
+	return insertCVEProductsDB(ctx, ds.writer, products)
+}
+
+func insertCVEProductsDB(ctx context.Context, exec sqlx.ExecerContext, products []fleet.CVEProduct) error {
+	query := `INSERT IGNORE INTO cve_products (cve, vendor, product) VALUES %s`
+
+	batchSize := 500
+	for i := 0; i < len(products); i += batchSize {
+		end := i + batchSize
+		if end > len(products) {
+			end = len(products)
+		}
+
+		batch := products[i:end]
+
+		valuesFrag := strings.TrimSuffix(strings.Repeat("(?, ?, ?), ", len(batch)), ", ")
+		var args []interface{}
+		for _, p := range batch {
+			args = append(args, p.CVE, p.Vendor, p.Product)
+		}
+
+		if _, err := exec.ExecContext(ctx, fmt.Sprintf(query, valuesFrag), args...); err != nil {
+			return ctxerr.Wrap(ctx, err, "insert cve products")
+		}
+	}
+
+	return nil
+}
+
+func (ds *Datastore) CVEsByVendorProduct(ctx context.Context, vendor, product string, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	if vendor == "" {
+		return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("vendor", "must not be empty"))
+	}
+	if product == "" {
+		return nil, ctxerr.Wrap(ctx, fleet.NewInvalidArgumentError("product", "must not be empty"))
+	}
+
+	stmt := `
+		SELECT
+			cm.cve,
+			cm.cvss_score,
+			cm.epss_probability,
+			cm.cisa_known_exploit,
+			cm.published,
+			cm.cvss_exploitability_score,
+			cm.cvss_impact_score,
+			cm.cvss_vector,
+			cm.last_modified,
+			cm.cvss_source
+		FROM cve_products cp
+		JOIN cve_meta cm ON cm.cve = cp.cve
+		WHERE cp.vendor = ? AND cp.product = ?
+	`
+	if opts.OrderKey == "" {
+		opts.OrderKey = "cve"
+	}
+	stmt = appendListOptionsToSQL(stmt, &opts)
+
+	var cves []fleet.CVEMeta
+	if err := sqlx.SelectContext(ctx, ds.reader, &cves, stmt, vendor, product); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select cves by vendor product")
+	}
+	return cves, nil
+}
+
+func (ds *Datastore) CountFleetCVEs(ctx context.Context, opts fleet.CountCVEsOptions) (int, error) {
+	// software CVEs are only counted if the software is installed on a host
+	stmt := `
+		SELECT COUNT(DISTINCT v.cve)
+		FROM (
+			SELECT sc.cve
+			FROM software_cve sc
+			WHERE EXISTS (SELECT 1 FROM host_software hs WHERE hs.software_id = sc.software_id)
+			UNION
+			SELECT osv.cve
+			FROM operating_system_vulnerabilities osv
+		) v
+	`
+	var args []interface{}
+	if opts.MinCVSSScore != nil {
+		stmt += ` JOIN cve_meta cm ON cm.cve = v.cve WHERE cm.cvss_score >= ?`
+		args = append(args, *opts.MinCVSSScore)
+	}
+
+	var count int
+	if err := sqlx.GetContext(ctx, ds.reader, &count, stmt, args...); err != nil {
+		return 0, ctxerr.Wrap(ctx, err, "count fleet cves")
+	}
+	return count, nil
+}
+
+func (ds *Datastore) CVECountByYear(ctx context.Context, opts fleet.CountCVEsOptions) (map[int]int, error) {
+	// software CVEs are only counted if the software is installed on a host
+	stmt := `
+		SELECT YEAR(cm.published) AS year, COUNT(DISTINCT v.cve) AS count
+		FROM (
+			SELECT sc.cve
+			FROM software_cve sc
+			WHERE EXISTS (SELECT 1 FROM host_software hs WHERE hs.software_id = sc.software_id)
+			UNION
+			SELECT osv.cve
+			FROM operating_system_vulnerabilities osv
+		) v
+		JOIN cve_meta cm ON cm.cve = v.cve
+		WHERE cm.published IS NOT NULL
+	`
+	var args []interface{}
+	if opts.MinCVSSScore != nil {
+		stmt += ` AND cm.cvss_score >= ?`
+		args = append(args, *opts.MinCVSSScore)
+	}
+	stmt += ` GROUP BY YEAR(cm.published)`
+
+	var rows []struct {
+		Year  int `db:"year"`
+		Count int `db:"count"`
+	}
+	if err := sqlx.SelectContext(ctx, ds.reader, &rows, stmt, args...); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "count fleet cves by year")
+	}
+
+	counts := make(map[int]int, len(rows))
+	for _, r := range rows {
+		counts[r.Year] = r.Count
+	}
+	return counts, nil
+}
+
+func (ds *Datastore) RecordFleetCVECountSnapshot(ctx context.Context, snapshotDate time.Time, cveCount int) error {
+	return recordFleetCVECountSnapshotDB(ctx, ds.writer, snapshotDate, cveCount)
+}
+
+func recordFleetCVECountSnapshotDB(ctx context.Context, exec sqlx.ExecerContext, snapshotDate time.Time, cveCount int) error {
+	stmt := `
+		INSERT INTO fleet_cve_count_snapshots (snapshot_date, cve_count)
+		VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE
+			cve_count = VALUES(cve_count)
+	`
+	if _, err := exec.ExecContext(ctx, stmt, snapshotDate.Format("2006-01-02"), cveCount); err != nil {
+		return ctxerr.Wrap(ctx, err, "record fleet cve count snapshot")
+	}
+	return nil
+}
+
+func (ds *Datastore) FleetCVETrend(ctx context.Context, since time.Time) ([]fleet.FleetCVECountSnapshot, error) {
+	stmt := `
+		SELECT snapshot_date, cve_count
+		FROM fleet_cve_count_snapshots
+		WHERE snapshot_date >= ?
+		ORDER BY snapshot_date
+	`
+	var trend []fleet.FleetCVECountSnapshot
+	if err := sqlx.SelectContext(ctx, ds.reader, &trend, stmt, since.Format("2006-01-02")); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select fleet cve trend")
+	}
+	return trend, nil
+}
+
+func (ds *Datastore) RecordHostCVECountSnapshot(ctx context.Context, hostID uint, snapshotDate time.Time, cveCount int) error {
+	stmt := `
+		INSERT INTO host_cve_count_snapshots (host_id, snapshot_date, cve_count)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE
+			cve_count = VALUES(cve_count)
+	`
+	if _, err := ds.writer.ExecContext(ctx, stmt, hostID, snapshotDate.Format("2006-01-02"), cveCount); err != nil {
+		return ctxerr.Wrap(ctx, err, "record host cve count snapshot")
+	}
+	return nil
+}
+
+// hostCVECountSnapshotsRetention is how long the CVE count snapshots of the hosts are kept.
+const hostCVECountSnapshotsRetention = 90 * 24 * time.Hour
+
+func (ds *Datastore) RecordHostCVECountSnapshots(ctx context.Context, snapshotDate time.Time) error {
+	stmt := `
+		INSERT INTO host_cve_count_snapshots (host_id, snapshot_date, cve_count)
+		SELECT c.host_id, ?, c.cve_count
+		FROM (
+			SELECT h.id AS host_id, COUNT(DISTINCT v.cve) AS cve_count
+			FROM hosts h
+			LEFT JOIN (
+				SELECT hs.host_id, sc.cve
+				FROM host_software hs
+				JOIN software_cve sc ON sc.software_id = hs.software_id
+				UNION
+				SELECT osv.host_id, osv.cve
+				FROM operating_system_vulnerabilities osv
+			) v ON v.host_id = h.id
+			GROUP BY h.id
+		) c
+		ON DUPLICATE KEY UPDATE
+			cve_count = VALUES(cve_count)
+	`
+	if _, err := ds.writer.ExecContext(ctx, stmt, snapshotDate.Format("2006-01-02")); err != nil {
+		return ctxerr.Wrap(ctx, err, "record host cve count snapshots")
+	}
+
+	// a snapshot of every host is recorded every day, the old snapshots are dropped as the new ones come in
+	if _, err := ds.writer.ExecContext(ctx,
+		`DELETE FROM host_cve_count_snapshots WHERE snapshot_date < ?`,
+		snapshotDate.Add(-hostCVECountSnapshotsRetention).Format("2006-01-02"),
+	); err != nil {
+		return ctxerr.Wrap(ctx, err, "delete old host cve count snapshots")
+	}
+	return nil
+}
+
+func (ds *Datastore) HostCVETrend(ctx context.Context, hostID uint, since time.Time) ([]fleet.HostCVECountSnapshot, error) {
+	stmt := `
+		SELECT host_id, snapshot_date, cve_count
+		FROM host_cve_count_snapshots
+		WHERE host_id = ? AND snapshot_date >= ?
+		ORDER BY snapshot_date
+	`
+	var trend []fleet.HostCVECountSnapshot
+	if err := sqlx.SelectContext(ctx, ds.reader, &trend, stmt, hostID, since.Format("2006-01-02")); err != nil {
+		return nil, ctxerr.Wrap(ctx, err, "select host cve trend")
+	}
+	return trend, nil
+}
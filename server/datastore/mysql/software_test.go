@@ -2,10 +2,12 @@ package mysql
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -13,6 +15,7 @@ import (
 	"github.com/fleetdm/fleet/v4/server/ptr"
 	"github.com/fleetdm/fleet/v4/server/test"
 	"github.com/fleetdm/fleet/v4/server/vulnerabilities/oval"
+	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -29,12 +32,14 @@ func TestSoftware(t *testing.T) {
 		{"HostDuplicates", testSoftwareHostDuplicates},
 		{"LoadVulnerabilities", testSoftwareLoadVulnerabilities},
 		{"ListSoftwareCPEs", testListSoftwareCPEs},
+		{"ListHostSoftwareCPEs", testListHostSoftwareCPEs},
 		{"NothingChanged", testSoftwareNothingChanged},
 		{"LoadSupportsTonsOfCVEs", testSoftwareLoadSupportsTonsOfCVEs},
 		{"List", testSoftwareList},
 		{"SyncHostsSoftware", testSoftwareSyncHostsSoftware},
 		{"DeleteSoftwareVulnerabilities", testDeleteSoftwareVulnerabilities},
 		{"HostsByCVE", testHostsByCVE},
+		{"HostsByCVEOrder", testHostsByCVEOrder},
 		{"HostsBySoftwareIDs", testHostsBySoftwareIDs},
 		{"UpdateHostSoftware", testUpdateHostSoftware},
 		{"ListSoftwareBySourceIter", testListSoftwareBySourceIter},
@@ -42,8 +47,37 @@ func TestSoftware(t *testing.T) {
 		{"ListSoftwareVulnerabilitiesByHostIDsSource", testListSoftwareVulnerabilitiesByHostIDsSource},
 		{"InsertSoftwareVulnerabilities", testInsertSoftwareVulnerabilities},
 		{"ListCVEs", testListCVEs},
+		{"NewCVEsSince", testNewCVEsSince},
+		{"CVEMetaChangedSince", testCVEMetaChangedSince},
+		{"CVEsWithoutCVSS", testCVEsWithoutCVSS},
+		{"OverdueCVEs", testOverdueCVEs},
+		{"FleetKnownExploitedCVEs", testFleetKnownExploitedCVEs},
+		{"HostCVEs", testHostCVEs},
+		{"UpsertCVEMeta", testUpsertCVEMeta},
+		{"LastCVESyncInfo", testLastCVESyncInfo},
+		{"SyncAttempts", testSyncAttempts},
+		{"WithCVEMetaTx", testWithCVEMetaTx},
+		{"EPSSCoverage", testEPSSCoverage},
+		{"LastCISACatalogVersion", testLastCISACatalogVersion},
+		{"PruneCVEMeta", testPruneCVEMeta},
+		{"LockCVEMetaLoad", testLockCVEMetaLoad},
+		{"CVEMetaProvenance", testCVEMetaProvenance},
+		{"HostVulnerabilitySummary", testHostVulnerabilitySummary},
+		{"MostVulnerableHosts", testMostVulnerableHosts},
+		{"CleanHosts", testCleanHosts},
+		{"HostsBySeverity", testHostsBySeverity},
+		{"EPSSSnapshots", testEPSSSnapshots},
+		{"EPSSModelScores", testEPSSModelScores},
+		{"CVEsByLabel", testCVEsByLabel},
+		{"CVEsByCWE", testCVEsByCWE},
+		{"CVEsByVendorProduct", testCVEsByVendorProduct},
+		{"CountFleetCVEs", testCountFleetCVEs},
+		{"CVECountByYear", testCVECountByYear},
+		{"FleetCVETrend", testFleetCVETrend},
+		{"HostCVETrend", testHostCVETrend},
 		{"ListSoftwareForVulnDetection", testListSoftwareForVulnDetection},
 		{"SoftwareByID", testSoftwareByID},
+		{"ListSoftwareTitles", testListSoftwareTitles},
 	}
 	for _, c := range cases {
 		t.Run(c.name, func(t *testing.T) {
@@ -323,6 +357,46 @@ func testListSoftwareCPEs(t *testing.T, ds *Datastore) {
 	assert.ElementsMatch(t, actual, expected)
 }
 
+func testListHostSoftwareCPEs(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	host1 := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	host2 := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+
+	software := []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "bar", Version: "0.0.1", Source: "apps"},
+		{Name: "baz", Version: "0.0.1", Source: "apps"},
+	}
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host1.ID, software[:2]))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host2.ID, software[1:]))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host2, false))
+	for _, s := range host2.Software {
+		require.NoError(t, ds.AddCPEForSoftware(ctx, s, "cpe:"+s.Name))
+	}
+
+	cpeList := func(hostID uint) []string {
+		cpes, err := ds.ListHostSoftwareCPEs(ctx, hostID)
+		require.NoError(t, err)
+		var list []string
+		for _, cpe := range cpes {
+			list = append(list, cpe.CPE)
+		}
+		return list
+	}
+
+	// foo has no cpe
+	require.Equal(t, []string{"cpe:bar"}, cpeList(host1.ID))
+	require.ElementsMatch(t, []string{"cpe:bar", "cpe:baz"}, cpeList(host2.ID))
+
+	// the cpes follow the software of the host
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host1.ID, software[2:]))
+	require.Equal(t, []string{"cpe:baz"}, cpeList(host1.ID))
+
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host1.ID, nil))
+	require.Empty(t, cpeList(host1.ID))
+}
+
 func testSoftwareNothingChanged(t *testing.T, ds *Datastore) {
 	cases := []struct {
 		desc     string
@@ -1224,14 +1298,14 @@ func testDeleteSoftwareVulnerabilities(t *testing.T, ds *Datastore) {
 func testHostsByCVE(t *testing.T, ds *Datastore) {
 	ctx := context.Background()
 
-	hosts, err := ds.HostsByCVE(ctx, "CVE-0000-0000")
+	hosts, err := ds.HostsByCVE(ctx, "CVE-0000-0000", fleet.HostsByCVEOptions{})
 	require.NoError(t, err)
 	require.Len(t, hosts, 0)
 
 	insertVulnSoftwareForTest(t, ds)
 
 	// CVE of foo chrome 0.0.3, both hosts have it
-	hosts, err = ds.HostsByCVE(ctx, "CVE-2022-0001")
+	hosts, err = ds.HostsByCVE(ctx, "CVE-2022-0001", fleet.HostsByCVEOptions{})
 	require.NoError(t, err)
 	require.Len(t, hosts, 2)
 	require.ElementsMatch(t, hosts, []*fleet.HostShort{
@@ -1247,12 +1321,62 @@ func testHostsByCVE(t *testing.T, ds *Datastore) {
 	})
 
 	// CVE of bar.rpm 0.0.3, only host 2 has it
-	hosts, err = ds.HostsByCVE(ctx, "CVE-2022-0002")
+	hosts, err = ds.HostsByCVE(ctx, "CVE-2022-0002", fleet.HostsByCVEOptions{})
 	require.NoError(t, err)
 	require.Len(t, hosts, 1)
 	require.Equal(t, hosts[0].Hostname, "host2")
 }
 
+func testHostsByCVEOrder(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	insertVulnSoftwareForTest(t, ds)
+	host1, err := ds.HostByIdentifier(ctx, "host1")
+	require.NoError(t, err)
+	host2, err := ds.HostByIdentifier(ctx, "host2")
+	require.NoError(t, err)
+
+	// host2 was seen last, only host1 is internet-facing
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, ds.MarkHostsSeen(ctx, []uint{host1.ID}, now.Add(-time.Hour)))
+	require.NoError(t, ds.MarkHostsSeen(ctx, []uint{host2.ID}, now))
+	label, err := ds.NewLabel(ctx, &fleet.Label{Name: "internet-facing", Query: "select 1"})
+	require.NoError(t, err)
+	require.NoError(t, ds.RecordLabelQueryExecutions(ctx, host1, map[uint]*bool{label.ID: ptr.Bool(true)}, now, false))
+
+	hostIDs := func(opts fleet.HostsByCVEOptions) []uint {
+		hosts, err := ds.HostsByCVE(ctx, "CVE-2022-0001", opts)
+		require.NoError(t, err)
+		var ids []uint
+		for _, h := range hosts {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	cases := []struct {
+		desc string
+		opts fleet.HostsByCVEOptions
+		want []uint
+	}{
+		{"default", fleet.HostsByCVEOptions{}, []uint{host1.ID, host2.ID}},
+		{"id desc", fleet.HostsByCVEOptions{OrderKey: "id", OrderDirection: fleet.OrderDescending}, []uint{host2.ID, host1.ID}},
+		{"seen_time asc", fleet.HostsByCVEOptions{OrderKey: "seen_time"}, []uint{host1.ID, host2.ID}},
+		{"seen_time desc", fleet.HostsByCVEOptions{OrderKey: "seen_time", OrderDirection: fleet.OrderDescending}, []uint{host2.ID, host1.ID}},
+		{"label", fleet.HostsByCVEOptions{LabelID: &label.ID, OrderDirection: fleet.OrderDescending}, []uint{host1.ID, host2.ID}},
+		{"label then seen_time desc", fleet.HostsByCVEOptions{LabelID: &label.ID, OrderKey: "seen_time", OrderDirection: fleet.OrderDescending}, []uint{host1.ID, host2.ID}},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			require.Equal(t, c.want, hostIDs(c.opts))
+		})
+	}
+
+	_, err = ds.HostsByCVE(ctx, "CVE-2022-0001", fleet.HostsByCVEOptions{OrderKey: "hostname"})
+	var invalid *fleet.InvalidArgumentError
+	require.ErrorAs(t, err, &invalid)
+}
+
 func testHostsBySoftwareIDs(t *testing.T, ds *Datastore) {
 	ctx := context.Background()
 
@@ -1601,8 +1725,10 @@ func testListCVEs(t *testing.T, ds *Datastore) {
 	twoWeeksAgo := now.Add(-14 * 24 * time.Hour)
 	twoMonthsAgo := now.Add(-60 * 24 * time.Hour)
 
+	dateAdded := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	dueDate := time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC)
 	testCases := []fleet.CVEMeta{
-		{CVE: "cve-1", Published: &threeDaysAgo},
+		{CVE: "cve-1", Published: &threeDaysAgo, CISAKnownExploit: ptr.Bool(true), CISADateAdded: &dateAdded, CISADueDate: &dueDate},
 		{CVE: "cve-2", Published: &twoWeeksAgo},
 		{CVE: "cve-3", Published: &twoMonthsAgo},
 		{CVE: "cve-4"},
@@ -1621,88 +1747,2017 @@ func testListCVEs(t *testing.T, ds *Datastore) {
 	}
 
 	require.ElementsMatch(t, expected, actual)
+	for _, r := range result {
+		if r.CVE == "cve-1" {
+			require.NotNil(t, r.CISADueDate)
+			require.Equal(t, dueDate, *r.CISADueDate)
+			require.NotNil(t, r.CISADateAdded)
+			require.Equal(t, dateAdded, *r.CISADateAdded)
+		} else {
+			require.Nil(t, r.CISADueDate)
+			require.Nil(t, r.CISADateAdded)
+		}
+	}
 }
 
-func testListSoftwareForVulnDetection(t *testing.T, ds *Datastore) {
-	t.Run("returns software without CPE entries", func(t *testing.T) {
-		ctx := context.Background()
+func testNewCVEsSince(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
 
-		host := test.NewHost(t, ds, "host3", "", "host3key", "host3uuid", time.Now())
-		host.Platform = "debian"
-		require.NoError(t, ds.UpdateHost(ctx, host))
+	since := time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC)
+	before := since.Add(-time.Hour)
+	after := since.Add(time.Hour)
+	later := since.Add(48 * time.Hour)
+	dateAdded := time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC)
+	dueDate := time.Date(2023, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-before", Published: &before},
+		{CVE: "cve-at", Published: &since},
+		{CVE: "cve-later", Published: &later},
+		{CVE: "cve-after", Published: &after, CISAKnownExploit: ptr.Bool(true), CISADateAdded: &dateAdded, CISADueDate: &dueDate},
+		{CVE: "cve-unpublished"},
+	}))
+
+	cves := func(metas []fleet.CVEMeta) []string {
+		var res []string
+		for _, m := range metas {
+			res = append(res, m.CVE)
+		}
+		return res
+	}
 
-		software := []fleet.Software{
-			{Name: "foo", Version: "0.0.1", Source: "chrome_extensions"},
-			{Name: "bar", Version: "0.0.3", Source: "apps"},
-			{Name: "biz", Version: "0.0.1", Source: "deb_packages"},
-			{Name: "baz", Version: "0.0.3", Source: "deb_packages"},
+	// the boundary is exclusive, ordered by publication date by default
+	result, err := ds.NewCVEsSince(ctx, since, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-after", "cve-later"}, cves(result))
+	require.NotNil(t, result[0].CISADueDate)
+	require.Equal(t, dueDate, *result[0].CISADueDate)
+	require.Equal(t, dateAdded, *result[0].CISADateAdded)
+	require.Nil(t, result[1].CISADueDate)
+	require.Nil(t, result[1].CISADateAdded)
+
+	result, err = ds.NewCVEsSince(ctx, before.Add(-time.Second), fleet.ListOptions{OrderDirection: fleet.OrderDescending})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-later", "cve-after", "cve-at", "cve-before"}, cves(result))
+
+	result, err = ds.NewCVEsSince(ctx, before, fleet.ListOptions{OrderKey: "cve", PerPage: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-after", "cve-at"}, cves(result))
+
+	result, err = ds.NewCVEsSince(ctx, later, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, result)
+}
+
+func testCVEMetaChangedSince(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(1.0)},
+		{CVE: "cve-2", CVSSScore: ptr.Float64(2.0)},
+		{CVE: "cve-3", CVSSScore: ptr.Float64(3.0)},
+		{CVE: "cve-4", CVSSScore: ptr.Float64(4.0)},
+	}))
+
+	loaded := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx, `UPDATE cve_meta SET updated_at = ?`, loaded)
+		return err
+	})
+
+	cves := func(metas []fleet.CVEMeta) []string {
+		var res []string
+		for _, m := range metas {
+			res = append(res, m.CVE)
 		}
-		require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, software))
-		require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
-		require.NoError(t, ds.AddCPEForSoftware(ctx, host.Software[0], "cpe1"))
-		// Load software again so that CPE data is included.
-		require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
+		return res
+	}
 
-		result, err := ds.ListSoftwareForVulnDetection(ctx, host.ID)
-		require.NoError(t, err)
+	since := time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC)
+	result, err := ds.CVEMetaChangedSince(ctx, since, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, result)
 
-		sort.Slice(host.Software, func(i, j int) bool { return host.Software[i].ID < host.Software[j].ID })
-		sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+	// all cves changed at or after the time they were loaded
+	result, err = ds.CVEMetaChangedSince(ctx, loaded, fleet.ListOptions{OrderKey: "cve"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-1", "cve-2", "cve-3", "cve-4"}, cves(result))
+
+	// saving the same metadata again is not a change
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(1.0)},
+		{CVE: "cve-3", CVSSScore: ptr.Float64(3.5)},
+	}))
+	require.NoError(t, ds.UpsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-2", EPSSProbability: ptr.Float64(0.5)},
+		{CVE: "cve-5", CVSSScore: ptr.Float64(5.0)},
+	}))
+
+	result, err = ds.CVEMetaChangedSince(ctx, since, fleet.ListOptions{OrderKey: "cve"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-2", "cve-3", "cve-5"}, cves(result))
+	for _, m := range result {
+		require.NotNil(t, m.UpdatedAt)
+		require.True(t, m.UpdatedAt.After(since))
+	}
+	require.Equal(t, 3.5, *result[1].CVSSScore)
 
-		require.Equal(t, len(host.Software), len(result))
+	result, err = ds.CVEMetaChangedSince(ctx, since, fleet.ListOptions{OrderKey: "cve", OrderDirection: fleet.OrderDescending, PerPage: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-5", "cve-3"}, cves(result))
+}
 
-		for i := range host.Software {
-			require.Equal(t, host.Software[i].ID, result[i].ID)
-			require.Equal(t, host.Software[i].Name, result[i].Name)
-			require.Equal(t, host.Software[i].Version, result[i].Version)
-			require.Equal(t, host.Software[i].Release, result[i].Release)
-			require.Equal(t, host.Software[i].Arch, result[i].Arch)
-			require.Equal(t, host.Software[i].GenerateCPE, result[i].GenerateCPE)
+func testCVEsWithoutCVSS(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	result, err := ds.CVEsWithoutCVSS(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, result)
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-scored", CVSSScore: ptr.Float64(7.5), EPSSProbability: ptr.Float64(0.1)},
+		{CVE: "cve-epss", EPSSProbability: ptr.Float64(0.5)},
+		{CVE: "cve-cisa", CISAKnownExploit: ptr.Bool(true)},
+		{CVE: "cve-zero", CVSSScore: ptr.Float64(0)},
+		{CVE: "cve-bare"},
+	}))
+
+	cves := func(metas []fleet.CVEMeta) []string {
+		var res []string
+		for _, m := range metas {
+			res = append(res, m.CVE)
 		}
-	})
+		return res
+	}
+
+	// a zero score is still a score
+	result, err = ds.CVEsWithoutCVSS(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-bare", "cve-cisa", "cve-epss"}, cves(result))
+	require.Equal(t, 0.5, *result[2].EPSSProbability)
+	require.True(t, *result[1].CISAKnownExploit)
+	for _, m := range result {
+		require.Nil(t, m.CVSSScore)
+	}
+
+	result, err = ds.CVEsWithoutCVSS(ctx, fleet.ListOptions{OrderDirection: fleet.OrderDescending, PerPage: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-epss", "cve-cisa"}, cves(result))
+
+	// scoring a cve removes it from the list
+	require.NoError(t, ds.UpsertCVEMeta(ctx, []fleet.CVEMeta{{CVE: "cve-epss", CVSSScore: ptr.Float64(5.0)}}))
+	result, err = ds.CVEsWithoutCVSS(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-bare", "cve-cisa"}, cves(result))
 }
 
-func testSoftwareByID(t *testing.T, ds *Datastore) {
-	t.Run("software installed in multiple hosts does not have duplicated vulnerabilities", func(t *testing.T) {
-		ctx := context.Background()
+func testOverdueCVEs(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
 
-		hostA := test.NewHost(t, ds, "hostA", "", "hostAkey", "hostAuuid", time.Now())
-		hostA.Platform = "ubuntu"
-		require.NoError(t, ds.UpdateHost(ctx, hostA))
+	date := func(year int, month time.Month, day int) *time.Time {
+		d := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CISAKnownExploit: ptr.Bool(true), CISADueDate: date(2023, 1, 15)},
+		{CVE: "cve-2", CISAKnownExploit: ptr.Bool(true), CISADueDate: date(2023, 1, 10)},
+		{CVE: "cve-3", CISAKnownExploit: ptr.Bool(true), CISADueDate: date(2023, 3, 1)},
+		{CVE: "cve-4", CISAKnownExploit: ptr.Bool(true), CISADueDate: date(2023, 1, 1)},
+		{CVE: "cve-5", CISAKnownExploit: ptr.Bool(true), CISADueDate: date(2023, 1, 1)},
+		{CVE: "cve-6", CISAKnownExploit: ptr.Bool(false)},
+	}))
+
+	// cve-1, cve-3 and cve-6 affect the software of a host, cve-2 its operating system, cve-4 affects software
+	// not installed on any host and cve-5 nothing
+	host := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "bar", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
+	softwareIDs := make(map[string]uint)
+	for _, s := range host.Software {
+		softwareIDs[s.Name] = s.ID
+	}
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+	}))
+	_, err := ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-1"},
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-3"},
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-6"},
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-4"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?)`,
+		host.ID, "cve-2",
+	)
+	require.NoError(t, err)
 
-		hostB := test.NewHost(t, ds, "hostB", "", "hostBkey", "hostBuuid", time.Now())
-		hostB.Platform = "ubuntu"
-		require.NoError(t, ds.UpdateHost(ctx, hostB))
+	cveIDs := func(cves []fleet.CVEMeta) []string {
+		var ids []string
+		for _, c := range cves {
+			ids = append(ids, c.CVE)
+		}
+		return ids
+	}
 
-		software := []fleet.Software{
-			{Name: "foo_123", Version: "0.0.1", Source: "chrome_extensions"},
-			{Name: "bar_123", Version: "0.0.3", Source: "apps"},
-			{Name: "biz_123", Version: "0.0.1", Source: "deb_packages"},
-			{Name: "baz_123", Version: "0.0.3", Source: "deb_packages"},
+	// ordered by due date by default
+	cves, err := ds.OverdueCVEs(ctx, time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC), fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-2", "cve-1"}, cveIDs(cves))
+	require.Equal(t, *date(2023, 1, 10), *cves[0].CISADueDate)
+
+	// a cve isn't overdue on its due date
+	cves, err = ds.OverdueCVEs(ctx, time.Date(2023, 1, 15, 23, 0, 0, 0, time.UTC), fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-2"}, cveIDs(cves))
+	cves, err = ds.OverdueCVEs(ctx, time.Date(2023, 1, 16, 0, 0, 0, 0, time.UTC), fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-2", "cve-1"}, cveIDs(cves))
+
+	cves, err = ds.OverdueCVEs(ctx, time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, cves)
+
+	cves, err = ds.OverdueCVEs(ctx, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), fleet.ListOptions{OrderKey: "cve", OrderDirection: fleet.OrderDescending})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-3", "cve-2", "cve-1"}, cveIDs(cves))
+
+	// a remediated cve is no longer overdue
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{
+		{Name: "baz", Version: "0.0.1", Source: "apps"},
+	}))
+	cves, err = ds.OverdueCVEs(ctx, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-2"}, cveIDs(cves))
+}
+
+func testFleetKnownExploitedCVEs(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	date := func(year int, month time.Month, day int) *time.Time {
+		d := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		return &d
+	}
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CISAKnownExploit: ptr.Bool(true), CISADateAdded: date(2023, 1, 1), CISADueDate: date(2023, 1, 15)},
+		{CVE: "cve-2", CISAKnownExploit: ptr.Bool(true), CISADateAdded: date(2023, 2, 1)},
+		{CVE: "cve-3", CISAKnownExploit: ptr.Bool(true), CISADateAdded: date(2023, 3, 1)},
+		{CVE: "cve-4", CISAKnownExploit: ptr.Bool(true), CISADateAdded: date(2023, 4, 1)},
+		{CVE: "cve-5", CISAKnownExploit: ptr.Bool(false)},
+	}))
+
+	// cve-1, cve-3 and cve-5 affect the software of a host, cve-2 its operating system and cve-4 affects software
+	// not installed on any host
+	host := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "bar", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
+	softwareIDs := make(map[string]uint)
+	for _, s := range host.Software {
+		softwareIDs[s.Name] = s.ID
+	}
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+	}))
+	_, err := ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-1"},
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-3"},
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-5"},
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-4"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?)`,
+		host.ID, "cve-2",
+	)
+	require.NoError(t, err)
+
+	cveIDs := func(cves []fleet.CVEMeta) []string {
+		var ids []string
+		for _, c := range cves {
+			ids = append(ids, c.CVE)
 		}
+		return ids
+	}
 
-		require.NoError(t, ds.UpdateHostSoftware(ctx, hostA.ID, software))
-		require.NoError(t, ds.UpdateHostSoftware(ctx, hostB.ID, software))
+	// most recently added first by default
+	cves, err := ds.FleetKnownExploitedCVEs(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-3", "cve-2", "cve-1"}, cveIDs(cves))
+	require.Equal(t, *date(2023, 1, 1), *cves[2].CISADateAdded)
+	require.Equal(t, *date(2023, 1, 15), *cves[2].CISADueDate)
 
-		require.NoError(t, ds.LoadHostSoftware(ctx, hostA, false))
-		require.NoError(t, ds.LoadHostSoftware(ctx, hostB, false))
+	cves, err = ds.FleetKnownExploitedCVEs(ctx, fleet.ListOptions{OrderKey: "cve", PerPage: 2})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-1", "cve-2"}, cveIDs(cves))
 
-		// Add one vulnerability to each software
-		var vulns []fleet.SoftwareVulnerability
-		for i, s := range hostA.Software {
-			vulns = append(vulns, fleet.SoftwareVulnerability{
-				SoftwareID: s.ID,
-				CVE:        fmt.Sprintf("cve-%d", i),
-			})
+	// a remediated cve is no longer listed
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{
+		{Name: "baz", Version: "0.0.1", Source: "apps"},
+	}))
+	cves, err = ds.FleetKnownExploitedCVEs(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-2"}, cveIDs(cves))
+}
+
+func testHostCVEs(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	host := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	otherHost := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+
+	// a host without vulnerabilities
+	cves, err := ds.HostCVEs(ctx, host.ID, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, cves)
+
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "chrome_extensions"},
+		{Name: "bar", Version: "0.0.3", Source: "apps"},
+		{Name: "baz", Version: "1.0", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, otherHost.ID, []fleet.Software{
+		{Name: "other", Version: "1.0", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, otherHost, false))
+
+	softwareIDs := make(map[string]uint)
+	for _, s := range host.Software {
+		softwareIDs[s.Name] = s.ID
+	}
+
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-1"},
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-2"},
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-2"},
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-3"},
+		{SoftwareID: softwareIDs["baz"], CVE: "cve-no-meta"},
+		{SoftwareID: otherHost.Software[0].ID, CVE: "cve-other"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(9.8), EPSSProbability: ptr.Float64(0.01), CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "cve-2", CVSSScore: ptr.Float64(5.5), EPSSProbability: ptr.Float64(0.9), CISAKnownExploit: ptr.Bool(true)},
+		{CVE: "cve-3", CVSSScore: ptr.Float64(7.2), EPSSProbability: ptr.Float64(0.5), CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "cve-other", CVSSScore: ptr.Float64(10.0)},
+	}))
+
+	type cveSoftware struct {
+		cve      string
+		software string
+	}
+	toCVESoftware := func(cves []fleet.HostCVE) []cveSoftware {
+		var res []cveSoftware
+		for _, c := range cves {
+			res = append(res, cveSoftware{c.CVE, c.SoftwareName})
 		}
-		n, err := ds.InsertSoftwareVulnerabilities(ctx, vulns, fleet.UbuntuOVALSource)
-		require.NoError(t, err)
-		require.Equal(t, 4, int(n))
+		return res
+	}
 
-		for _, s := range hostA.Software {
-			result, err := ds.SoftwareByID(ctx, s.ID, true)
-			require.NoError(t, err)
-			require.Len(t, result.Vulnerabilities, 1)
+	// ordered by cve by default, listed once per affected software
+	cves, err = ds.HostCVEs(ctx, host.ID, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, cves, 5)
+	require.ElementsMatch(t, []cveSoftware{
+		{"cve-1", "foo"}, {"cve-2", "foo"}, {"cve-2", "bar"}, {"cve-3", "bar"}, {"cve-no-meta", "baz"},
+	}, toCVESoftware(cves))
+	require.Equal(t, "cve-1", cves[0].CVE)
+	require.Equal(t, softwareIDs["foo"], cves[0].SoftwareID)
+	require.Equal(t, "0.0.1", cves[0].SoftwareVersion)
+	require.Equal(t, "chrome_extensions", cves[0].SoftwareSource)
+	require.Equal(t, 9.8, *cves[0].CVSSScore)
+	require.Equal(t, 0.01, *cves[0].EPSSProbability)
+	require.False(t, *cves[0].CISAKnownExploit)
+	require.Equal(t, "cve-no-meta", cves[4].CVE)
+	require.Nil(t, cves[4].CVSSScore)
+	require.Nil(t, cves[4].EPSSProbability)
+	require.Nil(t, cves[4].CISAKnownExploit)
+
+	// sorted by cvss score
+	cves, err = ds.HostCVEs(ctx, host.ID, fleet.ListOptions{OrderKey: "cvss_score", OrderDirection: fleet.OrderDescending})
+	require.NoError(t, err)
+	require.Len(t, cves, 5)
+	require.Equal(t, "cve-1", cves[0].CVE)
+	require.Equal(t, "cve-3", cves[1].CVE)
+	require.Equal(t, "cve-2", cves[2].CVE)
+	require.Equal(t, "cve-2", cves[3].CVE)
+	require.Equal(t, "cve-no-meta", cves[4].CVE)
+
+	// sorted by epss probability, paginated
+	opts := fleet.ListOptions{OrderKey: "epss_probability", OrderDirection: fleet.OrderDescending, PerPage: 2}
+	cves, err = ds.HostCVEs(ctx, host.ID, opts)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []cveSoftware{{"cve-2", "bar"}, {"cve-2", "foo"}}, toCVESoftware(cves))
+	opts.Page = 1
+	cves, err = ds.HostCVEs(ctx, host.ID, opts)
+	require.NoError(t, err)
+	require.Equal(t, []cveSoftware{{"cve-3", "bar"}, {"cve-1", "foo"}}, toCVESoftware(cves))
+	opts.Page = 2
+	cves, err = ds.HostCVEs(ctx, host.ID, opts)
+	require.NoError(t, err)
+	require.Equal(t, []cveSoftware{{"cve-no-meta", "baz"}}, toCVESoftware(cves))
+
+	cves, err = ds.HostCVEs(ctx, otherHost.ID, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, cves, 1)
+	require.Equal(t, "cve-other", cves[0].CVE)
+	require.Equal(t, "other", cves[0].SoftwareName)
+
+	// the CVEs of the operating system are matched to it
+	require.NoError(t, ds.UpdateHostOperatingSystem(ctx, otherHost.ID, fleet.OperatingSystem{
+		Name: "Ubuntu", Version: "22.04.1 LTS", Arch: "x86_64", KernelVersion: "5.15.0", Platform: "ubuntu",
+	}))
+	osList, err := ds.ListOperatingSystems(ctx)
+	require.NoError(t, err)
+	require.Len(t, osList, 1)
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, ?, ?), (?, ?, ?)`,
+		otherHost.ID, osList[0].ID, "cve-1", otherHost.ID, osList[0].ID, "cve-other",
+	)
+	require.NoError(t, err)
+
+	cves, err = ds.HostCVEs(ctx, otherHost.ID, fleet.ListOptions{OrderKey: "cvss_score", OrderDirection: fleet.OrderDescending})
+	require.NoError(t, err)
+	require.Len(t, cves, 3)
+	require.Equal(t, "cve-other", cves[0].CVE)
+	require.Equal(t, "cve-other", cves[1].CVE)
+	osCVE := cves[2]
+	require.Equal(t, "cve-1", osCVE.CVE)
+	require.Zero(t, osCVE.SoftwareID)
+	require.Equal(t, osList[0].ID, osCVE.OperatingSystemID)
+	require.Equal(t, "Ubuntu", osCVE.SoftwareName)
+	require.Equal(t, "22.04.1 LTS", osCVE.SoftwareVersion)
+	require.Empty(t, osCVE.SoftwareSource)
+	require.Equal(t, 9.8, *osCVE.CVSSScore)
+	for _, c := range cves[:2] {
+		if c.OperatingSystemID == 0 {
+			require.Equal(t, otherHost.Software[0].ID, c.SoftwareID)
+		} else {
+			require.Zero(t, c.SoftwareID)
 		}
-	})
+	}
+
+	// the CVEs of the operating system of the other host aren't listed
+	cves, err = ds.HostCVEs(ctx, host.ID, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, cves, 5)
+}
+
+func testHostVulnerabilitySummary(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	host := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	otherHost := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+
+	// a host without vulnerabilities
+	summary, err := ds.HostVulnerabilitySummary(ctx, host.ID)
+	require.NoError(t, err)
+	require.Equal(t, &fleet.HostVulnerabilitySummary{HostID: host.ID}, summary)
+
+	software := []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "chrome_extensions"},
+		{Name: "bar", Version: "0.0.3", Source: "apps"},
+		{Name: "baz", Version: "1.0", Source: "apps"},
+	}
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, software))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, otherHost.ID, []fleet.Software{
+		{Name: "other", Version: "1.0", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, otherHost, false))
+
+	vulns := []fleet.SoftwareVulnerability{
+		{SoftwareID: host.Software[0].ID, CVE: "cve-critical"},
+		{SoftwareID: host.Software[0].ID, CVE: "cve-high-1"},
+		{SoftwareID: host.Software[1].ID, CVE: "cve-high-1"}, // counted once
+		{SoftwareID: host.Software[1].ID, CVE: "cve-high-2"},
+		{SoftwareID: host.Software[1].ID, CVE: "cve-medium"},
+		{SoftwareID: host.Software[2].ID, CVE: "cve-low"},
+		{SoftwareID: host.Software[2].ID, CVE: "cve-no-score"},
+		{SoftwareID: host.Software[2].ID, CVE: "cve-no-meta"},
+		{SoftwareID: otherHost.Software[0].ID, CVE: "cve-other"},
+	}
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, vulns, fleet.NVDSource)
+	require.NoError(t, err)
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-critical", CVSSScore: ptr.Float64(9.8), CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "cve-high-1", CVSSScore: ptr.Float64(7.0), CISAKnownExploit: ptr.Bool(true)},
+		{CVE: "cve-high-2", CVSSScore: ptr.Float64(8.9), CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "cve-medium", CVSSScore: ptr.Float64(4.0)},
+		{CVE: "cve-low", CVSSScore: ptr.Float64(3.9)},
+		{CVE: "cve-no-score", CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "cve-other", CVSSScore: ptr.Float64(10.0), CISAKnownExploit: ptr.Bool(true)},
+	}))
+
+	summary, err = ds.HostVulnerabilitySummary(ctx, host.ID)
+	require.NoError(t, err)
+	require.Equal(t, host.ID, summary.HostID)
+	require.NotNil(t, summary.MaxCVSSScore)
+	require.InDelta(t, 9.8, *summary.MaxCVSSScore, 0.001)
+	require.Equal(t, uint(1), summary.CriticalCount)
+	require.Equal(t, uint(2), summary.HighCount)
+	require.Equal(t, uint(1), summary.MediumCount)
+	require.Equal(t, uint(1), summary.LowCount)
+	require.Equal(t, uint(2), summary.UnscoredCount)
+	require.True(t, summary.CISAKnownExploit)
+	require.Equal(t, uint(1), summary.KnownExploitCount)
+	require.Equal(t, uint(10+5+2*3+1), summary.RiskScore)
+	require.Equal(t, summary.ComputeRiskScore(), summary.RiskScore)
+
+	summary, err = ds.HostVulnerabilitySummary(ctx, otherHost.ID)
+	require.NoError(t, err)
+	require.InDelta(t, 10.0, *summary.MaxCVSSScore, 0.001)
+	require.Equal(t, uint(1), summary.CriticalCount)
+	require.Zero(t, summary.HighCount+summary.MediumCount+summary.LowCount+summary.UnscoredCount)
+	require.True(t, summary.CISAKnownExploit)
+	require.Equal(t, uint(10+5), summary.RiskScore)
+
+	// the CVEs of the operating system are counted too, once if the software is also affected
+	osHost := test.NewHost(t, ds, "host3", "", "host3key", "host3uuid", time.Now())
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?), (?, 1, ?), (?, 1, ?)`,
+		osHost.ID, "cve-critical", osHost.ID, "cve-medium", host.ID, "cve-critical",
+	)
+	require.NoError(t, err)
+
+	summary, err = ds.HostVulnerabilitySummary(ctx, osHost.ID)
+	require.NoError(t, err)
+	require.InDelta(t, 9.8, *summary.MaxCVSSScore, 0.001)
+	require.Equal(t, uint(1), summary.CriticalCount)
+	require.Equal(t, uint(1), summary.MediumCount)
+	require.False(t, summary.CISAKnownExploit)
+	require.Equal(t, uint(5+1), summary.RiskScore)
+
+	summary, err = ds.HostVulnerabilitySummary(ctx, host.ID)
+	require.NoError(t, err)
+	require.Equal(t, uint(1), summary.CriticalCount)
+	require.Equal(t, uint(10+5+2*3+1), summary.RiskScore)
+}
+
+func testMostVulnerableHosts(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	_, err := ds.MostVulnerableHosts(ctx, 0, fleet.MostVulnerableHostsOptions{})
+	var argErr *fleet.InvalidArgumentError
+	require.ErrorAs(t, err, &argErr)
+
+	// no host has vulnerabilities yet
+	summaries, err := ds.MostVulnerableHosts(ctx, 10, fleet.MostVulnerableHostsOptions{})
+	require.NoError(t, err)
+	require.Empty(t, summaries)
+
+	var hosts []*fleet.Host
+	for i := 0; i < 5; i++ {
+		name := fmt.Sprintf("host%d", i)
+		h := test.NewHost(t, ds, name, "", name+"key", name+"uuid", time.Now())
+		require.NoError(t, ds.UpdateHostSoftware(ctx, h.ID, []fleet.Software{
+			{Name: name, Version: "1.0", Source: "apps"},
+		}))
+		require.NoError(t, ds.LoadHostSoftware(ctx, h, false))
+		hosts = append(hosts, h)
+	}
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-critical-exploit", CVSSScore: ptr.Float64(9.8), CISAKnownExploit: ptr.Bool(true)},
+		{CVE: "cve-critical-1", CVSSScore: ptr.Float64(9.1), CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "cve-critical-2", CVSSScore: ptr.Float64(9.5), CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "cve-high-1", CVSSScore: ptr.Float64(7.5)},
+		{CVE: "cve-high-2", CVSSScore: ptr.Float64(8.0)},
+		{CVE: "cve-high-3", CVSSScore: ptr.Float64(8.5)},
+		{CVE: "cve-low", CVSSScore: ptr.Float64(2.0)},
+	}))
+
+	// hosts[0]: one critical known exploit, 10 + 5 = 15
+	// hosts[1]: three high, 3 * 3 = 9
+	// hosts[2]: two critical, 2 * 5 = 10
+	// hosts[3]: one low and one unscored CVE, 0
+	// hosts[4]: no CVEs, not ranked
+	vulns := []fleet.SoftwareVulnerability{
+		{SoftwareID: hosts[0].Software[0].ID, CVE: "cve-critical-exploit"},
+		{SoftwareID: hosts[1].Software[0].ID, CVE: "cve-high-1"},
+		{SoftwareID: hosts[1].Software[0].ID, CVE: "cve-high-2"},
+		{SoftwareID: hosts[1].Software[0].ID, CVE: "cve-high-3"},
+		{SoftwareID: hosts[2].Software[0].ID, CVE: "cve-critical-1"},
+		{SoftwareID: hosts[2].Software[0].ID, CVE: "cve-critical-2"},
+		{SoftwareID: hosts[3].Software[0].ID, CVE: "cve-low"},
+		{SoftwareID: hosts[3].Software[0].ID, CVE: "cve-no-meta"},
+	}
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, vulns, fleet.NVDSource)
+	require.NoError(t, err)
+
+	hostIDs := func(summaries []fleet.HostVulnerabilitySummary) []uint {
+		var ids []uint
+		for _, s := range summaries {
+			ids = append(ids, s.HostID)
+		}
+		return ids
+	}
+
+	summaries, err = ds.MostVulnerableHosts(ctx, 10, fleet.MostVulnerableHostsOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uint{hosts[0].ID, hosts[2].ID, hosts[1].ID, hosts[3].ID}, hostIDs(summaries))
+	for i, want := range []uint{15, 10, 9, 0} {
+		require.Equal(t, want, summaries[i].RiskScore)
+		require.Equal(t, summaries[i].ComputeRiskScore(), summaries[i].RiskScore)
+	}
+	require.Equal(t, uint(1), summaries[0].KnownExploitCount)
+	require.Equal(t, uint(2), summaries[1].CriticalCount)
+	require.Equal(t, uint(3), summaries[2].HighCount)
+	require.Equal(t, uint(1), summaries[3].UnscoredCount)
+
+	// the ranking matches the per-host summary
+	summary, err := ds.HostVulnerabilitySummary(ctx, hosts[1].ID)
+	require.NoError(t, err)
+	require.Equal(t, summaries[2], *summary)
+
+	summaries, err = ds.MostVulnerableHosts(ctx, 2, fleet.MostVulnerableHostsOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uint{hosts[0].ID, hosts[2].ID}, hostIDs(summaries))
+
+	team, err := ds.NewTeam(ctx, &fleet.Team{Name: "team1"})
+	require.NoError(t, err)
+	require.NoError(t, ds.AddHostsToTeam(ctx, &team.ID, []uint{hosts[1].ID, hosts[3].ID, hosts[4].ID}))
+
+	summaries, err = ds.MostVulnerableHosts(ctx, 10, fleet.MostVulnerableHostsOptions{TeamID: &team.ID})
+	require.NoError(t, err)
+	require.Equal(t, []uint{hosts[1].ID, hosts[3].ID}, hostIDs(summaries))
+
+	// hosts[4]: only its operating system is affected, by a critical known exploit and a high CVE, 10 + 5 + 3 = 18
+	// hosts[0]: its operating system has the same CVE as its software, still 15
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?), (?, 1, ?), (?, 1, ?)`,
+		hosts[4].ID, "cve-critical-exploit", hosts[4].ID, "cve-high-1", hosts[0].ID, "cve-critical-exploit",
+	)
+	require.NoError(t, err)
+
+	summaries, err = ds.MostVulnerableHosts(ctx, 2, fleet.MostVulnerableHostsOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []uint{hosts[4].ID, hosts[0].ID}, hostIDs(summaries))
+	require.Equal(t, uint(18), summaries[0].RiskScore)
+	require.Equal(t, uint(15), summaries[1].RiskScore)
+	summary, err = ds.HostVulnerabilitySummary(ctx, hosts[4].ID)
+	require.NoError(t, err)
+	require.Equal(t, summaries[0], *summary)
+
+	summaries, err = ds.MostVulnerableHosts(ctx, 10, fleet.MostVulnerableHostsOptions{TeamID: &team.ID})
+	require.NoError(t, err)
+	require.Equal(t, []uint{hosts[4].ID, hosts[1].ID, hosts[3].ID}, hostIDs(summaries))
+}
+
+func testUpsertCVEMeta(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	published := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{
+			CVE: "cve-1", CVSSScore: ptr.Float64(5), EPSSProbability: ptr.Float64(0.1), CISAKnownExploit: ptr.Bool(false), Published: &published,
+			CVSSExploitabilityScore: ptr.Float64(1.8), CVSSImpactScore: ptr.Float64(3.6), CVSSVector: ptr.String("CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:U/C:H/I:N/A:N"),
+			LastModified: &published, CVSSSource: ptr.String(fleet.CVSSSourceNVD),
+		},
+		{CVE: "cve-2", CVSSScore: ptr.Float64(7), EPSSProbability: ptr.Float64(0.2), CISAKnownExploit: ptr.Bool(true), Published: &published},
+	}))
+
+	// incremental load of a modified cve and a new one, without epss scores nor known exploits
+	require.NoError(t, ds.UpsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(9.8)},
+		{CVE: "cve-3", CVSSScore: ptr.Float64(4), Published: &published},
+	}))
+
+	var rows []fleet.CVEMeta
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &rows,
+			`SELECT cve, cvss_score, epss_probability, cisa_known_exploit, published,
+				cvss_exploitability_score, cvss_impact_score, cvss_vector, last_modified, cvss_source FROM cve_meta ORDER BY cve`)
+	})
+	require.Len(t, rows, 3)
+
+	// only the parsed fields of the targeted cve are updated
+	require.Equal(t, "cve-1", rows[0].CVE)
+	require.Equal(t, 9.8, *rows[0].CVSSScore)
+	require.Equal(t, 0.1, *rows[0].EPSSProbability)
+	require.False(t, *rows[0].CISAKnownExploit)
+	require.True(t, published.Equal(*rows[0].Published))
+	require.Equal(t, 1.8, *rows[0].CVSSExploitabilityScore)
+	require.Equal(t, 3.6, *rows[0].CVSSImpactScore)
+	require.Equal(t, "CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:U/C:H/I:N/A:N", *rows[0].CVSSVector)
+	require.True(t, published.Equal(*rows[0].LastModified))
+	require.Equal(t, fleet.CVSSSourceNVD, *rows[0].CVSSSource)
+
+	// other cves are left untouched
+	require.Equal(t, "cve-2", rows[1].CVE)
+	require.Equal(t, 7.0, *rows[1].CVSSScore)
+	require.Equal(t, 0.2, *rows[1].EPSSProbability)
+	require.True(t, *rows[1].CISAKnownExploit)
+
+	require.Equal(t, "cve-3", rows[2].CVE)
+	require.Equal(t, 4.0, *rows[2].CVSSScore)
+	require.Nil(t, rows[2].EPSSProbability)
+	require.Nil(t, rows[2].CISAKnownExploit)
+
+	var row fleet.CVEMeta
+	getRow := func() {
+		row = fleet.CVEMeta{}
+		ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+			return sqlx.GetContext(ctx, q, &row,
+				`SELECT cve, cvss_score, epss_probability, cvss_exploitability_score, cvss_impact_score, cvss_vector, last_modified
+				FROM cve_meta WHERE cve = ?`, "cve-1")
+		})
+	}
+
+	// a full load without the optional fields keeps their stored values
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{{CVE: "cve-1", CVSSScore: ptr.Float64(9.8)}}))
+	getRow()
+	require.Equal(t, 9.8, *row.CVSSScore)
+	require.Nil(t, row.EPSSProbability)
+	require.Equal(t, 1.8, *row.CVSSExploitabilityScore)
+	require.Equal(t, 3.6, *row.CVSSImpactScore)
+	require.Equal(t, "CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:U/C:H/I:N/A:N", *row.CVSSVector)
+	require.True(t, published.Equal(*row.LastModified))
+
+	// unless the score changed, the stored subscores belong to the previous score
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{{CVE: "cve-1", CVSSScore: ptr.Float64(9.1)}}))
+	getRow()
+	require.Equal(t, 9.1, *row.CVSSScore)
+	require.Nil(t, row.CVSSExploitabilityScore)
+	require.Nil(t, row.CVSSImpactScore)
+	require.Nil(t, row.CVSSVector)
+
+	// loaded subscores always replace the stored ones
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{{
+		CVE: "cve-1", CVSSScore: ptr.Float64(9.1),
+		CVSSExploitabilityScore: ptr.Float64(3.9), CVSSImpactScore: ptr.Float64(5.2), CVSSVector: ptr.String("CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:N"),
+	}}, fleet.WithCVSSSubscoresLoaded()))
+	getRow()
+	require.Equal(t, 3.9, *row.CVSSExploitabilityScore)
+	require.Equal(t, 5.2, *row.CVSSImpactScore)
+	require.Equal(t, "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:N", *row.CVSSVector)
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{{CVE: "cve-1", CVSSScore: ptr.Float64(9.1)}}, fleet.WithCVSSSubscoresLoaded()))
+	getRow()
+	require.Equal(t, 9.1, *row.CVSSScore)
+	require.Nil(t, row.CVSSExploitabilityScore)
+	require.Nil(t, row.CVSSImpactScore)
+	require.Nil(t, row.CVSSVector)
+	require.True(t, published.Equal(*row.LastModified))
+
+	// loaded last modified dates always replace the stored ones
+	modified := published.Add(24 * time.Hour)
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{{CVE: "cve-1", CVSSScore: ptr.Float64(9.1), LastModified: &modified}}))
+	getRow()
+	require.True(t, modified.Equal(*row.LastModified))
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{{CVE: "cve-1", CVSSScore: ptr.Float64(9.1)}}, fleet.WithLastModifiedLoaded()))
+	getRow()
+	require.Nil(t, row.LastModified)
+}
+
+func testPruneCVEMeta(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(5)},
+		{CVE: "cve-2", CVSSScore: ptr.Float64(7)},
+		{CVE: "cve-rejected", CVSSScore: ptr.Float64(9)},
+	}))
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		for _, cve := range []string{"cve-1", "cve-rejected"} {
+			if _, err := q.ExecContext(ctx, `INSERT INTO cve_meta_provenance (cve, field, source) VALUES (?, 'cvss_score', 'nvd')`, cve); err != nil {
+				return err
+			}
+			if _, err := q.ExecContext(ctx, `INSERT INTO epss_model_scores (cve, model_version, score) VALUES (?, 'v1', 0.5)`, cve); err != nil {
+				return err
+			}
+			if _, err := q.ExecContext(ctx, `INSERT INTO cve_products (cve, vendor, product) VALUES (?, 'vendor', 'product')`, cve); err != nil {
+				return err
+			}
+			if _, err := q.ExecContext(ctx, `INSERT INTO cve_cwes (cve, cwe) VALUES (?, 'CWE-79')`, cve); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	listCVEs := func(table string) []string {
+		var cves []string
+		ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+			return sqlx.SelectContext(ctx, q, &cves, fmt.Sprintf(`SELECT cve FROM %s ORDER BY cve`, table))
+		})
+		return cves
+	}
+
+	// cves of the feeds that were never stored are ignored
+	n, err := ds.PruneCVEMeta(ctx, []string{"cve-1", "cve-2", "cve-3"})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	require.Equal(t, []string{"cve-1", "cve-2"}, listCVEs("cve_meta"))
+	// the data loaded with the metadata is pruned with it
+	for _, table := range cveMetaCompanionTables {
+		require.Equal(t, []string{"cve-1"}, listCVEs(table), table)
+	}
+
+	// nothing left to prune
+	n, err = ds.PruneCVEMeta(ctx, []string{"cve-1", "cve-2"})
+	require.NoError(t, err)
+	require.Zero(t, n)
+	require.Equal(t, []string{"cve-1", "cve-2"}, listCVEs("cve_meta"))
+}
+
+func testLockCVEMetaLoad(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	// a load that doesn't wait fails while another one holds the lock
+	unlock, err := ds.LockCVEMetaLoad(ctx, false)
+	require.NoError(t, err)
+	_, err = ds.LockCVEMetaLoad(ctx, false)
+	require.ErrorIs(t, err, fleet.ErrCVEMetaLoadInProgress)
+	unlock()
+
+	unlock, err = ds.LockCVEMetaLoad(ctx, false)
+	require.NoError(t, err)
+	unlock()
+
+	// two concurrent loads, each marking all the cves (more than one insert batch) with its own known exploit flag
+	load := func(knownExploit bool) error {
+		unlock, err := ds.LockCVEMetaLoad(ctx, true)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		meta := make([]fleet.CVEMeta, 0, 1200)
+		for i := 0; i < 1200; i++ {
+			meta = append(meta, fleet.CVEMeta{CVE: fmt.Sprintf("cve-%d", i), CISAKnownExploit: ptr.Bool(knownExploit)})
+		}
+		if err := ds.InsertCVEMeta(ctx, meta); err != nil {
+			return err
+		}
+		return ds.RecordCVESync(ctx, time.Now().UTC(), len(meta))
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, knownExploit := range []bool{true, false} {
+		i, knownExploit := i, knownExploit
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = load(knownExploit)
+		}()
+	}
+	wg.Wait()
+	require.NoError(t, errs[0])
+	require.NoError(t, errs[1])
+
+	// the writes of the loads were not interleaved, all the cves have the flag of the load that ran last
+	var flags []bool
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		return sqlx.SelectContext(ctx, q, &flags, `SELECT DISTINCT cisa_known_exploit FROM cve_meta`)
+	})
+	require.Len(t, flags, 1)
+
+	info, err := ds.LastCVESyncInfo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1200, info.CVECount)
+}
+
+func testCVEMetaProvenance(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	loaded1 := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	require.NoError(t, ds.InsertCVEMetaProvenance(ctx, []fleet.CVEMetaProvenance{
+		{CVE: "cve-1", Field: "cvss_score", Source: "nvdcve-1.1-2022.json.gz", LoadedAt: loaded1},
+		{CVE: "cve-1", Field: "epss_probability", Source: "epss_scores-current.csv", LoadedAt: loaded1},
+		{CVE: "cve-2", Field: "cvss_score", Source: "nvdcve-1.1-2021.json.gz", LoadedAt: loaded1},
+	}))
+
+	// a later load replaces the provenance of the same field
+	loaded2 := loaded1.Add(30 * time.Minute)
+	require.NoError(t, ds.InsertCVEMetaProvenance(ctx, []fleet.CVEMetaProvenance{
+		{CVE: "cve-1", Field: "cvss_score", Source: "nvdcve-1.1-modified.json.gz", LoadedAt: loaded2},
+	}))
+
+	prov, err := ds.ListCVEMetaProvenance(ctx, "cve-1")
+	require.NoError(t, err)
+	require.Len(t, prov, 2)
+	require.Equal(t, "cvss_score", prov[0].Field)
+	require.Equal(t, "nvdcve-1.1-modified.json.gz", prov[0].Source)
+	require.Equal(t, loaded2, prov[0].LoadedAt.UTC())
+	require.Equal(t, "epss_probability", prov[1].Field)
+	require.Equal(t, "epss_scores-current.csv", prov[1].Source)
+	require.Equal(t, loaded1, prov[1].LoadedAt.UTC())
+
+	prov, err = ds.ListCVEMetaProvenance(ctx, "cve-3")
+	require.NoError(t, err)
+	require.Empty(t, prov)
+
+	// the provenance of pruned cves is deleted too
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{{CVE: "cve-1"}, {CVE: "cve-2"}}))
+	n, err := ds.PruneCVEMeta(ctx, []string{"cve-2"})
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+	prov, err = ds.ListCVEMetaProvenance(ctx, "cve-1")
+	require.NoError(t, err)
+	require.Empty(t, prov)
+	prov, err = ds.ListCVEMetaProvenance(ctx, "cve-2")
+	require.NoError(t, err)
+	require.Len(t, prov, 1)
+}
+
+func testLastCVESyncInfo(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	// never synced
+	_, err := ds.LastCVESyncInfo(ctx)
+	require.True(t, fleet.IsNotFound(err))
+
+	first := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	require.NoError(t, ds.RecordCVESync(ctx, first, 10))
+
+	info, err := ds.LastCVESyncInfo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, first, info.SyncedAt.UTC())
+	require.Equal(t, 10, info.CVECount)
+
+	// a later sync replaces the previous one
+	second := first.Add(30 * time.Minute)
+	require.NoError(t, ds.RecordCVESync(ctx, second, 12))
+
+	info, err = ds.LastCVESyncInfo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, second, info.SyncedAt.UTC())
+	require.Equal(t, 12, info.CVECount)
+}
+
+func testSyncAttempts(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	attempts, err := ds.ListSyncAttempts(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, attempts)
+
+	failedAt := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	failed := &fleet.SyncAttempt{
+		StartedAt:  failedAt,
+		DurationMS: 1500,
+		Error:      ptr.String("sync EPSS CVE feed: unexpected status code 500"),
+		Sources: fleet.SyncSourceResults{
+			{Source: "nvd", Success: true},
+			{Source: "epss", Error: "unexpected status code 500"},
+		},
+	}
+	require.NoError(t, ds.RecordSyncAttempt(ctx, failed))
+	require.NotZero(t, failed.ID)
+
+	succeededAt := failedAt.Add(30 * time.Minute)
+	succeeded := &fleet.SyncAttempt{
+		StartedAt:  succeededAt,
+		DurationMS: 1200,
+		Success:    true,
+		Sources: fleet.SyncSourceResults{
+			{Source: "nvd", Success: true},
+			{Source: "epss", Success: true},
+		},
+	}
+	require.NoError(t, ds.RecordSyncAttempt(ctx, succeeded))
+
+	// most recent first by default
+	attempts, err = ds.ListSyncAttempts(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+
+	require.Equal(t, succeeded.ID, attempts[0].ID)
+	require.Equal(t, succeededAt, attempts[0].StartedAt.UTC())
+	require.Equal(t, int64(1200), attempts[0].DurationMS)
+	require.True(t, attempts[0].Success)
+	require.Nil(t, attempts[0].Error)
+	require.Equal(t, succeeded.Sources, attempts[0].Sources)
+
+	require.Equal(t, failed.ID, attempts[1].ID)
+	require.Equal(t, failedAt, attempts[1].StartedAt.UTC())
+	require.False(t, attempts[1].Success)
+	require.Equal(t, *failed.Error, *attempts[1].Error)
+	require.Equal(t, failed.Sources, attempts[1].Sources)
+
+	attempts, err = ds.ListSyncAttempts(ctx, fleet.ListOptions{OrderKey: "started_at", PerPage: 1})
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	require.Equal(t, failed.ID, attempts[0].ID)
+
+	// the attempts past the retention are deleted when a new one is recorded
+	latest := &fleet.SyncAttempt{
+		StartedAt: failedAt.Add(syncAttemptsRetention + 15*time.Minute),
+		Success:   true,
+	}
+	require.NoError(t, ds.RecordSyncAttempt(ctx, latest))
+	attempts, err = ds.ListSyncAttempts(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	require.Equal(t, latest.ID, attempts[0].ID)
+	require.Equal(t, succeeded.ID, attempts[1].ID)
+}
+
+func testWithCVEMetaTx(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	save := func(tx fleet.CVEMetaTx, cve string) {
+		require.NoError(t, tx.InsertCVEMeta(ctx, []fleet.CVEMeta{{CVE: cve, CVSSScore: ptr.Float64(9.8)}}))
+		require.NoError(t, tx.UpsertCVEMeta(ctx, []fleet.CVEMeta{{CVE: cve, EPSSProbability: ptr.Float64(0.5)}}))
+		require.NoError(t, tx.RecordCVESync(ctx, time.Now().UTC(), 1))
+		// another table updated along with the metadata
+		_, err := tx.ExecContext(ctx, `INSERT INTO cve_cwes (cve, cwe) VALUES (?, ?)`, cve, "CWE-79")
+		require.NoError(t, err)
+	}
+	countRows := func(table string) int {
+		var count int
+		require.NoError(t, sqlx.GetContext(ctx, ds.reader, &count, `SELECT COUNT(*) FROM `+table))
+		return count
+	}
+
+	// rolling back the transaction discards everything saved in it
+	errRollback := errors.New("rollback")
+	err := ds.WithCVEMetaTx(ctx, func(tx fleet.CVEMetaTx) error {
+		save(tx, "cve-1")
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+	require.Zero(t, countRows("cve_meta"))
+	require.Zero(t, countRows("cve_cwes"))
+	_, err = ds.LastCVESyncInfo(ctx)
+	require.True(t, fleet.IsNotFound(err))
+
+	// committing it saves everything
+	require.NoError(t, ds.WithCVEMetaTx(ctx, func(tx fleet.CVEMetaTx) error {
+		save(tx, "cve-2")
+		return nil
+	}))
+	var meta fleet.CVEMeta
+	require.NoError(t, sqlx.GetContext(ctx, ds.reader, &meta, `SELECT cve, cvss_score, epss_probability FROM cve_meta`))
+	require.Equal(t, "cve-2", meta.CVE)
+	require.Equal(t, 9.8, *meta.CVSSScore)
+	require.Equal(t, 0.5, *meta.EPSSProbability)
+	require.Equal(t, 1, countRows("cve_cwes"))
+	info, err := ds.LastCVESyncInfo(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, info.CVECount)
+}
+
+func testEPSSCoverage(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	// nothing stored
+	coverage, err := ds.EPSSCoverage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, fleet.EPSSCoverage{}, *coverage)
+	require.Zero(t, coverage.Ratio())
+
+	// 3 of the 4 cves have an epss probability, including one of 0
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(5), EPSSProbability: ptr.Float64(0.5)},
+		{CVE: "cve-2", EPSSProbability: ptr.Float64(0.01)},
+		{CVE: "cve-3", EPSSProbability: ptr.Float64(0)},
+		{CVE: "cve-4", CVSSScore: ptr.Float64(9)},
+	}))
+
+	coverage, err = ds.EPSSCoverage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, fleet.EPSSCoverage{CVECount: 4, EPSSCount: 3}, *coverage)
+	require.Equal(t, 0.75, coverage.Ratio())
+
+	// a load without epss scores drops the coverage
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(5)},
+		{CVE: "cve-2"},
+	}))
+
+	coverage, err = ds.EPSSCoverage(ctx)
+	require.NoError(t, err)
+	require.Equal(t, fleet.EPSSCoverage{CVECount: 4, EPSSCount: 1}, *coverage)
+	require.Equal(t, 0.25, coverage.Ratio())
+}
+
+func testLastCISACatalogVersion(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	// never loaded
+	_, err := ds.LastCISACatalogVersion(ctx)
+	require.True(t, fleet.IsNotFound(err))
+
+	released := time.Date(2022, 6, 2, 17, 48, 15, 0, time.UTC)
+	loadedAt := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, ds.RecordCISACatalogVersion(ctx, fleet.CISACatalogVersion{
+		CatalogVersion: "2022.06.02",
+		DateReleased:   &released,
+		LoadedAt:       loadedAt,
+	}))
+
+	version, err := ds.LastCISACatalogVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "2022.06.02", version.CatalogVersion)
+	require.NotNil(t, version.DateReleased)
+	require.Equal(t, released, version.DateReleased.UTC())
+	require.Equal(t, loadedAt, version.LoadedAt.UTC())
+
+	// a later load replaces the previous one
+	require.NoError(t, ds.RecordCISACatalogVersion(ctx, fleet.CISACatalogVersion{
+		CatalogVersion: "2022.06.03",
+		LoadedAt:       loadedAt.Add(time.Hour),
+	}))
+
+	version, err = ds.LastCISACatalogVersion(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "2022.06.03", version.CatalogVersion)
+	require.Nil(t, version.DateReleased)
+	require.Equal(t, loadedAt.Add(time.Hour), version.LoadedAt.UTC())
+}
+
+func testEPSSSnapshots(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	day1 := time.Date(2022, 6, 1, 0, 0, 0, 0, time.UTC)
+	day2 := day1.Add(7 * 24 * time.Hour)
+
+	// insert the most recent snapshot first, the series is returned in date order regardless
+	require.NoError(t, ds.InsertEPSSSnapshots(ctx, []fleet.EPSSSnapshot{
+		{CVE: "cve-1", SnapshotDate: day2, Score: 0.2, Percentile: 0.8},
+		{CVE: "cve-2", SnapshotDate: day2, Score: 0.5, Percentile: 0.9},
+	}))
+	require.NoError(t, ds.InsertEPSSSnapshots(ctx, []fleet.EPSSSnapshot{
+		{CVE: "cve-1", SnapshotDate: day1, Score: 0.1, Percentile: 0.7},
+	}))
+
+	series, err := ds.ListEPSSSnapshots(ctx, "cve-1")
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	require.True(t, series[0].SnapshotDate.Equal(day1))
+	require.InDelta(t, 0.1, series[0].Score, 0.0001)
+	require.InDelta(t, 0.7, series[0].Percentile, 0.0001)
+	require.True(t, series[1].SnapshotDate.Equal(day2))
+	require.InDelta(t, 0.2, series[1].Score, 0.0001)
+	require.InDelta(t, 0.8, series[1].Percentile, 0.0001)
+
+	// reloading a snapshot replaces the score of that date
+	require.NoError(t, ds.InsertEPSSSnapshots(ctx, []fleet.EPSSSnapshot{
+		{CVE: "cve-1", SnapshotDate: day2, Score: 0.3, Percentile: 0.85},
+	}))
+	series, err = ds.ListEPSSSnapshots(ctx, "cve-1")
+	require.NoError(t, err)
+	require.Len(t, series, 2)
+	require.InDelta(t, 0.3, series[1].Score, 0.0001)
+
+	series, err = ds.ListEPSSSnapshots(ctx, "cve-3")
+	require.NoError(t, err)
+	require.Empty(t, series)
+}
+
+func testEPSSModelScores(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	require.NoError(t, ds.InsertEPSSModelScores(ctx, []fleet.EPSSModelScore{
+		{CVE: "cve-1", ModelVersion: "v2023.03.01", Score: 0.2},
+		{CVE: "cve-2", ModelVersion: "v2023.03.01", Score: 0.5},
+	}))
+	require.NoError(t, ds.InsertEPSSModelScores(ctx, []fleet.EPSSModelScore{
+		{CVE: "cve-1", ModelVersion: "v2022.01.01", Score: 0.1},
+	}))
+
+	scores, err := ds.ListEPSSModelScores(ctx, "cve-1")
+	require.NoError(t, err)
+	require.Len(t, scores, 2)
+	require.Equal(t, "v2022.01.01", scores[0].ModelVersion)
+	require.InDelta(t, 0.1, scores[0].Score, 0.0001)
+	require.Equal(t, "v2023.03.01", scores[1].ModelVersion)
+	require.InDelta(t, 0.2, scores[1].Score, 0.0001)
+
+	// reloading the scores of a model version replaces them
+	require.NoError(t, ds.InsertEPSSModelScores(ctx, []fleet.EPSSModelScore{
+		{CVE: "cve-1", ModelVersion: "v2023.03.01", Score: 0.3},
+	}))
+	scores, err = ds.ListEPSSModelScores(ctx, "cve-1")
+	require.NoError(t, err)
+	require.Len(t, scores, 2)
+	require.InDelta(t, 0.3, scores[1].Score, 0.0001)
+
+	scores, err = ds.ListEPSSModelScores(ctx, "cve-3")
+	require.NoError(t, err)
+	require.Empty(t, scores)
+}
+
+func testCVEsByLabel(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	label, err := ds.NewLabel(ctx, &fleet.Label{Name: "web servers", Query: "select 1"})
+	require.NoError(t, err)
+
+	cves, err := ds.CVEsByLabel(ctx, label.ID, fleet.CVEsByLabelOptions{})
+	require.NoError(t, err)
+	require.Empty(t, cves)
+
+	// host1 and host2 are in the label, host3 isn't
+	host1 := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	host2 := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+	host3 := test.NewHost(t, ds, "host3", "", "host3key", "host3uuid", time.Now())
+	for _, h := range []*fleet.Host{host1, host2} {
+		require.NoError(t, ds.RecordLabelQueryExecutions(ctx, h, map[uint]*bool{label.ID: ptr.Bool(true)}, time.Now(), false))
+	}
+
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host1.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host2.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "bar", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host3.ID, []fleet.Software{
+		{Name: "baz", Version: "0.0.1", Source: "apps"},
+	}))
+	softwareIDs := make(map[string]uint)
+	for _, h := range []*fleet.Host{host1, host2, host3} {
+		require.NoError(t, ds.LoadHostSoftware(ctx, h, false))
+		for _, s := range h.Software {
+			softwareIDs[s.Name] = s.ID
+		}
+	}
+
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-1"}, // foo is on both hosts of the label
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-2"},
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-1"}, // and cve-1 affects multiple software
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-3"},
+		{SoftwareID: softwareIDs["baz"], CVE: "cve-4"}, // not in the label
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+
+	// operating system vulnerabilities, overlapping with the software ones
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?), (?, 1, ?), (?, 1, ?)`,
+		host1.ID, "cve-3", host2.ID, "cve-5", host3.ID, "cve-6",
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(9.8), CISAKnownExploit: ptr.Bool(true)},
+		{CVE: "cve-2", CVSSScore: ptr.Float64(5.0)},
+		{CVE: "cve-3", CVSSScore: ptr.Float64(7.5)},
+		{CVE: "cve-4", CVSSScore: ptr.Float64(10.0)},
+	}))
+
+	cveIDs := func(cves []fleet.CVEMeta) []string {
+		var ids []string
+		for _, c := range cves {
+			ids = append(ids, c.CVE)
+		}
+		return ids
+	}
+
+	cves, err = ds.CVEsByLabel(ctx, label.ID, fleet.CVEsByLabelOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-1", "cve-2", "cve-3", "cve-5"}, cveIDs(cves))
+	require.NotNil(t, cves[0].CVSSScore)
+	require.Equal(t, 9.8, *cves[0].CVSSScore)
+	require.NotNil(t, cves[0].CISAKnownExploit)
+	require.True(t, *cves[0].CISAKnownExploit)
+	// no metadata for cve-5
+	require.Nil(t, cves[3].CVSSScore)
+
+	cves, err = ds.CVEsByLabel(ctx, label.ID, fleet.CVEsByLabelOptions{MinCVSSScore: ptr.Float64(7.0)})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-1", "cve-3"}, cveIDs(cves))
+
+	cves, err = ds.CVEsByLabel(ctx, label.ID, fleet.CVEsByLabelOptions{
+		ListOptions: fleet.ListOptions{Page: 1, PerPage: 3},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-5"}, cveIDs(cves))
+
+	cves, err = ds.CVEsByLabel(ctx, label.ID, fleet.CVEsByLabelOptions{
+		ListOptions: fleet.ListOptions{OrderKey: "cvss_score", OrderDirection: fleet.OrderDescending, PerPage: 2},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-1", "cve-3"}, cveIDs(cves))
+}
+
+func testCVEsByCWE(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	_, err := ds.CVEsByCWE(ctx, "", fleet.CVEsByCWEOptions{})
+	var argErr *fleet.InvalidArgumentError
+	require.ErrorAs(t, err, &argErr)
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(6.1)},
+		{CVE: "cve-2", CVSSScore: ptr.Float64(5.4)},
+		{CVE: "cve-3", CVSSScore: ptr.Float64(9.8)},
+		{CVE: "cve-4", CVSSScore: ptr.Float64(4.3)},
+	}))
+	require.NoError(t, ds.InsertCVECWEs(ctx, []fleet.CVECWE{
+		{CVE: "cve-1", CWE: "CWE-79"},
+		{CVE: "cve-2", CWE: "CWE-79"},
+		{CVE: "cve-2", CWE: "CWE-352"}, // multiple CWEs
+		{CVE: "cve-3", CWE: "CWE-89"},
+		{CVE: "cve-4", CWE: "CWE-79"},
+		{CVE: "cve-5", CWE: "CWE-79"}, // no metadata
+	}))
+	// inserting existing associations is a no-op
+	require.NoError(t, ds.InsertCVECWEs(ctx, []fleet.CVECWE{{CVE: "cve-1", CWE: "CWE-79"}}))
+
+	cveIDs := func(cves []fleet.CVEMeta) []string {
+		var ids []string
+		for _, c := range cves {
+			ids = append(ids, c.CVE)
+		}
+		return ids
+	}
+
+	cves, err := ds.CVEsByCWE(ctx, "CWE-79", fleet.CVEsByCWEOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-1", "cve-2", "cve-4"}, cveIDs(cves))
+	require.Equal(t, 6.1, *cves[0].CVSSScore)
+
+	cves, err = ds.CVEsByCWE(ctx, "CWE-352", fleet.CVEsByCWEOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-2"}, cveIDs(cves))
+
+	cves, err = ds.CVEsByCWE(ctx, "CWE-20", fleet.CVEsByCWEOptions{})
+	require.NoError(t, err)
+	require.Empty(t, cves)
+
+	cves, err = ds.CVEsByCWE(ctx, "CWE-79", fleet.CVEsByCWEOptions{
+		ListOptions: fleet.ListOptions{OrderKey: "cvss_score", OrderDirection: fleet.OrderDescending, PerPage: 2},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-1", "cve-2"}, cveIDs(cves))
+
+	// cve-1 affects the software of a host, cve-4 its operating system, cve-2 affects software not installed on
+	// any host
+	host := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "bar", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
+	softwareIDs := make(map[string]uint)
+	for _, s := range host.Software {
+		softwareIDs[s.Name] = s.ID
+	}
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+	}))
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-1"},
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-2"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?)`,
+		host.ID, "cve-4",
+	)
+	require.NoError(t, err)
+
+	cves, err = ds.CVEsByCWE(ctx, "CWE-79", fleet.CVEsByCWEOptions{AffectingHostsOnly: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-1", "cve-4"}, cveIDs(cves))
+}
+
+func testCVEsByVendorProduct(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	_, err := ds.CVEsByVendorProduct(ctx, "", "http_server", fleet.ListOptions{})
+	var argErr *fleet.InvalidArgumentError
+	require.ErrorAs(t, err, &argErr)
+	_, err = ds.CVEsByVendorProduct(ctx, "apache", "", fleet.ListOptions{})
+	require.ErrorAs(t, err, &argErr)
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(6.1)},
+		{CVE: "cve-2", CVSSScore: ptr.Float64(9.8)},
+		{CVE: "cve-3", CVSSScore: ptr.Float64(5.4)},
+	}))
+	require.NoError(t, ds.InsertCVEProducts(ctx, []fleet.CVEProduct{
+		{CVE: "cve-1", Vendor: "apache", Product: "http_server"},
+		{CVE: "cve-2", Vendor: "apache", Product: "http_server"},
+		{CVE: "cve-2", Vendor: "apache", Product: "tomcat"}, // multiple products
+		{CVE: "cve-3", Vendor: "nginx", Product: "nginx"},
+		{CVE: "cve-4", Vendor: "apache", Product: "http_server"}, // no metadata
+	}))
+	// inserting existing associations is a no-op
+	require.NoError(t, ds.InsertCVEProducts(ctx, []fleet.CVEProduct{{CVE: "cve-1", Vendor: "apache", Product: "http_server"}}))
+
+	cveIDs := func(cves []fleet.CVEMeta) []string {
+		var ids []string
+		for _, c := range cves {
+			ids = append(ids, c.CVE)
+		}
+		return ids
+	}
+
+	// nothing is installed on any host, the cves are listed regardless
+	cves, err := ds.CVEsByVendorProduct(ctx, "apache", "http_server", fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-1", "cve-2"}, cveIDs(cves))
+	require.Equal(t, 6.1, *cves[0].CVSSScore)
+
+	cves, err = ds.CVEsByVendorProduct(ctx, "apache", "tomcat", fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-2"}, cveIDs(cves))
+
+	// the vendor and product must both match
+	cves, err = ds.CVEsByVendorProduct(ctx, "nginx", "http_server", fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, cves)
+
+	cves, err = ds.CVEsByVendorProduct(ctx, "apache", "http_server", fleet.ListOptions{
+		OrderKey: "cvss_score", OrderDirection: fleet.OrderDescending, PerPage: 1,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"cve-2"}, cveIDs(cves))
+}
+
+func testCountFleetCVEs(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	count, err := ds.CountFleetCVEs(ctx, fleet.CountCVEsOptions{})
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	host1 := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	host2 := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host1.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "bar", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host2.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "baz", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host1, false))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host2, false))
+
+	softwareIDs := make(map[string]uint)
+	for _, s := range append(host1.Software, host2.Software...) {
+		softwareIDs[s.Name] = s.ID
+	}
+
+	// software not installed on any host
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host2.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "baz", Version: "0.0.1", Source: "apps"},
+		{Name: "uninstalled", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host2, false))
+	for _, s := range host2.Software {
+		softwareIDs[s.Name] = s.ID
+	}
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host2.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "baz", Version: "0.0.1", Source: "apps"},
+	}))
+
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-1"}, // foo is on both hosts
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-1"}, // and cve-1 affects multiple software
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-2"},
+		{SoftwareID: softwareIDs["baz"], CVE: "cve-3"},
+		{SoftwareID: softwareIDs["uninstalled"], CVE: "cve-4"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+
+	// operating system vulnerabilities, overlapping with the software ones
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?), (?, 1, ?), (?, 1, ?)`,
+		host1.ID, "cve-3", host2.ID, "cve-3", host2.ID, "cve-5",
+	)
+	require.NoError(t, err)
+
+	count, err = ds.CountFleetCVEs(ctx, fleet.CountCVEsOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 4, count) // cve-1, cve-2, cve-3, cve-5
+
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(9.8)},
+		{CVE: "cve-2", CVSSScore: ptr.Float64(5.0)},
+		{CVE: "cve-3", CVSSScore: ptr.Float64(7.0)},
+		{CVE: "cve-4", CVSSScore: ptr.Float64(10.0)},
+	}))
+
+	count, err = ds.CountFleetCVEs(ctx, fleet.CountCVEsOptions{MinCVSSScore: ptr.Float64(7.0)})
+	require.NoError(t, err)
+	require.Equal(t, 2, count) // cve-1, cve-3
+}
+
+func testListSoftwareForVulnDetection(t *testing.T, ds *Datastore) {
+	t.Run("returns software without CPE entries", func(t *testing.T) {
+		ctx := context.Background()
+
+		host := test.NewHost(t, ds, "host3", "", "host3key", "host3uuid", time.Now())
+		host.Platform = "debian"
+		require.NoError(t, ds.UpdateHost(ctx, host))
+
+		software := []fleet.Software{
+			{Name: "foo", Version: "0.0.1", Source: "chrome_extensions"},
+			{Name: "bar", Version: "0.0.3", Source: "apps"},
+			{Name: "biz", Version: "0.0.1", Source: "deb_packages"},
+			{Name: "baz", Version: "0.0.3", Source: "deb_packages"},
+		}
+		require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, software))
+		require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
+		require.NoError(t, ds.AddCPEForSoftware(ctx, host.Software[0], "cpe1"))
+		// Load software again so that CPE data is included.
+		require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
+
+		result, err := ds.ListSoftwareForVulnDetection(ctx, host.ID)
+		require.NoError(t, err)
+
+		sort.Slice(host.Software, func(i, j int) bool { return host.Software[i].ID < host.Software[j].ID })
+		sort.Slice(result, func(i, j int) bool { return result[i].ID < result[j].ID })
+
+		require.Equal(t, len(host.Software), len(result))
+
+		for i := range host.Software {
+			require.Equal(t, host.Software[i].ID, result[i].ID)
+			require.Equal(t, host.Software[i].Name, result[i].Name)
+			require.Equal(t, host.Software[i].Version, result[i].Version)
+			require.Equal(t, host.Software[i].Release, result[i].Release)
+			require.Equal(t, host.Software[i].Arch, result[i].Arch)
+			require.Equal(t, host.Software[i].GenerateCPE, result[i].GenerateCPE)
+		}
+	})
+}
+
+func testSoftwareByID(t *testing.T, ds *Datastore) {
+	t.Run("software installed in multiple hosts does not have duplicated vulnerabilities", func(t *testing.T) {
+		ctx := context.Background()
+
+		hostA := test.NewHost(t, ds, "hostA", "", "hostAkey", "hostAuuid", time.Now())
+		hostA.Platform = "ubuntu"
+		require.NoError(t, ds.UpdateHost(ctx, hostA))
+
+		hostB := test.NewHost(t, ds, "hostB", "", "hostBkey", "hostBuuid", time.Now())
+		hostB.Platform = "ubuntu"
+		require.NoError(t, ds.UpdateHost(ctx, hostB))
+
+		software := []fleet.Software{
+			{Name: "foo_123", Version: "0.0.1", Source: "chrome_extensions"},
+			{Name: "bar_123", Version: "0.0.3", Source: "apps"},
+			{Name: "biz_123", Version: "0.0.1", Source: "deb_packages"},
+			{Name: "baz_123", Version: "0.0.3", Source: "deb_packages"},
+		}
+
+		require.NoError(t, ds.UpdateHostSoftware(ctx, hostA.ID, software))
+		require.NoError(t, ds.UpdateHostSoftware(ctx, hostB.ID, software))
+
+		require.NoError(t, ds.LoadHostSoftware(ctx, hostA, false))
+		require.NoError(t, ds.LoadHostSoftware(ctx, hostB, false))
+
+		// Add one vulnerability to each software
+		var vulns []fleet.SoftwareVulnerability
+		for i, s := range hostA.Software {
+			vulns = append(vulns, fleet.SoftwareVulnerability{
+				SoftwareID: s.ID,
+				CVE:        fmt.Sprintf("cve-%d", i),
+			})
+		}
+		n, err := ds.InsertSoftwareVulnerabilities(ctx, vulns, fleet.UbuntuOVALSource)
+		require.NoError(t, err)
+		require.Equal(t, 4, int(n))
+
+		for _, s := range hostA.Software {
+			result, err := ds.SoftwareByID(ctx, s.ID, true)
+			require.NoError(t, err)
+			require.Len(t, result.Vulnerabilities, 1)
+		}
+	})
+}
+
+func testListSoftwareTitles(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	host1 := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	host2 := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+	host3 := test.NewHost(t, ds, "host3", "", "host3key", "host3uuid", time.Now())
+
+	titles, err := ds.ListSoftwareTitles(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Empty(t, titles)
+
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host1.ID, []fleet.Software{
+		{Name: "foo", Version: "1.0", Source: "apps"},
+		{Name: "bar", Version: "1.0", Source: "apps"},
+	}))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host2.ID, []fleet.Software{
+		{Name: "foo", Version: "2.0", Source: "apps"},
+		{Name: "bar", Version: "1.0", Source: "apps"},
+		{Name: "bar", Version: "1.0", Source: "deb_packages"},
+	}))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host3.ID, []fleet.Software{
+		{Name: "foo", Version: "1.0", Source: "apps"},
+		{Name: "foo", Version: "2.0", Source: "apps"},
+	}))
+	for _, h := range []*fleet.Host{host1, host2} {
+		require.NoError(t, ds.LoadHostSoftware(ctx, h, false))
+	}
+
+	softwareIDs := make(map[string]uint)
+	for _, h := range []*fleet.Host{host1, host2} {
+		for _, s := range h.Software {
+			softwareIDs[s.Name+"-"+s.Version+"-"+s.Source] = s.ID
+		}
+	}
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["foo-1.0-apps"], CVE: "cve-1"},
+		{SoftwareID: softwareIDs["foo-1.0-apps"], CVE: "cve-2"},
+		{SoftwareID: softwareIDs["foo-2.0-apps"], CVE: "cve-2"}, // counted once for the title
+		{SoftwareID: softwareIDs["bar-1.0-deb_packages"], CVE: "cve-3"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+
+	// ordered by name by default
+	titles, err = ds.ListSoftwareTitles(ctx, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Len(t, titles, 3)
+	byKey := make(map[string]fleet.SoftwareTitle)
+	for _, title := range titles {
+		byKey[title.Name+"-"+title.Source] = title
+	}
+	require.Len(t, byKey, 3)
+	require.Equal(t, "bar", titles[0].Name)
+	require.Equal(t, "bar", titles[1].Name)
+	require.Equal(t, "foo", titles[2].Name)
+
+	require.Equal(t, fleet.SoftwareTitle{Name: "foo", Source: "apps", VersionsCount: 2, HostsCount: 3, VulnerabilitiesCount: 2}, byKey["foo-apps"])
+	require.Equal(t, fleet.SoftwareTitle{Name: "bar", Source: "apps", VersionsCount: 1, HostsCount: 2, VulnerabilitiesCount: 0}, byKey["bar-apps"])
+	require.Equal(t, fleet.SoftwareTitle{Name: "bar", Source: "deb_packages", VersionsCount: 1, HostsCount: 1, VulnerabilitiesCount: 1}, byKey["bar-deb_packages"])
+
+	// sorted by hosts count
+	titles, err = ds.ListSoftwareTitles(ctx, fleet.ListOptions{OrderKey: "hosts_count", OrderDirection: fleet.OrderDescending})
+	require.NoError(t, err)
+	require.Len(t, titles, 3)
+	require.Equal(t, []int{3, 2, 1}, []int{titles[0].HostsCount, titles[1].HostsCount, titles[2].HostsCount})
+
+	// sorted by vulnerabilities count, paginated
+	opts := fleet.ListOptions{OrderKey: "vulnerabilities_count", OrderDirection: fleet.OrderDescending, PerPage: 2}
+	titles, err = ds.ListSoftwareTitles(ctx, opts)
+	require.NoError(t, err)
+	require.Len(t, titles, 2)
+	require.Equal(t, "foo", titles[0].Name)
+	require.Equal(t, "bar", titles[1].Name)
+	require.Equal(t, "deb_packages", titles[1].Source)
+
+	opts.Page = 1
+	titles, err = ds.ListSoftwareTitles(ctx, opts)
+	require.NoError(t, err)
+	require.Len(t, titles, 1)
+	require.Equal(t, "bar", titles[0].Name)
+	require.Equal(t, "apps", titles[0].Source)
+}
+
+func testCVECountByYear(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	counts, err := ds.CVECountByYear(ctx, fleet.CountCVEsOptions{})
+	require.NoError(t, err)
+	require.Empty(t, counts)
+
+	host1 := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	host2 := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host1.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "bar", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host2.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "uninstalled", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host1, false))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host2, false))
+
+	softwareIDs := make(map[string]uint)
+	for _, s := range append(host1.Software, host2.Software...) {
+		softwareIDs[s.Name] = s.ID
+	}
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host2.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+	}))
+
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-1"}, // foo is on both hosts
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-1"}, // and cve-1 affects multiple software
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-2"},
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-3"},
+		{SoftwareID: softwareIDs["uninstalled"], CVE: "cve-4"},
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-6"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?), (?, 1, ?)`,
+		host1.ID, "cve-3", host2.ID, "cve-5",
+	)
+	require.NoError(t, err)
+
+	published := func(year int) *time.Time {
+		return ptr.Time(time.Date(year, 6, 1, 0, 0, 0, 0, time.UTC))
+	}
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-1", CVSSScore: ptr.Float64(9.8), Published: published(2021)},
+		{CVE: "cve-2", CVSSScore: ptr.Float64(5.0), Published: published(2022)},
+		{CVE: "cve-3", CVSSScore: ptr.Float64(7.0), Published: published(2022)},
+		{CVE: "cve-4", CVSSScore: ptr.Float64(10.0), Published: published(2020)}, // not installed
+		{CVE: "cve-5", CVSSScore: ptr.Float64(4.0), Published: published(2023)},
+		{CVE: "cve-6", CVSSScore: ptr.Float64(8.0)}, // no published date
+	}))
+
+	counts, err = ds.CVECountByYear(ctx, fleet.CountCVEsOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[int]int{2021: 1, 2022: 2, 2023: 1}, counts)
+
+	counts, err = ds.CVECountByYear(ctx, fleet.CountCVEsOptions{MinCVSSScore: ptr.Float64(7.0)})
+	require.NoError(t, err)
+	require.Equal(t, map[int]int{2021: 1, 2022: 1}, counts)
+}
+
+func testFleetCVETrend(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	trend, err := ds.FleetCVETrend(ctx, time.Time{})
+	require.NoError(t, err)
+	require.Empty(t, trend)
+
+	week1 := time.Date(2023, 3, 14, 0, 0, 0, 0, time.UTC)
+	week2 := week1.AddDate(0, 0, 7)
+
+	// record the most recent snapshot first, the trend is returned in date order regardless
+	require.NoError(t, ds.RecordFleetCVECountSnapshot(ctx, week2.Add(10*time.Hour), 12))
+	require.NoError(t, ds.RecordFleetCVECountSnapshot(ctx, week1, 10))
+
+	trend, err = ds.FleetCVETrend(ctx, week1.AddDate(0, 0, -30))
+	require.NoError(t, err)
+	require.Len(t, trend, 2)
+	require.True(t, trend[0].SnapshotDate.Equal(week1))
+	require.Equal(t, 10, trend[0].CVECount)
+	require.True(t, trend[1].SnapshotDate.Equal(week2))
+	require.Equal(t, 12, trend[1].CVECount)
+
+	// recording the same date again replaces its count
+	require.NoError(t, ds.RecordFleetCVECountSnapshot(ctx, week2, 15))
+	trend, err = ds.FleetCVETrend(ctx, week2.Add(5*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, trend, 1)
+	require.True(t, trend[0].SnapshotDate.Equal(week2))
+	require.Equal(t, 15, trend[0].CVECount)
+
+	trend, err = ds.FleetCVETrend(ctx, week2.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Empty(t, trend)
+}
+
+func testHostCVETrend(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	host := test.NewHost(t, ds, "host1", "", "host1key", "host1uuid", time.Now())
+	otherHost := test.NewHost(t, ds, "host2", "", "host2key", "host2uuid", time.Now())
+
+	trend, err := ds.HostCVETrend(ctx, host.ID, time.Time{})
+	require.NoError(t, err)
+	require.Empty(t, trend)
+
+	week1 := time.Date(2023, 3, 14, 0, 0, 0, 0, time.UTC)
+	week2 := week1.AddDate(0, 0, 7)
+
+	// record the most recent snapshot first, the trend is returned in date order regardless
+	require.NoError(t, ds.RecordHostCVECountSnapshot(ctx, host.ID, week2.Add(10*time.Hour), 12))
+	require.NoError(t, ds.RecordHostCVECountSnapshot(ctx, host.ID, week1, 10))
+	require.NoError(t, ds.RecordHostCVECountSnapshot(ctx, otherHost.ID, week2, 3))
+
+	trend, err = ds.HostCVETrend(ctx, host.ID, week1.AddDate(0, 0, -30))
+	require.NoError(t, err)
+	require.Len(t, trend, 2)
+	require.Equal(t, host.ID, trend[0].HostID)
+	require.True(t, trend[0].SnapshotDate.Equal(week1))
+	require.Equal(t, 10, trend[0].CVECount)
+	require.True(t, trend[1].SnapshotDate.Equal(week2))
+	require.Equal(t, 12, trend[1].CVECount)
+
+	// recording the same date again replaces its count, without affecting the other hosts
+	require.NoError(t, ds.RecordHostCVECountSnapshot(ctx, host.ID, week2, 8))
+	trend, err = ds.HostCVETrend(ctx, host.ID, week2.Add(5*time.Hour))
+	require.NoError(t, err)
+	require.Len(t, trend, 1)
+	require.True(t, trend[0].SnapshotDate.Equal(week2))
+	require.Equal(t, 8, trend[0].CVECount)
+
+	trend, err = ds.HostCVETrend(ctx, otherHost.ID, week1)
+	require.NoError(t, err)
+	require.Len(t, trend, 1)
+	require.Equal(t, otherHost.ID, trend[0].HostID)
+	require.Equal(t, 3, trend[0].CVECount)
+
+	trend, err = ds.HostCVETrend(ctx, host.ID, week2.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Empty(t, trend)
+
+	// the snapshots of all the hosts are computed from their software and operating system CVEs
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{{Name: "foo", Version: "0.0.1", Source: "apps"}}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, host, false))
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: host.Software[0].ID, CVE: "cve-1"},
+		{SoftwareID: host.Software[0].ID, CVE: "cve-2"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+	ExecAdhocSQL(t, ds, func(q sqlx.ExtContext) error {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?), (?, 1, ?)`,
+			host.ID, "cve-2", host.ID, "cve-3")
+		return err
+	})
+
+	week3 := week2.AddDate(0, 0, 7)
+	require.NoError(t, ds.RecordHostCVECountSnapshots(ctx, week3.Add(time.Hour)))
+	trend, err = ds.HostCVETrend(ctx, host.ID, week3)
+	require.NoError(t, err)
+	require.Len(t, trend, 1)
+	require.True(t, trend[0].SnapshotDate.Equal(week3))
+	require.Equal(t, 3, trend[0].CVECount)
+	trend, err = ds.HostCVETrend(ctx, otherHost.ID, week3)
+	require.NoError(t, err)
+	require.Len(t, trend, 1)
+	require.Zero(t, trend[0].CVECount)
+
+	// the snapshots older than the retention are dropped as the new ones are recorded
+	later := week1.Add(hostCVECountSnapshotsRetention).AddDate(0, 0, 1)
+	require.NoError(t, ds.RecordHostCVECountSnapshots(ctx, later))
+	trend, err = ds.HostCVETrend(ctx, host.ID, time.Time{})
+	require.NoError(t, err)
+	require.Len(t, trend, 3)
+	require.True(t, trend[0].SnapshotDate.Equal(week2))
+	require.True(t, trend[1].SnapshotDate.Equal(week3))
+	require.True(t, trend[2].SnapshotDate.Equal(later))
+}
+
+func testCleanHosts(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	clean := test.NewHost(t, ds, "clean", "", "cleankey", "cleanuuid", time.Now())
+	vulnerable := test.NewHost(t, ds, "vulnerable", "", "vulnerablekey", "vulnerableuuid", time.Now())
+	vulnerableOS := test.NewHost(t, ds, "vulnerable_os", "", "vulnerableoskey", "vulnerableosuuid", time.Now())
+	unscanned := test.NewHost(t, ds, "unscanned", "", "unscannedkey", "unscanneduuid", time.Now())
+
+	require.NoError(t, ds.UpdateHostSoftware(ctx, clean.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, vulnerable.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+		{Name: "bar", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, vulnerableOS.ID, []fleet.Software{
+		{Name: "foo", Version: "0.0.1", Source: "apps"},
+	}))
+	require.NoError(t, ds.LoadHostSoftware(ctx, vulnerable, false))
+
+	softwareIDs := make(map[string]uint)
+	for _, s := range vulnerable.Software {
+		softwareIDs[s.Name] = s.ID
+	}
+	_, err := ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["bar"], CVE: "cve-1"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?)`,
+		vulnerableOS.ID, "cve-2",
+	)
+	require.NoError(t, err)
+
+	hosts, err := ds.CleanHosts(ctx, fleet.CleanHostsOptions{})
+	require.NoError(t, err)
+	require.Len(t, hosts, 2)
+	require.Equal(t, clean.ID, hosts[0].ID)
+	require.Equal(t, "clean", hosts[0].Hostname)
+	require.False(t, hosts[0].Unscanned)
+	require.Equal(t, unscanned.ID, hosts[1].ID)
+	require.True(t, hosts[1].Unscanned)
+
+	// label scoping
+	label, err := ds.NewLabel(ctx, &fleet.Label{Name: "clean", Query: "select 1"})
+	require.NoError(t, err)
+	for _, h := range []*fleet.Host{unscanned, vulnerable} {
+		require.NoError(t, ds.RecordLabelQueryExecutions(ctx, h, map[uint]*bool{label.ID: ptr.Bool(true)}, time.Now(), false))
+	}
+
+	hosts, err = ds.CleanHosts(ctx, fleet.CleanHostsOptions{LabelID: &label.ID})
+	require.NoError(t, err)
+	require.Len(t, hosts, 1)
+	require.Equal(t, unscanned.ID, hosts[0].ID)
+	require.True(t, hosts[0].Unscanned)
+
+	// a host is no longer clean once a CVE affects its software
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["foo"], CVE: "cve-3"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+	hosts, err = ds.CleanHosts(ctx, fleet.CleanHostsOptions{ListOptions: fleet.ListOptions{OrderKey: "hostname"}})
+	require.NoError(t, err)
+	require.Len(t, hosts, 1)
+	require.Equal(t, unscanned.ID, hosts[0].ID)
+}
+
+func testHostsBySeverity(t *testing.T, ds *Datastore) {
+	ctx := context.Background()
+
+	// the hosts are named after the worst severity of their CVEs
+	var hosts []*fleet.Host
+	for _, name := range []string{"critical", "high", "medium", "low", "unscored", "clean", "os-high"} {
+		hosts = append(hosts, test.NewHost(t, ds, name, "", name+"key", name+"uuid", time.Now()))
+	}
+	critical, high, medium, low, unscored, clean, osHigh := hosts[0], hosts[1], hosts[2], hosts[3], hosts[4], hosts[5], hosts[6]
+
+	hostSoftware := map[*fleet.Host][]fleet.Software{
+		critical: {{Name: "critical", Version: "0.0.1", Source: "apps"}, {Name: "low", Version: "0.0.1", Source: "apps"}},
+		high:     {{Name: "high", Version: "0.0.1", Source: "apps"}, {Name: "medium", Version: "0.0.1", Source: "apps"}},
+		medium:   {{Name: "medium", Version: "0.0.1", Source: "apps"}},
+		low:      {{Name: "low", Version: "0.0.1", Source: "apps"}, {Name: "unscored", Version: "0.0.1", Source: "apps"}},
+		unscored: {{Name: "unscored", Version: "0.0.1", Source: "apps"}},
+		clean:    {{Name: "clean", Version: "0.0.1", Source: "apps"}},
+		osHigh:   {{Name: "clean", Version: "0.0.1", Source: "apps"}},
+	}
+	softwareIDs := make(map[string]uint)
+	for h, software := range hostSoftware {
+		require.NoError(t, ds.UpdateHostSoftware(ctx, h.ID, software))
+		require.NoError(t, ds.LoadHostSoftware(ctx, h, false))
+		for _, s := range h.Software {
+			softwareIDs[s.Name] = s.ID
+		}
+	}
+
+	// the software are named after the severity of their CVE
+	_, err := ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: softwareIDs["critical"], CVE: "cve-critical"},
+		{SoftwareID: softwareIDs["high"], CVE: "cve-high"},
+		{SoftwareID: softwareIDs["medium"], CVE: "cve-medium"},
+		{SoftwareID: softwareIDs["low"], CVE: "cve-low"},
+		{SoftwareID: softwareIDs["unscored"], CVE: "cve-unscored"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+	require.NoError(t, ds.InsertCVEMeta(ctx, []fleet.CVEMeta{
+		{CVE: "cve-critical", CVSSScore: ptr.Float64(9.0)},
+		{CVE: "cve-high", CVSSScore: ptr.Float64(8.9)},
+		{CVE: "cve-medium", CVSSScore: ptr.Float64(4.0)},
+		{CVE: "cve-low", CVSSScore: ptr.Float64(0.1)},
+		{CVE: "cve-unscored", EPSSProbability: ptr.Float64(0.9)},
+		{CVE: "cve-os-high", CVSSScore: ptr.Float64(7.5)},
+		{CVE: "cve-os-unscored"},
+	}))
+	// os-high is only affected through its operating system
+	_, err = ds.writer.ExecContext(ctx,
+		`INSERT INTO operating_system_vulnerabilities (host_id, operating_system_id, cve) VALUES (?, 1, ?), (?, 1, ?)`,
+		osHigh.ID, "cve-os-high", unscored.ID, "cve-os-unscored",
+	)
+	require.NoError(t, err)
+
+	hostIDs := func(hosts []fleet.Host) []uint {
+		ids := make([]uint, 0, len(hosts))
+		for _, h := range hosts {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	for _, c := range []struct {
+		severity string
+		want     []uint
+	}{
+		{fleet.CVSSSeverityCritical, []uint{critical.ID}},
+		{fleet.CVSSSeverityHigh, []uint{critical.ID, high.ID, osHigh.ID}},
+		{fleet.CVSSSeverityMedium, []uint{critical.ID, high.ID, medium.ID, osHigh.ID}},
+		{fleet.CVSSSeverityLow, []uint{critical.ID, high.ID, medium.ID, low.ID, osHigh.ID}},
+	} {
+		hosts, err := ds.HostsBySeverity(ctx, c.severity, fleet.ListOptions{})
+		require.NoError(t, err, c.severity)
+		require.Equal(t, c.want, hostIDs(hosts), c.severity)
+	}
+
+	list, err := ds.HostsBySeverity(ctx, fleet.CVSSSeverityHigh, fleet.ListOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "critical", list[0].Hostname)
+
+	// ordering and pagination
+	list, err = ds.HostsBySeverity(ctx, fleet.CVSSSeverityLow, fleet.ListOptions{
+		OrderKey:       "hostname",
+		OrderDirection: fleet.OrderDescending,
+		PerPage:        2,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []uint{osHigh.ID, medium.ID}, hostIDs(list))
+
+	_, err = ds.HostsBySeverity(ctx, "severe", fleet.ListOptions{})
+	require.Error(t, err)
+	var iae *fleet.InvalidArgumentError
+	require.ErrorAs(t, err, &iae)
 }
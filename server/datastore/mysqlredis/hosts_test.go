@@ -26,7 +26,7 @@ func TestEnforceHostLimit(t *testing.T) {
 
 		ctx := context.Background()
 		ds := new(mock.Store)
-		ds.EnrollHostFunc = func(ctx context.Context, isMDMEnabled bool, osqueryHostId, hUUID, hSerial, nodeKey string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
+		ds.EnrollHostFunc = func(ctx context.Context, isMDMEnabled bool, osqueryHostId, hUUID, hSerial, nodeKey, enrollSecret string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
 			hostIDSeq++
 			return &fleet.Host{
 				ID: hostIDSeq, OsqueryHostID: &osqueryHostId, NodeKey: &nodeKey,
@@ -68,12 +68,12 @@ func TestEnforceHostLimit(t *testing.T) {
 		require.NotNil(t, h1)
 		requireInvokedAndReset(&ds.NewHostFuncInvoked)
 		requireCanEnroll(true)
-		h2, err := wrappedDS.EnrollHost(ctx, false, "osquery-2", "", "", "node-2", nil, time.Second)
+		h2, err := wrappedDS.EnrollHost(ctx, false, "osquery-2", "", "", "node-2", "", nil, time.Second)
 		require.NoError(t, err)
 		require.NotNil(t, h2)
 		requireInvokedAndReset(&ds.EnrollHostFuncInvoked)
 		requireCanEnroll(true)
-		h3, err := wrappedDS.EnrollHost(ctx, false, "osquery-3", "", "", "node-3", nil, time.Second)
+		h3, err := wrappedDS.EnrollHost(ctx, false, "osquery-3", "", "", "node-3", "", nil, time.Second)
 		require.NoError(t, err)
 		require.NotNil(t, h3)
 		requireInvokedAndReset(&ds.EnrollHostFuncInvoked)
@@ -83,7 +83,7 @@ func TestEnforceHostLimit(t *testing.T) {
 		err = wrappedDS.DeleteHost(ctx, h1.ID)
 		require.NoError(t, err)
 		requireCanEnroll(true)
-		h4, err := wrappedDS.EnrollHost(ctx, false, "osquery-4", "", "", "node-4", nil, time.Second)
+		h4, err := wrappedDS.EnrollHost(ctx, false, "osquery-4", "", "", "node-4", "", nil, time.Second)
 		require.NoError(t, err)
 		require.NotNil(t, h4)
 		requireInvokedAndReset(&ds.EnrollHostFuncInvoked)
@@ -93,7 +93,7 @@ func TestEnforceHostLimit(t *testing.T) {
 		err = wrappedDS.DeleteHosts(ctx, []uint{h1.ID, h2.ID, h3.ID})
 		require.NoError(t, err)
 		requireCanEnroll(true)
-		h5, err := wrappedDS.EnrollHost(ctx, false, "osquery-5", "", "", "node-5", nil, time.Second)
+		h5, err := wrappedDS.EnrollHost(ctx, false, "osquery-5", "", "", "node-5", "", nil, time.Second)
 		require.NoError(t, err)
 		require.NotNil(t, h5)
 		requireInvokedAndReset(&ds.EnrollHostFuncInvoked)
@@ -116,7 +116,7 @@ func TestEnforceHostLimit(t *testing.T) {
 		requireCanEnroll(true)
 
 		// can now create 2 more
-		h7, err := wrappedDS.EnrollHost(ctx, false, "osquery-7", "", "", "node-7", nil, time.Second)
+		h7, err := wrappedDS.EnrollHost(ctx, false, "osquery-7", "", "", "node-7", "", nil, time.Second)
 		require.NoError(t, err)
 		require.NotNil(t, h7)
 		requireInvokedAndReset(&ds.EnrollHostFuncInvoked)
@@ -69,12 +69,13 @@ type Datastore interface {
 	// NewQuery creates a new query object in thie datastore. The returned query should have the ID updated.
 	NewQuery(ctx context.Context, query *Query, opts ...OptionalArg) (*Query, error)
 	// SaveQuery saves changes to an existing query object.
-	SaveQuery(ctx context.Context, query *Query) error
+	SaveQuery(ctx context.Context, query *Query, opts ...OptionalArg) error
 	// DeleteQuery deletes an existing query object.
 	DeleteQuery(ctx context.Context, name string) error
-	// DeleteQueries deletes the existing query objects with the provided IDs. The number of deleted queries is returned
-	// along with any error.
-	DeleteQueries(ctx context.Context, ids []uint) (uint, error)
+	// DeleteQueries deletes the existing query objects with the provided IDs, except those that are scheduled in a pack
+	// unless WithForcedQueryDeletion is passed. The number of deleted queries is returned along with the IDs of the
+	// queries that were kept because they are scheduled.
+	DeleteQueries(ctx context.Context, ids []uint, opts ...OptionalArg) (deleted uint, blocked []uint, err error)
 	// Query returns the query associated with the provided ID. Associated packs should also be loaded.
 	Query(ctx context.Context, id uint) (*Query, error)
 	// ListQueries returns a list of queries with the provided sorting and paging options. Associated packs should also
@@ -82,9 +83,17 @@ type Datastore interface {
 	ListQueries(ctx context.Context, opt ListQueryOptions) ([]*Query, error)
 	// QueryByName looks up a query by name.
 	QueryByName(ctx context.Context, name string, opts ...OptionalArg) (*Query, error)
+	// SearchQueriesByBody returns the saved queries whose SQL contains the given substring (case-insensitive).
+	SearchQueriesByBody(ctx context.Context, substring string, opt ListOptions) ([]*Query, error)
 	// ObserverCanRunQuery returns whether a user with an observer role is permitted to run the
 	// identified query
 	ObserverCanRunQuery(ctx context.Context, queryID uint) (bool, error)
+	// FindDuplicateQueryBodies returns groups of saved queries whose SQL bodies are identical once comments and
+	// whitespace are normalized. Only groups with more than one query are returned.
+	FindDuplicateQueryBodies(ctx context.Context) ([][]*Query, error)
+	// ValidateQueriesAgainstSchema returns the saved queries that read from tables that are not in the schema, e.g.
+	// tables removed from a newer version of osquery, along with these tables. Queries are ordered by ID.
+	ValidateQueriesAgainstSchema(ctx context.Context, schema OsquerySchema) ([]QueryMissingTables, error)
 
 	///////////////////////////////////////////////////////////////////////////////
 	// CampaignStore defines the distributed query campaign related datastore methods
@@ -118,6 +127,10 @@ type Datastore interface {
 	GetPackSpecs(ctx context.Context) ([]*PackSpec, error)
 	// GetPackSpec returns the spec for the named pack.
 	GetPackSpec(ctx context.Context, name string) (*PackSpec, error)
+	// ExportPackSpec returns the spec of the pack with the given ID, along with the definitions of the queries it
+	// schedules, so that it can be applied as-is on another instance. The label and team targets are referenced
+	// by name and must exist where the spec is applied.
+	ExportPackSpec(ctx context.Context, packID uint) (*PackSpec, error)
 
 	// NewPack creates a new pack in the datastore.
 	NewPack(ctx context.Context, pack *Pack, opts ...OptionalArg) (*Pack, error)
@@ -137,9 +150,35 @@ type Datastore interface {
 	// PackByName fetches pack if it exists, if the pack exists the bool return value is true
 	PackByName(ctx context.Context, name string, opts ...OptionalArg) (*Pack, bool, error)
 
+	// ListPacksWithoutTargets lists the (non-system) packs that don't target any host, directly or via a label or
+	// team, e.g. because their labels have no members. Their queries never run.
+	ListPacksWithoutTargets(ctx context.Context) ([]Pack, error)
+
+	// PacksByLabel lists the packs that target the label directly, i.e. not via its hosts, along with their targets.
+	PacksByLabel(ctx context.Context, labelID uint) ([]Pack, error)
+
+	// AuditPackQueryReferences returns the scheduled queries of packs that reference a query that doesn't exist, by
+	// name or by ID, ordered by pack and scheduled query. It is a consistency check, deleting a query normally
+	// deletes its scheduled queries.
+	AuditPackQueryReferences(ctx context.Context) ([]PackQueryReference, error)
+
 	// ListPacksForHost lists the packs that a host should execute.
 	ListPacksForHost(ctx context.Context, hid uint) (packs []*Pack, err error)
 
+	// ListHostsInPack lists a page of the hosts targeted by the pack, directly or via a label or team, and returns
+	// the total number of hosts matching the options.
+	ListHostsInPack(ctx context.Context, pid uint, opt ListOptions) (hosts []*HostShort, count int, err error)
+
+	// ResolvePackTargets returns the IDs of the hosts targeted by the pack once its label and team targets are
+	// expanded, merged with its host targets, without duplicates and in ascending order. It is meant to explain why a
+	// host runs a pack.
+	ResolvePackTargets(ctx context.Context, packID uint) ([]uint, error)
+
+	// HostsMissingPack returns the hosts of the label that the pack doesn't target, directly or via a label or team,
+	// e.g. to find the hosts out of compliance with a pack that must run on all of them. It returns a not found error
+	// if the label or the pack doesn't exist.
+	HostsMissingPack(ctx context.Context, labelID, packID uint, opts ListOptions) ([]Host, error)
+
 	// EnsureGlobalPack gets or inserts a pack with type global
 	EnsureGlobalPack(ctx context.Context) (*Pack, error)
 
@@ -161,6 +200,9 @@ type Datastore interface {
 	DeleteLabel(ctx context.Context, name string) error
 	Label(ctx context.Context, lid uint) (*Label, error)
 	ListLabels(ctx context.Context, filter TeamFilter, opt ListOptions) ([]*Label, error)
+	// ListLabelsWithCounts returns the labels along with the number of member hosts visible with the filter, computed
+	// in a single aggregated query.
+	ListLabelsWithCounts(ctx context.Context, filter TeamFilter, opt ListOptions) ([]*Label, error)
 	LabelsSummary(ctx context.Context) ([]*LabelSummary, error)
 
 	// LabelQueriesForHost returns the label queries that should be executed for the given host.
@@ -170,6 +212,10 @@ type Datastore interface {
 	// ListLabelsForHost returns the labels that the given host is in.
 	ListLabelsForHost(ctx context.Context, hid uint) ([]*Label, error)
 
+	// LabelsNotForHost returns the labels the given host is not a member of and can be manually added to, i.e. the
+	// manual labels it is not in. They are sorted by name unless opts sets another order.
+	LabelsNotForHost(ctx context.Context, hostID uint, opts ListOptions) ([]Label, error)
+
 	// ListHostsInLabel returns a slice of hosts in the label with the given ID.
 	ListHostsInLabel(ctx context.Context, filter TeamFilter, lid uint, opt HostListOptions) ([]*Host, error)
 
@@ -182,6 +228,10 @@ type Datastore interface {
 	// LabelIDsByName Retrieve the IDs associated with the given labels
 	LabelIDsByName(ctx context.Context, labels []string) ([]uint, error)
 
+	// CleanupOrphanedLabelMemberships deletes the label memberships of hosts or labels that no longer exist and
+	// returns the number of memberships deleted. It is safe to run periodically.
+	CleanupOrphanedLabelMemberships(ctx context.Context) (int, error)
+
 	// Methods used for async processing of host label query results.
 	AsyncBatchInsertLabelMembership(ctx context.Context, batch [][2]uint) error
 	AsyncBatchDeleteLabelMembership(ctx context.Context, batch [][2]uint) error
@@ -192,7 +242,14 @@ type Datastore interface {
 
 	// NewHost is deprecated and will be removed. Hosts should always be enrolled via EnrollHost.
 	NewHost(ctx context.Context, host *Host) (*Host, error)
+	// BulkUpsertHosts inserts new hosts and updates existing ones (matched by UUID) in batches within a single
+	// transaction. It returns the IDs of the hosts that were created and of those that were updated.
+	BulkUpsertHosts(ctx context.Context, hosts []*Host) (created, updated []uint, err error)
 	DeleteHost(ctx context.Context, hid uint) error
+	// MergeHosts moves the label memberships, pack targets and scheduled query stats of host mergeID to host keepID
+	// and deletes mergeID, all in a single transaction. The kept host retains the oldest creation date and the most
+	// recent seen time of both hosts.
+	MergeHosts(ctx context.Context, keepID, mergeID uint) error
 	Host(ctx context.Context, id uint) (*Host, error)
 	ListHosts(ctx context.Context, filter TeamFilter, opt HostListOptions) ([]*Host, error)
 
@@ -211,6 +268,9 @@ type Datastore interface {
 	CleanupIncomingHosts(ctx context.Context, now time.Time) ([]uint, error)
 	// GenerateHostStatusStatistics retrieves the count of online, offline, MIA and new hosts.
 	GenerateHostStatusStatistics(ctx context.Context, filter TeamFilter, now time.Time, platform *string, lowDiskSpace *int) (*HostSummary, error)
+	// GenerateHostStatusStatisticsByTeam is GenerateHostStatusStatistics for each of the given teams, computed in
+	// bulk. The returned map has an entry for every team, keyed by team ID. The TeamID of the filter is ignored.
+	GenerateHostStatusStatisticsByTeam(ctx context.Context, filter TeamFilter, teamIDs []uint, now time.Time, platform *string, lowDiskSpace *int) (map[uint]*HostSummary, error)
 	// HostIDsByName Retrieve the IDs associated with the given hostnames
 	HostIDsByName(ctx context.Context, filter TeamFilter, hostnames []string) ([]uint, error)
 
@@ -331,6 +391,11 @@ type Datastore interface {
 	// NewInvite creates and stores a new invitation in a DB.
 	NewInvite(ctx context.Context, i *Invite) (*Invite, error)
 
+	// BulkCreateInvites creates the invites in a single transaction and returns the ones created, in order. The
+	// invites that are invalid or whose email is already invited, in the datastore or earlier in the batch, are
+	// skipped and reported in a *BulkInviteError, which is returned along with the created invites.
+	BulkCreateInvites(ctx context.Context, invites []Invite) ([]Invite, error)
+
 	// ListInvites lists all invites in the datastore.
 	ListInvites(ctx context.Context, opt ListOptions) ([]*Invite, error)
 
@@ -348,6 +413,10 @@ type Datastore interface {
 
 	UpdateInvite(ctx context.Context, id uint, i *Invite) (*Invite, error)
 
+	// InvitesExpiringBefore returns the invites that expire strictly before the given time, including the already
+	// expired ones. The invites without a recorded expiry are not returned.
+	InvitesExpiringBefore(ctx context.Context, before time.Time, opts ListOptions) ([]*Invite, error)
+
 	///////////////////////////////////////////////////////////////////////////////
 	// ScheduledQueryStore
 
@@ -357,7 +426,18 @@ type Datastore interface {
 	SaveScheduledQuery(ctx context.Context, sq *ScheduledQuery) (*ScheduledQuery, error)
 	DeleteScheduledQuery(ctx context.Context, id uint) error
 	ScheduledQuery(ctx context.Context, id uint) (*ScheduledQuery, error)
+	// ScheduledQueriesDueForHost returns the scheduled queries of the enabled packs targeting the host that are due to
+	// run at the given time, i.e. that never ran on the host or whose interval elapsed since they last ran on it.
+	ScheduledQueriesDueForHost(ctx context.Context, hostID uint, at time.Time) ([]ScheduledQuery, error)
+	// ScheduledQueriesNeverRun returns the scheduled queries that no host reported stats for, e.g. because their pack
+	// is disabled or doesn't target any host, ordered by ID.
+	ScheduledQueriesNeverRun(ctx context.Context) ([]ScheduledQuery, error)
 	CleanupExpiredHosts(ctx context.Context) ([]uint, error)
+	// ScheduledQueryIntervalHistogram returns the number of scheduled queries of the enabled packs by interval, in
+	// the buckets defined by ScheduledQueryIntervalBounds. All the buckets are returned, in increasing order of
+	// interval, even the empty ones.
+	ScheduledQueryIntervalHistogram(ctx context.Context) ([]ScheduledQueryIntervalBucket, error)
+
 	// ScheduledQueryIDsByName loads the IDs associated with the given pack and
 	// query names. It returns a slice of IDs in the same order as
 	// packAndSchedQueryNames, with the ID set to 0 if the corresponding
@@ -405,6 +485,8 @@ type Datastore interface {
 	AllSoftwareWithoutCPEIterator(ctx context.Context, excludedPlatforms []string) (SoftwareIterator, error)
 	AddCPEForSoftware(ctx context.Context, software Software, cpe string) error
 	ListSoftwareCPEs(ctx context.Context) ([]SoftwareCPE, error)
+	// ListHostSoftwareCPEs returns the CPEs of the software installed on the host.
+	ListHostSoftwareCPEs(ctx context.Context, hostID uint) ([]SoftwareCPE, error)
 	// InsertSoftwareVulnerabilities inserts the given vulnerabilities in the datastore, returns the number
 	// of rows inserted. If a vulnerability already exists in the datastore, then it will be ignored.
 	InsertSoftwareVulnerabilities(ctx context.Context, vulns []SoftwareVulnerability, source VulnerabilitySource) (int64, error)
@@ -420,9 +502,134 @@ type Datastore interface {
 	// on removed hosts, software uninstalled on hosts, etc.)
 	SyncHostsSoftware(ctx context.Context, updatedAt time.Time) error
 	HostsBySoftwareIDs(ctx context.Context, softwareIDs []uint) ([]*HostShort, error)
-	HostsByCVE(ctx context.Context, cve string) ([]*HostShort, error)
-	InsertCVEMeta(ctx context.Context, cveMeta []CVEMeta) error
+	// HostsByCVE returns the hosts that have software affected by the CVE, in the order defined by opts.
+	HostsByCVE(ctx context.Context, cve string, opts HostsByCVEOptions) ([]*HostShort, error)
+	// InsertCVEMeta inserts or replaces the metadata of the given CVEs, e.g. from a full load of the feeds. The CVSS
+	// subscores and vector are only loaded on demand: unless WithCVSSSubscoresLoaded is passed, the stored ones are
+	// kept when nil, as long as the CVSS score didn't change. Likewise, the stored last modified dates are kept when
+	// nil unless WithLastModifiedLoaded is passed.
+	InsertCVEMeta(ctx context.Context, cveMeta []CVEMeta, opts ...OptionalArg) error
+	// UpsertCVEMeta inserts or updates the metadata of the given CVEs. Unlike InsertCVEMeta, the nil fields of an
+	// existing CVE keep their stored value, so it can be used to apply partial (incremental) updates.
+	UpsertCVEMeta(ctx context.Context, cveMeta []CVEMeta) error
+	// PruneCVEMeta deletes the metadata of the stored CVEs that are not in current, along with their provenance, EPSS
+	// model scores, products and CWEs, and returns the number of CVEs deleted.
+	PruneCVEMeta(ctx context.Context, current []string) (int, error)
+	// LockCVEMetaLoad serializes the loads of CVE metadata, so that two concurrent loads (e.g. from two Fleet
+	// instances) don't interleave their writes. If another load holds the lock, it waits for it to be released when
+	// wait is true, and fails with ErrCVEMetaLoadInProgress otherwise. The returned function releases the lock.
+	LockCVEMetaLoad(ctx context.Context, wait bool) (unlock func(), err error)
+	// WithCVEMetaTx runs fn in a transaction, which is committed if fn succeeds and rolled back otherwise. The CVE
+	// metadata saved through tx, e.g. by nvd.LoadCVEMeta with nvd.WithTx, is only visible once committed.
+	WithCVEMetaTx(ctx context.Context, fn func(tx CVEMetaTx) error) error
+	// InsertCVEMetaProvenance stores the provenance of CVE fields, replacing the previous provenance of the same
+	// fields.
+	InsertCVEMetaProvenance(ctx context.Context, provenance []CVEMetaProvenance) error
+	// ListCVEMetaProvenance returns the provenance of the fields of the CVE, ordered by field.
+	ListCVEMetaProvenance(ctx context.Context, cve string) ([]CVEMetaProvenance, error)
 	ListCVEs(ctx context.Context, maxAge time.Duration) ([]CVEMeta, error)
+	// NewCVEsSince returns the CVEs published after since, ordered by publication date by default. CVEs without a
+	// published date are never returned.
+	NewCVEsSince(ctx context.Context, since time.Time, opts ListOptions) ([]CVEMeta, error)
+	// CVEMetaChangedSince returns the CVEs whose metadata changed at or after since, e.g. to export only the changes
+	// since the previous export, ordered by the time of the change by default. Saving the same metadata again is not a
+	// change. Changes are tracked to the second, so the CVEs that changed during the second of since are returned
+	// again.
+	CVEMetaChangedSince(ctx context.Context, since time.Time, opts ListOptions) ([]CVEMeta, error)
+	// CVEsWithoutCVSS returns the CVEs without a CVSS score, e.g. the ones only known from the EPSS or CISA feeds,
+	// which can't be prioritized automatically. They are ordered by CVE by default.
+	CVEsWithoutCVSS(ctx context.Context, opts ListOptions) ([]CVEMeta, error)
+	// OverdueCVEs returns the CVEs past their CISA due date, i.e. due before the day (in UTC) of asOf, that still
+	// affect at least one host, via its software or operating system. They are ordered by due date by default.
+	OverdueCVEs(ctx context.Context, asOf time.Time, opts ListOptions) ([]CVEMeta, error)
+	// FleetKnownExploitedCVEs returns the CVEs in the CISA known exploited vulnerabilities catalog that affect at
+	// least one host, via its software or operating system. They are ordered by the date they were added to the
+	// catalog by default, most recent first.
+	FleetKnownExploitedCVEs(ctx context.Context, opts ListOptions) ([]CVEMeta, error)
+	// RecordCVESync records that the metadata of cveCount CVEs was successfully loaded at syncedAt, replacing the
+	// previous record.
+	RecordCVESync(ctx context.Context, syncedAt time.Time, cveCount int) error
+	// LastCVESyncInfo returns when the CVE metadata was last successfully loaded. It returns a not found error if it
+	// was never loaded.
+	LastCVESyncInfo(ctx context.Context) (*CVESyncInfo, error)
+	// RecordSyncAttempt stores an attempt at downloading the vulnerability feeds and sets its ID. The attempts started
+	// more than 30 days before it are deleted.
+	RecordSyncAttempt(ctx context.Context, attempt *SyncAttempt) error
+	// ListSyncAttempts returns a page of the recorded attempts at downloading the vulnerability feeds, most recent
+	// first by default.
+	ListSyncAttempts(ctx context.Context, opts ListOptions) ([]SyncAttempt, error)
+	// EPSSCoverage returns how many of the stored CVEs have an EPSS probability.
+	EPSSCoverage(ctx context.Context) (*EPSSCoverage, error)
+	// RecordCISACatalogVersion records the version of the CISA known exploits catalog that was loaded, replacing the
+	// previous record.
+	RecordCISACatalogVersion(ctx context.Context, version CISACatalogVersion) error
+	// LastCISACatalogVersion returns the version of the CISA known exploits catalog that was last loaded. It returns a
+	// not found error if no catalog was loaded yet.
+	LastCISACatalogVersion(ctx context.Context) (*CISACatalogVersion, error)
+	// HostVulnerabilitySummary returns the highest CVSS score, the number of CVEs by severity and whether there are
+	// known exploits among the vulnerabilities of the software installed on the host and of its operating system.
+	HostVulnerabilitySummary(ctx context.Context, hostID uint) (*HostVulnerabilitySummary, error)
+	// MostVulnerableHosts returns the vulnerability summaries of the limit hosts with the highest risk score (see
+	// HostVulnerabilitySummary.ComputeRiskScore), highest first. The CVEs of the software and of the operating system of
+	// the hosts are counted. Hosts without CVEs are not ranked.
+	MostVulnerableHosts(ctx context.Context, limit int, opts MostVulnerableHostsOptions) ([]HostVulnerabilitySummary, error)
+	// CleanHosts returns the hosts that are affected by no CVE, neither through their software nor their operating
+	// system. The hosts without software inventory are included, and flagged as unscanned.
+	CleanHosts(ctx context.Context, opts CleanHostsOptions) ([]*CleanHost, error)
+	// HostsBySeverity returns the hosts affected by at least one CVE, through their software or their operating
+	// system, whose CVSS score is in the minSeverity band or a higher one, e.g. CVSSSeverityHigh lists the hosts with
+	// a high or critical CVE. The CVEs without a CVSS score are ignored. Results are ordered by host id by default.
+	HostsBySeverity(ctx context.Context, minSeverity string, opts ListOptions) ([]Host, error)
+	// HostCVEs returns the CVEs affecting the software and the operating system of the host along with their metadata,
+	// one entry per CVE and software or operating system. Results can be ordered by cve, cvss_score, epss_probability
+	// or published, and are ordered by cve by default.
+	HostCVEs(ctx context.Context, hostID uint, opts ListOptions) ([]HostCVE, error)
+	// InsertEPSSSnapshots stores the given EPSS scores, keeping one score per CVE and snapshot date. Scores of
+	// previous dates are kept, so that the evolution of a CVE's score can be tracked.
+	InsertEPSSSnapshots(ctx context.Context, snapshots []EPSSSnapshot) error
+	// ListEPSSSnapshots returns the stored EPSS scores of the CVE, ordered by snapshot date.
+	ListEPSSSnapshots(ctx context.Context, cve string) ([]EPSSSnapshot, error)
+	// InsertEPSSModelScores stores the given EPSS scores, keeping one score per CVE and model version. Scores of
+	// previously stored model versions are kept.
+	InsertEPSSModelScores(ctx context.Context, scores []EPSSModelScore) error
+	// ListEPSSModelScores returns the stored EPSS scores of the CVE, ordered by model version.
+	ListEPSSModelScores(ctx context.Context, cve string) ([]EPSSModelScore, error)
+	// CVEsByLabel returns a page of the distinct CVEs that affect the software or the operating system of at least one
+	// member host of the label, along with their metadata. They are ordered by CVE by default.
+	CVEsByLabel(ctx context.Context, labelID uint, opts CVEsByLabelOptions) ([]CVEMeta, error)
+	// InsertCVECWEs stores the given associations between CVEs and CWEs, as read from the NVD feeds. Existing
+	// associations are kept.
+	InsertCVECWEs(ctx context.Context, cwes []CVECWE) error
+	// CVEsByCWE returns a page of the CVEs of the given CWE (e.g. CWE-79) that have metadata, along with their
+	// metadata. They are ordered by CVE by default.
+	CVEsByCWE(ctx context.Context, cweID string, opts CVEsByCWEOptions) ([]CVEMeta, error)
+	// InsertCVEProducts stores the given associations between CVEs and the products they affect. Existing
+	// associations are kept.
+	InsertCVEProducts(ctx context.Context, products []CVEProduct) error
+	// CVEsByVendorProduct returns a page of the CVEs affecting the given vendor and product (e.g. apache and
+	// http_server) that have metadata, whether or not the product is installed on any host. They are ordered by CVE by
+	// default.
+	CVEsByVendorProduct(ctx context.Context, vendor, product string, opts ListOptions) ([]CVEMeta, error)
+	// CountFleetCVEs returns the number of distinct CVEs that affect the software or the operating system of at
+	// least one host.
+	CountFleetCVEs(ctx context.Context, opts CountCVEsOptions) (int, error)
+	// CVECountByYear returns the number of distinct CVEs that affect the hosts of the fleet, keyed by the year they
+	// were published. CVEs without a known published date are not counted.
+	CVECountByYear(ctx context.Context, opts CountCVEsOptions) (map[int]int, error)
+	// RecordFleetCVECountSnapshot stores the number of distinct CVEs affecting the hosts of the fleet on the date of
+	// snapshotDate, replacing the count previously stored for that date.
+	RecordFleetCVECountSnapshot(ctx context.Context, snapshotDate time.Time, cveCount int) error
+	// FleetCVETrend returns the fleet CVE counts recorded since the date of since, ordered by date.
+	FleetCVETrend(ctx context.Context, since time.Time) ([]FleetCVECountSnapshot, error)
+	// RecordHostCVECountSnapshot stores the number of distinct CVEs affecting the host on the date of snapshotDate,
+	// replacing the count previously stored for that host and date.
+	RecordHostCVECountSnapshot(ctx context.Context, hostID uint, snapshotDate time.Time, cveCount int) error
+	// RecordHostCVECountSnapshots counts the distinct CVEs affecting the software or the operating system of each host
+	// and stores them as the snapshots of the date of snapshotDate (see RecordHostCVECountSnapshot). The hosts without
+	// CVEs are recorded with a count of zero. The snapshots more than 90 days older than snapshotDate are deleted.
+	RecordHostCVECountSnapshots(ctx context.Context, snapshotDate time.Time) error
+	// HostCVETrend returns the CVE counts of the host recorded since the date of since, ordered by date.
+	HostCVETrend(ctx context.Context, hostID uint, since time.Time) ([]HostCVECountSnapshot, error)
 
 	///////////////////////////////////////////////////////////////////////////////
 	// OperatingSystemsStore
@@ -495,6 +702,10 @@ type Datastore interface {
 
 	ListSoftware(ctx context.Context, opt SoftwareListOptions) ([]Software, error)
 	CountSoftware(ctx context.Context, opt SoftwareListOptions) (int, error)
+	// ListSoftwareTitles returns the distinct software titles installed on hosts, with their host and vulnerability
+	// counts. Results can be ordered by name, hosts_count or vulnerabilities_count, and are ordered by name by
+	// default.
+	ListSoftwareTitles(ctx context.Context, opts ListOptions) ([]SoftwareTitle, error)
 	// DeleteVulnerabilities deletes the given list of vulnerabilities identified by CPE+CVE.
 	DeleteSoftwareVulnerabilities(ctx context.Context, vulnerabilities []SoftwareVulnerability) error
 
@@ -637,6 +848,10 @@ type Datastore interface {
 
 	// SaveHostAdditional updates the additional queries results of a host.
 	SaveHostAdditional(ctx context.Context, hostID uint, additional *json.RawMessage) error
+	// SetAdditionalQueriesForHosts sets the additional queries of the given hosts, e.g. to roll out new additional
+	// queries to a subset of the hosts. They replace the additional queries of the global or team config for those
+	// hosts only. A nil queries map removes the hosts' additional queries, so that the config applies again.
+	SetAdditionalQueriesForHosts(ctx context.Context, hostIDs []uint, queries map[string]string) error
 
 	SetOrUpdateMunkiInfo(ctx context.Context, hostID uint, version string, errors, warnings []string) error
 	SetOrUpdateMDMData(ctx context.Context, hostID uint, isServer, enrolled bool, serverURL string, installedFromDep bool, name string) error
@@ -670,8 +885,26 @@ type Datastore interface {
 
 	// EnrollHost will enroll a new host with the given identifier, setting the node key, and team. Implementations of
 	// this method should respect the provided host enrollment cooldown, by returning an error if the host has enrolled
-	// within the cooldown period.
-	EnrollHost(ctx context.Context, isMDMEnabled bool, osqueryHostId, hardwareUUID, hardwareSerial, nodeKey string, teamID *uint, cooldown time.Duration) (*Host, error)
+	// within the cooldown period. If not empty, enrollSecret is recorded as the enroll secret used by the host,
+	// replacing the one it previously enrolled with (see HostsByEnrollSecret).
+	EnrollHost(ctx context.Context, isMDMEnabled bool, osqueryHostId, hardwareUUID, hardwareSerial, nodeKey, enrollSecret string, teamID *uint, cooldown time.Duration) (*Host, error)
+
+	// HostsByEnrollSecret returns the hosts that used the provided enroll secret the last time they enrolled, including
+	// after the secret is removed. Only a hash of the secrets used by the hosts is stored.
+	HostsByEnrollSecret(ctx context.Context, secret string, opt ListOptions) ([]Host, error)
+
+	// HostCountByEnrollSecret returns the number of hosts that used each enroll secret the last time they enrolled,
+	// keyed by secret. The current secrets that no host used are included with a count of zero. The secrets that were
+	// removed are not included, as only their hash is stored.
+	HostCountByEnrollSecret(ctx context.Context) (map[string]int, error)
+
+	// StaleHosts returns the hosts that have not been seen since the provided time, optionally restricted to the
+	// members of a label.
+	StaleHosts(ctx context.Context, since time.Time, opt StaleHostsOptions) ([]*Host, error)
+
+	// DuplicateHostsBySerial returns the groups of hosts that share the same hardware serial, ignoring empty and
+	// placeholder serials. Each group has at least two hosts, ordered by ID.
+	DuplicateHostsBySerial(ctx context.Context) ([][]*Host, error)
 
 	// EnrollOrbit will enroll a new orbit instance.
 	//	- If an entry for the host exists (osquery enrolled first) then it will update the host's orbit node key and team.
@@ -837,6 +1070,9 @@ const (
 	DefaultScheduledQueryIDsByNameBatchSize = 1000
 	// Default batch size for loading IDs of or inserting new munki issues.
 	DefaultMunkiIssuesBatchSize = 100
+	// Default batch size for updating the seen time of hosts in MarkHostsSeen. Two placeholders are used per host,
+	// so it must stay well under the limit of 65535 placeholders per statement.
+	DefaultMarkHostsSeenBatchSize = 10000
 )
 
 type PolicyFailure struct {
@@ -16,6 +16,9 @@ var (
 	ErrNoContext             = errors.New("context key not set")
 	ErrPasswordResetRequired = &passwordResetRequiredError{}
 	ErrMissingLicense        = &licenseError{}
+	// ErrCVEMetaLoadInProgress is returned by Datastore.LockCVEMetaLoad when another load of CVE metadata holds the
+	// lock.
+	ErrCVEMetaLoadInProgress = errors.New("a cve meta load is already in progress")
 )
 
 // ErrWithInternal is an interface for errors that include extra "internal"
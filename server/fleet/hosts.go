@@ -90,6 +90,9 @@ type HostListOptions struct {
 	AdditionalFilters []string
 	// StatusFilter selects the online status of the hosts.
 	StatusFilter HostStatus
+	// StatusesFilter selects the hosts that have any of the online statuses. It can be combined with StatusFilter,
+	// in which case its status is one more of the set. An unknown status is an invalid argument.
+	StatusesFilter []HostStatus
 	// TeamFilter selects the hosts for specified team
 	TeamFilter *uint
 
@@ -101,6 +104,14 @@ type HostListOptions struct {
 	OSIDFilter      *uint
 	OSNameFilter    *string
 	OSVersionFilter *string
+	// OSVersionMinFilter and OSVersionMaxFilter select the hosts running a version of the OSNameFilter operating
+	// system in the [min, max) range, compared as semantic versions. Either bound can be omitted. They require
+	// OSNameFilter and can't be used along with OSVersionFilter.
+	OSVersionMinFilter *string
+	OSVersionMaxFilter *string
+	// OSVersionExcludeUnparseable excludes the hosts whose OS version is not a semantic version from the results
+	// of the OS version range filter. They are included by default.
+	OSVersionExcludeUnparseable bool
 
 	DisableFailingPolicies bool
 
@@ -127,6 +138,7 @@ func (h HostListOptions) Empty() bool {
 		h.DeviceMapping == false &&
 		len(h.AdditionalFilters) == 0 &&
 		h.StatusFilter == "" &&
+		len(h.StatusesFilter) == 0 &&
 		h.TeamFilter == nil &&
 		h.PolicyIDFilter == nil &&
 		h.PolicyResponseFilter == nil &&
@@ -134,6 +146,8 @@ func (h HostListOptions) Empty() bool {
 		h.OSIDFilter == nil &&
 		h.OSNameFilter == nil &&
 		h.OSVersionFilter == nil &&
+		h.OSVersionMinFilter == nil &&
+		h.OSVersionMaxFilter == nil &&
 		h.DisableFailingPolicies == false &&
 		h.MDMIDFilter == nil &&
 		h.MDMEnrollmentStatusFilter == "" &&
@@ -141,6 +155,14 @@ func (h HostListOptions) Empty() bool {
 		h.LowDiskSpaceFilter == nil
 }
 
+// StaleHostsOptions are the options to list the hosts that have not been seen since a given time.
+type StaleHostsOptions struct {
+	ListOptions
+
+	// LabelID, if set, restricts the hosts to the members of that label.
+	LabelID *uint
+}
+
 type HostUser struct {
 	Uid       uint   `json:"uid" db:"uid"`
 	Username  string `json:"username" db:"username"`
@@ -206,6 +228,9 @@ type Host struct {
 	// Additional is the additional information from the host
 	// additional_queries. This should be stored in a separate DB table.
 	Additional *json.RawMessage `json:"additional,omitempty" db:"additional" csv:"-"`
+	// AdditionalQueries are the additional queries set for the host with SetAdditionalQueriesForHosts, which replace
+	// those of the config. They are only loaded by LoadHostByNodeKey.
+	AdditionalQueries *json.RawMessage `json:"-" db:"additional_queries" csv:"-"`
 
 	// Users currently in the host
 	Users []HostUser `json:"users,omitempty" csv:"-"`
@@ -791,6 +816,16 @@ type HostShort struct {
 	DisplayName string `json:"display_name" db:"display_name"`
 }
 
+// HostsByCVEOptions defines the order of the hosts returned by Datastore.HostsByCVE.
+type HostsByCVEOptions struct {
+	// LabelID, if set, lists the hosts that are members of that label (e.g. internet-facing hosts) first.
+	LabelID *uint
+	// OrderKey orders the hosts, after the label members if LabelID is set. It is either "id" (the default) or
+	// "seen_time".
+	OrderKey       string
+	OrderDirection OrderDirection
+}
+
 type OSVersions struct {
 	CountsUpdatedAt time.Time   `json:"counts_updated_at"`
 	OSVersions      []OSVersion `json:"os_versions"`
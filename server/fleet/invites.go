@@ -1,6 +1,11 @@
 package fleet
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
 	"gopkg.in/guregu/null.v3"
 )
 
@@ -26,8 +31,32 @@ type Invite struct {
 	SSOEnabled bool        `json:"sso_enabled" db:"sso_enabled"`
 	GlobalRole null.String `json:"global_role" db:"global_role"`
 	Teams      []UserTeam  `json:"teams"`
+	// ExpiresAt is when the invite token expires. It is nil for the invites created before it was recorded, whose
+	// token expires after the configured validity period since their creation.
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
 }
 
 func (i Invite) AuthzType() string {
 	return "invite"
 }
+
+// BulkInviteError is returned by Datastore.BulkCreateInvites when some of the invites could not be created, e.g.
+// because their email was already invited.
+type BulkInviteError struct {
+	// Errors are the errors of the invites that were not created, keyed by their index in the batch.
+	Errors map[int]error
+}
+
+func (e *BulkInviteError) Error() string {
+	idxs := make([]int, 0, len(e.Errors))
+	for idx := range e.Errors {
+		idxs = append(idxs, idx)
+	}
+	sort.Ints(idxs)
+
+	msgs := make([]string, 0, len(idxs))
+	for _, idx := range idxs {
+		msgs = append(msgs, fmt.Sprintf("invite %d: %s", idx, e.Errors[idx]))
+	}
+	return fmt.Sprintf("%d invites not created: %s", len(idxs), strings.Join(msgs, "; "))
+}
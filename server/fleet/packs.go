@@ -136,6 +136,10 @@ type PackSpec struct {
 	Disabled    bool            `json:"disabled"`
 	Targets     PackSpecTargets `json:"targets,omitempty"`
 	Queries     []PackSpecQuery `json:"queries,omitempty"`
+	// QuerySpecs are the definitions of the queries scheduled by the pack, so that the spec can be applied on
+	// another Fleet instance. They are only set by ExportPackSpec. When applied, the queries are created or updated
+	// along with the pack.
+	QuerySpecs []QuerySpec `json:"query_specs,omitempty"`
 }
 
 // Verify verifies the pack's spec fields are valid.
@@ -176,6 +180,16 @@ type PackTarget struct {
 	Target
 }
 
+// PackQueryReference is a scheduled query of a pack that references a query that doesn't exist (anymore).
+type PackQueryReference struct {
+	PackID             uint   `json:"pack_id" db:"pack_id"`
+	PackName           string `json:"pack_name" db:"pack_name"`
+	ScheduledQueryID   uint   `json:"scheduled_query_id" db:"scheduled_query_id"`
+	ScheduledQueryName string `json:"scheduled_query_name" db:"scheduled_query_name"`
+	QueryID            *uint  `json:"query_id" db:"query_id"`
+	QueryName          string `json:"query_name" db:"query_name"`
+}
+
 type PackStats struct {
 	PackID   uint   `json:"pack_id"`
 	PackName string `json:"pack_name"`
@@ -39,6 +39,22 @@ type Query struct {
 	AggregatedStats `json:"stats,omitempty"`
 }
 
+// OsquerySchema is the definition of the tables of a version of osquery, in the format of the osquery schema JSON
+// (see schema/osquery_fleet_schema.json).
+type OsquerySchema []OsquerySchemaTable
+
+// OsquerySchemaTable is a table of an OsquerySchema.
+type OsquerySchemaTable struct {
+	Name string `json:"name"`
+}
+
+// QueryMissingTables is a query that references tables missing from an OsquerySchema.
+type QueryMissingTables struct {
+	Query *Query `json:"query"`
+	// MissingTables are the lowercased names of the tables that are not in the schema.
+	MissingTables []string `json:"missing_tables"`
+}
+
 func (q Query) AuthzType() string {
 	return "query"
 }
@@ -78,6 +94,24 @@ func (tq *TargetedQuery) AuthzType() string {
 	return "targeted_query"
 }
 
+// ValidateQuerySQL is the value of the OptionalArg returned by WithQuerySQLValidation.
+type ValidateQuerySQL struct{}
+
+// WithQuerySQLValidation makes Datastore.NewQuery and Datastore.SaveQuery reject the queries whose SQL is not valid
+// osquery SQL, e.g. because of a syntax error or an unknown table. It is opt-in as some callers store templated SQL.
+func WithQuerySQLValidation() OptionalArg {
+	return func() interface{} { return ValidateQuerySQL{} }
+}
+
+// ForceQueryDeletion is the value of the OptionalArg returned by WithForcedQueryDeletion.
+type ForceQueryDeletion struct{}
+
+// WithForcedQueryDeletion makes Datastore.DeleteQueries also delete the queries that are scheduled in a pack, along
+// with their schedules, instead of keeping them.
+func WithForcedQueryDeletion() OptionalArg {
+	return func() interface{} { return ForceQueryDeletion{} }
+}
+
 var (
 	errQueryEmptyName  = errors.New("query name cannot be empty")
 	errQueryEmptyQuery = errors.New("query's SQL query cannot be empty")
@@ -58,6 +58,21 @@ type ScheduledQuery struct {
 
 type ScheduledQueryList []*ScheduledQuery
 
+// ScheduledQueryIntervalBounds are the upper bounds, in seconds, of the buckets of the histogram of the scheduled
+// queries intervals: up to a minute, 5 minutes, 15 minutes, an hour and a day. A last bucket holds the longer
+// intervals.
+var ScheduledQueryIntervalBounds = []uint{60, 300, 900, 3600, 86400}
+
+// ScheduledQueryIntervalBucket is a bucket of the histogram of the scheduled queries intervals.
+type ScheduledQueryIntervalBucket struct {
+	// MinInterval and MaxInterval are the bounds of the bucket in seconds, both inclusive. MaxInterval is nil for the
+	// last bucket, which has no upper bound.
+	MinInterval uint  `json:"min_interval"`
+	MaxInterval *uint `json:"max_interval"`
+	// Count is the number of scheduled queries with an interval in the bucket.
+	Count int `json:"count"`
+}
+
 func (sql ScheduledQueryList) Clone() (interface{}, error) {
 	var cloned ScheduledQueryList
 	for _, sq := range sql {
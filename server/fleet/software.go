@@ -59,6 +59,18 @@ func (Software) AuthzType() string {
 	return "software"
 }
 
+// SoftwareTitle is a piece of software identified by its name and source, regardless of its version.
+type SoftwareTitle struct {
+	Name   string `json:"name" db:"name"`
+	Source string `json:"source" db:"source"`
+	// VersionsCount is the number of distinct versions of the title installed on hosts.
+	VersionsCount int `json:"versions_count" db:"versions_count"`
+	// HostsCount is the number of hosts with any version of the title installed.
+	HostsCount int `json:"hosts_count" db:"hosts_count"`
+	// VulnerabilitiesCount is the number of distinct CVEs affecting any of the installed versions.
+	VulnerabilitiesCount int `json:"vulnerabilities_count" db:"vulnerabilities_count"`
+}
+
 // AuthzSoftwareInventory is used for access controls on software inventory.
 type AuthzSoftwareInventory struct {
 	// TeamID is the ID of the team. A value of nil means global scope.
@@ -1,6 +1,10 @@
 package fleet
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"time"
 )
@@ -32,6 +36,334 @@ type CVEMeta struct {
 	CISAKnownExploit *bool `db:"cisa_known_exploit"`
 	// Published is when the cve was published according to NIST.score
 	Published *time.Time `db:"published"`
+	// CVSSExploitabilityScore and CVSSImpactScore are the CVSS v3 subscores the base score is computed from. They
+	// are only loaded when requested, see nvd.WithCVSSSubscores.
+	CVSSExploitabilityScore *float64 `db:"cvss_exploitability_score"`
+	CVSSImpactScore         *float64 `db:"cvss_impact_score"`
+	// CVSSVector is the CVSS v3 vector string, which holds the individual metric values (attack vector,
+	// privileges required, etc.), e.g. CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H.
+	CVSSVector *string `db:"cvss_vector"`
+	// LastModified is when NIST last modified the record of the cve, e.g. when it was re-scored. It is only loaded
+	// when requested, see nvd.WithLastModified.
+	LastModified *time.Time `db:"last_modified"`
+	// CVSSSource is who assigned the CVSS score, e.g. CVSSSourceNVD. Unset if the source is unknown, e.g. for scores
+	// loaded before it was recorded or from a custom source.
+	CVSSSource *string `db:"cvss_source"`
+	// CISADueDate is the date by which CISA requires federal agencies to remediate the known exploit.
+	CISADueDate *time.Time `db:"cisa_due_date"`
+	// CISADateAdded is the date the known exploit was added to the CISA catalog.
+	CISADateAdded *time.Time `db:"cisa_date_added"`
+	// UpdatedAt is when the metadata of the cve last changed. It is only loaded by CVEMetaChangedSince.
+	UpdatedAt *time.Time `db:"updated_at"`
+}
+
+// CVSSSourceNVD is the source of the CVSS scores assigned by NVD analysts, the only ones in the NVD 1.1 feeds.
+const CVSSSourceNVD = "nvd"
+
+// CVSSSubscoresLoaded is the value of the OptionalArg returned by WithCVSSSubscoresLoaded.
+type CVSSSubscoresLoaded struct{}
+
+// WithCVSSSubscoresLoaded tells Datastore.InsertCVEMeta that the CVSS subscores and vector of the CVEs were loaded,
+// so that they replace the stored ones even when nil, e.g. when NVD removed the score of a CVE.
+func WithCVSSSubscoresLoaded() OptionalArg {
+	return func() interface{} { return CVSSSubscoresLoaded{} }
+}
+
+// LastModifiedLoaded is the value of the OptionalArg returned by WithLastModifiedLoaded.
+type LastModifiedLoaded struct{}
+
+// WithLastModifiedLoaded tells Datastore.InsertCVEMeta that the last modified dates of the CVEs were loaded, so that
+// they replace the stored ones even when nil, e.g. when the date of the latest revision of a CVE can't be parsed.
+func WithLastModifiedLoaded() OptionalArg {
+	return func() interface{} { return LastModifiedLoaded{} }
+}
+
+// CVEMetaWriter saves CVE metadata, either the Datastore or a CVEMetaTx. Its methods behave like the Datastore methods
+// of the same name.
+type CVEMetaWriter interface {
+	InsertCVEMeta(ctx context.Context, cveMeta []CVEMeta, opts ...OptionalArg) error
+	UpsertCVEMeta(ctx context.Context, cveMeta []CVEMeta) error
+	InsertCVEMetaProvenance(ctx context.Context, provenance []CVEMetaProvenance) error
+	InsertEPSSModelScores(ctx context.Context, scores []EPSSModelScore) error
+	RecordCVESync(ctx context.Context, syncedAt time.Time, cveCount int) error
+	RecordCISACatalogVersion(ctx context.Context, version CISACatalogVersion) error
+	RecordFleetCVECountSnapshot(ctx context.Context, snapshotDate time.Time, cveCount int) error
+	InsertCVEProducts(ctx context.Context, products []CVEProduct) error
+	InsertCVECWEs(ctx context.Context, cwes []CVECWE) error
+}
+
+// CVEMetaTx is a transaction that saves CVE metadata, see Datastore.WithCVEMetaTx.
+type CVEMetaTx interface {
+	CVEMetaWriter
+	// ExecContext runs a statement in the transaction, e.g. to update another table along with the CVE metadata.
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// CountCVEsOptions are the options to count the CVEs affecting the hosts of the fleet.
+type CountCVEsOptions struct {
+	// MinCVSSScore, if set, only counts the CVEs with a CVSS score greater than or equal to it. CVEs without a score
+	// are then excluded.
+	MinCVSSScore *float64
+}
+
+// CVEsByLabelOptions are the options to list the CVEs affecting the hosts of a label.
+type CVEsByLabelOptions struct {
+	ListOptions
+	// MinCVSSScore, if set, only lists the CVEs with a CVSS score greater than or equal to it. CVEs without a score
+	// are then excluded.
+	MinCVSSScore *float64
+}
+
+// CVECWE associates a CVE with one of its Common Weakness Enumeration (CWE) types.
+// See https://cwe.mitre.org/.
+type CVECWE struct {
+	CVE string `json:"cve" db:"cve"`
+	// CWE is the ID of the weakness, e.g. CWE-79.
+	CWE string `json:"cwe" db:"cwe"`
+}
+
+// CVEProduct associates a CVE with a product it affects, as named by the CPEs of the CVE's NVD configurations.
+type CVEProduct struct {
+	CVE string `json:"cve" db:"cve"`
+	// Vendor and Product are the vendor and product of the CPE, e.g. apache and http_server.
+	Vendor  string `json:"vendor" db:"vendor"`
+	Product string `json:"product" db:"product"`
+}
+
+// CVEsByCWEOptions are the options to list the CVEs of a CWE.
+type CVEsByCWEOptions struct {
+	ListOptions
+	// AffectingHostsOnly only lists the CVEs that affect the software or the operating system of at least one host.
+	AffectingHostsOnly bool
+}
+
+// EPSSSnapshot is the EPSS score of a CVE as published in the EPSS feed of a given date.
+type EPSSSnapshot struct {
+	CVE          string    `json:"cve" db:"cve"`
+	SnapshotDate time.Time `json:"snapshot_date" db:"snapshot_date"`
+	// Score is the probability that the vulnerability will be exploited in the next 30 days.
+	Score float64 `json:"score" db:"score"`
+	// Percentile is the proportion of all the scored vulnerabilities with the same or a lower score.
+	Percentile float64 `json:"percentile" db:"percentile"`
+}
+
+// EPSSModelScore is the EPSS score of a CVE as computed by a given version of the EPSS model.
+type EPSSModelScore struct {
+	CVE string `json:"cve" db:"cve"`
+	// ModelVersion is the version of the EPSS model, e.g. v2023.03.01.
+	ModelVersion string `json:"model_version" db:"model_version"`
+	// Score is the probability that the vulnerability will be exploited in the next 30 days.
+	Score float64 `json:"score" db:"score"`
+}
+
+// CVEMetaProvenance records where the value of a CVEMeta field came from.
+type CVEMetaProvenance struct {
+	CVE string `json:"cve" db:"cve"`
+	// Field is the name of the CVEMeta field, e.g. cvss_score.
+	Field string `json:"field" db:"field"`
+	// Source is the name of the feed file the value was loaded from.
+	Source   string    `json:"source" db:"source"`
+	LoadedAt time.Time `json:"loaded_at" db:"loaded_at"`
+}
+
+// FleetCVECountSnapshot is the number of distinct CVEs that affected the hosts of the fleet on a given date.
+type FleetCVECountSnapshot struct {
+	SnapshotDate time.Time `json:"snapshot_date" db:"snapshot_date"`
+	CVECount     int       `json:"cve_count" db:"cve_count"`
+}
+
+// HostCVECountSnapshot is the number of distinct CVEs that affected a host on a given date.
+type HostCVECountSnapshot struct {
+	HostID       uint      `json:"host_id" db:"host_id"`
+	SnapshotDate time.Time `json:"snapshot_date" db:"snapshot_date"`
+	CVECount     int       `json:"cve_count" db:"cve_count"`
+}
+
+// SyncAttempt is an attempt at downloading the vulnerability feeds, successful or not.
+type SyncAttempt struct {
+	ID         uint      `json:"id" db:"id"`
+	StartedAt  time.Time `json:"started_at" db:"started_at"`
+	DurationMS int64     `json:"duration_ms" db:"duration_ms"`
+	// Success is whether all the feeds were downloaded.
+	Success bool `json:"success" db:"success"`
+	// Error is the error that failed the attempt, if any.
+	Error *string `json:"error,omitempty" db:"error"`
+	// Sources are the results of the feeds downloaded, in download order. The attempt stops at the first failure, so
+	// only the last source can have failed.
+	Sources SyncSourceResults `json:"sources" db:"sources"`
+}
+
+// SyncSourceResult is the result of the download of one of the feeds of a SyncAttempt.
+type SyncSourceResult struct {
+	Source  string `json:"source"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// SyncSourceResults are the results of the feeds of a SyncAttempt, stored as JSON.
+type SyncSourceResults []SyncSourceResult
+
+// Scan implements the sql.Scanner interface
+func (r *SyncSourceResults) Scan(val interface{}) error {
+	switch v := val.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	case nil: // sql NULL
+		return nil
+	default:
+		return fmt.Errorf("unsupported type: %T", v)
+	}
+}
+
+// Value implements the sql.Valuer interface
+func (r SyncSourceResults) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+	return json.Marshal(r)
+}
+
+// CVESyncInfo describes the last successful load of the CVE metadata.
+type CVESyncInfo struct {
+	SyncedAt time.Time `json:"synced_at" db:"synced_at"`
+	// CVECount is the number of CVEs whose metadata was loaded.
+	CVECount int `json:"cve_count" db:"cve_count"`
+}
+
+// EPSSCoverage is the number of stored CVEs that have an EPSS probability. A drop of the coverage from one load to
+// the next usually means that the EPSS feed download went wrong.
+type EPSSCoverage struct {
+	// CVECount is the number of CVEs whose metadata is stored.
+	CVECount int `json:"cve_count" db:"cve_count"`
+	// EPSSCount is the number of those CVEs that have an EPSS probability.
+	EPSSCount int `json:"epss_count" db:"epss_count"`
+}
+
+// Ratio returns the fraction of the stored CVEs that have an EPSS probability, 0 if no CVE is stored.
+func (c EPSSCoverage) Ratio() float64 {
+	if c.CVECount == 0 {
+		return 0
+	}
+	return float64(c.EPSSCount) / float64(c.CVECount)
+}
+
+// CISACatalogVersion identifies the version of the CISA known exploited vulnerabilities catalog that was last
+// loaded.
+type CISACatalogVersion struct {
+	CatalogVersion string     `json:"catalog_version" db:"catalog_version"`
+	DateReleased   *time.Time `json:"date_released" db:"date_released"`
+	LoadedAt       time.Time  `json:"loaded_at" db:"loaded_at"`
+}
+
+// HostVulnerabilitySummary summarizes the vulnerabilities of the software installed on a host and of its operating
+// system. CVEs are counted once per host, and are banded by their CVSS v3 base score.
+type HostVulnerabilitySummary struct {
+	HostID uint `json:"host_id" db:"host_id"`
+	// MaxCVSSScore is the highest CVSS score among the host's CVEs, nil if none of them has a score.
+	MaxCVSSScore *float64 `json:"max_cvss_score" db:"max_cvss_score"`
+	// CriticalCount is the number of CVEs with a score of 9.0 or more.
+	CriticalCount uint `json:"critical_count" db:"critical_count"`
+	// HighCount is the number of CVEs with a score from 7.0 to 8.9.
+	HighCount uint `json:"high_count" db:"high_count"`
+	// MediumCount is the number of CVEs with a score from 4.0 to 6.9.
+	MediumCount uint `json:"medium_count" db:"medium_count"`
+	// LowCount is the number of CVEs with a score below 4.0.
+	LowCount uint `json:"low_count" db:"low_count"`
+	// UnscoredCount is the number of CVEs without a CVSS score.
+	UnscoredCount uint `json:"unscored_count" db:"unscored_count"`
+	// CISAKnownExploit is whether any of the host's CVEs is a known exploit according to CISA.
+	CISAKnownExploit bool `json:"cisa_known_exploit" db:"cisa_known_exploit"`
+	// KnownExploitCount is the number of CVEs that are known exploits according to CISA.
+	KnownExploitCount uint `json:"known_exploit_count" db:"known_exploit_count"`
+	// RiskScore ranks the hosts by how vulnerable they are, see ComputeRiskScore.
+	RiskScore uint `json:"risk_score" db:"risk_score"`
+}
+
+// The severity bands of the CVEs by CVSS score, as counted in the HostVulnerabilitySummary.
+const (
+	CVSSSeverityCritical = "critical"
+	CVSSSeverityHigh     = "high"
+	CVSSSeverityMedium   = "medium"
+	CVSSSeverityLow      = "low"
+)
+
+// CVSSSeverityMinScore returns the lowest CVSS score of the severity band, and false if the severity is unknown.
+func CVSSSeverityMinScore(severity string) (float64, bool) {
+	switch severity {
+	case CVSSSeverityCritical:
+		return 9.0, true
+	case CVSSSeverityHigh:
+		return 7.0, true
+	case CVSSSeverityMedium:
+		return 4.0, true
+	case CVSSSeverityLow:
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// The weights of the CVEs in the risk score of a host.
+const (
+	RiskScoreKnownExploitWeight = 10
+	RiskScoreCriticalWeight     = 5
+	RiskScoreHighWeight         = 3
+	RiskScoreMediumWeight       = 1
+)
+
+// ComputeRiskScore returns the risk score of the host: the weighted sum of its critical, high and medium CVEs, where
+// a CVE that is a known exploit is also counted with the known exploit weight, on top of its severity:
+//
+//	10 * known exploits + 5 * critical + 3 * high + 1 * medium
+//
+// The low and unscored CVEs don't add to the score.
+func (s HostVulnerabilitySummary) ComputeRiskScore() uint {
+	return RiskScoreKnownExploitWeight*s.KnownExploitCount +
+		RiskScoreCriticalWeight*s.CriticalCount +
+		RiskScoreHighWeight*s.HighCount +
+		RiskScoreMediumWeight*s.MediumCount
+}
+
+// MostVulnerableHostsOptions are the options of Datastore.MostVulnerableHosts.
+type MostVulnerableHostsOptions struct {
+	// TeamID, if set, only ranks the hosts of the team.
+	TeamID *uint
+}
+
+// CleanHostsOptions are the options of Datastore.CleanHosts.
+type CleanHostsOptions struct {
+	ListOptions
+	// LabelID, if set, only lists the members of the label.
+	LabelID *uint
+}
+
+// CleanHost is a host without known vulnerabilities.
+type CleanHost struct {
+	Host
+	// Unscanned is whether the host has no software inventory, in which case it has no known vulnerabilities
+	// because its software couldn't be checked.
+	Unscanned bool `json:"unscanned" db:"unscanned"`
+}
+
+// HostCVE is a CVE affecting a software installed on a host or its operating system, along with the CVE's
+// metadata. A CVE that affects several software of the host is listed once per software, and once more if it also
+// affects the operating system.
+type HostCVE struct {
+	CVE        string `json:"cve" db:"cve"`
+	SoftwareID uint   `json:"software_id" db:"software_id"`
+	// OperatingSystemID is the id of the operating system affected by the CVE, zero if it affects a software. The
+	// software name and version are then those of the operating system, and the software source is empty.
+	OperatingSystemID uint   `json:"operating_system_id" db:"operating_system_id"`
+	SoftwareName      string `json:"software_name" db:"software_name"`
+	SoftwareVersion   string `json:"software_version" db:"software_version"`
+	SoftwareSource    string `json:"software_source" db:"software_source"`
+	// The metadata fields are nil if the CVE has no metadata.
+	CVSSScore        *float64   `json:"cvss_score" db:"cvss_score"`
+	EPSSProbability  *float64   `json:"epss_probability" db:"epss_probability"`
+	CISAKnownExploit *bool      `json:"cisa_known_exploit" db:"cisa_known_exploit"`
+	Published        *time.Time `json:"published" db:"published"`
 }
 
 // SoftwareCPE represents an entry in the `software_cpe` table.
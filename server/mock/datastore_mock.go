@@ -58,11 +58,11 @@ type ApplyQueriesFunc func(ctx context.Context, authorID uint, queries []*fleet.
 
 type NewQueryFunc func(ctx context.Context, query *fleet.Query, opts ...fleet.OptionalArg) (*fleet.Query, error)
 
-type SaveQueryFunc func(ctx context.Context, query *fleet.Query) error
+type SaveQueryFunc func(ctx context.Context, query *fleet.Query, opts ...fleet.OptionalArg) error
 
 type DeleteQueryFunc func(ctx context.Context, name string) error
 
-type DeleteQueriesFunc func(ctx context.Context, ids []uint) (uint, error)
+type DeleteQueriesFunc func(ctx context.Context, ids []uint, opts ...fleet.OptionalArg) (deleted uint, blocked []uint, err error)
 
 type QueryFunc func(ctx context.Context, id uint) (*fleet.Query, error)
 
@@ -70,8 +70,14 @@ type ListQueriesFunc func(ctx context.Context, opt fleet.ListQueryOptions) ([]*f
 
 type QueryByNameFunc func(ctx context.Context, name string, opts ...fleet.OptionalArg) (*fleet.Query, error)
 
+type SearchQueriesByBodyFunc func(ctx context.Context, substring string, opt fleet.ListOptions) ([]*fleet.Query, error)
+
 type ObserverCanRunQueryFunc func(ctx context.Context, queryID uint) (bool, error)
 
+type FindDuplicateQueryBodiesFunc func(ctx context.Context) ([][]*fleet.Query, error)
+
+type ValidateQueriesAgainstSchemaFunc func(ctx context.Context, schema fleet.OsquerySchema) ([]fleet.QueryMissingTables, error)
+
 type NewDistributedQueryCampaignFunc func(ctx context.Context, camp *fleet.DistributedQueryCampaign) (*fleet.DistributedQueryCampaign, error)
 
 type DistributedQueryCampaignFunc func(ctx context.Context, id uint) (*fleet.DistributedQueryCampaign, error)
@@ -92,6 +98,8 @@ type GetPackSpecsFunc func(ctx context.Context) ([]*fleet.PackSpec, error)
 
 type GetPackSpecFunc func(ctx context.Context, name string) (*fleet.PackSpec, error)
 
+type ExportPackSpecFunc func(ctx context.Context, packID uint) (*fleet.PackSpec, error)
+
 type NewPackFunc func(ctx context.Context, pack *fleet.Pack, opts ...fleet.OptionalArg) (*fleet.Pack, error)
 
 type SavePackFunc func(ctx context.Context, pack *fleet.Pack) error
@@ -102,10 +110,22 @@ type PackFunc func(ctx context.Context, pid uint) (*fleet.Pack, error)
 
 type ListPacksFunc func(ctx context.Context, opt fleet.PackListOptions) ([]*fleet.Pack, error)
 
+type ListPacksWithoutTargetsFunc func(ctx context.Context) ([]fleet.Pack, error)
+
 type PackByNameFunc func(ctx context.Context, name string, opts ...fleet.OptionalArg) (*fleet.Pack, bool, error)
 
 type ListPacksForHostFunc func(ctx context.Context, hid uint) (packs []*fleet.Pack, err error)
 
+type PacksByLabelFunc func(ctx context.Context, labelID uint) ([]fleet.Pack, error)
+
+type AuditPackQueryReferencesFunc func(ctx context.Context) ([]fleet.PackQueryReference, error)
+
+type ListHostsInPackFunc func(ctx context.Context, pid uint, opt fleet.ListOptions) (hosts []*fleet.HostShort, count int, err error)
+
+type ResolvePackTargetsFunc func(ctx context.Context, packID uint) ([]uint, error)
+
+type HostsMissingPackFunc func(ctx context.Context, labelID, packID uint, opts fleet.ListOptions) ([]fleet.Host, error)
+
 type EnsureGlobalPackFunc func(ctx context.Context) (*fleet.Pack, error)
 
 type EnsureTeamPackFunc func(ctx context.Context, teamID uint) (*fleet.Pack, error)
@@ -126,12 +146,16 @@ type LabelFunc func(ctx context.Context, lid uint) (*fleet.Label, error)
 
 type ListLabelsFunc func(ctx context.Context, filter fleet.TeamFilter, opt fleet.ListOptions) ([]*fleet.Label, error)
 
+type ListLabelsWithCountsFunc func(ctx context.Context, filter fleet.TeamFilter, opt fleet.ListOptions) ([]*fleet.Label, error)
+
 type LabelsSummaryFunc func(ctx context.Context) ([]*fleet.LabelSummary, error)
 
 type LabelQueriesForHostFunc func(ctx context.Context, host *fleet.Host) (map[string]string, error)
 
 type ListLabelsForHostFunc func(ctx context.Context, hid uint) ([]*fleet.Label, error)
 
+type LabelsNotForHostFunc func(ctx context.Context, hostID uint, opts fleet.ListOptions) ([]fleet.Label, error)
+
 type ListHostsInLabelFunc func(ctx context.Context, filter fleet.TeamFilter, lid uint, opt fleet.HostListOptions) ([]*fleet.Host, error)
 
 type ListUniqueHostsInLabelsFunc func(ctx context.Context, filter fleet.TeamFilter, labels []uint) ([]*fleet.Host, error)
@@ -140,6 +164,8 @@ type SearchLabelsFunc func(ctx context.Context, filter fleet.TeamFilter, query s
 
 type LabelIDsByNameFunc func(ctx context.Context, labels []string) ([]uint, error)
 
+type CleanupOrphanedLabelMembershipsFunc func(ctx context.Context) (int, error)
+
 type AsyncBatchInsertLabelMembershipFunc func(ctx context.Context, batch [][2]uint) error
 
 type AsyncBatchDeleteLabelMembershipFunc func(ctx context.Context, batch [][2]uint) error
@@ -148,8 +174,12 @@ type AsyncBatchUpdateLabelTimestampFunc func(ctx context.Context, ids []uint, ts
 
 type NewHostFunc func(ctx context.Context, host *fleet.Host) (*fleet.Host, error)
 
+type BulkUpsertHostsFunc func(ctx context.Context, hosts []*fleet.Host) (created, updated []uint, err error)
+
 type DeleteHostFunc func(ctx context.Context, hid uint) error
 
+type MergeHostsFunc func(ctx context.Context, keepID uint, mergeID uint) error
+
 type HostFunc func(ctx context.Context, id uint) (*fleet.Host, error)
 
 type ListHostsFunc func(ctx context.Context, filter fleet.TeamFilter, opt fleet.HostListOptions) ([]*fleet.Host, error)
@@ -166,6 +196,8 @@ type CleanupIncomingHostsFunc func(ctx context.Context, now time.Time) ([]uint,
 
 type GenerateHostStatusStatisticsFunc func(ctx context.Context, filter fleet.TeamFilter, now time.Time, platform *string, lowDiskSpace *int) (*fleet.HostSummary, error)
 
+type GenerateHostStatusStatisticsByTeamFunc func(ctx context.Context, filter fleet.TeamFilter, teamIDs []uint, now time.Time, platform *string, lowDiskSpace *int) (map[uint]*fleet.HostSummary, error)
+
 type HostIDsByNameFunc func(ctx context.Context, filter fleet.TeamFilter, hostnames []string) ([]uint, error)
 
 type HostIDsByOSIDFunc func(ctx context.Context, osID uint, offset int, limit int) ([]uint, error)
@@ -260,6 +292,8 @@ type ApplyEnrollSecretsFunc func(ctx context.Context, teamID *uint, secrets []*f
 
 type NewInviteFunc func(ctx context.Context, i *fleet.Invite) (*fleet.Invite, error)
 
+type BulkCreateInvitesFunc func(ctx context.Context, invites []fleet.Invite) ([]fleet.Invite, error)
+
 type ListInvitesFunc func(ctx context.Context, opt fleet.ListOptions) ([]*fleet.Invite, error)
 
 type InviteFunc func(ctx context.Context, id uint) (*fleet.Invite, error)
@@ -272,6 +306,8 @@ type DeleteInviteFunc func(ctx context.Context, id uint) error
 
 type UpdateInviteFunc func(ctx context.Context, id uint, i *fleet.Invite) (*fleet.Invite, error)
 
+type InvitesExpiringBeforeFunc func(ctx context.Context, before time.Time, opts fleet.ListOptions) ([]*fleet.Invite, error)
+
 type ListScheduledQueriesInPackWithStatsFunc func(ctx context.Context, id uint, opts fleet.ListOptions) ([]*fleet.ScheduledQuery, error)
 
 type NewScheduledQueryFunc func(ctx context.Context, sq *fleet.ScheduledQuery, opts ...fleet.OptionalArg) (*fleet.ScheduledQuery, error)
@@ -282,6 +318,12 @@ type DeleteScheduledQueryFunc func(ctx context.Context, id uint) error
 
 type ScheduledQueryFunc func(ctx context.Context, id uint) (*fleet.ScheduledQuery, error)
 
+type ScheduledQueriesDueForHostFunc func(ctx context.Context, hostID uint, at time.Time) ([]fleet.ScheduledQuery, error)
+
+type ScheduledQueriesNeverRunFunc func(ctx context.Context) ([]fleet.ScheduledQuery, error)
+
+type ScheduledQueryIntervalHistogramFunc func(ctx context.Context) ([]fleet.ScheduledQueryIntervalBucket, error)
+
 type CleanupExpiredHostsFunc func(ctx context.Context) ([]uint, error)
 
 type ScheduledQueryIDsByNameFunc func(ctx context.Context, batchSize int, packAndSchedQueryNames ...[2]string) ([]uint, error)
@@ -320,6 +362,8 @@ type AddCPEForSoftwareFunc func(ctx context.Context, software fleet.Software, cp
 
 type ListSoftwareCPEsFunc func(ctx context.Context) ([]fleet.SoftwareCPE, error)
 
+type ListHostSoftwareCPEsFunc func(ctx context.Context, hostID uint) ([]fleet.SoftwareCPE, error)
+
 type InsertSoftwareVulnerabilitiesFunc func(ctx context.Context, vulns []fleet.SoftwareVulnerability, source fleet.VulnerabilitySource) (int64, error)
 
 type SoftwareByIDFunc func(ctx context.Context, id uint, includeCVEScores bool) (*fleet.Software, error)
@@ -330,12 +374,90 @@ type SyncHostsSoftwareFunc func(ctx context.Context, updatedAt time.Time) error
 
 type HostsBySoftwareIDsFunc func(ctx context.Context, softwareIDs []uint) ([]*fleet.HostShort, error)
 
-type HostsByCVEFunc func(ctx context.Context, cve string) ([]*fleet.HostShort, error)
+type HostsByCVEFunc func(ctx context.Context, cve string, opts fleet.HostsByCVEOptions) ([]*fleet.HostShort, error)
+
+type InsertCVEMetaFunc func(ctx context.Context, cveMeta []fleet.CVEMeta, opts ...fleet.OptionalArg) error
+
+type UpsertCVEMetaFunc func(ctx context.Context, cveMeta []fleet.CVEMeta) error
+
+type PruneCVEMetaFunc func(ctx context.Context, current []string) (int, error)
+
+type LockCVEMetaLoadFunc func(ctx context.Context, wait bool) (unlock func(), err error)
 
-type InsertCVEMetaFunc func(ctx context.Context, cveMeta []fleet.CVEMeta) error
+type WithCVEMetaTxFunc func(ctx context.Context, fn func(tx fleet.CVEMetaTx) error) error
+
+type InsertCVEMetaProvenanceFunc func(ctx context.Context, provenance []fleet.CVEMetaProvenance) error
+
+type ListCVEMetaProvenanceFunc func(ctx context.Context, cve string) ([]fleet.CVEMetaProvenance, error)
 
 type ListCVEsFunc func(ctx context.Context, maxAge time.Duration) ([]fleet.CVEMeta, error)
 
+type NewCVEsSinceFunc func(ctx context.Context, since time.Time, opts fleet.ListOptions) ([]fleet.CVEMeta, error)
+
+type CVEMetaChangedSinceFunc func(ctx context.Context, since time.Time, opts fleet.ListOptions) ([]fleet.CVEMeta, error)
+
+type CVEsWithoutCVSSFunc func(ctx context.Context, opts fleet.ListOptions) ([]fleet.CVEMeta, error)
+
+type OverdueCVEsFunc func(ctx context.Context, asOf time.Time, opts fleet.ListOptions) ([]fleet.CVEMeta, error)
+
+type FleetKnownExploitedCVEsFunc func(ctx context.Context, opts fleet.ListOptions) ([]fleet.CVEMeta, error)
+
+type RecordCVESyncFunc func(ctx context.Context, syncedAt time.Time, cveCount int) error
+
+type LastCVESyncInfoFunc func(ctx context.Context) (*fleet.CVESyncInfo, error)
+
+type RecordSyncAttemptFunc func(ctx context.Context, attempt *fleet.SyncAttempt) error
+
+type ListSyncAttemptsFunc func(ctx context.Context, opts fleet.ListOptions) ([]fleet.SyncAttempt, error)
+
+type EPSSCoverageFunc func(ctx context.Context) (*fleet.EPSSCoverage, error)
+
+type RecordCISACatalogVersionFunc func(ctx context.Context, version fleet.CISACatalogVersion) error
+
+type LastCISACatalogVersionFunc func(ctx context.Context) (*fleet.CISACatalogVersion, error)
+
+type HostVulnerabilitySummaryFunc func(ctx context.Context, hostID uint) (*fleet.HostVulnerabilitySummary, error)
+
+type MostVulnerableHostsFunc func(ctx context.Context, limit int, opts fleet.MostVulnerableHostsOptions) ([]fleet.HostVulnerabilitySummary, error)
+
+type CleanHostsFunc func(ctx context.Context, opts fleet.CleanHostsOptions) ([]*fleet.CleanHost, error)
+
+type HostsBySeverityFunc func(ctx context.Context, minSeverity string, opts fleet.ListOptions) ([]fleet.Host, error)
+
+type HostCVEsFunc func(ctx context.Context, hostID uint, opts fleet.ListOptions) ([]fleet.HostCVE, error)
+
+type InsertEPSSSnapshotsFunc func(ctx context.Context, snapshots []fleet.EPSSSnapshot) error
+
+type ListEPSSSnapshotsFunc func(ctx context.Context, cve string) ([]fleet.EPSSSnapshot, error)
+
+type InsertEPSSModelScoresFunc func(ctx context.Context, scores []fleet.EPSSModelScore) error
+
+type ListEPSSModelScoresFunc func(ctx context.Context, cve string) ([]fleet.EPSSModelScore, error)
+
+type CVEsByLabelFunc func(ctx context.Context, labelID uint, opts fleet.CVEsByLabelOptions) ([]fleet.CVEMeta, error)
+
+type InsertCVECWEsFunc func(ctx context.Context, cwes []fleet.CVECWE) error
+
+type CVEsByCWEFunc func(ctx context.Context, cweID string, opts fleet.CVEsByCWEOptions) ([]fleet.CVEMeta, error)
+
+type InsertCVEProductsFunc func(ctx context.Context, products []fleet.CVEProduct) error
+
+type CVEsByVendorProductFunc func(ctx context.Context, vendor, product string, opts fleet.ListOptions) ([]fleet.CVEMeta, error)
+
+type CountFleetCVEsFunc func(ctx context.Context, opts fleet.CountCVEsOptions) (int, error)
+
+type CVECountByYearFunc func(ctx context.Context, opts fleet.CountCVEsOptions) (map[int]int, error)
+
+type RecordFleetCVECountSnapshotFunc func(ctx context.Context, snapshotDate time.Time, cveCount int) error
+
+type FleetCVETrendFunc func(ctx context.Context, since time.Time) ([]fleet.FleetCVECountSnapshot, error)
+
+type RecordHostCVECountSnapshotFunc func(ctx context.Context, hostID uint, snapshotDate time.Time, cveCount int) error
+
+type RecordHostCVECountSnapshotsFunc func(ctx context.Context, snapshotDate time.Time) error
+
+type HostCVETrendFunc func(ctx context.Context, hostID uint, since time.Time) ([]fleet.HostCVECountSnapshot, error)
+
 type ListOperatingSystemsFunc func(ctx context.Context) ([]fleet.OperatingSystem, error)
 
 type UpdateHostOperatingSystemFunc func(ctx context.Context, hostID uint, hostOS fleet.OperatingSystem) error
@@ -386,6 +508,8 @@ type ListSoftwareFunc func(ctx context.Context, opt fleet.SoftwareListOptions) (
 
 type CountSoftwareFunc func(ctx context.Context, opt fleet.SoftwareListOptions) (int, error)
 
+type ListSoftwareTitlesFunc func(ctx context.Context, opts fleet.ListOptions) ([]fleet.SoftwareTitle, error)
+
 type DeleteSoftwareVulnerabilitiesFunc func(ctx context.Context, vulnerabilities []fleet.SoftwareVulnerability) error
 
 type NewTeamPolicyFunc func(ctx context.Context, teamID uint, authorID *uint, args fleet.PolicyPayload) (*fleet.Policy, error)
@@ -458,6 +582,8 @@ type SaveHostUsersFunc func(ctx context.Context, hostID uint, users []fleet.Host
 
 type SaveHostAdditionalFunc func(ctx context.Context, hostID uint, additional *json.RawMessage) error
 
+type SetAdditionalQueriesForHostsFunc func(ctx context.Context, hostIDs []uint, queries map[string]string) error
+
 type SetOrUpdateMunkiInfoFunc func(ctx context.Context, hostID uint, version string, errors []string, warnings []string) error
 
 type SetOrUpdateMDMDataFunc func(ctx context.Context, hostID uint, isServer bool, enrolled bool, serverURL string, installedFromDep bool, name string) error
@@ -484,7 +610,15 @@ type ReplaceHostBatteriesFunc func(ctx context.Context, id uint, mappings []*fle
 
 type VerifyEnrollSecretFunc func(ctx context.Context, secret string) (*fleet.EnrollSecret, error)
 
-type EnrollHostFunc func(ctx context.Context, isMDMEnabled bool, osqueryHostId string, hardwareUUID string, hardwareSerial string, nodeKey string, teamID *uint, cooldown time.Duration) (*fleet.Host, error)
+type EnrollHostFunc func(ctx context.Context, isMDMEnabled bool, osqueryHostId string, hardwareUUID string, hardwareSerial string, nodeKey string, enrollSecret string, teamID *uint, cooldown time.Duration) (*fleet.Host, error)
+
+type HostsByEnrollSecretFunc func(ctx context.Context, secret string, opt fleet.ListOptions) ([]fleet.Host, error)
+
+type HostCountByEnrollSecretFunc func(ctx context.Context) (map[string]int, error)
+
+type StaleHostsFunc func(ctx context.Context, since time.Time, opt fleet.StaleHostsOptions) ([]*fleet.Host, error)
+
+type DuplicateHostsBySerialFunc func(ctx context.Context) ([][]*fleet.Host, error)
 
 type EnrollOrbitFunc func(ctx context.Context, isMDMEnabled bool, hostInfo fleet.OrbitHostInfo, orbitNodeKey string, teamID *uint) (*fleet.Host, error)
 
@@ -656,9 +790,18 @@ type DataStore struct {
 	QueryByNameFunc        QueryByNameFunc
 	QueryByNameFuncInvoked bool
 
+	SearchQueriesByBodyFunc        SearchQueriesByBodyFunc
+	SearchQueriesByBodyFuncInvoked bool
+
 	ObserverCanRunQueryFunc        ObserverCanRunQueryFunc
 	ObserverCanRunQueryFuncInvoked bool
 
+	FindDuplicateQueryBodiesFunc        FindDuplicateQueryBodiesFunc
+	FindDuplicateQueryBodiesFuncInvoked bool
+
+	ValidateQueriesAgainstSchemaFunc        ValidateQueriesAgainstSchemaFunc
+	ValidateQueriesAgainstSchemaFuncInvoked bool
+
 	NewDistributedQueryCampaignFunc        NewDistributedQueryCampaignFunc
 	NewDistributedQueryCampaignFuncInvoked bool
 
@@ -689,6 +832,9 @@ type DataStore struct {
 	GetPackSpecFunc        GetPackSpecFunc
 	GetPackSpecFuncInvoked bool
 
+	ExportPackSpecFunc        ExportPackSpecFunc
+	ExportPackSpecFuncInvoked bool
+
 	NewPackFunc        NewPackFunc
 	NewPackFuncInvoked bool
 
@@ -704,12 +850,30 @@ type DataStore struct {
 	ListPacksFunc        ListPacksFunc
 	ListPacksFuncInvoked bool
 
+	ListPacksWithoutTargetsFunc        ListPacksWithoutTargetsFunc
+	ListPacksWithoutTargetsFuncInvoked bool
+
 	PackByNameFunc        PackByNameFunc
 	PackByNameFuncInvoked bool
 
 	ListPacksForHostFunc        ListPacksForHostFunc
 	ListPacksForHostFuncInvoked bool
 
+	PacksByLabelFunc        PacksByLabelFunc
+	PacksByLabelFuncInvoked bool
+
+	AuditPackQueryReferencesFunc        AuditPackQueryReferencesFunc
+	AuditPackQueryReferencesFuncInvoked bool
+
+	ListHostsInPackFunc        ListHostsInPackFunc
+	ListHostsInPackFuncInvoked bool
+
+	ResolvePackTargetsFunc        ResolvePackTargetsFunc
+	ResolvePackTargetsFuncInvoked bool
+
+	HostsMissingPackFunc        HostsMissingPackFunc
+	HostsMissingPackFuncInvoked bool
+
 	EnsureGlobalPackFunc        EnsureGlobalPackFunc
 	EnsureGlobalPackFuncInvoked bool
 
@@ -740,6 +904,9 @@ type DataStore struct {
 	ListLabelsFunc        ListLabelsFunc
 	ListLabelsFuncInvoked bool
 
+	ListLabelsWithCountsFunc        ListLabelsWithCountsFunc
+	ListLabelsWithCountsFuncInvoked bool
+
 	LabelsSummaryFunc        LabelsSummaryFunc
 	LabelsSummaryFuncInvoked bool
 
@@ -749,6 +916,9 @@ type DataStore struct {
 	ListLabelsForHostFunc        ListLabelsForHostFunc
 	ListLabelsForHostFuncInvoked bool
 
+	LabelsNotForHostFunc        LabelsNotForHostFunc
+	LabelsNotForHostFuncInvoked bool
+
 	ListHostsInLabelFunc        ListHostsInLabelFunc
 	ListHostsInLabelFuncInvoked bool
 
@@ -761,6 +931,9 @@ type DataStore struct {
 	LabelIDsByNameFunc        LabelIDsByNameFunc
 	LabelIDsByNameFuncInvoked bool
 
+	CleanupOrphanedLabelMembershipsFunc        CleanupOrphanedLabelMembershipsFunc
+	CleanupOrphanedLabelMembershipsFuncInvoked bool
+
 	AsyncBatchInsertLabelMembershipFunc        AsyncBatchInsertLabelMembershipFunc
 	AsyncBatchInsertLabelMembershipFuncInvoked bool
 
@@ -773,9 +946,15 @@ type DataStore struct {
 	NewHostFunc        NewHostFunc
 	NewHostFuncInvoked bool
 
+	BulkUpsertHostsFunc        BulkUpsertHostsFunc
+	BulkUpsertHostsFuncInvoked bool
+
 	DeleteHostFunc        DeleteHostFunc
 	DeleteHostFuncInvoked bool
 
+	MergeHostsFunc        MergeHostsFunc
+	MergeHostsFuncInvoked bool
+
 	HostFunc        HostFunc
 	HostFuncInvoked bool
 
@@ -800,6 +979,9 @@ type DataStore struct {
 	GenerateHostStatusStatisticsFunc        GenerateHostStatusStatisticsFunc
 	GenerateHostStatusStatisticsFuncInvoked bool
 
+	GenerateHostStatusStatisticsByTeamFunc        GenerateHostStatusStatisticsByTeamFunc
+	GenerateHostStatusStatisticsByTeamFuncInvoked bool
+
 	HostIDsByNameFunc        HostIDsByNameFunc
 	HostIDsByNameFuncInvoked bool
 
@@ -941,6 +1123,9 @@ type DataStore struct {
 	NewInviteFunc        NewInviteFunc
 	NewInviteFuncInvoked bool
 
+	BulkCreateInvitesFunc        BulkCreateInvitesFunc
+	BulkCreateInvitesFuncInvoked bool
+
 	ListInvitesFunc        ListInvitesFunc
 	ListInvitesFuncInvoked bool
 
@@ -959,6 +1144,9 @@ type DataStore struct {
 	UpdateInviteFunc        UpdateInviteFunc
 	UpdateInviteFuncInvoked bool
 
+	InvitesExpiringBeforeFunc        InvitesExpiringBeforeFunc
+	InvitesExpiringBeforeFuncInvoked bool
+
 	ListScheduledQueriesInPackWithStatsFunc        ListScheduledQueriesInPackWithStatsFunc
 	ListScheduledQueriesInPackWithStatsFuncInvoked bool
 
@@ -974,6 +1162,15 @@ type DataStore struct {
 	ScheduledQueryFunc        ScheduledQueryFunc
 	ScheduledQueryFuncInvoked bool
 
+	ScheduledQueriesDueForHostFunc        ScheduledQueriesDueForHostFunc
+	ScheduledQueriesDueForHostFuncInvoked bool
+
+	ScheduledQueriesNeverRunFunc        ScheduledQueriesNeverRunFunc
+	ScheduledQueriesNeverRunFuncInvoked bool
+
+	ScheduledQueryIntervalHistogramFunc        ScheduledQueryIntervalHistogramFunc
+	ScheduledQueryIntervalHistogramFuncInvoked bool
+
 	CleanupExpiredHostsFunc        CleanupExpiredHostsFunc
 	CleanupExpiredHostsFuncInvoked bool
 
@@ -1031,6 +1228,9 @@ type DataStore struct {
 	ListSoftwareCPEsFunc        ListSoftwareCPEsFunc
 	ListSoftwareCPEsFuncInvoked bool
 
+	ListHostSoftwareCPEsFunc        ListHostSoftwareCPEsFunc
+	ListHostSoftwareCPEsFuncInvoked bool
+
 	InsertSoftwareVulnerabilitiesFunc        InsertSoftwareVulnerabilitiesFunc
 	InsertSoftwareVulnerabilitiesFuncInvoked bool
 
@@ -1052,9 +1252,126 @@ type DataStore struct {
 	InsertCVEMetaFunc        InsertCVEMetaFunc
 	InsertCVEMetaFuncInvoked bool
 
+	UpsertCVEMetaFunc        UpsertCVEMetaFunc
+	UpsertCVEMetaFuncInvoked bool
+
+	PruneCVEMetaFunc        PruneCVEMetaFunc
+	PruneCVEMetaFuncInvoked bool
+
+	LockCVEMetaLoadFunc        LockCVEMetaLoadFunc
+	LockCVEMetaLoadFuncInvoked bool
+
+	WithCVEMetaTxFunc        WithCVEMetaTxFunc
+	WithCVEMetaTxFuncInvoked bool
+
+	InsertCVEMetaProvenanceFunc        InsertCVEMetaProvenanceFunc
+	InsertCVEMetaProvenanceFuncInvoked bool
+
+	ListCVEMetaProvenanceFunc        ListCVEMetaProvenanceFunc
+	ListCVEMetaProvenanceFuncInvoked bool
+
 	ListCVEsFunc        ListCVEsFunc
 	ListCVEsFuncInvoked bool
 
+	NewCVEsSinceFunc        NewCVEsSinceFunc
+	NewCVEsSinceFuncInvoked bool
+
+	CVEMetaChangedSinceFunc        CVEMetaChangedSinceFunc
+	CVEMetaChangedSinceFuncInvoked bool
+
+	CVEsWithoutCVSSFunc        CVEsWithoutCVSSFunc
+	CVEsWithoutCVSSFuncInvoked bool
+
+	OverdueCVEsFunc        OverdueCVEsFunc
+	OverdueCVEsFuncInvoked bool
+
+	FleetKnownExploitedCVEsFunc        FleetKnownExploitedCVEsFunc
+	FleetKnownExploitedCVEsFuncInvoked bool
+
+	RecordCVESyncFunc        RecordCVESyncFunc
+	RecordCVESyncFuncInvoked bool
+
+	LastCVESyncInfoFunc        LastCVESyncInfoFunc
+	LastCVESyncInfoFuncInvoked bool
+
+	RecordSyncAttemptFunc        RecordSyncAttemptFunc
+	RecordSyncAttemptFuncInvoked bool
+
+	ListSyncAttemptsFunc        ListSyncAttemptsFunc
+	ListSyncAttemptsFuncInvoked bool
+
+	EPSSCoverageFunc        EPSSCoverageFunc
+	EPSSCoverageFuncInvoked bool
+
+	RecordCISACatalogVersionFunc        RecordCISACatalogVersionFunc
+	RecordCISACatalogVersionFuncInvoked bool
+
+	LastCISACatalogVersionFunc        LastCISACatalogVersionFunc
+	LastCISACatalogVersionFuncInvoked bool
+
+	HostVulnerabilitySummaryFunc        HostVulnerabilitySummaryFunc
+	HostVulnerabilitySummaryFuncInvoked bool
+
+	MostVulnerableHostsFunc        MostVulnerableHostsFunc
+	MostVulnerableHostsFuncInvoked bool
+
+	CleanHostsFunc        CleanHostsFunc
+	CleanHostsFuncInvoked bool
+
+	HostsBySeverityFunc        HostsBySeverityFunc
+	HostsBySeverityFuncInvoked bool
+
+	HostCVEsFunc        HostCVEsFunc
+	HostCVEsFuncInvoked bool
+
+	InsertEPSSSnapshotsFunc        InsertEPSSSnapshotsFunc
+	InsertEPSSSnapshotsFuncInvoked bool
+
+	ListEPSSSnapshotsFunc        ListEPSSSnapshotsFunc
+	ListEPSSSnapshotsFuncInvoked bool
+
+	InsertEPSSModelScoresFunc        InsertEPSSModelScoresFunc
+	InsertEPSSModelScoresFuncInvoked bool
+
+	ListEPSSModelScoresFunc        ListEPSSModelScoresFunc
+	ListEPSSModelScoresFuncInvoked bool
+
+	CVEsByLabelFunc        CVEsByLabelFunc
+	CVEsByLabelFuncInvoked bool
+
+	InsertCVECWEsFunc        InsertCVECWEsFunc
+	InsertCVECWEsFuncInvoked bool
+
+	CVEsByCWEFunc        CVEsByCWEFunc
+	CVEsByCWEFuncInvoked bool
+
+	InsertCVEProductsFunc        InsertCVEProductsFunc
+	InsertCVEProductsFuncInvoked bool
+
+	CVEsByVendorProductFunc        CVEsByVendorProductFunc
+	CVEsByVendorProductFuncInvoked bool
+
+	CountFleetCVEsFunc        CountFleetCVEsFunc
+	CountFleetCVEsFuncInvoked bool
+
+	CVECountByYearFunc        CVECountByYearFunc
+	CVECountByYearFuncInvoked bool
+
+	RecordFleetCVECountSnapshotFunc        RecordFleetCVECountSnapshotFunc
+	RecordFleetCVECountSnapshotFuncInvoked bool
+
+	FleetCVETrendFunc        FleetCVETrendFunc
+	FleetCVETrendFuncInvoked bool
+
+	RecordHostCVECountSnapshotFunc        RecordHostCVECountSnapshotFunc
+	RecordHostCVECountSnapshotFuncInvoked bool
+
+	RecordHostCVECountSnapshotsFunc        RecordHostCVECountSnapshotsFunc
+	RecordHostCVECountSnapshotsFuncInvoked bool
+
+	HostCVETrendFunc        HostCVETrendFunc
+	HostCVETrendFuncInvoked bool
+
 	ListOperatingSystemsFunc        ListOperatingSystemsFunc
 	ListOperatingSystemsFuncInvoked bool
 
@@ -1130,6 +1447,9 @@ type DataStore struct {
 	CountSoftwareFunc        CountSoftwareFunc
 	CountSoftwareFuncInvoked bool
 
+	ListSoftwareTitlesFunc        ListSoftwareTitlesFunc
+	ListSoftwareTitlesFuncInvoked bool
+
 	DeleteSoftwareVulnerabilitiesFunc        DeleteSoftwareVulnerabilitiesFunc
 	DeleteSoftwareVulnerabilitiesFuncInvoked bool
 
@@ -1238,6 +1558,9 @@ type DataStore struct {
 	SaveHostAdditionalFunc        SaveHostAdditionalFunc
 	SaveHostAdditionalFuncInvoked bool
 
+	SetAdditionalQueriesForHostsFunc        SetAdditionalQueriesForHostsFunc
+	SetAdditionalQueriesForHostsFuncInvoked bool
+
 	SetOrUpdateMunkiInfoFunc        SetOrUpdateMunkiInfoFunc
 	SetOrUpdateMunkiInfoFuncInvoked bool
 
@@ -1280,6 +1603,18 @@ type DataStore struct {
 	EnrollHostFunc        EnrollHostFunc
 	EnrollHostFuncInvoked bool
 
+	HostsByEnrollSecretFunc        HostsByEnrollSecretFunc
+	HostsByEnrollSecretFuncInvoked bool
+
+	HostCountByEnrollSecretFunc        HostCountByEnrollSecretFunc
+	HostCountByEnrollSecretFuncInvoked bool
+
+	StaleHostsFunc        StaleHostsFunc
+	StaleHostsFuncInvoked bool
+
+	DuplicateHostsBySerialFunc        DuplicateHostsBySerialFunc
+	DuplicateHostsBySerialFuncInvoked bool
+
 	EnrollOrbitFunc        EnrollOrbitFunc
 	EnrollOrbitFuncInvoked bool
 
@@ -1562,11 +1897,11 @@ func (s *DataStore) NewQuery(ctx context.Context, query *fleet.Query, opts ...fl
 	return s.NewQueryFunc(ctx, query, opts...)
 }
 
-func (s *DataStore) SaveQuery(ctx context.Context, query *fleet.Query) error {
+func (s *DataStore) SaveQuery(ctx context.Context, query *fleet.Query, opts ...fleet.OptionalArg) error {
 	s.mu.Lock()
 	s.SaveQueryFuncInvoked = true
 	s.mu.Unlock()
-	return s.SaveQueryFunc(ctx, query)
+	return s.SaveQueryFunc(ctx, query, opts...)
 }
 
 func (s *DataStore) DeleteQuery(ctx context.Context, name string) error {
@@ -1576,11 +1911,11 @@ func (s *DataStore) DeleteQuery(ctx context.Context, name string) error {
 	return s.DeleteQueryFunc(ctx, name)
 }
 
-func (s *DataStore) DeleteQueries(ctx context.Context, ids []uint) (uint, error) {
+func (s *DataStore) DeleteQueries(ctx context.Context, ids []uint, opts ...fleet.OptionalArg) (deleted uint, blocked []uint, err error) {
 	s.mu.Lock()
 	s.DeleteQueriesFuncInvoked = true
 	s.mu.Unlock()
-	return s.DeleteQueriesFunc(ctx, ids)
+	return s.DeleteQueriesFunc(ctx, ids, opts...)
 }
 
 func (s *DataStore) Query(ctx context.Context, id uint) (*fleet.Query, error) {
@@ -1604,6 +1939,13 @@ func (s *DataStore) QueryByName(ctx context.Context, name string, opts ...fleet.
 	return s.QueryByNameFunc(ctx, name, opts...)
 }
 
+func (s *DataStore) SearchQueriesByBody(ctx context.Context, substring string, opt fleet.ListOptions) ([]*fleet.Query, error) {
+	s.mu.Lock()
+	s.SearchQueriesByBodyFuncInvoked = true
+	s.mu.Unlock()
+	return s.SearchQueriesByBodyFunc(ctx, substring, opt)
+}
+
 func (s *DataStore) ObserverCanRunQuery(ctx context.Context, queryID uint) (bool, error) {
 	s.mu.Lock()
 	s.ObserverCanRunQueryFuncInvoked = true
@@ -1611,6 +1953,20 @@ func (s *DataStore) ObserverCanRunQuery(ctx context.Context, queryID uint) (bool
 	return s.ObserverCanRunQueryFunc(ctx, queryID)
 }
 
+func (s *DataStore) FindDuplicateQueryBodies(ctx context.Context) ([][]*fleet.Query, error) {
+	s.mu.Lock()
+	s.FindDuplicateQueryBodiesFuncInvoked = true
+	s.mu.Unlock()
+	return s.FindDuplicateQueryBodiesFunc(ctx)
+}
+
+func (s *DataStore) ValidateQueriesAgainstSchema(ctx context.Context, schema fleet.OsquerySchema) ([]fleet.QueryMissingTables, error) {
+	s.mu.Lock()
+	s.ValidateQueriesAgainstSchemaFuncInvoked = true
+	s.mu.Unlock()
+	return s.ValidateQueriesAgainstSchemaFunc(ctx, schema)
+}
+
 func (s *DataStore) NewDistributedQueryCampaign(ctx context.Context, camp *fleet.DistributedQueryCampaign) (*fleet.DistributedQueryCampaign, error) {
 	s.mu.Lock()
 	s.NewDistributedQueryCampaignFuncInvoked = true
@@ -1681,6 +2037,13 @@ func (s *DataStore) GetPackSpec(ctx context.Context, name string) (*fleet.PackSp
 	return s.GetPackSpecFunc(ctx, name)
 }
 
+func (s *DataStore) ExportPackSpec(ctx context.Context, packID uint) (*fleet.PackSpec, error) {
+	s.mu.Lock()
+	s.ExportPackSpecFuncInvoked = true
+	s.mu.Unlock()
+	return s.ExportPackSpecFunc(ctx, packID)
+}
+
 func (s *DataStore) NewPack(ctx context.Context, pack *fleet.Pack, opts ...fleet.OptionalArg) (*fleet.Pack, error) {
 	s.mu.Lock()
 	s.NewPackFuncInvoked = true
@@ -1716,6 +2079,13 @@ func (s *DataStore) ListPacks(ctx context.Context, opt fleet.PackListOptions) ([
 	return s.ListPacksFunc(ctx, opt)
 }
 
+func (s *DataStore) ListPacksWithoutTargets(ctx context.Context) ([]fleet.Pack, error) {
+	s.mu.Lock()
+	s.ListPacksWithoutTargetsFuncInvoked = true
+	s.mu.Unlock()
+	return s.ListPacksWithoutTargetsFunc(ctx)
+}
+
 func (s *DataStore) PackByName(ctx context.Context, name string, opts ...fleet.OptionalArg) (*fleet.Pack, bool, error) {
 	s.mu.Lock()
 	s.PackByNameFuncInvoked = true
@@ -1730,6 +2100,41 @@ func (s *DataStore) ListPacksForHost(ctx context.Context, hid uint) (packs []*fl
 	return s.ListPacksForHostFunc(ctx, hid)
 }
 
+func (s *DataStore) PacksByLabel(ctx context.Context, labelID uint) ([]fleet.Pack, error) {
+	s.mu.Lock()
+	s.PacksByLabelFuncInvoked = true
+	s.mu.Unlock()
+	return s.PacksByLabelFunc(ctx, labelID)
+}
+
+func (s *DataStore) AuditPackQueryReferences(ctx context.Context) ([]fleet.PackQueryReference, error) {
+	s.mu.Lock()
+	s.AuditPackQueryReferencesFuncInvoked = true
+	s.mu.Unlock()
+	return s.AuditPackQueryReferencesFunc(ctx)
+}
+
+func (s *DataStore) ListHostsInPack(ctx context.Context, pid uint, opt fleet.ListOptions) (hosts []*fleet.HostShort, count int, err error) {
+	s.mu.Lock()
+	s.ListHostsInPackFuncInvoked = true
+	s.mu.Unlock()
+	return s.ListHostsInPackFunc(ctx, pid, opt)
+}
+
+func (s *DataStore) ResolvePackTargets(ctx context.Context, packID uint) ([]uint, error) {
+	s.mu.Lock()
+	s.ResolvePackTargetsFuncInvoked = true
+	s.mu.Unlock()
+	return s.ResolvePackTargetsFunc(ctx, packID)
+}
+
+func (s *DataStore) HostsMissingPack(ctx context.Context, labelID, packID uint, opts fleet.ListOptions) ([]fleet.Host, error) {
+	s.mu.Lock()
+	s.HostsMissingPackFuncInvoked = true
+	s.mu.Unlock()
+	return s.HostsMissingPackFunc(ctx, labelID, packID, opts)
+}
+
 func (s *DataStore) EnsureGlobalPack(ctx context.Context) (*fleet.Pack, error) {
 	s.mu.Lock()
 	s.EnsureGlobalPackFuncInvoked = true
@@ -1800,6 +2205,13 @@ func (s *DataStore) ListLabels(ctx context.Context, filter fleet.TeamFilter, opt
 	return s.ListLabelsFunc(ctx, filter, opt)
 }
 
+func (s *DataStore) ListLabelsWithCounts(ctx context.Context, filter fleet.TeamFilter, opt fleet.ListOptions) ([]*fleet.Label, error) {
+	s.mu.Lock()
+	s.ListLabelsWithCountsFuncInvoked = true
+	s.mu.Unlock()
+	return s.ListLabelsWithCountsFunc(ctx, filter, opt)
+}
+
 func (s *DataStore) LabelsSummary(ctx context.Context) ([]*fleet.LabelSummary, error) {
 	s.mu.Lock()
 	s.LabelsSummaryFuncInvoked = true
@@ -1821,6 +2233,13 @@ func (s *DataStore) ListLabelsForHost(ctx context.Context, hid uint) ([]*fleet.L
 	return s.ListLabelsForHostFunc(ctx, hid)
 }
 
+func (s *DataStore) LabelsNotForHost(ctx context.Context, hostID uint, opts fleet.ListOptions) ([]fleet.Label, error) {
+	s.mu.Lock()
+	s.LabelsNotForHostFuncInvoked = true
+	s.mu.Unlock()
+	return s.LabelsNotForHostFunc(ctx, hostID, opts)
+}
+
 func (s *DataStore) ListHostsInLabel(ctx context.Context, filter fleet.TeamFilter, lid uint, opt fleet.HostListOptions) ([]*fleet.Host, error) {
 	s.mu.Lock()
 	s.ListHostsInLabelFuncInvoked = true
@@ -1849,6 +2268,13 @@ func (s *DataStore) LabelIDsByName(ctx context.Context, labels []string) ([]uint
 	return s.LabelIDsByNameFunc(ctx, labels)
 }
 
+func (s *DataStore) CleanupOrphanedLabelMemberships(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	s.CleanupOrphanedLabelMembershipsFuncInvoked = true
+	s.mu.Unlock()
+	return s.CleanupOrphanedLabelMembershipsFunc(ctx)
+}
+
 func (s *DataStore) AsyncBatchInsertLabelMembership(ctx context.Context, batch [][2]uint) error {
 	s.mu.Lock()
 	s.AsyncBatchInsertLabelMembershipFuncInvoked = true
@@ -1877,6 +2303,13 @@ func (s *DataStore) NewHost(ctx context.Context, host *fleet.Host) (*fleet.Host,
 	return s.NewHostFunc(ctx, host)
 }
 
+func (s *DataStore) BulkUpsertHosts(ctx context.Context, hosts []*fleet.Host) (created, updated []uint, err error) {
+	s.mu.Lock()
+	s.BulkUpsertHostsFuncInvoked = true
+	s.mu.Unlock()
+	return s.BulkUpsertHostsFunc(ctx, hosts)
+}
+
 func (s *DataStore) DeleteHost(ctx context.Context, hid uint) error {
 	s.mu.Lock()
 	s.DeleteHostFuncInvoked = true
@@ -1884,6 +2317,13 @@ func (s *DataStore) DeleteHost(ctx context.Context, hid uint) error {
 	return s.DeleteHostFunc(ctx, hid)
 }
 
+func (s *DataStore) MergeHosts(ctx context.Context, keepID uint, mergeID uint) error {
+	s.mu.Lock()
+	s.MergeHostsFuncInvoked = true
+	s.mu.Unlock()
+	return s.MergeHostsFunc(ctx, keepID, mergeID)
+}
+
 func (s *DataStore) Host(ctx context.Context, id uint) (*fleet.Host, error) {
 	s.mu.Lock()
 	s.HostFuncInvoked = true
@@ -1940,6 +2380,13 @@ func (s *DataStore) GenerateHostStatusStatistics(ctx context.Context, filter fle
 	return s.GenerateHostStatusStatisticsFunc(ctx, filter, now, platform, lowDiskSpace)
 }
 
+func (s *DataStore) GenerateHostStatusStatisticsByTeam(ctx context.Context, filter fleet.TeamFilter, teamIDs []uint, now time.Time, platform *string, lowDiskSpace *int) (map[uint]*fleet.HostSummary, error) {
+	s.mu.Lock()
+	s.GenerateHostStatusStatisticsByTeamFuncInvoked = true
+	s.mu.Unlock()
+	return s.GenerateHostStatusStatisticsByTeamFunc(ctx, filter, teamIDs, now, platform, lowDiskSpace)
+}
+
 func (s *DataStore) HostIDsByName(ctx context.Context, filter fleet.TeamFilter, hostnames []string) ([]uint, error) {
 	s.mu.Lock()
 	s.HostIDsByNameFuncInvoked = true
@@ -2269,6 +2716,13 @@ func (s *DataStore) NewInvite(ctx context.Context, i *fleet.Invite) (*fleet.Invi
 	return s.NewInviteFunc(ctx, i)
 }
 
+func (s *DataStore) BulkCreateInvites(ctx context.Context, invites []fleet.Invite) ([]fleet.Invite, error) {
+	s.mu.Lock()
+	s.BulkCreateInvitesFuncInvoked = true
+	s.mu.Unlock()
+	return s.BulkCreateInvitesFunc(ctx, invites)
+}
+
 func (s *DataStore) ListInvites(ctx context.Context, opt fleet.ListOptions) ([]*fleet.Invite, error) {
 	s.mu.Lock()
 	s.ListInvitesFuncInvoked = true
@@ -2311,6 +2765,13 @@ func (s *DataStore) UpdateInvite(ctx context.Context, id uint, i *fleet.Invite)
 	return s.UpdateInviteFunc(ctx, id, i)
 }
 
+func (s *DataStore) InvitesExpiringBefore(ctx context.Context, before time.Time, opts fleet.ListOptions) ([]*fleet.Invite, error) {
+	s.mu.Lock()
+	s.InvitesExpiringBeforeFuncInvoked = true
+	s.mu.Unlock()
+	return s.InvitesExpiringBeforeFunc(ctx, before, opts)
+}
+
 func (s *DataStore) ListScheduledQueriesInPackWithStats(ctx context.Context, id uint, opts fleet.ListOptions) ([]*fleet.ScheduledQuery, error) {
 	s.mu.Lock()
 	s.ListScheduledQueriesInPackWithStatsFuncInvoked = true
@@ -2346,6 +2807,27 @@ func (s *DataStore) ScheduledQuery(ctx context.Context, id uint) (*fleet.Schedul
 	return s.ScheduledQueryFunc(ctx, id)
 }
 
+func (s *DataStore) ScheduledQueriesDueForHost(ctx context.Context, hostID uint, at time.Time) ([]fleet.ScheduledQuery, error) {
+	s.mu.Lock()
+	s.ScheduledQueriesDueForHostFuncInvoked = true
+	s.mu.Unlock()
+	return s.ScheduledQueriesDueForHostFunc(ctx, hostID, at)
+}
+
+func (s *DataStore) ScheduledQueriesNeverRun(ctx context.Context) ([]fleet.ScheduledQuery, error) {
+	s.mu.Lock()
+	s.ScheduledQueriesNeverRunFuncInvoked = true
+	s.mu.Unlock()
+	return s.ScheduledQueriesNeverRunFunc(ctx)
+}
+
+func (s *DataStore) ScheduledQueryIntervalHistogram(ctx context.Context) ([]fleet.ScheduledQueryIntervalBucket, error) {
+	s.mu.Lock()
+	s.ScheduledQueryIntervalHistogramFuncInvoked = true
+	s.mu.Unlock()
+	return s.ScheduledQueryIntervalHistogramFunc(ctx)
+}
+
 func (s *DataStore) CleanupExpiredHosts(ctx context.Context) ([]uint, error) {
 	s.mu.Lock()
 	s.CleanupExpiredHostsFuncInvoked = true
@@ -2479,6 +2961,13 @@ func (s *DataStore) ListSoftwareCPEs(ctx context.Context) ([]fleet.SoftwareCPE,
 	return s.ListSoftwareCPEsFunc(ctx)
 }
 
+func (s *DataStore) ListHostSoftwareCPEs(ctx context.Context, hostID uint) ([]fleet.SoftwareCPE, error) {
+	s.mu.Lock()
+	s.ListHostSoftwareCPEsFuncInvoked = true
+	s.mu.Unlock()
+	return s.ListHostSoftwareCPEsFunc(ctx, hostID)
+}
+
 func (s *DataStore) InsertSoftwareVulnerabilities(ctx context.Context, vulns []fleet.SoftwareVulnerability, source fleet.VulnerabilitySource) (int64, error) {
 	s.mu.Lock()
 	s.InsertSoftwareVulnerabilitiesFuncInvoked = true
@@ -2514,18 +3003,60 @@ func (s *DataStore) HostsBySoftwareIDs(ctx context.Context, softwareIDs []uint)
 	return s.HostsBySoftwareIDsFunc(ctx, softwareIDs)
 }
 
-func (s *DataStore) HostsByCVE(ctx context.Context, cve string) ([]*fleet.HostShort, error) {
+func (s *DataStore) HostsByCVE(ctx context.Context, cve string, opts fleet.HostsByCVEOptions) ([]*fleet.HostShort, error) {
 	s.mu.Lock()
 	s.HostsByCVEFuncInvoked = true
 	s.mu.Unlock()
-	return s.HostsByCVEFunc(ctx, cve)
+	return s.HostsByCVEFunc(ctx, cve, opts)
 }
 
-func (s *DataStore) InsertCVEMeta(ctx context.Context, cveMeta []fleet.CVEMeta) error {
+func (s *DataStore) InsertCVEMeta(ctx context.Context, cveMeta []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
 	s.mu.Lock()
 	s.InsertCVEMetaFuncInvoked = true
 	s.mu.Unlock()
-	return s.InsertCVEMetaFunc(ctx, cveMeta)
+	return s.InsertCVEMetaFunc(ctx, cveMeta, opts...)
+}
+
+func (s *DataStore) UpsertCVEMeta(ctx context.Context, cveMeta []fleet.CVEMeta) error {
+	s.mu.Lock()
+	s.UpsertCVEMetaFuncInvoked = true
+	s.mu.Unlock()
+	return s.UpsertCVEMetaFunc(ctx, cveMeta)
+}
+
+func (s *DataStore) PruneCVEMeta(ctx context.Context, current []string) (int, error) {
+	s.mu.Lock()
+	s.PruneCVEMetaFuncInvoked = true
+	s.mu.Unlock()
+	return s.PruneCVEMetaFunc(ctx, current)
+}
+
+func (s *DataStore) LockCVEMetaLoad(ctx context.Context, wait bool) (unlock func(), err error) {
+	s.mu.Lock()
+	s.LockCVEMetaLoadFuncInvoked = true
+	s.mu.Unlock()
+	return s.LockCVEMetaLoadFunc(ctx, wait)
+}
+
+func (s *DataStore) WithCVEMetaTx(ctx context.Context, fn func(tx fleet.CVEMetaTx) error) error {
+	s.mu.Lock()
+	s.WithCVEMetaTxFuncInvoked = true
+	s.mu.Unlock()
+	return s.WithCVEMetaTxFunc(ctx, fn)
+}
+
+func (s *DataStore) InsertCVEMetaProvenance(ctx context.Context, provenance []fleet.CVEMetaProvenance) error {
+	s.mu.Lock()
+	s.InsertCVEMetaProvenanceFuncInvoked = true
+	s.mu.Unlock()
+	return s.InsertCVEMetaProvenanceFunc(ctx, provenance)
+}
+
+func (s *DataStore) ListCVEMetaProvenance(ctx context.Context, cve string) ([]fleet.CVEMetaProvenance, error) {
+	s.mu.Lock()
+	s.ListCVEMetaProvenanceFuncInvoked = true
+	s.mu.Unlock()
+	return s.ListCVEMetaProvenanceFunc(ctx, cve)
 }
 
 func (s *DataStore) ListCVEs(ctx context.Context, maxAge time.Duration) ([]fleet.CVEMeta, error) {
@@ -2535,6 +3066,237 @@ func (s *DataStore) ListCVEs(ctx context.Context, maxAge time.Duration) ([]fleet
 	return s.ListCVEsFunc(ctx, maxAge)
 }
 
+func (s *DataStore) NewCVEsSince(ctx context.Context, since time.Time, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	s.mu.Lock()
+	s.NewCVEsSinceFuncInvoked = true
+	s.mu.Unlock()
+	return s.NewCVEsSinceFunc(ctx, since, opts)
+}
+
+func (s *DataStore) CVEMetaChangedSince(ctx context.Context, since time.Time, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	s.mu.Lock()
+	s.CVEMetaChangedSinceFuncInvoked = true
+	s.mu.Unlock()
+	return s.CVEMetaChangedSinceFunc(ctx, since, opts)
+}
+
+func (s *DataStore) CVEsWithoutCVSS(ctx context.Context, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	s.mu.Lock()
+	s.CVEsWithoutCVSSFuncInvoked = true
+	s.mu.Unlock()
+	return s.CVEsWithoutCVSSFunc(ctx, opts)
+}
+
+func (s *DataStore) OverdueCVEs(ctx context.Context, asOf time.Time, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	s.mu.Lock()
+	s.OverdueCVEsFuncInvoked = true
+	s.mu.Unlock()
+	return s.OverdueCVEsFunc(ctx, asOf, opts)
+}
+
+func (s *DataStore) FleetKnownExploitedCVEs(ctx context.Context, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	s.mu.Lock()
+	s.FleetKnownExploitedCVEsFuncInvoked = true
+	s.mu.Unlock()
+	return s.FleetKnownExploitedCVEsFunc(ctx, opts)
+}
+
+func (s *DataStore) RecordCVESync(ctx context.Context, syncedAt time.Time, cveCount int) error {
+	s.mu.Lock()
+	s.RecordCVESyncFuncInvoked = true
+	s.mu.Unlock()
+	return s.RecordCVESyncFunc(ctx, syncedAt, cveCount)
+}
+
+func (s *DataStore) LastCVESyncInfo(ctx context.Context) (*fleet.CVESyncInfo, error) {
+	s.mu.Lock()
+	s.LastCVESyncInfoFuncInvoked = true
+	s.mu.Unlock()
+	return s.LastCVESyncInfoFunc(ctx)
+}
+
+func (s *DataStore) RecordSyncAttempt(ctx context.Context, attempt *fleet.SyncAttempt) error {
+	s.mu.Lock()
+	s.RecordSyncAttemptFuncInvoked = true
+	s.mu.Unlock()
+	return s.RecordSyncAttemptFunc(ctx, attempt)
+}
+
+func (s *DataStore) ListSyncAttempts(ctx context.Context, opts fleet.ListOptions) ([]fleet.SyncAttempt, error) {
+	s.mu.Lock()
+	s.ListSyncAttemptsFuncInvoked = true
+	s.mu.Unlock()
+	return s.ListSyncAttemptsFunc(ctx, opts)
+}
+
+func (s *DataStore) EPSSCoverage(ctx context.Context) (*fleet.EPSSCoverage, error) {
+	s.mu.Lock()
+	s.EPSSCoverageFuncInvoked = true
+	s.mu.Unlock()
+	return s.EPSSCoverageFunc(ctx)
+}
+
+func (s *DataStore) RecordCISACatalogVersion(ctx context.Context, version fleet.CISACatalogVersion) error {
+	s.mu.Lock()
+	s.RecordCISACatalogVersionFuncInvoked = true
+	s.mu.Unlock()
+	return s.RecordCISACatalogVersionFunc(ctx, version)
+}
+
+func (s *DataStore) LastCISACatalogVersion(ctx context.Context) (*fleet.CISACatalogVersion, error) {
+	s.mu.Lock()
+	s.LastCISACatalogVersionFuncInvoked = true
+	s.mu.Unlock()
+	return s.LastCISACatalogVersionFunc(ctx)
+}
+
+func (s *DataStore) HostVulnerabilitySummary(ctx context.Context, hostID uint) (*fleet.HostVulnerabilitySummary, error) {
+	s.mu.Lock()
+	s.HostVulnerabilitySummaryFuncInvoked = true
+	s.mu.Unlock()
+	return s.HostVulnerabilitySummaryFunc(ctx, hostID)
+}
+
+func (s *DataStore) MostVulnerableHosts(ctx context.Context, limit int, opts fleet.MostVulnerableHostsOptions) ([]fleet.HostVulnerabilitySummary, error) {
+	s.mu.Lock()
+	s.MostVulnerableHostsFuncInvoked = true
+	s.mu.Unlock()
+	return s.MostVulnerableHostsFunc(ctx, limit, opts)
+}
+
+func (s *DataStore) CleanHosts(ctx context.Context, opts fleet.CleanHostsOptions) ([]*fleet.CleanHost, error) {
+	s.mu.Lock()
+	s.CleanHostsFuncInvoked = true
+	s.mu.Unlock()
+	return s.CleanHostsFunc(ctx, opts)
+}
+
+func (s *DataStore) HostsBySeverity(ctx context.Context, minSeverity string, opts fleet.ListOptions) ([]fleet.Host, error) {
+	s.mu.Lock()
+	s.HostsBySeverityFuncInvoked = true
+	s.mu.Unlock()
+	return s.HostsBySeverityFunc(ctx, minSeverity, opts)
+}
+
+func (s *DataStore) HostCVEs(ctx context.Context, hostID uint, opts fleet.ListOptions) ([]fleet.HostCVE, error) {
+	s.mu.Lock()
+	s.HostCVEsFuncInvoked = true
+	s.mu.Unlock()
+	return s.HostCVEsFunc(ctx, hostID, opts)
+}
+
+func (s *DataStore) InsertEPSSSnapshots(ctx context.Context, snapshots []fleet.EPSSSnapshot) error {
+	s.mu.Lock()
+	s.InsertEPSSSnapshotsFuncInvoked = true
+	s.mu.Unlock()
+	return s.InsertEPSSSnapshotsFunc(ctx, snapshots)
+}
+
+func (s *DataStore) ListEPSSSnapshots(ctx context.Context, cve string) ([]fleet.EPSSSnapshot, error) {
+	s.mu.Lock()
+	s.ListEPSSSnapshotsFuncInvoked = true
+	s.mu.Unlock()
+	return s.ListEPSSSnapshotsFunc(ctx, cve)
+}
+
+func (s *DataStore) InsertEPSSModelScores(ctx context.Context, scores []fleet.EPSSModelScore) error {
+	s.mu.Lock()
+	s.InsertEPSSModelScoresFuncInvoked = true
+	s.mu.Unlock()
+	return s.InsertEPSSModelScoresFunc(ctx, scores)
+}
+
+func (s *DataStore) ListEPSSModelScores(ctx context.Context, cve string) ([]fleet.EPSSModelScore, error) {
+	s.mu.Lock()
+	s.ListEPSSModelScoresFuncInvoked = true
+	s.mu.Unlock()
+	return s.ListEPSSModelScoresFunc(ctx, cve)
+}
+
+func (s *DataStore) CVEsByLabel(ctx context.Context, labelID uint, opts fleet.CVEsByLabelOptions) ([]fleet.CVEMeta, error) {
+	s.mu.Lock()
+	s.CVEsByLabelFuncInvoked = true
+	s.mu.Unlock()
+	return s.CVEsByLabelFunc(ctx, labelID, opts)
+}
+
+func (s *DataStore) InsertCVECWEs(ctx context.Context, cwes []fleet.CVECWE) error {
+	s.mu.Lock()
+	s.InsertCVECWEsFuncInvoked = true
+	s.mu.Unlock()
+	return s.InsertCVECWEsFunc(ctx, cwes)
+}
+
+func (s *DataStore) CVEsByCWE(ctx context.Context, cweID string, opts fleet.CVEsByCWEOptions) ([]fleet.CVEMeta, error) {
+	s.mu.Lock()
+	s.CVEsByCWEFuncInvoked = true
+	s.mu.Unlock()
+	return s.CVEsByCWEFunc(ctx, cweID, opts)
+}
+
+func (s *DataStore) InsertCVEProducts(ctx context.Context, products []fleet.CVEProduct) error {
+	s.mu.Lock()
+	s.InsertCVEProductsFuncInvoked = true
+	s.mu.Unlock()
+	return s.InsertCVEProductsFunc(ctx, products)
+}
+
+func (s *DataStore) CVEsByVendorProduct(ctx context.Context, vendor, product string, opts fleet.ListOptions) ([]fleet.CVEMeta, error) {
+	s.mu.Lock()
+	s.CVEsByVendorProductFuncInvoked = true
+	s.mu.Unlock()
+	return s.CVEsByVendorProductFunc(ctx, vendor, product, opts)
+}
+
+func (s *DataStore) CountFleetCVEs(ctx context.Context, opts fleet.CountCVEsOptions) (int, error) {
+	s.mu.Lock()
+	s.CountFleetCVEsFuncInvoked = true
+	s.mu.Unlock()
+	return s.CountFleetCVEsFunc(ctx, opts)
+}
+
+func (s *DataStore) CVECountByYear(ctx context.Context, opts fleet.CountCVEsOptions) (map[int]int, error) {
+	s.mu.Lock()
+	s.CVECountByYearFuncInvoked = true
+	s.mu.Unlock()
+	return s.CVECountByYearFunc(ctx, opts)
+}
+
+func (s *DataStore) RecordFleetCVECountSnapshot(ctx context.Context, snapshotDate time.Time, cveCount int) error {
+	s.mu.Lock()
+	s.RecordFleetCVECountSnapshotFuncInvoked = true
+	s.mu.Unlock()
+	return s.RecordFleetCVECountSnapshotFunc(ctx, snapshotDate, cveCount)
+}
+
+func (s *DataStore) FleetCVETrend(ctx context.Context, since time.Time) ([]fleet.FleetCVECountSnapshot, error) {
+	s.mu.Lock()
+	s.FleetCVETrendFuncInvoked = true
+	s.mu.Unlock()
+	return s.FleetCVETrendFunc(ctx, since)
+}
+
+func (s *DataStore) RecordHostCVECountSnapshot(ctx context.Context, hostID uint, snapshotDate time.Time, cveCount int) error {
+	s.mu.Lock()
+	s.RecordHostCVECountSnapshotFuncInvoked = true
+	s.mu.Unlock()
+	return s.RecordHostCVECountSnapshotFunc(ctx, hostID, snapshotDate, cveCount)
+}
+
+func (s *DataStore) RecordHostCVECountSnapshots(ctx context.Context, snapshotDate time.Time) error {
+	s.mu.Lock()
+	s.RecordHostCVECountSnapshotsFuncInvoked = true
+	s.mu.Unlock()
+	return s.RecordHostCVECountSnapshotsFunc(ctx, snapshotDate)
+}
+
+func (s *DataStore) HostCVETrend(ctx context.Context, hostID uint, since time.Time) ([]fleet.HostCVECountSnapshot, error) {
+	s.mu.Lock()
+	s.HostCVETrendFuncInvoked = true
+	s.mu.Unlock()
+	return s.HostCVETrendFunc(ctx, hostID, since)
+}
+
 func (s *DataStore) ListOperatingSystems(ctx context.Context) ([]fleet.OperatingSystem, error) {
 	s.mu.Lock()
 	s.ListOperatingSystemsFuncInvoked = true
@@ -2710,6 +3472,13 @@ func (s *DataStore) CountSoftware(ctx context.Context, opt fleet.SoftwareListOpt
 	return s.CountSoftwareFunc(ctx, opt)
 }
 
+func (s *DataStore) ListSoftwareTitles(ctx context.Context, opts fleet.ListOptions) ([]fleet.SoftwareTitle, error) {
+	s.mu.Lock()
+	s.ListSoftwareTitlesFuncInvoked = true
+	s.mu.Unlock()
+	return s.ListSoftwareTitlesFunc(ctx, opts)
+}
+
 func (s *DataStore) DeleteSoftwareVulnerabilities(ctx context.Context, vulnerabilities []fleet.SoftwareVulnerability) error {
 	s.mu.Lock()
 	s.DeleteSoftwareVulnerabilitiesFuncInvoked = true
@@ -2962,6 +3731,13 @@ func (s *DataStore) SaveHostAdditional(ctx context.Context, hostID uint, additio
 	return s.SaveHostAdditionalFunc(ctx, hostID, additional)
 }
 
+func (s *DataStore) SetAdditionalQueriesForHosts(ctx context.Context, hostIDs []uint, queries map[string]string) error {
+	s.mu.Lock()
+	s.SetAdditionalQueriesForHostsFuncInvoked = true
+	s.mu.Unlock()
+	return s.SetAdditionalQueriesForHostsFunc(ctx, hostIDs, queries)
+}
+
 func (s *DataStore) SetOrUpdateMunkiInfo(ctx context.Context, hostID uint, version string, errors []string, warnings []string) error {
 	s.mu.Lock()
 	s.SetOrUpdateMunkiInfoFuncInvoked = true
@@ -3053,11 +3829,39 @@ func (s *DataStore) VerifyEnrollSecret(ctx context.Context, secret string) (*fle
 	return s.VerifyEnrollSecretFunc(ctx, secret)
 }
 
-func (s *DataStore) EnrollHost(ctx context.Context, isMDMEnabled bool, osqueryHostId string, hardwareUUID string, hardwareSerial string, nodeKey string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
+func (s *DataStore) EnrollHost(ctx context.Context, isMDMEnabled bool, osqueryHostId string, hardwareUUID string, hardwareSerial string, nodeKey string, enrollSecret string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
 	s.mu.Lock()
 	s.EnrollHostFuncInvoked = true
 	s.mu.Unlock()
-	return s.EnrollHostFunc(ctx, isMDMEnabled, osqueryHostId, hardwareUUID, hardwareSerial, nodeKey, teamID, cooldown)
+	return s.EnrollHostFunc(ctx, isMDMEnabled, osqueryHostId, hardwareUUID, hardwareSerial, nodeKey, enrollSecret, teamID, cooldown)
+}
+
+func (s *DataStore) HostsByEnrollSecret(ctx context.Context, secret string, opt fleet.ListOptions) ([]fleet.Host, error) {
+	s.mu.Lock()
+	s.HostsByEnrollSecretFuncInvoked = true
+	s.mu.Unlock()
+	return s.HostsByEnrollSecretFunc(ctx, secret, opt)
+}
+
+func (s *DataStore) HostCountByEnrollSecret(ctx context.Context) (map[string]int, error) {
+	s.mu.Lock()
+	s.HostCountByEnrollSecretFuncInvoked = true
+	s.mu.Unlock()
+	return s.HostCountByEnrollSecretFunc(ctx)
+}
+
+func (s *DataStore) StaleHosts(ctx context.Context, since time.Time, opt fleet.StaleHostsOptions) ([]*fleet.Host, error) {
+	s.mu.Lock()
+	s.StaleHostsFuncInvoked = true
+	s.mu.Unlock()
+	return s.StaleHostsFunc(ctx, since, opt)
+}
+
+func (s *DataStore) DuplicateHostsBySerial(ctx context.Context) ([][]*fleet.Host, error) {
+	s.mu.Lock()
+	s.DuplicateHostsBySerialFuncInvoked = true
+	s.mu.Unlock()
+	return s.DuplicateHostsBySerialFunc(ctx)
 }
 
 func (s *DataStore) EnrollOrbit(ctx context.Context, isMDMEnabled bool, hostInfo fleet.OrbitHostInfo, orbitNodeKey string, teamID *uint) (*fleet.Host, error) {
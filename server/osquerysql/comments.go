@@ -0,0 +1,99 @@
+package osquerysql
+
+import "strings"
+
+// StripComments replaces each comment of the query with a space. The comment markers inside string literals and
+// quoted identifiers are part of them and are left alone.
+func StripComments(query string) string {
+	return scanComments(query, false)
+}
+
+// Normalize strips the comments of the query, collapses its whitespace and drops its trailing semicolons, so that
+// cosmetically different queries compare equal. String literals and quoted identifiers are left alone.
+func Normalize(query string) string {
+	return strings.TrimRight(scanComments(query, true), "; ")
+}
+
+// scanComments copies the query without its comments, also collapsing the whitespace outside of the string literals
+// and quoted identifiers if collapse is set. An unterminated comment or literal runs to the end of the query.
+func scanComments(query string, collapse bool) string {
+	var b strings.Builder
+	b.Grow(len(query))
+
+	// whitespace is only written before the next token, so that it's dropped at the start and end of the query
+	pendingSpace := false
+	space := func() {
+		if collapse {
+			pendingSpace = true
+			return
+		}
+		b.WriteByte(' ')
+	}
+	write := func(s string) {
+		if pendingSpace && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		pendingSpace = false
+		b.WriteString(s)
+	}
+
+	for i := 0; i < len(query); {
+		switch c := query[i]; {
+		case strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			i += end
+			space()
+		case strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += 2 + end + 2
+			}
+			space()
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			end := literalEnd(query, i)
+			write(query[i:end])
+			i = end
+		case collapse && isSpace(c):
+			pendingSpace = true
+			i++
+		default:
+			write(query[i : i+1])
+			i++
+		}
+	}
+	return b.String()
+}
+
+// literalEnd returns the index following the string literal or quoted identifier that starts at i. A doubled quote
+// is an escaped one, except for the bracket quoted identifiers which can't contain a closing bracket.
+func literalEnd(query string, i int) int {
+	closing := query[i]
+	if closing == '[' {
+		closing = ']'
+	}
+	for j := i + 1; ; {
+		k := strings.IndexByte(query[j:], closing)
+		if k < 0 {
+			return len(query)
+		}
+		j += k + 1
+		if closing != ']' && j < len(query) && query[j] == closing {
+			j++
+			continue
+		}
+		return j
+	}
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\r', '\v', '\f':
+		return true
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package osquerysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripComments(t *testing.T) {
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT 1 -- one\nFROM time", "SELECT 1  \nFROM time"},
+		{"SELECT /* all */ * FROM time", "SELECT   * FROM time"},
+		// comment markers inside literals and quoted identifiers
+		{"SELECT '--not a comment', \"/* nor */\" FROM time", "SELECT '--not a comment', \"/* nor */\" FROM time"},
+		{"SELECT 'it''s -- here' -- gone", "SELECT 'it''s -- here'  "},
+		{"SELECT `a--b`, [c/*d] FROM time /* gone", "SELECT `a--b`, [c/*d] FROM time  "},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, StripComments(c.query), c.query)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		query string
+		want  string
+	}{
+		{"select * from time;", "select * from time"},
+		{"  select *\n  from time -- current time\n", "select * from time"},
+		{"/* q */ SELECT * FROM   osquery_info; ;", "SELECT * FROM osquery_info"},
+		// literals are kept as is
+		{"SELECT * FROM file WHERE path = '/tmp/--x'", "SELECT * FROM file WHERE path = '/tmp/--x'"},
+		{"SELECT * FROM file WHERE path LIKE '/*  */%';", "SELECT * FROM file WHERE path LIKE '/*  */%'"},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, Normalize(c.query), c.query)
+	}
+}
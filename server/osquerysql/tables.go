@@ -0,0 +1,134 @@
+package osquerysql
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	stringRegex = regexp.MustCompile(`'(?:[^']|'')*'`)
+	tokenRegex  = regexp.MustCompile("\"(?:[^\"]|\"\")*\"|`[^`]*`|\\[[^\\]]*\\]|[A-Za-z_][A-Za-z0-9_$]*|[(),;.]")
+)
+
+// tableListEnd are the keywords that end the list of tables of a FROM clause.
+var tableListEnd = map[string]bool{
+	"where": true, "group": true, "order": true, "limit": true, "having": true, "window": true,
+	"union": true, "intersect": true, "except": true, "on": true, "using": true,
+	"join": true, "inner": true, "left": true, "right": true, "full": true, "cross": true, "natural": true,
+}
+
+// Tables returns the names of the tables the query reads from, lowercased and in order of appearance. The names of
+// common table expressions, subqueries and table-valued functions (e.g. json_each) are not tables and are left out.
+// The query is only scanned, not compiled, so the tables are returned even if they don't exist.
+func Tables(query string) []string {
+	query = StripComments(query)
+	query = stringRegex.ReplaceAllString(query, "''")
+	tokens := tokenRegex.FindAllString(query, -1)
+
+	lower := make([]string, len(tokens))
+	for i, token := range tokens {
+		lower[i] = strings.ToLower(token)
+	}
+
+	// the names of the common table expressions, as in "WITH name [(columns)] AS ("
+	ctes := make(map[string]bool)
+	for i := 1; i+1 < len(lower); i++ {
+		if lower[i] != "as" || lower[i+1] != "(" {
+			continue
+		}
+		j := i - 1
+		if lower[j] == ")" {
+			for j >= 0 && lower[j] != "(" {
+				j--
+			}
+			j--
+		}
+		if j >= 0 && isIdentifier(tokens[j]) {
+			ctes[unquoteIdentifier(lower[j])] = true
+		}
+	}
+
+	var tables []string
+	seen := make(map[string]bool)
+	add := func(i int) {
+		name := unquoteIdentifier(lower[i])
+		if ctes[name] || seen[name] {
+			return
+		}
+		seen[name] = true
+		tables = append(tables, name)
+	}
+
+	for i := 0; i < len(lower); i++ {
+		if lower[i] != "from" && lower[i] != "join" {
+			continue
+		}
+		// a comma separated list of tables, each with an optional alias
+		for j := i + 1; j < len(lower); {
+			if !isIdentifier(tokens[j]) || tableListEnd[lower[j]] {
+				break
+			}
+			// skip the schema of qualified names
+			if j+2 < len(lower) && lower[j+1] == "." && isIdentifier(tokens[j+2]) {
+				j += 2
+			}
+			// table-valued functions are called
+			if j+1 >= len(lower) || lower[j+1] != "(" {
+				add(j)
+			}
+			j = skipTableReference(lower, tokens, j+1)
+			if j >= len(lower) || lower[j] != "," {
+				break
+			}
+			j++
+		}
+	}
+	return tables
+}
+
+// skipTableReference skips the arguments and the alias of the table reference whose name ends before i, and returns
+// the index of the token that follows them.
+func skipTableReference(lower, tokens []string, i int) int {
+	if i < len(lower) && lower[i] == "(" {
+		depth := 0
+		for ; i < len(lower); i++ {
+			switch lower[i] {
+			case "(":
+				depth++
+			case ")":
+				depth--
+			}
+			if depth == 0 {
+				i++
+				break
+			}
+		}
+	}
+	if i < len(lower) && lower[i] == "as" {
+		i++
+	}
+	if i < len(lower) && isIdentifier(tokens[i]) && !tableListEnd[lower[i]] {
+		i++
+	}
+	return i
+}
+
+func isIdentifier(token string) bool {
+	switch token[0] {
+	case '"', '`', '[':
+		return true
+	case '(', ')', ',', ';', '.':
+		return false
+	}
+	return true
+}
+
+func unquoteIdentifier(token string) string {
+	switch token[0] {
+	case '"':
+		return strings.ReplaceAll(token[1:len(token)-1], `""`, `"`)
+	case '`', '[':
+		return token[1 : len(token)-1]
+	}
+	return token
+}
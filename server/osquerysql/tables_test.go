@@ -0,0 +1,40 @@
+package osquerysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTables(t *testing.T) {
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"SELECT 1", nil},
+		{"SELECT * FROM osquery_info;", []string{"osquery_info"}},
+		{"select * from Time, processes p where p.pid = 1", []string{"time", "processes"}},
+		{
+			"SELECT u.username FROM users u JOIN account_policy_data a USING (uid) LEFT JOIN groups AS g ON g.gid = u.gid",
+			[]string{"users", "account_policy_data", "groups"},
+		},
+		// common table expressions and subqueries
+		{
+			"WITH recent(pid) AS (SELECT pid FROM processes) SELECT * FROM recent JOIN process_open_sockets USING (pid)",
+			[]string{"processes", "process_open_sockets"},
+		},
+		{
+			"SELECT * FROM (SELECT * FROM users) WHERE uid IN (SELECT uid FROM logged_in_users)",
+			[]string{"users", "logged_in_users"},
+		},
+		// table-valued functions and quoted names
+		{`SELECT value FROM json_each('[1]'), "os_version"`, []string{"os_version"}},
+		// comments and strings are ignored, and each table is listed once
+		{"-- from comments\nSELECT 'from strings' FROM main.chrome_extensions /* from block */", []string{"chrome_extensions"}},
+		{"SELECT * FROM users UNION SELECT * FROM Users", []string{"users"}},
+		{"SELECT '--' AS dashes FROM users", []string{"users"}},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, Tables(c.query), c.query)
+	}
+}
@@ -0,0 +1,136 @@
+// Package osquerysql validates the SQL of osquery queries.
+package osquerysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/fleetdm/fleet/v4/schema"
+	sqlite3 "github.com/mattn/go-sqlite3"
+)
+
+// osquerySQLFunctions are the functions osquery adds to SQLite.
+// See https://osquery.readthedocs.io/en/stable/introduction/sql/#sqlite-extensions.
+var osquerySQLFunctions = []string{
+	// math
+	"sqrt", "log", "log10", "ceil", "floor", "power", "pi",
+	"sin", "cos", "tan", "cot", "asin", "acos", "atan", "radians", "degrees",
+	// strings
+	"split", "regex_split", "regex_match", "concat", "concat_ws", "inet_aton", "community_id_v1", "version_compare",
+	// hashing and encoding
+	"sha1", "sha256", "md5", "to_base64", "from_base64", "conditional_to_base64",
+}
+
+const driverName = "sqlite3_osquery"
+
+var (
+	// registerOnce registers the driver, which can only be done once per process.
+	registerOnce sync.Once
+	// mu guards db, which is only set once the schema database was opened successfully, so that a failure is retried
+	// by the next Validate.
+	mu sync.Mutex
+	db *sql.DB
+)
+
+type osqueryTable struct {
+	Name    string `json:"name"`
+	Columns []struct {
+		Name string `json:"name"`
+	} `json:"columns"`
+}
+
+// Validate returns an error if the query is not valid osquery SQL: if it's not valid SQLite SQL, or if it references
+// tables or columns that osquery doesn't have. The query is compiled, not run.
+func Validate(query string) error {
+	if strings.TrimSpace(query) == "" {
+		return errors.New("empty query")
+	}
+
+	schemaDB, err := getSchemaDB()
+	if err != nil {
+		return fmt.Errorf("load osquery schema: %w", err)
+	}
+
+	stmt, err := schemaDB.Prepare(query)
+	if err != nil {
+		return err
+	}
+	return stmt.Close()
+}
+
+// getSchemaDB returns the schema database, opening it on first use.
+func getSchemaDB() (*sql.DB, error) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if db != nil {
+		return db, nil
+	}
+	schemaDB, err := openSchemaDB()
+	if err != nil {
+		return nil, err
+	}
+	db = schemaDB
+	return db, nil
+}
+
+// osquerySQLFunctionStub stands for the osquery functions, only their name matters to compile queries. The return
+// type must be concrete, go-sqlite3 can't register functions returning interface{}.
+func osquerySQLFunctionStub(args ...interface{}) (string, error) {
+	return "", nil
+}
+
+// openSchemaDB opens an in-memory SQLite database with an empty table for each osquery table, where the queries can
+// be compiled.
+func openSchemaDB() (*sql.DB, error) {
+	var tables []osqueryTable
+	if err := json.Unmarshal(schema.OsqueryFleetSchemaJSON, &tables); err != nil {
+		return nil, fmt.Errorf("unmarshal schema: %w", err)
+	}
+
+	registerOnce.Do(func() {
+		sql.Register(driverName, &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				for _, name := range osquerySQLFunctions {
+					if err := conn.RegisterFunc(name, osquerySQLFunctionStub, true); err != nil {
+						return fmt.Errorf("register function %s: %w", name, err)
+					}
+				}
+				return nil
+			},
+		})
+	})
+
+	db, err := sql.Open(driverName, ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// every connection to :memory: is a distinct database
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetMaxIdleConns(1)
+
+	for _, table := range tables {
+		columns := make([]string, 0, len(table.Columns))
+		for _, column := range table.Columns {
+			columns = append(columns, quoteIdentifier(column.Name))
+		}
+		if len(columns) == 0 {
+			continue
+		}
+		stmt := fmt.Sprintf("CREATE TABLE %s (%s)", quoteIdentifier(table.Name), strings.Join(columns, ", "))
+		if _, err := db.Exec(stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("create table %s: %w", table.Name, err)
+		}
+	}
+	return db, nil
+}
+
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,37 @@
+package osquerysql
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	valid := []string{
+		"SELECT 1",
+		"SELECT * FROM osquery_info;",
+		"SELECT name, version FROM programs WHERE name LIKE '%chrome%'",
+		"SELECT u.username, a.creation_time FROM users u JOIN account_policy_data a USING (uid)",
+		"SELECT path, sha256 FROM hash WHERE path = '/etc/hosts'",
+		"SELECT regex_match(version, '^(\\d+)', 1) AS major FROM os_version",
+	}
+	for _, query := range valid {
+		require.NoError(t, Validate(query), query)
+	}
+
+	invalid := []string{
+		// syntax errors
+		"",
+		"SELEC * FROM osquery_info",
+		"SELECT * FROM osquery_info WHERE",
+		// unknown table
+		"SELECT * FROM no_such_table",
+		// unknown column
+		"SELECT no_such_column FROM osquery_info",
+		// unknown function
+		"SELECT no_such_function(1)",
+	}
+	for _, query := range invalid {
+		require.Error(t, Validate(query), query)
+	}
+}
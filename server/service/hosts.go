@@ -866,7 +866,7 @@ func processHostFilters(ctx context.Context, opt fleet.HostListOptions, lid *uin
 	}
 	filter := fleet.TeamFilter{User: vc.User, IncludeObserver: true}
 
-	if opt.StatusFilter != "" && lid != nil {
+	if (opt.StatusFilter != "" || len(opt.StatusesFilter) > 0) && lid != nil {
 		return fleet.TeamFilter{}, fleet.NewInvalidArgumentError("status", "may not be provided with label_id")
 	}
 
@@ -80,6 +80,8 @@ func (svc *Service) InviteNewUser(ctx context.Context, payload fleet.InvitePaylo
 		GlobalRole: payload.GlobalRole,
 		Teams:      payload.Teams,
 	}
+	expiresAt := svc.clock.Now().Add(svc.config.App.InviteTokenValidityPeriod)
+	invite.ExpiresAt = &expiresAt
 	if payload.Position != nil {
 		invite.Position = *payload.Position
 	}
@@ -309,6 +311,9 @@ func (svc *Service) VerifyInvite(ctx context.Context, token string) (*fleet.Invi
 	}
 
 	expiresAt := invite.CreatedAt.Add(svc.config.App.InviteTokenValidityPeriod)
+	if invite.ExpiresAt != nil {
+		expiresAt = *invite.ExpiresAt
+	}
 	if svc.clock.Now().After(expiresAt) {
 		return nil, fleet.NewInvalidArgumentError("invite_token", "Invite token has expired.")
 	}
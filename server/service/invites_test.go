@@ -30,12 +30,13 @@ func TestInviteNewUserMock(t *testing.T) {
 		return i, nil
 	}
 	mailer := &mockMailService{SendEmailFn: func(e fleet.Email) error { return nil }}
+	mockClock := clock.NewMockClock()
 
 	svc := validationMiddleware{&Service{
 		ds:          ms,
 		config:      config.TestConfig(),
 		mailService: mailer,
-		clock:       clock.NewMockClock(),
+		clock:       mockClock,
 		authz:       authz.Must(),
 	}, ms, nil}
 
@@ -47,6 +48,8 @@ func TestInviteNewUserMock(t *testing.T) {
 	invite, err := svc.InviteNewUser(test.UserContext(context.Background(), test.UserAdmin), payload)
 	require.Nil(t, err)
 	assert.Equal(t, test.UserAdmin.ID, invite.InvitedBy)
+	require.NotNil(t, invite.ExpiresAt)
+	assert.Equal(t, mockClock.Now().Add(config.TestConfig().App.InviteTokenValidityPeriod), *invite.ExpiresAt)
 	assert.True(t, ms.NewInviteFuncInvoked)
 	assert.True(t, ms.AppConfigFuncInvoked)
 	assert.True(t, mailer.Invoked)
@@ -160,7 +160,7 @@ func (svc *Service) EnrollAgent(ctx context.Context, enrollSecret, hostIdentifie
 		return "", newOsqueryErrorWithInvalidNode("app config load failed: " + err.Error())
 	}
 
-	host, err := svc.ds.EnrollHost(ctx, appConfig.MDM.EnabledAndConfigured, hostIdentifier, hardwareUUID, hardwareSerial, nodeKey, secret.TeamID, svc.config.Osquery.EnrollCooldown)
+	host, err := svc.ds.EnrollHost(ctx, appConfig.MDM.EnabledAndConfigured, hostIdentifier, hardwareUUID, hardwareSerial, nodeKey, enrollSecret, secret.TeamID, svc.config.Osquery.EnrollCooldown)
 	if err != nil {
 		return "", newOsqueryErrorWithInvalidNode("save enroll failed: " + err.Error())
 	}
@@ -641,13 +641,19 @@ func (svc *Service) detailQueriesForHost(ctx context.Context, host *fleet.Host)
 		}
 	}
 
-	if features.AdditionalQueries == nil {
+	// the additional queries set for the host replace the ones of the config
+	additional := features.AdditionalQueries
+	if host.AdditionalQueries != nil {
+		additional = host.AdditionalQueries
+	}
+
+	if additional == nil {
 		// No additional queries set
 		return queries, discovery, nil
 	}
 
 	var additionalQueries map[string]string
-	if err := json.Unmarshal(*features.AdditionalQueries, &additionalQueries); err != nil {
+	if err := json.Unmarshal(*additional, &additionalQueries); err != nil {
 		return nil, nil, ctxerr.Wrap(ctx, err, "unmarshal additional queries")
 	}
 
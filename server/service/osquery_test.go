@@ -213,7 +213,8 @@ func TestEnrollAgent(t *testing.T) {
 			return nil, errors.New("not found")
 		}
 	}
-	ds.EnrollHostFunc = func(ctx context.Context, isMDMEnabled bool, osqueryHostId, hUUID, hSerial, nodeKey string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
+	ds.EnrollHostFunc = func(ctx context.Context, isMDMEnabled bool, osqueryHostId, hUUID, hSerial, nodeKey, enrollSecret string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
+		assert.Equal(t, "valid_secret", enrollSecret)
 		assert.Equal(t, ptr.Uint(3), teamID)
 		return &fleet.Host{
 			OsqueryHostID: &osqueryHostId, NodeKey: &nodeKey,
@@ -244,7 +245,7 @@ func TestEnrollAgentEnforceLimit(t *testing.T) {
 				return nil, errors.New("not found")
 			}
 		}
-		ds.EnrollHostFunc = func(ctx context.Context, isMDMEnabled bool, osqueryHostId, hUUID, hSerial, nodeKey string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
+		ds.EnrollHostFunc = func(ctx context.Context, isMDMEnabled bool, osqueryHostId, hUUID, hSerial, nodeKey, enrollSecret string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
 			hostIDSeq++
 			return &fleet.Host{
 				ID: hostIDSeq, OsqueryHostID: &osqueryHostId, NodeKey: &nodeKey,
@@ -328,7 +329,7 @@ func TestEnrollAgentDetails(t *testing.T) {
 	ds.VerifyEnrollSecretFunc = func(ctx context.Context, secret string) (*fleet.EnrollSecret, error) {
 		return &fleet.EnrollSecret{}, nil
 	}
-	ds.EnrollHostFunc = func(ctx context.Context, isMDMEnabled bool, osqueryHostId, hUUID, hSerial, nodeKey string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
+	ds.EnrollHostFunc = func(ctx context.Context, isMDMEnabled bool, osqueryHostId, hUUID, hSerial, nodeKey, enrollSecret string, teamID *uint, cooldown time.Duration) (*fleet.Host, error) {
 		return &fleet.Host{
 			OsqueryHostID: &osqueryHostId, NodeKey: &nodeKey,
 		}, nil
@@ -581,6 +582,16 @@ func TestHostDetailQueries(t *testing.T) {
 	}
 	assert.Equal(t, "bam", queries[hostAdditionalQueryPrefix+"bim"])
 	assert.Equal(t, "select foo", queries[hostAdditionalQueryPrefix+"foobar"])
+
+	// the additional queries set for the host replace the ones of the config
+	hostAdditional := json.RawMessage(`{"time": "select * from time"}`)
+	host.AdditionalQueries = &hostAdditional
+	queries, discovery, err = svc.detailQueriesForHost(context.Background(), &host)
+	require.NoError(t, err)
+	require.Equal(t, len(expectedDetailQueriesForPlatform(host.Platform))+1, len(queries), distQueriesMapKeys(queries))
+	verifyDiscovery(t, queries, discovery)
+	assert.Equal(t, "select * from time", queries[hostAdditionalQueryPrefix+"time"])
+	assert.NotContains(t, queries, hostAdditionalQueryPrefix+"bim")
 }
 
 func TestQueriesAndHostFeatures(t *testing.T) {
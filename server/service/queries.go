@@ -431,7 +431,8 @@ func (svc *Service) DeleteQueries(ctx context.Context, ids []uint) (uint, error)
 		}
 	}
 
-	n, err := svc.ds.DeleteQueries(ctx, ids)
+	// the API deletes the scheduled queries along with their schedules
+	n, _, err := svc.ds.DeleteQueries(ctx, ids, fleet.WithForcedQueryDeletion())
 	if err != nil {
 		return n, err
 	}
@@ -100,14 +100,14 @@ func TestQueryAuth(t *testing.T) {
 		}
 		return &fleet.Query{ID: 8888, AuthorID: ptr.Uint(6666)}, nil
 	}
-	ds.SaveQueryFunc = func(ctx context.Context, query *fleet.Query) error {
+	ds.SaveQueryFunc = func(ctx context.Context, query *fleet.Query, opts ...fleet.OptionalArg) error {
 		return nil
 	}
 	ds.DeleteQueryFunc = func(ctx context.Context, name string) error {
 		return nil
 	}
-	ds.DeleteQueriesFunc = func(ctx context.Context, ids []uint) (uint, error) {
-		return 0, nil
+	ds.DeleteQueriesFunc = func(ctx context.Context, ids []uint, opts ...fleet.OptionalArg) (uint, []uint, error) {
+		return 0, nil, nil
 	}
 	ds.ListQueriesFunc = func(ctx context.Context, opts fleet.ListQueryOptions) ([]*fleet.Query, error) {
 		return nil, nil
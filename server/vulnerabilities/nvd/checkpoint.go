@@ -0,0 +1,130 @@
+package nvd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/log/level"
+)
+
+// cveMetaCheckpointBatchSize is the number of CVEs inserted between two checkpoints.
+const cveMetaCheckpointBatchSize = 500
+
+// cveMetaCheckpoint records the progress of the insertion of the CVE metadata by LoadCVEMeta, so that a failed load
+// can be resumed from the first batch that wasn't inserted.
+type cveMetaCheckpoint struct {
+	// Key identifies the feeds and the options of the load. A checkpoint with a different key is ignored.
+	Key string `json:"key"`
+	// CompletedBatches is the number of batches that were inserted, in CVE order.
+	CompletedBatches int `json:"completed_batches"`
+}
+
+// cveMetaCheckpointKey returns the identity of a load of the given feed files with the given options, based on the
+// checksums of the files, and of the metadata loaded from the additional CVE sources.
+func cveMetaCheckpointKey(files []string, sourcesMeta []fleet.CVEMeta, o loadCVEMetaOptions) (string, error) {
+	sorted := append([]string(nil), files...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "sources=%d incremental=%t subscores=%t last_modified=%t match_filter=%t skip_epss_only=%t batch=%d\n",
+		o.sources, o.incremental, o.subscores, o.lastModified, o.matchFilter, o.skipEPSSOnly, cveMetaCheckpointBatchSize)
+	for _, file := range sorted {
+		sum, err := sha256File(file)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(h, "%s %s\n", filepath.Base(file), sum)
+	}
+	if len(sourcesMeta) > 0 {
+		if err := json.NewEncoder(h).Encode(sourcesMeta); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readCVEMetaCheckpoint returns the number of completed batches recorded in the checkpoint at path, or 0 if there's no
+// checkpoint for the given key.
+func readCVEMetaCheckpoint(path, key string) (int, error) {
+	b, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+
+	var checkpoint cveMetaCheckpoint
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		// a corrupted checkpoint is ignored, the load starts from scratch
+		return 0, nil
+	}
+	if checkpoint.Key != key {
+		return 0, nil
+	}
+	return checkpoint.CompletedBatches, nil
+}
+
+// writeCVEMetaCheckpoint atomically replaces the checkpoint at path.
+func writeCVEMetaCheckpoint(path string, checkpoint cveMetaCheckpoint) error {
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// insertCVEMetaWithCheckpoint inserts the metadata in batches, recording each completed batch in the checkpoint at
+// path. The batches completed by a previous call with the same key are skipped.
+func insertCVEMetaWithCheckpoint(
+	ctx context.Context,
+	logger log.Logger,
+	insert func(context.Context, []fleet.CVEMeta) error,
+	meta []fleet.CVEMeta,
+	path, key string,
+) error {
+	completed, err := readCVEMetaCheckpoint(path, key)
+	if err != nil {
+		return fmt.Errorf("read checkpoint: %w", err)
+	}
+
+	// the batches must be the same from one run to the next
+	sort.Slice(meta, func(i, j int) bool { return meta[i].CVE < meta[j].CVE })
+
+	if completed > 0 {
+		level.Info(logger).Log("msg", "resuming cve meta load from checkpoint", "completed_batches", completed)
+	}
+
+	for batch := 0; batch*cveMetaCheckpointBatchSize < len(meta); batch++ {
+		if batch < completed {
+			continue
+		}
+
+		start := batch * cveMetaCheckpointBatchSize
+		end := start + cveMetaCheckpointBatchSize
+		if end > len(meta) {
+			end = len(meta)
+		}
+		if err := insert(ctx, meta[start:end]); err != nil {
+			return err
+		}
+
+		if err := writeCVEMetaCheckpoint(path, cveMetaCheckpoint{Key: key, CompletedBatches: batch + 1}); err != nil {
+			return fmt.Errorf("write checkpoint: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package nvd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fleetdm/fleet/v4/server/contexts/license"
+	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/fleetdm/fleet/v4/server/mock"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCVEMetaCheckpoint(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	vulnPath := t.TempDir()
+	for _, name := range []string{"nvdcve-1.1-recent.json.gz", "epss_scores-current.csv", cisaKnownExploitsFilename} {
+		b, err := os.ReadFile(filepath.Join("../testdata", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(vulnPath, name), b, 0o644))
+	}
+	checkpointPath := filepath.Join(t.TempDir(), "cve_meta.checkpoint")
+
+	// failAt is the index of the insert call that fails, -1 to never fail
+	var batches [][]fleet.CVEMeta
+	load := func(failAt int) error {
+		batches = nil
+		ds := new(mock.Store)
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			if len(batches) == failAt {
+				return errors.New("insert failed")
+			}
+			batches = append(batches, x)
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+			return nil
+		}
+		return LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithCheckpoint(checkpointPath))
+	}
+	countCVEs := func() int {
+		var n int
+		for _, b := range batches {
+			n += len(b)
+		}
+		return n
+	}
+
+	// a complete load, for reference
+	require.NoError(t, load(-1))
+	require.Greater(t, len(batches), 3)
+	allBatches := batches
+	total := countCVEs()
+	require.NoFileExists(t, checkpointPath)
+
+	// fails after two batches were inserted
+	require.Error(t, load(2))
+	require.Len(t, batches, 2)
+	require.FileExists(t, checkpointPath)
+
+	// the retry resumes from the third batch
+	require.NoError(t, load(-1))
+	require.Equal(t, allBatches[2:], batches)
+	require.Equal(t, total-len(allBatches[0])-len(allBatches[1]), countCVEs())
+	require.NoFileExists(t, checkpointPath)
+
+	// the checkpoint is discarded if the feeds changed
+	require.Error(t, load(2))
+	f, err := os.OpenFile(filepath.Join(vulnPath, "epss_scores-current.csv"), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString("CVE-2099-0001,0.00100,0.10000\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	require.NoError(t, load(-1))
+	require.Equal(t, total+1, countCVEs())
+	require.Equal(t, allBatches[0][0].CVE, batches[0][0].CVE)
+}
+
+func TestCVEMetaCheckpointKeyOptions(t *testing.T) {
+	file := filepath.Join("..", "testdata", "nvdcve-1.1-recent.json.gz")
+	key := func(o loadCVEMetaOptions) string {
+		k, err := cveMetaCheckpointKey([]string{file}, nil, o)
+		require.NoError(t, err)
+		return k
+	}
+
+	// the options that change the batches change the key
+	base := key(loadCVEMetaOptions{})
+	require.Equal(t, base, key(loadCVEMetaOptions{}))
+	require.NotEqual(t, base, key(loadCVEMetaOptions{skipEPSSOnly: true}))
+}
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -32,7 +33,11 @@ const (
 var cpeDBRegex = regexp.MustCompile(`^cpe-.*\.sqlite\.gz$`)
 
 func GetLatestGithubNVDRelease() (*github.RepositoryRelease, error) {
-	githubClient := github.NewClient(fleethttp.NewGithubClient())
+	return getLatestGithubNVDRelease(fleethttp.NewGithubClient())
+}
+
+func getLatestGithubNVDRelease(client *http.Client) (*github.RepositoryRelease, error) {
+	githubClient := github.NewClient(client)
 	releases, _, err := githubClient.Repositories.ListReleases(
 		context.Background(), owner, repo, &github.ListOptions{Page: 0, PerPage: 10},
 	)
@@ -52,11 +57,22 @@ func GetLatestGithubNVDRelease() (*github.RepositoryRelease, error) {
 
 // DownloadCPEDB downloads the CPE database to the given vulnPath. If cpeDBURL is empty, attempts to download it
 // from the latest release of github.com/fleetdm/nvd. Skips downloading if CPE database is newer than the release.
-func DownloadCPEDBFromGithub(vulnPath string, cpeDBURL string) error {
+//
+// The database is downloaded to a temporary file that only replaces the current database once it's verified, so the
+// current database is left untouched if the download fails and it is safe to retry.
+func DownloadCPEDBFromGithub(vulnPath string, cpeDBURL string, opts ...DownloadOption) error {
+	o := newDownloadOptions(opts)
+	if err := validateMinTLSVersion(o); err != nil {
+		return err
+	}
 	path := filepath.Join(vulnPath, cpeDBFilename)
 
-	if cpeDBURL == "" {
-		release, err := GetLatestGithubNVDRelease()
+	if cpeDBURL != "" {
+		if _, err := o.urlPolicy.Validate(cpeDBURL); err != nil {
+			return err
+		}
+	} else {
+		release, err := getLatestGithubNVDRelease(feedClient(fleethttp.NewGithubClient(), o))
 		if err != nil {
 			return err
 		}
@@ -89,12 +105,25 @@ func DownloadCPEDBFromGithub(vulnPath string, cpeDBURL string) error {
 		return err
 	}
 
-	githubClient := fleethttp.NewGithubClient()
-	if err := download.DownloadAndExtract(githubClient, u, path); err != nil {
+	if err := os.MkdirAll(vulnPath, 0o755); err != nil {
 		return err
 	}
+	tmp, err := os.CreateTemp(vulnPath, cpeDBFilename+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name()) // no-op once renamed
 
-	return nil
+	githubClient := feedClient(fleethttp.NewGithubClient(), o)
+	if err := download.DownloadAndExtract(githubClient, u, tmp.Name(), o.fileOptions()...); err != nil {
+		return err
+	}
+	if err := verifyCPEDB(tmp.Name()); err != nil {
+		return fmt.Errorf("verify downloaded cpe database: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
 }
 
 func cpeGeneralSearchQuery(software *fleet.Software) (string, []interface{}, error) {
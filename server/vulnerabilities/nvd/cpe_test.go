@@ -1,6 +1,7 @@
 package nvd
 
 import (
+	"bytes"
 	"compress/gzip"
 	"context"
 	"io/ioutil"
@@ -290,24 +291,62 @@ func TestTranslateSoftwareToCPE(t *testing.T) {
 }
 
 func TestSyncsCPEFromURL(t *testing.T) {
-	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		zw := gzip.NewWriter(w)
+	items, err := cpedict.Decode(strings.NewReader(XmlCPETestDict))
+	require.NoError(t, err)
+	generatedPath := filepath.Join(t.TempDir(), "generated.sqlite")
+	require.NoError(t, GenerateCPEDB(generatedPath, items))
+	generated, err := ioutil.ReadFile(generatedPath)
+	require.NoError(t, err)
 
-		_, err := zw.Write([]byte("Hello world!"))
+	gzipped := func(b []byte) []byte {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write(b)
 		require.NoError(t, err)
-		err = zw.Close()
+		require.NoError(t, zw.Close())
+		return buf.Bytes()
+	}
+
+	var body []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := w.Write(body)
 		require.NoError(t, err)
 	}))
 	defer ts.Close()
 
 	tempDir := t.TempDir()
-	err := DownloadCPEDBFromGithub(tempDir, ts.URL+"/hello-world.gz")
-	require.NoError(t, err)
-
 	dbPath := filepath.Join(tempDir, "cpe.sqlite")
+	syncDB := func() error {
+		return DownloadCPEDBFromGithub(tempDir, ts.URL+"/cpe.sqlite.gz", WithURLPolicy(URLPolicy{AllowHTTP: true}))
+	}
+
+	valid := gzipped(generated)
+	body = valid
+	require.NoError(t, syncDB())
 	stored, err := ioutil.ReadFile(dbPath)
 	require.NoError(t, err)
-	assert.Equal(t, "Hello world!", string(stored))
+	assert.Equal(t, generated, stored)
+
+	// a failed or invalid download keeps the previous database
+	for name, failing := range map[string][]byte{
+		"truncated download": valid[:len(valid)/2],
+		"not a database":     gzipped([]byte("Hello world!")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			body = failing
+			require.Error(t, syncDB())
+
+			stored, err := ioutil.ReadFile(dbPath)
+			require.NoError(t, err)
+			assert.Equal(t, generated, stored)
+			require.NoError(t, verifyCPEDB(dbPath))
+
+			// the temporary files are cleaned up
+			entries, err := os.ReadDir(tempDir)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+		})
+	}
 }
 
 func TestLegacyCPEDB(t *testing.T) {
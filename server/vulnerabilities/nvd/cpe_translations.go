@@ -33,11 +33,19 @@ func loadCPETranslations(path string) (CPETranslations, error) {
 
 // DownloadCPETranslationsFromGithub downloads the CPE translations to the given vulnPath. If cpeTranslationsURL is empty, attempts to download it
 // from the latest release of github.com/fleetdm/nvd. Skips downloading if CPE translations is newer than the release.
-func DownloadCPETranslationsFromGithub(vulnPath string, cpeTranslationsURL string) error {
+func DownloadCPETranslationsFromGithub(vulnPath string, cpeTranslationsURL string, opts ...DownloadOption) error {
+	o := newDownloadOptions(opts)
+	if err := validateMinTLSVersion(o); err != nil {
+		return err
+	}
 	path := filepath.Join(vulnPath, cpeTranslationsFilename)
 
-	if cpeTranslationsURL == "" {
-		release, err := GetLatestGithubNVDRelease()
+	if cpeTranslationsURL != "" {
+		if _, err := o.urlPolicy.Validate(cpeTranslationsURL); err != nil {
+			return err
+		}
+	} else {
+		release, err := getLatestGithubNVDRelease(feedClient(fleethttp.NewGithubClient(), o))
 		if err != nil {
 			return err
 		}
@@ -69,8 +77,8 @@ func DownloadCPETranslationsFromGithub(vulnPath string, cpeTranslationsURL strin
 	if err != nil {
 		return err
 	}
-	client := fleethttp.NewGithubClient()
-	if err := download.Download(client, u, path); err != nil {
+	client := feedClient(fleethttp.NewGithubClient(), o)
+	if err := download.Download(client, u, path, o.fileOptions()...); err != nil {
 		return err
 	}
 
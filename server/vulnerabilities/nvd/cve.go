@@ -1,32 +1,70 @@
 package nvd
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/facebookincubator/nvdtools/cvefeed"
 	"github.com/facebookincubator/nvdtools/providers/nvd"
 	"github.com/facebookincubator/nvdtools/wfn"
+	"github.com/fleetdm/fleet/v4/pkg/download"
+	"github.com/fleetdm/fleet/v4/pkg/fleethttp"
+	"github.com/fleetdm/fleet/v4/server/contexts/ctxerr"
 	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/fleetdm/fleet/v4/server/vulnerabilities/oval"
+	"github.com/fleetdm/fleet/v4/server/vulnerabilities/utils"
 	kitlog "github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
 )
 
 // DownloadNVDCVEFeed downloads the NVD CVE feed. Skips downloading if the cve feed has not changed since the last time.
-func DownloadNVDCVEFeed(vulnPath string, cveFeedPrefixURL string) error {
+// If cveFeedPrefixURL is a file URL, or the minimum TLS version is later than TLS 1.2, all the yearly feeds are
+// downloaded instead.
+func DownloadNVDCVEFeed(vulnPath string, cveFeedPrefixURL string, opts ...DownloadOption) error {
+	o := newDownloadOptions(opts)
+	if err := validateMinTLSVersion(o); err != nil {
+		return err
+	}
+
+	if len(o.nvdYears) > 0 {
+		return downloadNVDCVEYearlyFeeds(vulnPath, cveFeedPrefixURL, o)
+	}
+
+	// The nvdtools provider only supports http, its client only requires Go's default minimum TLS version (TLS 1.2)
+	// and it doesn't verify signatures. The yearly feeds of a local directory, that require a later TLS version or
+	// that must be signed, are all downloaded instead.
+	if strings.HasPrefix(cveFeedPrefixURL, "file:") || o.minTLSVersion > tls.VersionTLS12 || o.signatureKey != nil {
+		for year := firstNVDFeedYear; year <= time.Now().Year(); year++ {
+			o.nvdYears = append(o.nvdYears, year)
+		}
+		return downloadNVDCVEYearlyFeeds(vulnPath, cveFeedPrefixURL, o)
+	}
+
+	// the nvdtools provider uses its own http client, which can only be configured globally
+	if err := nvd.SetUserAgent(o.userAgent); err != nil {
+		return fmt.Errorf("set user agent: %w", err)
+	}
+
 	cve := nvd.SupportedCVE["cve-1.1.json.gz"]
 
 	source := nvd.NewSourceConfig()
 	if cveFeedPrefixURL != "" {
-		parsed, err := url.Parse(cveFeedPrefixURL)
+		parsed, err := o.urlPolicy.Validate(cveFeedPrefixURL)
 		if err != nil {
 			return fmt.Errorf("parsing cve feed url prefix override: %w", err)
 		}
@@ -56,10 +94,119 @@ func DownloadNVDCVEFeed(vulnPath string, cveFeedPrefixURL string) error {
 	return nil
 }
 
-const publishedDateFmt = "2006-01-02T15:04Z" // not quite RFC3339
+// nvdCVEFeedsURL is the default location of the NVD CVE feeds.
+const nvdCVEFeedsURL = "https://nvd.nist.gov/feeds/json/cve/1.1/"
+
+// downloadNVDCVEYearlyFeeds downloads the yearly NVD CVE feeds of the years set in the options, along with their meta
+// files. Unlike the full sync, the feeds are always downloaded.
+func downloadNVDCVEYearlyFeeds(vulnPath string, cveFeedPrefixURL string, o downloadOptions) error {
+	baseURL := nvdCVEFeedsURL
+	if cveFeedPrefixURL != "" {
+		if _, err := o.urlPolicy.Validate(cveFeedPrefixURL); err != nil {
+			return fmt.Errorf("parsing cve feed url prefix override: %w", err)
+		}
+		baseURL = cveFeedPrefixURL
+	}
+
+	currentYear := time.Now().Year()
+	for _, year := range o.nvdYears {
+		if year < firstNVDFeedYear || year > currentYear {
+			return fmt.Errorf("invalid nvd cve feed year: %d", year)
+		}
+	}
+
+	client := feedClient(fleethttp.NewClient(), o)
+	for _, year := range o.nvdYears {
+		metaPath := filepath.Join(vulnPath, fmt.Sprintf("nvdcve-1.1-%d.meta", year))
+		dataPath := filepath.Join(vulnPath, fmt.Sprintf("nvdcve-1.1-%d.json.gz", year))
 
-var rxNVDCVEArchive = regexp.MustCompile(`nvdcve.*\.gz$`)
+		// the meta file is written last, so that an interrupted download is detected by the next full sync
+		for _, path := range []string{dataPath, metaPath} {
+			u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/" + filepath.Base(path))
+			if err != nil {
+				return fmt.Errorf("parse url: %w", err)
+			}
+			// the meta file is checked against the signed feed
+			var dlOpts []download.Option
+			if path == dataPath {
+				dlOpts = o.fileOptions()
+			}
+			if err := download.Download(client, u, path, dlOpts...); err != nil {
+				return fmt.Errorf("download %s: %w", u, err)
+			}
+		}
+
+		if err := verifyNVDCVEFeed(dataPath, metaPath); err != nil {
+			return fmt.Errorf("verify %s: %w", filepath.Base(dataPath), err)
+		}
+	}
+
+	return nil
+}
+
+// verifyNVDCVEFeed checks the decompressed content of the feed at dataPath against the SHA-256 checksum listed in its
+// meta file.
+func verifyNVDCVEFeed(dataPath, metaPath string) error {
+	meta, err := os.ReadFile(metaPath)
+	if err != nil {
+		return err
+	}
+	var expected string
+	for _, line := range strings.Split(string(meta), "\n") {
+		if line = strings.TrimSpace(line); strings.HasPrefix(line, "sha256:") {
+			expected = strings.TrimPrefix(line, "sha256:")
+		}
+	}
+	if expected == "" {
+		return errors.New("missing sha256 in meta file")
+	}
+
+	f, err := os.Open(dataPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
 
+	h := sha256.New()
+	if _, err := io.Copy(h, gr); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch: want %s, have %s", expected, actual)
+	}
+	return nil
+}
+
+// nvdDateFormats are the date layouts NVD has been seen to use in its feeds. They are tried in order, so the most
+// common layout should come first.
+var nvdDateFormats = []string{
+	"2006-01-02T15:04Z", // not quite RFC3339
+	time.RFC3339,
+	"2006-01-02T15:04:05.000",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// parseNVDDate parses s using the first matching layout in nvdDateFormats.
+func parseNVDDate(s string) (time.Time, error) {
+	for _, layout := range nvdDateFormats {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized nvd date format: %q", s)
+}
+
+// rxNVDCVEFeed matches the NVD CVE feed files, either compressed or not.
+var rxNVDCVEFeed = regexp.MustCompile(`nvdcve.*\.json(\.gz)?$`)
+
+// getNVDCVEFeedFiles returns the NVD CVE feed files found in vulnPath. When a feed is present both compressed and
+// decompressed, only the compressed file is returned so that its CVEs are not loaded twice.
 func getNVDCVEFeedFiles(vulnPath string) ([]string, error) {
 	var files []string
 
@@ -72,7 +219,7 @@ func getNVDCVEFeedFiles(vulnPath string) ([]string, error) {
 			return nil
 		}
 
-		if match := rxNVDCVEArchive.MatchString(path); !match {
+		if match := rxNVDCVEFeed.MatchString(path); !match {
 			return nil
 		}
 
@@ -83,7 +230,63 @@ func getNVDCVEFeedFiles(vulnPath string) ([]string, error) {
 		return nil, err
 	}
 
-	return files, nil
+	compressed := make(map[string]bool)
+	for _, file := range files {
+		if strings.HasSuffix(file, ".gz") {
+			compressed[strings.TrimSuffix(file, ".gz")] = true
+		}
+	}
+	result := files[:0]
+	for _, file := range files {
+		if !compressed[file] {
+			result = append(result, file)
+		}
+	}
+
+	return result, nil
+}
+
+// loadNVDCVEFeed parses the NVD CVE feed file at path. Gzip compressed files are decompressed while being read, so
+// that only the compressed form needs to be stored on disk.
+func loadNVDCVEFeed(path string) (cvefeed.Dictionary, error) {
+	var vulns []cvefeed.Vuln
+	if err := readNVDCVEFeed(path, func(r io.Reader) error {
+		var err error
+		vulns, err = cvefeed.ParseJSON(r)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	dict := make(cvefeed.Dictionary, len(vulns))
+	for _, vuln := range vulns {
+		dict[vuln.ID()] = vuln
+	}
+	return dict, nil
+}
+
+// readNVDCVEFeed calls parse with the content of the NVD CVE feed file at path, decompressed if needed.
+func readNVDCVEFeed(path string, parse func(r io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("gzip reader %s: %w", path, err)
+		}
+		defer gr.Close()
+		r = gr
+	}
+
+	if err := parse(r); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
 }
 
 type softwareCPEWithNVDMeta struct {
@@ -114,6 +317,39 @@ func TranslateCPEToCVE(
 		return nil, err
 	}
 
+	vulns, err := matchCPEsToCVEs(ctx, ds, logger, CPEs, files, collectVulns)
+	if err != nil {
+		return nil, err
+	}
+
+	var newVulns []fleet.SoftwareVulnerability
+	for _, vuln := range vulns {
+		newCount, err := ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{vuln}, fleet.NVDSource)
+		if err != nil {
+			level.Error(logger).Log("cpe processing", "error", "err", err)
+			continue
+		}
+
+		// collect vuln only if newCount > 0, otherwise we would send
+		// webhook requests for the same vulnerability over and over again until
+		// it is older than 2 days.
+		if collectVulns && newCount > 0 {
+			newVulns = append(newVulns, vuln)
+		}
+	}
+
+	return newVulns, nil
+}
+
+// matchCPEsToCVEs returns the vulnerabilities of the given software CPEs found in the NVD feed files, by key.
+func matchCPEsToCVEs(
+	ctx context.Context,
+	ds fleet.Datastore,
+	logger kitlog.Logger,
+	CPEs []fleet.SoftwareCPE,
+	files []string,
+	collectVulns bool,
+) (map[string]fleet.SoftwareVulnerability, error) {
 	var parsed []softwareCPEWithNVDMeta
 	for _, CPE := range CPEs {
 		attr, err := wfn.Parse(CPE.CPE)
@@ -144,24 +380,109 @@ func TranslateCPEToCVE(
 			vulns[e.Key()] = e
 		}
 	}
+	return vulns, nil
+}
 
-	var newVulns []fleet.SoftwareVulnerability
-	for _, vuln := range vulns {
-		newCount, err := ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{vuln}, fleet.NVDSource)
+// RecomputeHostVulnerabilities re-runs the NVD matching of the software installed on the host only, e.g. to update
+// its vulnerabilities right after a patch was installed rather than on the next vulnerabilities scan. The software of
+// the host without a CPE are translated first, as TranslateSoftwareToCPE does, then the NVD vulnerabilities of the
+// host's software are replaced by those found in the feeds, as TranslateCPEToCVE does. Both use the CPE database and
+// NVD feeds previously downloaded to vulnPath.
+func RecomputeHostVulnerabilities(
+	ctx context.Context,
+	ds fleet.Datastore,
+	vulnPath string,
+	logger kitlog.Logger,
+	hostID uint,
+) error {
+	files, err := getNVDCVEFeedFiles(vulnPath)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		// without feeds, all the vulnerabilities of the host would look patched
+		return errors.New("no nvd cve feed found")
+	}
+
+	software, err := ds.ListSoftwareByHostIDShort(ctx, hostID)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "list host software")
+	}
+	CPEs, err := ds.ListHostSoftwareCPEs(ctx, hostID)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "list host software cpes")
+	}
+
+	withCPE := make(map[uint]bool, len(CPEs))
+	for _, CPE := range CPEs {
+		withCPE[CPE.SoftwareID] = true
+	}
+	// software from sources for which OVAL is used for vulnerability detection are skipped
+	ovalSources := make(map[string]bool, len(oval.SupportedSoftwareSources))
+	for _, source := range oval.SupportedSoftwareSources {
+		ovalSources[source] = true
+	}
+	var withoutCPE []fleet.Software
+	for _, s := range software {
+		if !withCPE[s.ID] && !ovalSources[s.Source] {
+			withoutCPE = append(withoutCPE, s)
+		}
+	}
+
+	if len(withoutCPE) > 0 {
+		db, err := sqliteDB(filepath.Join(vulnPath, cpeDBFilename))
 		if err != nil {
-			level.Error(logger).Log("cpe processing", "error", "err", err)
-			continue
+			return ctxerr.Wrap(ctx, err, "opening the cpe db")
 		}
+		defer db.Close()
 
-		// collect vuln only if newCount > 0, otherwise we would send
-		// webhook requests for the same vulnerability over and over again until
-		// it is older than 2 days.
-		if collectVulns && newCount > 0 {
-			newVulns = append(newVulns, vuln)
+		cpeTranslations, err := loadCPETranslations(filepath.Join(vulnPath, cpeTranslationsFilename))
+		if err != nil {
+			level.Error(logger).Log("msg", "failed to load cpe translations", "err", err)
+		}
+		reCache := newRegexpCache()
+
+		for i := range withoutCPE {
+			s := &withoutCPE[i]
+			cpe, err := CPEFromSoftware(db, s, cpeTranslations, reCache)
+			if err != nil {
+				level.Error(logger).Log("software->cpe", "error translating to CPE, skipping...", "err", err)
+				continue
+			}
+			if cpe == "" {
+				continue
+			}
+			if err := ds.AddCPEForSoftware(ctx, *s, cpe); err != nil {
+				return ctxerr.Wrap(ctx, err, "inserting cpe")
+			}
+			CPEs = append(CPEs, fleet.SoftwareCPE{SoftwareID: s.ID, CPE: cpe})
 		}
 	}
 
-	return newVulns, nil
+	vulns, err := matchCPEsToCVEs(ctx, ds, logger, CPEs, files, false)
+	if err != nil {
+		return err
+	}
+	found := make([]fleet.SoftwareVulnerability, 0, len(vulns))
+	for _, vuln := range vulns {
+		found = append(found, vuln)
+	}
+
+	existing, err := ds.ListSoftwareVulnerabilitiesByHostIDsSource(ctx, []uint{hostID}, fleet.NVDSource)
+	if err != nil {
+		return ctxerr.Wrap(ctx, err, "list host software vulnerabilities")
+	}
+
+	toInsert, toDelete := utils.VulnsDelta(found, existing[hostID])
+	if err := ds.DeleteSoftwareVulnerabilities(ctx, toDelete); err != nil {
+		return ctxerr.Wrap(ctx, err, "delete host software vulnerabilities")
+	}
+	if len(toInsert) > 0 {
+		if _, err := ds.InsertSoftwareVulnerabilities(ctx, toInsert, fleet.NVDSource); err != nil {
+			return ctxerr.Wrap(ctx, err, "insert host software vulnerabilities")
+		}
+	}
+	return nil
 }
 
 func checkCVEs(
@@ -172,7 +493,7 @@ func checkCVEs(
 	file string,
 	collectVulns bool,
 ) ([]fleet.SoftwareVulnerability, error) {
-	dict, err := cvefeed.LoadJSONDictionary(file)
+	dict, err := loadNVDCVEFeed(file)
 	if err != nil {
 		return nil, err
 	}
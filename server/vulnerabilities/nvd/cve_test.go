@@ -1,19 +1,28 @@
 package nvd
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/facebookincubator/nvdtools/cpedict"
 	"github.com/fleetdm/fleet/v4/pkg/nettest"
+	"github.com/fleetdm/fleet/v4/server/datastore/mysql"
 	"github.com/fleetdm/fleet/v4/server/fleet"
 	"github.com/fleetdm/fleet/v4/server/mock"
+	"github.com/fleetdm/fleet/v4/server/test"
 	kitlog "github.com/go-kit/kit/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -272,6 +281,88 @@ func TestTranslateCPEToCVE(t *testing.T) {
 	})
 }
 
+func TestRecomputeHostVulnerabilities(t *testing.T) {
+	ds := mysql.CreateMySQLDS(t)
+	ctx := context.Background()
+	vulnPath := t.TempDir()
+
+	// 1.2.3 is vulnerable to CVE-2022-0001, which is fixed in 1.2.4
+	items, err := cpedict.Decode(strings.NewReader(`<?xml version='1.0' encoding='UTF-8'?>
+<cpe-list xmlns="http://cpe.mitre.org/dictionary/2.0" xmlns:cpe-23="http://scap.nist.gov/schema/cpe-extension/2.3">
+  <cpe-item name="cpe:/a:vendor:product-1:1.2.3:~~~macos~~">
+    <title xml:lang="en-US">Vendor Product-1 1.2.3 for MacOS</title>
+    <cpe-23:cpe23-item name="cpe:2.3:a:vendor:product-1:1.2.3:*:*:*:*:macos:*:*"/>
+  </cpe-item>
+  <cpe-item name="cpe:/a:vendor:product-1:1.2.4:~~~macos~~">
+    <title xml:lang="en-US">Vendor Product-1 1.2.4 for MacOS</title>
+    <cpe-23:cpe23-item name="cpe:2.3:a:vendor:product-1:1.2.4:*:*:*:*:macos:*:*"/>
+  </cpe-item>
+</cpe-list>`))
+	require.NoError(t, err)
+	require.NoError(t, GenerateCPEDB(filepath.Join(vulnPath, cpeDBFilename), items))
+	require.NoError(t, os.WriteFile(filepath.Join(vulnPath, "nvdcve-1.1-2022.json"), []byte(`{"CVE_Items": [
+		{
+			"cve": {"CVE_data_meta": {"ID": "CVE-2022-0001"}},
+			"configurations": {"nodes": [{"operator": "OR", "cpe_match": [
+				{"vulnerable": true, "cpe23Uri": "cpe:2.3:a:vendor:product-1:*:*:*:*:*:*:*:*", "versionEndExcluding": "1.2.4"}
+			]}]},
+			"impact": {},
+			"publishedDate": "2022-01-01T00:00Z"
+		}
+	]}`), 0o644))
+
+	host := test.NewHost(t, ds, "host", "", "hostkey", "hostuuid", time.Now())
+	other := test.NewHost(t, ds, "other", "", "otherkey", "otheruuid", time.Now())
+
+	hostVulns := func(hostID uint) []string {
+		vulns, err := ds.ListSoftwareVulnerabilitiesByHostIDsSource(ctx, []uint{hostID}, fleet.NVDSource)
+		require.NoError(t, err)
+		var cves []string
+		for _, v := range vulns[hostID] {
+			cves = append(cves, v.CVE)
+		}
+		return cves
+	}
+
+	vulnerable := fleet.Software{Name: "Vendor Product-1.app", Version: "1.2.3", BundleIdentifier: "vendor", Source: "apps"}
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{vulnerable}))
+	require.NoError(t, ds.UpdateHostSoftware(ctx, other.ID, []fleet.Software{vulnerable}))
+
+	require.NoError(t, RecomputeHostVulnerabilities(ctx, ds, vulnPath, kitlog.NewNopLogger(), host.ID))
+	require.Equal(t, []string{"CVE-2022-0001"}, hostVulns(host.ID))
+	cpes, err := ds.ListHostSoftwareCPEs(ctx, host.ID)
+	require.NoError(t, err)
+	require.Len(t, cpes, 1)
+	require.Equal(t, "cpe:2.3:a:vendor:product-1:1.2.3:*:*:*:*:macos:*:*", cpes[0].CPE)
+
+	// the vulnerabilities that are no longer found are removed
+	_, err = ds.InsertSoftwareVulnerabilities(ctx, []fleet.SoftwareVulnerability{
+		{SoftwareID: cpes[0].SoftwareID, CVE: "CVE-2022-9999"},
+	}, fleet.NVDSource)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"CVE-2022-0001", "CVE-2022-9999"}, hostVulns(host.ID))
+	require.NoError(t, RecomputeHostVulnerabilities(ctx, ds, vulnPath, kitlog.NewNopLogger(), host.ID))
+	require.Equal(t, []string{"CVE-2022-0001"}, hostVulns(host.ID))
+
+	// the host is patched
+	patched := vulnerable
+	patched.Version = "1.2.4"
+	require.NoError(t, ds.UpdateHostSoftware(ctx, host.ID, []fleet.Software{patched}))
+	require.NoError(t, RecomputeHostVulnerabilities(ctx, ds, vulnPath, kitlog.NewNopLogger(), host.ID))
+	require.Empty(t, hostVulns(host.ID))
+	cpes, err = ds.ListHostSoftwareCPEs(ctx, host.ID)
+	require.NoError(t, err)
+	require.Len(t, cpes, 1)
+	require.Equal(t, "cpe:2.3:a:vendor:product-1:1.2.4:*:*:*:*:macos:*:*", cpes[0].CPE)
+
+	// the other host still has the vulnerable version
+	require.Equal(t, []string{"CVE-2022-0001"}, hostVulns(other.ID))
+
+	// without feeds, the vulnerabilities are left untouched
+	require.Error(t, RecomputeHostVulnerabilities(ctx, ds, t.TempDir(), kitlog.NewNopLogger(), other.ID))
+	require.Equal(t, []string{"CVE-2022-0001"}, hostVulns(other.ID))
+}
+
 func TestSyncsCVEFromURL(t *testing.T) {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(r.RequestURI, ".meta") {
@@ -286,10 +377,114 @@ func TestSyncsCVEFromURL(t *testing.T) {
 
 	tempDir := t.TempDir()
 	cveFeedPrefixURL := ts.URL + "/feeds/json/cve/1.1/"
-	err := DownloadNVDCVEFeed(tempDir, cveFeedPrefixURL)
+	err := DownloadNVDCVEFeed(tempDir, cveFeedPrefixURL, WithURLPolicy(URLPolicy{AllowHTTP: true}))
 	require.Error(t, err)
 	require.Contains(t,
 		err.Error(),
 		fmt.Sprintf("1 synchronisation error:\n\tunexpected size for \"%s/feeds/json/cve/1.1/nvdcve-1.1-2002.json.gz\" (200 OK): want 1453293, have 0", ts.URL),
 	)
 }
+
+func TestDownloadNVDCVEFeedYears(t *testing.T) {
+	feed, err := os.ReadFile(filepath.Join("..", "testdata", "nvdcve-1.1-recent.json.gz"))
+	require.NoError(t, err)
+	gr, err := gzip.NewReader(bytes.NewReader(feed))
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	sum := sha256.Sum256(decompressed)
+
+	var mu sync.Mutex
+	var requested []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested = append(requested, r.URL.Path)
+		metaSum := sum
+		mu.Unlock()
+
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".meta"):
+			fmt.Fprint(w, "lastModifiedDate:2023-03-21T03:00:01-04:00\r\n")
+			fmt.Fprintf(w, "sha256:%X\r\n", metaSum)
+		case strings.HasSuffix(r.URL.Path, ".json.gz"):
+			w.Write(feed) //nolint:errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	vulnPath := t.TempDir()
+	untouched := filepath.Join(vulnPath, "nvdcve-1.1-2022.json.gz")
+	require.NoError(t, os.WriteFile(untouched, []byte("2022 feed"), 0o644))
+
+	cveFeedPrefixURL := ts.URL + "/feeds/json/cve/1.1/"
+	err = DownloadNVDCVEFeed(vulnPath, cveFeedPrefixURL, WithURLPolicy(URLPolicy{AllowHTTP: true}), WithNVDYears(2020, 2021))
+	require.NoError(t, err)
+
+	require.ElementsMatch(t, []string{
+		"/feeds/json/cve/1.1/nvdcve-1.1-2020.json.gz",
+		"/feeds/json/cve/1.1/nvdcve-1.1-2020.meta",
+		"/feeds/json/cve/1.1/nvdcve-1.1-2021.json.gz",
+		"/feeds/json/cve/1.1/nvdcve-1.1-2021.meta",
+	}, requested)
+	for _, name := range []string{"nvdcve-1.1-2020.json.gz", "nvdcve-1.1-2020.meta", "nvdcve-1.1-2021.json.gz", "nvdcve-1.1-2021.meta"} {
+		require.FileExists(t, filepath.Join(vulnPath, name))
+	}
+	b, err := os.ReadFile(untouched)
+	require.NoError(t, err)
+	require.Equal(t, "2022 feed", string(b))
+
+	// years without a feed are rejected before downloading anything
+	mu.Lock()
+	requested = nil
+	mu.Unlock()
+	err = DownloadNVDCVEFeed(vulnPath, cveFeedPrefixURL, WithURLPolicy(URLPolicy{AllowHTTP: true}), WithNVDYears(2020, 1999))
+	require.Error(t, err)
+	require.Empty(t, requested)
+
+	// a corrupted download is detected
+	mu.Lock()
+	sum[0]++
+	mu.Unlock()
+	err = DownloadNVDCVEFeed(vulnPath, cveFeedPrefixURL, WithURLPolicy(URLPolicy{AllowHTTP: true}), WithNVDYears(2020))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "checksum mismatch")
+}
+
+func TestLoadNVDCVEFeedCompressed(t *testing.T) {
+	compressedPath := filepath.Join("..", "testdata", "nvdcve-1.1-recent.json.gz")
+
+	// store a decompressed copy of the feed
+	vulnPath := t.TempDir()
+	f, err := os.Open(compressedPath)
+	require.NoError(t, err)
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	require.NoError(t, err)
+	b, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	decompressedPath := filepath.Join(vulnPath, "nvdcve-1.1-recent.json")
+	require.NoError(t, os.WriteFile(decompressedPath, b, 0o644))
+
+	compressed, err := loadNVDCVEFeed(compressedPath)
+	require.NoError(t, err)
+	require.NotEmpty(t, compressed)
+	decompressed, err := loadNVDCVEFeed(decompressedPath)
+	require.NoError(t, err)
+	require.Equal(t, decompressed, compressed)
+
+	// the compressed file is preferred when both forms are present
+	files, err := getNVDCVEFeedFiles(vulnPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{decompressedPath}, files)
+
+	gzPath := filepath.Join(vulnPath, "nvdcve-1.1-recent.json.gz")
+	gz, err := os.ReadFile(compressedPath)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(gzPath, gz, 0o644))
+
+	files, err = getNVDCVEFeedFiles(vulnPath)
+	require.NoError(t, err)
+	require.Equal(t, []string{gzPath}, files)
+}
@@ -20,6 +20,30 @@ func sqliteDB(dbPath string) (*sqlx.DB, error) {
 	return db, nil
 }
 
+// verifyCPEDB checks that the file at dbPath is a complete CPE database: a SQLite database that passes the integrity
+// check and has the cpe_2 table.
+func verifyCPEDB(dbPath string) error {
+	db, err := sqliteDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var checks []string
+	if err := db.Select(&checks, `PRAGMA quick_check`); err != nil {
+		return fmt.Errorf("integrity check: %w", err)
+	}
+	if len(checks) != 1 || checks[0] != "ok" {
+		return fmt.Errorf("integrity check: %s", strings.Join(checks, "; "))
+	}
+
+	var n int
+	if err := db.Get(&n, `SELECT COUNT(*) FROM (SELECT 1 FROM cpe_2 LIMIT 1)`); err != nil {
+		return fmt.Errorf("query cpe table: %w", err)
+	}
+	return nil
+}
+
 func applyCPEDatabaseSchema(db *sqlx.DB) error {
 	// Use a new table cpe_2 containing new columns vendor, product. view cpe used for backwards compatibility
 	// with old fleet versions that use "select * from cpe ...". When creating the view, we need to
@@ -0,0 +1,81 @@
+package nvd
+
+import (
+	"sort"
+
+	"github.com/fleetdm/fleet/v4/server/fleet"
+)
+
+// CVEMetaDiff is what changed between two loads of CVE metadata, see DiffCVEMeta. All the lists are sorted by CVE.
+type CVEMetaDiff struct {
+	// Added are the CVEs that are only in the current load.
+	Added []fleet.CVEMeta
+	// Removed are the CVEs that are only in the previous load, e.g. because they were rejected.
+	Removed []fleet.CVEMeta
+	// ScoreChanged are the CVEs whose CVSS score or EPSS probability changed, including being set or unset.
+	ScoreChanged []CVEMetaChange
+	// ExploitStatusChanged are the CVEs that became known exploits according to CISA, or stopped being ones.
+	ExploitStatusChanged []CVEMetaChange
+}
+
+// CVEMetaChange is the metadata of a CVE in two loads.
+type CVEMetaChange struct {
+	Previous fleet.CVEMeta
+	Current  fleet.CVEMeta
+}
+
+// DiffCVEMeta compares two loads of CVE metadata, e.g. snapshots taken a week apart. A CVE whose scores and exploit
+// status both changed is in both ScoreChanged and ExploitStatusChanged. A CVE with no known exploit status is
+// considered not to be a known exploit.
+func DiffCVEMeta(previous []fleet.CVEMeta, current []fleet.CVEMeta) CVEMetaDiff {
+	previousByCVE := make(map[string]fleet.CVEMeta, len(previous))
+	for _, meta := range previous {
+		previousByCVE[meta.CVE] = meta
+	}
+	currentByCVE := make(map[string]fleet.CVEMeta, len(current))
+	for _, meta := range current {
+		currentByCVE[meta.CVE] = meta
+	}
+
+	var diff CVEMetaDiff
+	for cve, cur := range currentByCVE {
+		prev, ok := previousByCVE[cve]
+		if !ok {
+			diff.Added = append(diff.Added, cur)
+			continue
+		}
+		change := CVEMetaChange{Previous: prev, Current: cur}
+		if !equalFloat64Ptr(prev.CVSSScore, cur.CVSSScore) || !equalFloat64Ptr(prev.EPSSProbability, cur.EPSSProbability) {
+			diff.ScoreChanged = append(diff.ScoreChanged, change)
+		}
+		if isKnownExploit(prev) != isKnownExploit(cur) {
+			diff.ExploitStatusChanged = append(diff.ExploitStatusChanged, change)
+		}
+	}
+	for cve, prev := range previousByCVE {
+		if _, ok := currentByCVE[cve]; !ok {
+			diff.Removed = append(diff.Removed, prev)
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].CVE < diff.Added[j].CVE })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].CVE < diff.Removed[j].CVE })
+	sortChanges := func(changes []CVEMetaChange) {
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Current.CVE < changes[j].Current.CVE })
+	}
+	sortChanges(diff.ScoreChanged)
+	sortChanges(diff.ExploitStatusChanged)
+
+	return diff
+}
+
+func equalFloat64Ptr(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+func isKnownExploit(meta fleet.CVEMeta) bool {
+	return meta.CISAKnownExploit != nil && *meta.CISAKnownExploit
+}
@@ -0,0 +1,72 @@
+package nvd
+
+import (
+	"testing"
+
+	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/fleetdm/fleet/v4/server/ptr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffCVEMeta(t *testing.T) {
+	previous := []fleet.CVEMeta{
+		{CVE: "CVE-2022-0001", CVSSScore: ptr.Float64(5), EPSSProbability: ptr.Float64(0.1), CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "CVE-2022-0002", CVSSScore: ptr.Float64(7), EPSSProbability: ptr.Float64(0.2), CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "CVE-2022-0003", CVSSScore: ptr.Float64(9), CISAKnownExploit: ptr.Bool(true)},
+		{CVE: "CVE-2022-0004", CVSSScore: ptr.Float64(4), CISAKnownExploit: ptr.Bool(false)},
+		{CVE: "CVE-2022-0005", CVSSScore: ptr.Float64(6)},
+		{CVE: "CVE-2022-0006", EPSSProbability: ptr.Float64(0.3)},
+	}
+	current := []fleet.CVEMeta{
+		// unchanged, a missing exploit status is the same as not being a known exploit
+		{CVE: "CVE-2022-0001", CVSSScore: ptr.Float64(5), EPSSProbability: ptr.Float64(0.1)},
+		// re-scored
+		{CVE: "CVE-2022-0002", CVSSScore: ptr.Float64(7), EPSSProbability: ptr.Float64(0.6), CISAKnownExploit: ptr.Bool(false)},
+		// no longer a known exploit
+		{CVE: "CVE-2022-0003", CVSSScore: ptr.Float64(9), CISAKnownExploit: ptr.Bool(false)},
+		// newly known exploited and re-scored
+		{CVE: "CVE-2022-0004", CVSSScore: ptr.Float64(8.8), CISAKnownExploit: ptr.Bool(true)},
+		// score unset
+		{CVE: "CVE-2022-0005"},
+		// added
+		{CVE: "CVE-2023-0002", CVSSScore: ptr.Float64(3)},
+		{CVE: "CVE-2023-0001", CVSSScore: ptr.Float64(10), CISAKnownExploit: ptr.Bool(true)},
+	}
+
+	cves := func(metas []fleet.CVEMeta) []string {
+		var res []string
+		for _, m := range metas {
+			res = append(res, m.CVE)
+		}
+		return res
+	}
+	changedCVEs := func(changes []CVEMetaChange) []string {
+		var res []string
+		for _, c := range changes {
+			require.Equal(t, c.Previous.CVE, c.Current.CVE)
+			res = append(res, c.Current.CVE)
+		}
+		return res
+	}
+
+	diff := DiffCVEMeta(previous, current)
+	require.Equal(t, []string{"CVE-2023-0001", "CVE-2023-0002"}, cves(diff.Added))
+	require.Equal(t, []string{"CVE-2022-0006"}, cves(diff.Removed))
+	require.Equal(t, []string{"CVE-2022-0002", "CVE-2022-0004", "CVE-2022-0005"}, changedCVEs(diff.ScoreChanged))
+	require.Equal(t, []string{"CVE-2022-0003", "CVE-2022-0004"}, changedCVEs(diff.ExploitStatusChanged))
+
+	// the change holds the metadata of both loads
+	require.Equal(t, 0.2, *diff.ScoreChanged[0].Previous.EPSSProbability)
+	require.Equal(t, 0.6, *diff.ScoreChanged[0].Current.EPSSProbability)
+	require.False(t, *diff.ExploitStatusChanged[1].Previous.CISAKnownExploit)
+	require.True(t, *diff.ExploitStatusChanged[1].Current.CISAKnownExploit)
+
+	// nothing changed
+	diff = DiffCVEMeta(previous, previous)
+	require.Equal(t, CVEMetaDiff{}, diff)
+
+	// everything is added to an empty previous load
+	diff = DiffCVEMeta(nil, current)
+	require.Len(t, diff.Added, len(current))
+	require.Empty(t, diff.Removed)
+}
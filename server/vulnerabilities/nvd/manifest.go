@@ -0,0 +1,142 @@
+package nvd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const manifestFilename = "manifest.json"
+
+// Manifest records the SHA-256 checksum of every file in a vulnerabilities directory, keyed by the file's path
+// relative to that directory (using forward slashes).
+type Manifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// ManifestDiff lists the differences between a Manifest and the current contents of a vulnerabilities directory.
+type ManifestDiff struct {
+	Added    []string
+	Removed  []string
+	Modified []string
+}
+
+// Empty returns whether the directory matches the manifest.
+func (d ManifestDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// GenerateManifest computes the checksums of all the files in vulnPath and writes them to a manifest file in that
+// same directory, replacing any previous manifest.
+func GenerateManifest(vulnPath string) error {
+	files, err := checksumFiles(vulnPath)
+	if err != nil {
+		return fmt.Errorf("checksum files: %w", err)
+	}
+
+	b, err := json.MarshalIndent(Manifest{Files: files}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(vulnPath, manifestFilename), b, 0o644); err != nil {
+		return fmt.Errorf("write manifest: %w", err)
+	}
+	return nil
+}
+
+// VerifyManifest checks the files in vulnPath against the manifest previously written by GenerateManifest and returns
+// the files that were added, removed or modified since then.
+func VerifyManifest(vulnPath string) (*ManifestDiff, error) {
+	b, err := os.ReadFile(filepath.Join(vulnPath, manifestFilename))
+	if err != nil {
+		return nil, fmt.Errorf("read manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("unmarshal manifest: %w", err)
+	}
+
+	current, err := checksumFiles(vulnPath)
+	if err != nil {
+		return nil, fmt.Errorf("checksum files: %w", err)
+	}
+
+	var diff ManifestDiff
+	for name, sum := range current {
+		expected, ok := manifest.Files[name]
+		switch {
+		case !ok:
+			diff.Added = append(diff.Added, name)
+		case expected != sum:
+			diff.Modified = append(diff.Modified, name)
+		}
+	}
+	for name := range manifest.Files {
+		if _, ok := current[name]; !ok {
+			diff.Removed = append(diff.Removed, name)
+		}
+	}
+
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Modified)
+
+	return &diff, nil
+}
+
+// checksumFiles returns the SHA-256 checksum of every regular file under dir, except the manifest itself.
+func checksumFiles(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == manifestFilename {
+			return nil
+		}
+
+		sum, err := sha256File(path)
+		if err != nil {
+			return err
+		}
+		files[rel] = sum
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func sha256File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
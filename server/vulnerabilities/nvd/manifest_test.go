@@ -0,0 +1,52 @@
+package nvd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifest(t *testing.T) {
+	vulnPath := t.TempDir()
+
+	write := func(name, content string) {
+		path := filepath.Join(vulnPath, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	write(cpeDBFilename, "cpe db")
+	write(cisaKnownExploitsFilename, `{"vulnerabilities": []}`)
+	write("nvdcve-1.1-2022.json.gz", "nvd 2022")
+	write("oval/ubuntu.xml", "oval")
+
+	require.NoError(t, GenerateManifest(vulnPath))
+	require.FileExists(t, filepath.Join(vulnPath, manifestFilename))
+
+	diff, err := VerifyManifest(vulnPath)
+	require.NoError(t, err)
+	require.True(t, diff.Empty())
+
+	// tamper with the directory after the manifest was generated
+	write(cisaKnownExploitsFilename, `{"vulnerabilities": [{"cveID": "CVE-2022-0001"}]}`)
+	write("oval/rhel.xml", "oval")
+	require.NoError(t, os.Remove(filepath.Join(vulnPath, "nvdcve-1.1-2022.json.gz")))
+
+	diff, err = VerifyManifest(vulnPath)
+	require.NoError(t, err)
+	require.False(t, diff.Empty())
+	require.Equal(t, []string{cisaKnownExploitsFilename}, diff.Modified)
+	require.Equal(t, []string{"oval/rhel.xml"}, diff.Added)
+	require.Equal(t, []string{"nvdcve-1.1-2022.json.gz"}, diff.Removed)
+
+	// regenerating the manifest accepts the current state
+	require.NoError(t, GenerateManifest(vulnPath))
+	diff, err = VerifyManifest(vulnPath)
+	require.NoError(t, err)
+	require.True(t, diff.Empty())
+
+	// a missing manifest is an error
+	_, err = VerifyManifest(t.TempDir())
+	require.Error(t, err)
+}
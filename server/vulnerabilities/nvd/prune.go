@@ -0,0 +1,63 @@
+package nvd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// ErrIncompleteNVDFeeds is the reason a load doesn't prune the CVE metadata (see WithPrune) when the vulnerabilities
+// directory doesn't contain all the yearly NVD CVE feeds, e.g. when only the "modified" feed was downloaded.
+var ErrIncompleteNVDFeeds = errors.New("incomplete nvd cve feeds")
+
+// firstNVDFeedYear is the year of the oldest yearly NVD CVE feed.
+const firstNVDFeedYear = 2002
+
+var rxNVDCVEYearlyFeed = regexp.MustCompile(`nvdcve-1\.1-(\d{4})\.json(\.gz)?$`)
+
+// errPartialLoad is returned by checkFullLoad when the CVE metadata must not be pruned after a load.
+var errPartialLoad = errors.New("partial load")
+
+// checkFullLoad returns an error unless the load read all the feeds, so that the CVEs it didn't load can be pruned.
+func checkFullLoad(o loadCVEMetaOptions, feedFiles []string, missingFeeds bool) error {
+	switch {
+	case o.incremental:
+		return fmt.Errorf("%w: incremental", errPartialLoad)
+	case !o.sources.Has(FeedSourceNVD) || !o.sources.Has(FeedSourceEPSS) || !o.sources.Has(FeedSourceCISA):
+		return fmt.Errorf("%w: restricted feed sources", errPartialLoad)
+	case missingFeeds:
+		return fmt.Errorf("%w: missing or unreadable feeds", errPartialLoad)
+	}
+	return checkNVDYearlyFeeds(feedFiles, time.Now().Year())
+}
+
+// checkNVDYearlyFeeds returns ErrIncompleteNVDFeeds unless files contains a yearly NVD feed for every year from
+// firstNVDFeedYear to currentYear. A set that stops short of the current year, e.g. because its latest download
+// failed, would otherwise prune all the CVEs of the missing years.
+func checkNVDYearlyFeeds(files []string, currentYear int) error {
+	years := make(map[int]bool)
+	for _, file := range files {
+		m := rxNVDCVEYearlyFeed.FindStringSubmatch(filepath.Base(file))
+		if m == nil {
+			continue
+		}
+		year, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		years[year] = true
+	}
+
+	if len(years) == 0 {
+		return fmt.Errorf("%w: no yearly feed found", ErrIncompleteNVDFeeds)
+	}
+	for year := firstNVDFeedYear; year <= currentYear; year++ {
+		if !years[year] {
+			return fmt.Errorf("%w: missing %d feed", ErrIncompleteNVDFeeds, year)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package nvd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fleetdm/fleet/v4/server/contexts/license"
+	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/fleetdm/fleet/v4/server/mock"
+	"github.com/fleetdm/fleet/v4/server/ptr"
+	"github.com/go-kit/kit/log"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadCVEMetaPrune(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	feed, err := os.ReadFile(filepath.Join("..", "testdata", "nvdcve-1.1-recent.json.gz"))
+	require.NoError(t, err)
+
+	vulnPath := t.TempDir()
+	writeFeed := func(name string) {
+		require.NoError(t, os.WriteFile(filepath.Join(vulnPath, name), feed, 0o644))
+	}
+	for _, name := range []string{cisaKnownExploitsFilename, "epss_scores-current.csv"} {
+		b, err := os.ReadFile(filepath.Join("..", "testdata", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(vulnPath, name), b, 0o644))
+	}
+
+	ds := new(mock.Store)
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		return nil
+	}
+	ds.UpsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta) error {
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+	var current []string
+	ds.PruneCVEMetaFunc = func(ctx context.Context, cves []string) (int, error) {
+		current = cves
+		return 1, nil
+	}
+
+	source := &fakeCVESource{metas: []fleet.CVEMeta{
+		{CVE: "CVE-2099-0001", CVSSScore: ptr.Float64(9.9)},
+	}}
+	load := func(opts ...LoadCVEMetaOption) *LoadCVEMetaResult {
+		result, err := LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, ds, append(opts, WithPrune(), WithCVESources(source))...)
+		require.NoError(t, err)
+		return result
+	}
+
+	// only incremental feeds
+	writeFeed("nvdcve-1.1-recent.json.gz")
+	require.Zero(t, load().Pruned)
+	require.False(t, ds.PruneCVEMetaFuncInvoked)
+
+	// a yearly feed is missing
+	writeFeed("nvdcve-1.1-2002.json.gz")
+	writeFeed("nvdcve-1.1-2004.json.gz")
+	require.Zero(t, load().Pruned)
+	require.False(t, ds.PruneCVEMetaFuncInvoked)
+
+	// the feed of the current year is missing, e.g. its download failed
+	currentYear := time.Now().Year()
+	for year := firstNVDFeedYear + 1; year < currentYear; year++ {
+		writeFeed(fmt.Sprintf("nvdcve-1.1-%d.json.gz", year))
+	}
+	require.Zero(t, load().Pruned)
+	require.False(t, ds.PruneCVEMetaFuncInvoked)
+
+	// all the yearly feeds are there, but the load is partial
+	writeFeed(fmt.Sprintf("nvdcve-1.1-%d.json.gz", currentYear))
+	require.Zero(t, load(WithIncremental()).Pruned)
+	require.Zero(t, load(WithFeedSources(FeedSourceNVD)).Pruned)
+	require.False(t, ds.PruneCVEMetaFuncInvoked)
+
+	require.Equal(t, 1, load().Pruned)
+	require.True(t, ds.PruneCVEMetaFuncInvoked)
+	require.Contains(t, current, "CVE-2022-29676")
+	// the CVEs only known to the sources are kept
+	require.Contains(t, current, "CVE-2099-0001")
+
+	// a feed went missing
+	ds.PruneCVEMetaFuncInvoked = false
+	require.NoError(t, os.Remove(filepath.Join(vulnPath, cisaKnownExploitsFilename)))
+	require.Zero(t, load().Pruned)
+	require.False(t, ds.PruneCVEMetaFuncInvoked)
+
+	// a prune can't be part of a caller's transaction
+	_, err = LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, ds, WithPrune(), WithTx(fakeCVEMetaTx{new(mock.Store)}))
+	require.Error(t, err)
+}
@@ -0,0 +1,56 @@
+package nvd
+
+import (
+	"context"
+
+	"github.com/fleetdm/fleet/v4/server/fleet"
+)
+
+// CVESource is a source of CVE metadata, e.g. an internal advisory feed, that can be plugged into Sync and
+// LoadCVEMeta next to the built-in NVD, EPSS and CISA feeds, see SyncOptions.CVESources and WithCVESources.
+type CVESource interface {
+	// Download fetches the data of the source into vulnPath. It is called by Sync, after the built-in feeds were
+	// downloaded.
+	Download(ctx context.Context, vulnPath string) error
+	// Load reads the previously downloaded data of the source from vulnPath. It is called by LoadCVEMeta, after the
+	// built-in feeds were loaded. The non-nil fields of the returned metadata take precedence over the values of the
+	// built-in feeds.
+	Load(ctx context.Context, vulnPath string) ([]fleet.CVEMeta, error)
+}
+
+// mergeCVEMeta sets the non-nil fields of src on dst.
+func mergeCVEMeta(dst *fleet.CVEMeta, src fleet.CVEMeta) {
+	dst.CVE = src.CVE
+	if src.CVSSScore != nil {
+		// the source goes with the score, it is unknown unless the source says otherwise
+		dst.CVSSScore = src.CVSSScore
+		dst.CVSSSource = src.CVSSSource
+	}
+	if src.EPSSProbability != nil {
+		dst.EPSSProbability = src.EPSSProbability
+	}
+	if src.CISAKnownExploit != nil {
+		dst.CISAKnownExploit = src.CISAKnownExploit
+	}
+	if src.Published != nil {
+		dst.Published = src.Published
+	}
+	if src.CVSSExploitabilityScore != nil {
+		dst.CVSSExploitabilityScore = src.CVSSExploitabilityScore
+	}
+	if src.CVSSImpactScore != nil {
+		dst.CVSSImpactScore = src.CVSSImpactScore
+	}
+	if src.CVSSVector != nil {
+		dst.CVSSVector = src.CVSSVector
+	}
+	if src.LastModified != nil {
+		dst.LastModified = src.LastModified
+	}
+	if src.CISADueDate != nil {
+		dst.CISADueDate = src.CISADueDate
+	}
+	if src.CISADateAdded != nil {
+		dst.CISADateAdded = src.CISADateAdded
+	}
+}
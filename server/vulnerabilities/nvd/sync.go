@@ -1,292 +1,2287 @@
 package nvd
 
 import (
+	"bufio"
+	"compress/gzip"
 	"context"
+	"crypto/tls"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/fleetdm/fleet/v4/server/contexts/license"
 	"io"
+	"io/fs"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/facebookincubator/nvdtools/cvefeed"
 	feednvd "github.com/facebookincubator/nvdtools/cvefeed/nvd"
+	feednvdschema "github.com/facebookincubator/nvdtools/cvefeed/nvd/schema"
+	"github.com/facebookincubator/nvdtools/wfn"
 	"github.com/fleetdm/fleet/v4/pkg/download"
 	"github.com/fleetdm/fleet/v4/pkg/fleethttp"
 	"github.com/fleetdm/fleet/v4/server/fleet"
 	"github.com/fleetdm/fleet/v4/server/ptr"
 	"github.com/go-kit/kit/log"
 	"github.com/go-kit/kit/log/level"
+	"github.com/kolide/kit/version"
+	"golang.org/x/oauth2"
 )
 
+// FeedSource identifies one of the vulnerability data sources handled by Sync and LoadCVEMeta. Sources can be
+// combined into a set with a bitwise or.
+type FeedSource uint8
+
+const (
+	// FeedSourceCPE is the CPE database and the CPE translations.
+	FeedSourceCPE FeedSource = 1 << iota
+	// FeedSourceNVD is the NVD CVE feed.
+	FeedSourceNVD
+	// FeedSourceEPSS is the EPSS scores feed.
+	FeedSourceEPSS
+	// FeedSourceCISA is the CISA known exploited vulnerabilities catalog.
+	FeedSourceCISA
+
+	// FeedSourceAll is the set of all the feed sources.
+	FeedSourceAll = FeedSourceCPE | FeedSourceNVD | FeedSourceEPSS | FeedSourceCISA
+)
+
+// Has returns whether src is part of the set s. An empty set is treated as FeedSourceAll.
+func (s FeedSource) Has(src FeedSource) bool {
+	if s == 0 {
+		s = FeedSourceAll
+	}
+	return s&src != 0
+}
+
 type SyncOptions struct {
 	VulnPath           string
 	CPEDBURL           string
 	CPETranslationsURL string
 	CVEFeedPrefixURL   string
+	// Sources is the set of feed sources to download. If empty, all sources are downloaded.
+	Sources FeedSource
+	// UserAgent is the User-Agent header sent on all the feed requests. If empty, defaultUserAgent is used.
+	UserAgent string
+	// CreateVulnPath creates VulnPath if it doesn't exist.
+	CreateVulnPath bool
+	// URLPolicy restricts the URLs that CPEDBURL, CPETranslationsURL and CVEFeedPrefixURL can point to.
+	URLPolicy URLPolicy
+	// CVESources are additional sources of CVE metadata to download, after the built-in feeds. They are downloaded
+	// regardless of Sources.
+	CVESources []CVESource
+	// MinTLSVersion is the minimum TLS version of the connections to the feeds (e.g. tls.VersionTLS13). If zero,
+	// defaultMinTLSVersion is used.
+	MinTLSVersion uint16
+	// ValidateCISACatalog fails the sync if the downloaded CISA catalog doesn't have the expected structure, see
+	// WithCISACatalogValidation.
+	ValidateCISACatalog bool
+	// CompressedEPSS stores the EPSS scores feed compressed, without extracting it, see WithEPSSCompressed.
+	CompressedEPSS bool
+	// SignatureKey, if set, is the minisign public key that every feed must be signed with, see WithSignatureKey.
+	SignatureKey *download.MinisignPublicKey
+	// Staged downloads the feeds into a staging copy of VulnPath that replaces VulnPath once all the downloads
+	// succeeded, see syncStaged. If a download fails, VulnPath is left untouched. The parent directory of VulnPath
+	// must be writable.
+	Staged bool
+
+	// onSourceSynced, if set, is called with the result of the download of every source, see SyncAndRecord.
+	onSourceSynced func(source string, err error)
 }
 
-// Sync downloads all the vulnerability data sources.
-func Sync(opts SyncOptions) error {
-	if err := DownloadCPEDBFromGithub(opts.VulnPath, opts.CPEDBURL); err != nil {
-		return fmt.Errorf("sync CPE database: %w", err)
+// ErrVulnPathNotWritable is returned by Sync when the vulnerabilities path does not exist, is not a directory or
+// cannot be written to.
+var ErrVulnPathNotWritable = errors.New("vulnerabilities path is not a writable directory")
+
+// Sync downloads all the enabled vulnerability data sources. ctx is passed to the downloads of opts.CVESources.
+func Sync(ctx context.Context, opts SyncOptions) error {
+	if err := checkVulnPath(opts.VulnPath, opts.CreateVulnPath); err != nil {
+		return err
+	}
+	if opts.Staged {
+		return syncStaged(ctx, opts)
+	}
+
+	dlOpts := []DownloadOption{WithURLPolicy(opts.URLPolicy)}
+	if opts.UserAgent != "" {
+		dlOpts = append(dlOpts, WithUserAgent(opts.UserAgent))
+	}
+	if opts.MinTLSVersion != 0 {
+		dlOpts = append(dlOpts, WithMinTLSVersion(opts.MinTLSVersion))
+	}
+	if opts.ValidateCISACatalog {
+		dlOpts = append(dlOpts, WithCISACatalogValidation())
+	}
+	if opts.CompressedEPSS {
+		dlOpts = append(dlOpts, WithEPSSCompressed())
+	}
+	if opts.SignatureKey != nil {
+		dlOpts = append(dlOpts, WithSignatureKey(opts.SignatureKey))
+	}
+
+	syncSource := func(source string, download func() error) error {
+		err := download()
+		if opts.onSourceSynced != nil {
+			opts.onSourceSynced(source, err)
+		}
+		return err
+	}
+
+	if opts.Sources.Has(FeedSourceCPE) {
+		if err := syncSource("cpe_database", func() error {
+			return DownloadCPEDBFromGithub(opts.VulnPath, opts.CPEDBURL, dlOpts...)
+		}); err != nil {
+			return fmt.Errorf("sync CPE database: %w", err)
+		}
+
+		if err := syncSource("cpe_translations", func() error {
+			return DownloadCPETranslationsFromGithub(opts.VulnPath, opts.CPETranslationsURL, dlOpts...)
+		}); err != nil {
+			return fmt.Errorf("sync CPE translations: %w", err)
+		}
 	}
 
-	if err := DownloadCPETranslationsFromGithub(opts.VulnPath, opts.CPETranslationsURL); err != nil {
-		return fmt.Errorf("sync CPE translations: %w", err)
+	if opts.Sources.Has(FeedSourceNVD) {
+		if err := syncSource("nvd", func() error {
+			return DownloadNVDCVEFeed(opts.VulnPath, opts.CVEFeedPrefixURL, dlOpts...)
+		}); err != nil {
+			return fmt.Errorf("sync NVD CVE feed: %w", err)
+		}
 	}
 
-	if err := DownloadNVDCVEFeed(opts.VulnPath, opts.CVEFeedPrefixURL); err != nil {
-		return fmt.Errorf("sync NVD CVE feed: %w", err)
+	if opts.Sources.Has(FeedSourceEPSS) {
+		if err := syncSource("epss", func() error {
+			return DownloadEPSSFeed(opts.VulnPath, dlOpts...)
+		}); err != nil {
+			return fmt.Errorf("sync EPSS CVE feed: %w", err)
+		}
 	}
 
-	if err := DownloadEPSSFeed(opts.VulnPath); err != nil {
-		return fmt.Errorf("sync EPSS CVE feed: %w", err)
+	if opts.Sources.Has(FeedSourceCISA) {
+		if err := syncSource("cisa", func() error {
+			return DownloadCISAKnownExploitsFeed(opts.VulnPath, dlOpts...)
+		}); err != nil {
+			return fmt.Errorf("sync CISA known exploits feed: %w", err)
+		}
 	}
 
-	if err := DownloadCISAKnownExploitsFeed(opts.VulnPath); err != nil {
-		return fmt.Errorf("sync CISA known exploits feed: %w", err)
+	for i, source := range opts.CVESources {
+		source := source
+		if err := syncSource(fmt.Sprintf("cve_source_%d", i), func() error {
+			return source.Download(ctx, opts.VulnPath)
+		}); err != nil {
+			return fmt.Errorf("sync CVE source %d (%T): %w", i, source, err)
+		}
 	}
 
 	return nil
 }
 
-const (
-	epssFeedsURL = "https://epss.cyentia.com"
-	epssFilename = "epss_scores-current.csv.gz"
-)
-
-// DownloadEPSSFeed downloads the EPSS scores feed.
-func DownloadEPSSFeed(vulnPath string) error {
-	urlString := epssFeedsURL + "/" + epssFilename
-	u, err := url.Parse(urlString)
-	if err != nil {
-		return fmt.Errorf("parse url: %w", err)
+// SyncAndRecord runs Sync and records the attempt in the datastore, with the result of every source downloaded, so
+// that the history of the syncs can be reviewed with fleet.Datastore.ListSyncAttempts. It returns the error of Sync,
+// if any, after recording it.
+func SyncAndRecord(ctx context.Context, ds fleet.Datastore, opts SyncOptions) error {
+	attempt := fleet.SyncAttempt{StartedAt: time.Now().UTC()}
+	opts.onSourceSynced = func(source string, err error) {
+		result := fleet.SyncSourceResult{Source: source, Success: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		attempt.Sources = append(attempt.Sources, result)
 	}
-	path := filepath.Join(vulnPath, strings.TrimSuffix(epssFilename, ".gz"))
 
-	client := fleethttp.NewClient()
-	err = download.DownloadAndExtract(client, u, path)
+	err := Sync(ctx, opts)
+	attempt.DurationMS = time.Since(attempt.StartedAt).Milliseconds()
+	attempt.Success = err == nil
 	if err != nil {
-		return fmt.Errorf("download %s: %w", u, err)
+		attempt.Error = ptr.String(err.Error())
 	}
 
-	return nil
+	if rerr := ds.RecordSyncAttempt(ctx, &attempt); rerr != nil {
+		if err != nil {
+			return fmt.Errorf("%w (record sync attempt: %s)", err, rerr)
+		}
+		return fmt.Errorf("record sync attempt: %w", rerr)
+	}
+	return err
 }
 
-// epssScore represents the EPSS score for a CVE.
-type epssScore struct {
-	CVE   string
-	Score float64
-}
+// syncStaged runs Sync in a staging directory and swaps it with opts.VulnPath once all the downloads succeeded. The
+// staging directory is created next to opts.VulnPath, so that both are on the same file system, and starts as a copy
+// of it to keep the feeds that aren't synced and the state of the incremental downloads.
+//
+// The swap renames opts.VulnPath out of the way and then the staging directory in its place: the feeds are never
+// partially downloaded or updated in place, but opts.VulnPath is missing in between the two renames.
+func syncStaged(ctx context.Context, opts SyncOptions) error {
+	vulnPath := filepath.Clean(opts.VulnPath)
+	stat, err := os.Stat(vulnPath)
+	if err != nil {
+		return err
+	}
 
-func parseEPSSScoresFile(path string) ([]epssScore, error) {
-	f, err := os.Open(path)
+	staging, err := os.MkdirTemp(filepath.Dir(vulnPath), "."+filepath.Base(vulnPath)+"-staging-")
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("create staging directory: %w", err)
 	}
-	defer f.Close()
+	defer os.RemoveAll(staging)
 
-	r := csv.NewReader(f)
-	r.Comment = '#'
-	r.FieldsPerRecord = 3
+	if err := copyDir(vulnPath, staging); err != nil {
+		return fmt.Errorf("copy %s to staging directory: %w", vulnPath, err)
+	}
+	// MkdirTemp creates the directory with 0o700
+	if err := os.Chmod(staging, stat.Mode().Perm()); err != nil {
+		return fmt.Errorf("chmod staging directory: %w", err)
+	}
 
-	// skip the header
-	r.Read() //nolint:errcheck
+	stagedOpts := opts
+	stagedOpts.VulnPath = staging
+	stagedOpts.CreateVulnPath = false
+	stagedOpts.Staged = false
+	if err := Sync(ctx, stagedOpts); err != nil {
+		return err
+	}
 
-	var epssScores []epssScore
-	for {
-		rec, err := r.Read()
-		if err == io.EOF {
-			break
+	previous := staging + "-previous"
+	if err := os.Rename(vulnPath, previous); err != nil {
+		return fmt.Errorf("swap staging directory: %w", err)
+	}
+	if err := os.Rename(staging, vulnPath); err != nil {
+		// put the previous feeds back
+		if rerr := os.Rename(previous, vulnPath); rerr != nil {
+			return fmt.Errorf("swap staging directory: %w, restore %s from %s: %v", err, vulnPath, previous, rerr)
 		}
+		return fmt.Errorf("swap staging directory: %w", err)
+	}
+	if err := os.RemoveAll(previous); err != nil {
+		return fmt.Errorf("remove previous feeds: %w", err)
+	}
+	return nil
+}
+
+// copyDir copies the directories, regular files and symlinks under src to the existing directory dst. The
+// permissions and modification times of the files are kept.
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
-			return nil, err
+			return err
 		}
-
-		// each row should have 3 records: cve, epss, and percentile
-		if len(rec) != 3 {
-			continue
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
 		}
+		if rel == "." {
+			return nil
+		}
+		target := filepath.Join(dst, rel)
 
-		cve := rec[0]
-		score, err := strconv.ParseFloat(rec[1], 64)
+		info, err := d.Info()
 		if err != nil {
-			return nil, fmt.Errorf("parse epss score: %w", err)
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.Mkdir(target, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			if err := copyFile(path, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+			return os.Chtimes(target, info.ModTime(), info.ModTime())
+		default:
+			return nil
 		}
+	})
+}
 
-		// ignore percentile
+// copyFile copies the regular file at src to dst, created with the given permissions.
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
 
-		epssScores = append(epssScores, epssScore{
-			CVE:   cve,
-			Score: score,
-		})
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+// checkVulnPath checks that vulnPath is a writable directory, creating it first if create is set.
+func checkVulnPath(vulnPath string, create bool) error {
+	stat, err := os.Stat(vulnPath)
+	switch {
+	case errors.Is(err, os.ErrNotExist) && create:
+		if err := os.MkdirAll(vulnPath, 0o755); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrVulnPathNotWritable, vulnPath, err)
+		}
+	case err != nil:
+		return fmt.Errorf("%w: %s: %v", ErrVulnPathNotWritable, vulnPath, err)
+	case !stat.IsDir():
+		return fmt.Errorf("%w: %s: not a directory", ErrVulnPathNotWritable, vulnPath)
+	}
+
+	f, err := os.CreateTemp(vulnPath, ".write-check")
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrVulnPathNotWritable, vulnPath, err)
 	}
+	f.Close()
+	os.Remove(f.Name())
 
-	return epssScores, nil
+	return nil
 }
 
 const (
-	cisaKnownExploitsURL      = "https://www.cisa.gov/sites/default/files/feeds/known_exploited_vulnerabilities.json"
-	cisaKnownExploitsFilename = "known_exploited_vulnerabilities.json"
+	epssFeedsURL = "https://epss.cyentia.com"
+	epssFilename = "epss_scores-current.csv.gz"
 )
 
-// knownExploitedVulnerabilitiesCatalog represents the CISA Catalog of Known Exploited Vulnerabilities.
-type knownExploitedVulnerabilitiesCatalog struct {
-	Title           string                        `json:"title"`
-	CatalogVersion  string                        `json:"catalogVersion"`
-	DateReleased    time.Time                     `json:"dateReleased"`
-	Count           int                           `json:"count"`
-	Vulnerabilities []knownExploitedVulnerability `json:"vulnerabilities"`
+type downloadOptions struct {
+	baseURL        string
+	keepCompressed bool
+	userAgent      string
+	urlPolicy      URLPolicy
+	nvdYears       []int
+	epssDate       time.Time
+	minTLSVersion  uint16
+	validateCISA   bool
+	progress       []download.Option
+	epssCompressed bool
+	signatureKey   *download.MinisignPublicKey
 }
 
-// knownExploitedVulnerability represents a known exploit in the CISA catalog.
-type knownExploitedVulnerability struct {
-	CVEID string `json:"cveID"`
-	// remaining fields omitted
-	// VendorProject     string `json:"vendorProject"`
-	// Product           string `json:"product"`
-	// VulnerabilityName string `json:"vulnerabilityName"`
-	// DateAdded         time.time `json:"dateAdded"`
-	// ShortDescription  string `json:"shortDescription"`
-	// RequiredAction    string `json:"requiredAction"`
-	// DueDate           time.time `json:"dueDate"`
+// DownloadOption configures the behavior of the feed download functions.
+type DownloadOption func(o *downloadOptions)
+
+// WithBaseURL overrides the base URL the feed is downloaded from, e.g. to use a mirror. The URL must be allowed by
+// the URLPolicy.
+func WithBaseURL(baseURL string) DownloadOption {
+	return func(o *downloadOptions) {
+		o.baseURL = baseURL
+	}
 }
 
-// DownloadCISAKnownExploitsFeed downloads the CISA known exploited vulnerabilities feed.
-func DownloadCISAKnownExploitsFeed(vulnPath string) error {
-	path := filepath.Join(vulnPath, cisaKnownExploitsFilename)
+// WithKeepCompressed keeps the compressed file as delivered by the feed alongside the extracted one.
+func WithKeepCompressed() DownloadOption {
+	return func(o *downloadOptions) {
+		o.keepCompressed = true
+	}
+}
 
-	u, err := url.Parse(cisaKnownExploitsURL)
-	if err != nil {
-		return err
+// WithUserAgent sets the User-Agent header sent on the feed requests, instead of defaultUserAgent.
+func WithUserAgent(userAgent string) DownloadOption {
+	return func(o *downloadOptions) {
+		o.userAgent = userAgent
 	}
+}
 
-	client := fleethttp.NewClient()
-	err = download.Download(client, u, path)
-	if err != nil {
-		return fmt.Errorf("download cisa known exploits: %w", err)
+// WithURLPolicy sets the policy that the overridden feed URLs are validated against.
+func WithURLPolicy(policy URLPolicy) DownloadOption {
+	return func(o *downloadOptions) {
+		o.urlPolicy = policy
 	}
+}
 
-	return nil
+// WithMinTLSVersion sets the minimum TLS version of the connections to the feeds (e.g. tls.VersionTLS13), instead of
+// defaultMinTLSVersion. The downloads from servers that don't support it fail with ErrTLSVersionNotSupported.
+func WithMinTLSVersion(version uint16) DownloadOption {
+	return func(o *downloadOptions) {
+		o.minTLSVersion = version
+	}
 }
 
-// LoadCVEMeta loads the cvss scores, epss scores, and known exploits from the previously downloaded feeds and saves
-// them to the database.
-func LoadCVEMeta(ctx context.Context, logger log.Logger, vulnPath string, ds fleet.Datastore) error {
-	if !license.IsPremium(ctx) {
-		level.Info(logger).Log("msg", "skipping cve_meta parsing due to license check")
-		return nil
+// WithNVDYears restricts DownloadNVDCVEFeed to the yearly feeds of the given years, e.g. to repair a few corrupted
+// feeds. The feeds of the other years are left untouched. It has no effect on the other feeds.
+func WithNVDYears(years ...int) DownloadOption {
+	return func(o *downloadOptions) {
+		o.nvdYears = years
 	}
-	// load cvss scores
-	files, err := getNVDCVEFeedFiles(vulnPath)
-	if err != nil {
-		return fmt.Errorf("get nvd cve feeds: %w", err)
+}
+
+// WithEPSSDate makes DownloadEPSSFeed download the scores published on the given date instead of the current ones,
+// e.g. for reproducible historical scans. The scores are extracted to a file named after the date, see
+// EPSSFeedFilename, so that multiple dates can coexist. It has no effect on the other feeds.
+func WithEPSSDate(date time.Time) DownloadOption {
+	return func(o *downloadOptions) {
+		o.epssDate = date
 	}
+}
 
-	metaMap := make(map[string]fleet.CVEMeta)
+// WithEPSSProgress makes DownloadEPSSFeed report the progress of the download to fn, at most once per interval and
+// once more when it completes (see download.WithProgress). It has no effect on the other feeds.
+func WithEPSSProgress(fn download.ProgressFunc, interval time.Duration) DownloadOption {
+	return func(o *downloadOptions) {
+		o.progress = []download.Option{download.WithProgress(fn, interval)}
+	}
+}
 
-	for _, file := range files {
+// WithCISACatalogValidation makes DownloadCISAKnownExploitsFeed check that the downloaded catalog has the expected
+// structure, see ErrInvalidCISACatalog. It has no effect on the other feeds.
+func WithCISACatalogValidation() DownloadOption {
+	return func(o *downloadOptions) {
+		o.validateCISA = true
+	}
+}
 
-		// Load json files one at a time. Attempting to load them all uses too much memory, > 1 GB.
-		dict, err := cvefeed.LoadJSONDictionary(file)
-		if err != nil {
-			return err
+// WithEPSSCompressed makes DownloadEPSSFeed store the EPSS scores feed compressed, as delivered, instead of extracting
+// it. The scores are decompressed while being parsed, which saves the disk IO and space of the extracted file. A
+// previously extracted file is removed so that it isn't parsed instead. It has no effect on the other feeds.
+func WithEPSSCompressed() DownloadOption {
+	return func(o *downloadOptions) {
+		o.epssCompressed = true
+	}
+}
+
+// WithSignatureKey makes the feed downloads verify every feed against its detached minisign signature, published
+// next to it with a .minisig suffix (see download.WithSignature). A feed whose signature is missing or not made with
+// key fails to download, and the previously downloaded feed is kept. The NVD CVE feeds are then downloaded as yearly
+// feeds, like with WithNVDYears, as the incremental sync of the NVD feeds can't verify them.
+func WithSignatureKey(key *download.MinisignPublicKey) DownloadOption {
+	return func(o *downloadOptions) {
+		o.signatureKey = key
+	}
+}
+
+// fileOptions returns the options of the download of a feed file, opts and the verification of its signature.
+func (o downloadOptions) fileOptions(opts ...download.Option) []download.Option {
+	res := append([]download.Option{}, opts...)
+	if o.signatureKey != nil {
+		res = append(res, download.WithSignature(o.signatureKey))
+	}
+	return res
+}
+
+// EPSSFeedFilename returns the name of the extracted EPSS scores file of the given date, or of the current scores if
+// date is zero.
+func EPSSFeedFilename(date time.Time) string {
+	return strings.TrimSuffix(epssFeedGzipFilename(date), ".gz")
+}
+
+// epssFeedGzipFilename returns the name of the EPSS scores feed of the given date, as published, or of the current
+// scores if date is zero.
+func epssFeedGzipFilename(date time.Time) string {
+	if date.IsZero() {
+		return epssFilename
+	}
+	return fmt.Sprintf("epss_scores-%s.csv.gz", date.Format("2006-01-02"))
+}
+
+// ErrURLNotAllowed is returned when an overridden feed URL is not allowed by the URLPolicy.
+var ErrURLNotAllowed = errors.New("feed url not allowed")
+
+// URLPolicy restricts the URLs the feeds can be downloaded from when the default URLs are overridden. The zero value
+// only allows https URLs, to any host.
+type URLPolicy struct {
+	// AllowHTTP allows plain http URLs, e.g. for internal mirrors.
+	AllowHTTP bool
+	// AllowFile allows file URLs (e.g. file:///srv/feeds) that point to a local directory, e.g. for tests or
+	// air-gapped setups. The feeds are then copied from the local files instead of being requested over HTTP.
+	AllowFile bool
+	// AllowedHosts, if not empty, are the only hosts (without port) the URLs can point to.
+	AllowedHosts []string
+}
+
+// Validate parses rawURL and checks that it is allowed by the policy.
+func (p URLPolicy) Validate(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !p.AllowHTTP {
+			return nil, fmt.Errorf("%w: %s: http is not allowed, use https", ErrURLNotAllowed, rawURL)
+		}
+	case "file":
+		if !p.AllowFile {
+			return nil, fmt.Errorf("%w: %s: file urls are not allowed", ErrURLNotAllowed, rawURL)
 		}
+		if u.Host != "" && u.Host != "localhost" {
+			return nil, fmt.Errorf("%w: %s: file urls must be local", ErrURLNotAllowed, rawURL)
+		}
+		// the allowed hosts don't apply to local files
+		return u, nil
+	default:
+		return nil, fmt.Errorf("%w: %s: unsupported scheme %q", ErrURLNotAllowed, rawURL, u.Scheme)
+	}
 
-		for cve := range dict {
-			vuln, ok := dict[cve].(*feednvd.Vuln)
-			if !ok {
-				level.Error(logger).Log("msg", "unexpected type for Vuln interface", "cve", cve, "type", fmt.Sprintf("%T", dict[cve]))
-				continue
+	if len(p.AllowedHosts) > 0 {
+		host := u.Hostname()
+		allowed := false
+		for _, h := range p.AllowedHosts {
+			if strings.EqualFold(h, host) {
+				allowed = true
+				break
 			}
-			schema := vuln.Schema()
+		}
+		if !allowed {
+			return nil, fmt.Errorf("%w: %s: host %q is not in the allowed hosts", ErrURLNotAllowed, rawURL, host)
+		}
+	}
 
-			meta := fleet.CVEMeta{
-				CVE: cve,
-			}
+	return u, nil
+}
 
-			if schema.Impact.BaseMetricV3 != nil {
-				meta.CVSSScore = &schema.Impact.BaseMetricV3.CVSSV3.BaseScore
-			}
+// defaultMinTLSVersion is the minimum TLS version of the connections to the feeds when none is configured.
+const defaultMinTLSVersion = tls.VersionTLS12
 
-			if published, err := time.Parse(publishedDateFmt, schema.PublishedDate); err != nil {
-				level.Error(logger).Log("msg", "failed to parse published data", "cve", cve, "published_date", schema.PublishedDate, "err", err)
-			} else {
-				meta.Published = &published
-			}
+// ErrTLSVersionNotSupported is returned when a feed server doesn't support the minimum TLS version.
+var ErrTLSVersionNotSupported = errors.New("tls version not supported by server")
 
-			metaMap[cve] = meta
-		}
+// ParseTLSVersion parses a TLS version as written in the configuration, e.g. "1.2" for tls.VersionTLS12. An empty
+// version is parsed as zero, which selects defaultMinTLSVersion.
+func ParseTLSVersion(version string) (uint16, error) {
+	switch strings.TrimSpace(version) {
+	case "":
+		return 0, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported tls version: %q", version)
+	}
+}
+
+// validateMinTLSVersion checks that the minimum TLS version of the options is a known TLS version.
+func validateMinTLSVersion(o downloadOptions) error {
+	switch o.minTLSVersion {
+	case tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13:
+		return nil
+	default:
+		return fmt.Errorf("unsupported minimum tls version: %#x", o.minTLSVersion)
 	}
+}
 
-	// load epss scores
-	path := filepath.Join(vulnPath, strings.TrimSuffix(epssFilename, ".gz"))
+// defaultUserAgent returns the User-Agent header sent on the feed requests when none is configured.
+func defaultUserAgent() string {
+	return "fleet-vuln-sync/" + version.Version().Version
+}
 
-	epssScores, err := parseEPSSScoresFile(path)
-	if err != nil {
-		return fmt.Errorf("parse epss scores: %w", err)
+func newDownloadOptions(opts []DownloadOption) downloadOptions {
+	o := downloadOptions{userAgent: defaultUserAgent(), minTLSVersion: defaultMinTLSVersion}
+	for _, opt := range opts {
+		opt(&o)
 	}
+	return o
+}
 
-	for _, epssScore := range epssScores {
-		epssScore := epssScore // copy, don't take the address of loop variables
-		score, ok := metaMap[epssScore.CVE]
-		if !ok {
-			score.CVE = epssScore.CVE
-		}
-		score.EPSSProbability = &epssScore.Score
-		metaMap[epssScore.CVE] = score
+// userAgentTransport sets the User-Agent header on all the requests before handing them to the base transport.
+type userAgentTransport struct {
+	base      http.RoundTripper
+	userAgent string
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", t.userAgent)
+	return t.base.RoundTrip(req)
+}
+
+// withUserAgent makes client send userAgent on all of its requests.
+func withUserAgent(client *http.Client, userAgent string) *http.Client {
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
 	}
+	client.Transport = &userAgentTransport{base: base, userAgent: userAgent}
+	return client
+}
 
-	// load known exploits
-	path = filepath.Join(vulnPath, cisaKnownExploitsFilename)
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return err
+// fileTransport serves the requests of file URLs from the local filesystem and hands all the other requests to the
+// base transport.
+type fileTransport struct {
+	base http.RoundTripper
+	file http.RoundTripper
+}
+
+func (t *fileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme == "file" {
+		return t.file.RoundTrip(req)
 	}
+	return t.base.RoundTrip(req)
+}
 
-	var catalog knownExploitedVulnerabilitiesCatalog
-	if err := json.Unmarshal(b, &catalog); err != nil {
-		return fmt.Errorf("unmarshal cisa known exploited vulnerabilities catalog: %w", err)
+// minTLSVersionTransport reports the handshake failures caused by the minimum TLS version as
+// ErrTLSVersionNotSupported.
+type minTLSVersionTransport struct {
+	base       http.RoundTripper
+	minVersion uint16
+}
+
+func (t *minTLSVersionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	// the tls package doesn't export the protocol version alert
+	if err != nil && strings.Contains(err.Error(), "tls: protocol version not supported") {
+		return nil, fmt.Errorf("%w: %s doesn't support %s or later: %v", ErrTLSVersionNotSupported, req.URL.Host, tlsVersionName(t.minVersion), err)
 	}
+	return resp, err
+}
 
-	for _, vuln := range catalog.Vulnerabilities {
-		score, ok := metaMap[vuln.CVEID]
-		if !ok {
-			score.CVE = vuln.CVEID
-		}
-		score.CISAKnownExploit = ptr.Bool(true)
-		metaMap[vuln.CVEID] = score
+func tlsVersionName(version uint16) string {
+	switch version {
+	case tls.VersionTLS10:
+		return "TLS 1.0"
+	case tls.VersionTLS11:
+		return "TLS 1.1"
+	case tls.VersionTLS12:
+		return "TLS 1.2"
+	case tls.VersionTLS13:
+		return "TLS 1.3"
 	}
+	return fmt.Sprintf("TLS %#x", version)
+}
 
-	// The catalog only contains "known" exploits, meaning all other CVEs should have known exploit set to false.
-	for cve, meta := range metaMap {
-		if meta.CISAKnownExploit == nil {
-			meta.CISAKnownExploit = ptr.Bool(false)
+// withMinTLSVersion returns a copy of the transport rt that requires the TLS version minVersion or later.
+func withMinTLSVersion(rt http.RoundTripper, minVersion uint16) http.RoundTripper {
+	switch t := rt.(type) {
+	case nil:
+		return withMinTLSVersion(fleethttp.NewTransport(), minVersion)
+	case *http.Transport:
+		t = t.Clone()
+		if t.TLSClientConfig == nil {
+			t.TLSClientConfig = &tls.Config{MinVersion: minVersion}
+		} else {
+			t.TLSClientConfig = t.TLSClientConfig.Clone()
+			t.TLSClientConfig.MinVersion = minVersion
 		}
-		metaMap[cve] = meta
+		return t
+	case *oauth2.Transport:
+		// the github client of the network tests
+		clone := *t
+		clone.Base = withMinTLSVersion(t.Base, minVersion)
+		return &clone
 	}
+	return rt
+}
 
-	if len(metaMap) == 0 {
-		return nil
+// feedClient configures client to download the feeds according to the options. File URLs are only served if the
+// URLPolicy allows them, and redirects can't change the scheme, so that a remote feed can't redirect to a local file.
+func feedClient(client *http.Client, o downloadOptions) *http.Client {
+	client.Transport = &minTLSVersionTransport{
+		base:       withMinTLSVersion(client.Transport, o.minTLSVersion),
+		minVersion: o.minTLSVersion,
 	}
+	client = withUserAgent(client, o.userAgent)
+	if o.urlPolicy.AllowFile {
+		client.Transport = &fileTransport{base: client.Transport, file: http.NewFileTransport(http.Dir("/"))}
+	}
+	client.CheckRedirect = checkFeedRedirect
+	return client
+}
 
-	// convert to slice
-	var meta []fleet.CVEMeta
-	for _, score := range metaMap {
-		meta = append(meta, score)
+// checkFeedRedirect rejects the redirects to another scheme than the one of the original request, and stops after
+// 10 redirects as the default policy of http.Client does.
+func checkFeedRedirect(req *http.Request, via []*http.Request) error {
+	if from := via[0].URL.Scheme; req.URL.Scheme != from {
+		return fmt.Errorf("%w: redirect from %s to %s", ErrURLNotAllowed, from, req.URL.Redacted())
 	}
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	return nil
+}
 
-	insertCtx, cancel := context.WithTimeout(ctx, 1*time.Minute)
-	defer cancel()
-	if err := ds.InsertCVEMeta(insertCtx, meta); err != nil {
-		return fmt.Errorf("insert cve meta: %w", err)
+// DownloadEPSSFeed downloads the EPSS scores feed.
+func DownloadEPSSFeed(vulnPath string, opts ...DownloadOption) error {
+	o := newDownloadOptions(opts)
+	if err := validateMinTLSVersion(o); err != nil {
+		return err
 	}
 
-	return nil
+	if !o.epssDate.IsZero() {
+		// the scores of a date are published during that day (UTC) at the earliest
+		y, m, d := o.epssDate.Date()
+		if time.Date(y, m, d, 0, 0, 0, 0, time.UTC).After(time.Now().UTC()) {
+			return fmt.Errorf("epss date %s is in the future", o.epssDate.Format("2006-01-02"))
+		}
+	}
+
+	baseURL := epssFeedsURL
+	if o.baseURL != "" {
+		if _, err := o.urlPolicy.Validate(o.baseURL); err != nil {
+			return err
+		}
+		baseURL = o.baseURL
+	}
+
+	filename := epssFeedGzipFilename(o.epssDate)
+	urlString := strings.TrimSuffix(baseURL, "/") + "/" + filename
+	u, err := url.Parse(urlString)
+	if err != nil {
+		return fmt.Errorf("parse url: %w", err)
+	}
+	path := filepath.Join(vulnPath, strings.TrimSuffix(filename, ".gz"))
+
+	client := feedClient(fleethttp.NewClient(), o)
+	if o.epssCompressed {
+		if err := download.Download(client, u, filepath.Join(vulnPath, filename), o.fileOptions(o.progress...)...); err != nil {
+			return fmt.Errorf("download %s: %w", u, err)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove extracted epss feed: %w", err)
+		}
+		return nil
+	}
+	if !o.keepCompressed {
+		if err := download.DownloadAndExtract(client, u, path, o.fileOptions(o.progress...)...); err != nil {
+			return fmt.Errorf("download %s: %w", u, err)
+		}
+		return nil
+	}
+
+	gzPath := filepath.Join(vulnPath, filename)
+	if err := download.Download(client, u, gzPath, o.fileOptions(o.progress...)...); err != nil {
+		return fmt.Errorf("download %s: %w", u, err)
+	}
+	if err := extractGzipFile(gzPath, path); err != nil {
+		return fmt.Errorf("extract %s: %w", gzPath, err)
+	}
+
+	return nil
+}
+
+// extractGzipFile decompresses the gzip file at src into dst. dst is replaced atomically.
+func extractGzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	gr, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gr.Close()
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	defer tmp.Close()
+
+	if _, err := io.Copy(tmp, gr); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// epssScoresPath returns the path of the current EPSS scores file in vulnPath: the extracted file, or the compressed
+// one if the feed wasn't extracted (see WithEPSSCompressed). If neither exists, the path of the extracted file is
+// returned so that opening it fails with os.ErrNotExist.
+func epssScoresPath(vulnPath string) string {
+	path := filepath.Join(vulnPath, strings.TrimSuffix(epssFilename, ".gz"))
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	gzPath := filepath.Join(vulnPath, epssFilename)
+	if _, err := os.Stat(gzPath); err == nil {
+		return gzPath
+	}
+	return path
+}
+
+// gzipFileReader reads a gzip file decompressed.
+type gzipFileReader struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (r gzipFileReader) Close() error {
+	r.Reader.Close()
+	return r.f.Close()
+}
+
+// openEPSSScoresFile opens the EPSS scores file at path. A compressed file (.gz) is decompressed while being read.
+func openEPSSScoresFile(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return f, nil
+	}
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("gzip reader %s: %w", path, err)
+	}
+	return gzipFileReader{Reader: gr, f: f}, nil
+}
+
+// epssScore represents the EPSS score for a CVE.
+type epssScore struct {
+	CVE   string
+	Score float64
+	// ModelVersion is the version of the EPSS model that computed the score, e.g. v2023.03.01. It is empty if the feed
+	// doesn't say.
+	ModelVersion string
+}
+
+// epssHeaderField returns the value of the named field of the header comment of the EPSS feed, e.g. the model_version
+// of "#model_version:v2022.01.01,score_date:2022-06-03T00:00:00+0000", or an empty string if the field is missing.
+func epssHeaderField(header, name string) string {
+	for _, field := range strings.Split(strings.TrimPrefix(strings.TrimSpace(header), "#"), ",") {
+		if v := strings.TrimPrefix(field, name+":"); v != field {
+			return v
+		}
+	}
+	return ""
+}
+
+func parseEPSSScoresFile(path string) ([]epssScore, error) {
+	scores, _, err := parseEPSSScoresFileWithQuarantine(path, "")
+	return scores, err
+}
+
+// parseEPSSScoresFileWithQuarantine parses the EPSS scores file at path. If quarantinePath is set, the malformed rows
+// don't fail the parsing: they are written to a CSV file at quarantinePath, along with their line number and the
+// parse error, and skipped. It returns the number of quarantined rows. The quarantine file is only created if a row is
+// quarantined, the quarantine file of a previous parsing is removed.
+func parseEPSSScoresFileWithQuarantine(path, quarantinePath string) ([]epssScore, int, error) {
+	f, err := openEPSSScoresFile(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	if quarantinePath != "" {
+		if err := os.Remove(quarantinePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, 0, fmt.Errorf("remove previous quarantine file: %w", err)
+		}
+	}
+
+	br := bufio.NewReader(f)
+
+	// the feed may start with a comment holding the model version
+	var modelVersion string
+	// the lines read before the csv reader, so that the quarantined rows have their line number in the file
+	var headerLines int
+	if b, err := br.Peek(1); err == nil && b[0] == '#' {
+		header, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, 0, fmt.Errorf("read header: %w", err)
+		}
+		modelVersion = epssHeaderField(header, "model_version")
+		headerLines = 1
+	}
+
+	var quarantineFile *os.File
+	var quarantine *csv.Writer
+	var quarantined int
+	defer func() {
+		if quarantineFile != nil {
+			quarantineFile.Close()
+		}
+	}()
+	quarantineRow := func(line int, rec []string, rowErr error) error {
+		if quarantine == nil {
+			quarantineFile, err = os.Create(quarantinePath)
+			if err != nil {
+				return fmt.Errorf("create quarantine file: %w", err)
+			}
+			quarantine = csv.NewWriter(quarantineFile)
+			if err := quarantine.Write([]string{"line", "error", "row"}); err != nil {
+				return fmt.Errorf("write quarantine file: %w", err)
+			}
+		}
+		if err := quarantine.Write([]string{strconv.Itoa(headerLines + line), rowErr.Error(), strings.Join(rec, ",")}); err != nil {
+			return fmt.Errorf("write quarantine file: %w", err)
+		}
+		quarantined++
+		return nil
+	}
+
+	r := csv.NewReader(br)
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+
+	// skip the column names
+	r.Read() //nolint:errcheck
+
+	var epssScores []epssScore
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if quarantinePath == "" || !errors.As(err, &parseErr) {
+				return nil, 0, err
+			}
+			if err := quarantineRow(parseErr.StartLine, rec, parseErr.Err); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+
+		// each row should have 3 records: cve, epss, and percentile
+		if len(rec) != 3 {
+			continue
+		}
+
+		cve := rec[0]
+		score, err := strconv.ParseFloat(rec[1], 64)
+		if err != nil {
+			if quarantinePath == "" {
+				return nil, 0, fmt.Errorf("parse epss score: %w", err)
+			}
+			line, _ := r.FieldPos(0)
+			if err := quarantineRow(line, rec, fmt.Errorf("parse epss score: %w", err)); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+
+		// ignore percentile
+
+		epssScores = append(epssScores, epssScore{
+			CVE:          cve,
+			Score:        score,
+			ModelVersion: modelVersion,
+		})
+	}
+
+	if quarantine != nil {
+		quarantine.Flush()
+		if err := quarantine.Error(); err != nil {
+			return nil, 0, fmt.Errorf("write quarantine file: %w", err)
+		}
+		err := quarantineFile.Close()
+		quarantineFile = nil
+		if err != nil {
+			return nil, 0, fmt.Errorf("close quarantine file: %w", err)
+		}
+	}
+
+	return epssScores, quarantined, nil
+}
+
+// parseEPSSSnapshotFile parses the EPSS scores file at path, including the percentiles and the date of the scores
+// found in the header comment of the feed.
+func parseEPSSSnapshotFile(path string) ([]fleet.EPSSSnapshot, error) {
+	f, err := openEPSSScoresFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+
+	// the first line is a comment with the model version and the score date, e.g.
+	// #model_version:v2022.01.01,score_date:2022-06-03T00:00:00+0000
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	v := epssHeaderField(header, "score_date")
+	if v == "" {
+		return nil, errors.New("missing score date in header")
+	}
+	scoreDate, err := time.Parse("2006-01-02T15:04:05-0700", v)
+	if err != nil {
+		return nil, fmt.Errorf("parse score date: %w", err)
+	}
+	scoreDate = scoreDate.UTC().Truncate(24 * time.Hour)
+
+	r := csv.NewReader(br)
+	r.Comment = '#'
+	r.FieldsPerRecord = 3
+
+	// skip the column names
+	r.Read() //nolint:errcheck
+
+	var snapshots []fleet.EPSSSnapshot
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		score, err := strconv.ParseFloat(rec[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse epss score: %w", err)
+		}
+		percentile, err := strconv.ParseFloat(rec[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse epss percentile: %w", err)
+		}
+
+		snapshots = append(snapshots, fleet.EPSSSnapshot{
+			CVE:          rec[0],
+			SnapshotDate: scoreDate,
+			Score:        score,
+			Percentile:   percentile,
+		})
+	}
+
+	return snapshots, nil
+}
+
+// LoadEPSSSnapshot saves the scores of the previously downloaded EPSS feed as a snapshot dated with the feed's score
+// date. Unlike LoadCVEMeta, the scores of previous snapshots are kept.
+func LoadEPSSSnapshot(ctx context.Context, logger log.Logger, vulnPath string, ds fleet.Datastore) error {
+	if !license.IsPremium(ctx) {
+		level.Info(logger).Log("msg", "skipping epss snapshot loading due to license check")
+		return nil
+	}
+
+	snapshots, err := parseEPSSSnapshotFile(epssScoresPath(vulnPath))
+	if err != nil {
+		return fmt.Errorf("parse epss snapshot: %w", err)
+	}
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	insertCtx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+	defer cancel()
+	if err := ds.InsertEPSSSnapshots(insertCtx, snapshots); err != nil {
+		return fmt.Errorf("insert epss snapshots: %w", err)
+	}
+
+	return nil
+}
+
+const (
+	cisaFeedsURL              = "https://www.cisa.gov/sites/default/files/feeds"
+	cisaKnownExploitsFilename = "known_exploited_vulnerabilities.json"
+)
+
+// knownExploitedVulnerabilitiesCatalog represents the CISA Catalog of Known Exploited Vulnerabilities.
+type knownExploitedVulnerabilitiesCatalog struct {
+	Title           string                        `json:"title"`
+	CatalogVersion  string                        `json:"catalogVersion"`
+	DateReleased    time.Time                     `json:"dateReleased"`
+	Count           int                           `json:"count"`
+	Vulnerabilities []knownExploitedVulnerability `json:"vulnerabilities"`
+}
+
+// version returns the version of the catalog, as recorded once it's loaded.
+func (c knownExploitedVulnerabilitiesCatalog) version(loadedAt time.Time) fleet.CISACatalogVersion {
+	v := fleet.CISACatalogVersion{
+		CatalogVersion: c.CatalogVersion,
+		LoadedAt:       loadedAt,
+	}
+	if !c.DateReleased.IsZero() {
+		released := c.DateReleased.UTC()
+		v.DateReleased = &released
+	}
+	return v
+}
+
+// CISACatalogChanged returns whether the CISA known exploits catalog in vulnPath differs from the catalog last loaded
+// by LoadCVEMeta, based on the catalog version and release date. It returns true if no catalog was loaded yet.
+func CISACatalogChanged(ctx context.Context, ds fleet.Datastore, vulnPath string) (bool, error) {
+	b, err := os.ReadFile(filepath.Join(vulnPath, cisaKnownExploitsFilename))
+	if err != nil {
+		return false, err
+	}
+
+	var catalog knownExploitedVulnerabilitiesCatalog
+	if err := json.Unmarshal(b, &catalog); err != nil {
+		return false, fmt.Errorf("unmarshal cisa known exploited vulnerabilities catalog: %w", err)
+	}
+	current := catalog.version(time.Time{})
+
+	last, err := ds.LastCISACatalogVersion(ctx)
+	switch {
+	case fleet.IsNotFound(err):
+		return true, nil
+	case err != nil:
+		return false, fmt.Errorf("get last cisa catalog version: %w", err)
+	}
+
+	if current.CatalogVersion != last.CatalogVersion {
+		return true, nil
+	}
+	if current.DateReleased == nil || last.DateReleased == nil {
+		return current.DateReleased != last.DateReleased, nil
+	}
+	return !current.DateReleased.Equal(*last.DateReleased), nil
+}
+
+// knownExploitedVulnerability represents a known exploit in the CISA catalog.
+type knownExploitedVulnerability struct {
+	CVEID string `json:"cveID"`
+	// DateAdded and DueDate are when the vulnerability was added to the catalog and its remediation due date,
+	// formatted as cisaDateLayout.
+	DateAdded string `json:"dateAdded"`
+	DueDate   string `json:"dueDate"`
+	// remaining fields omitted
+	// VendorProject     string `json:"vendorProject"`
+	// Product           string `json:"product"`
+	// VulnerabilityName string `json:"vulnerabilityName"`
+	// ShortDescription  string `json:"shortDescription"`
+	// RequiredAction    string `json:"requiredAction"`
+}
+
+// cisaDateLayout is the layout of the dates of the vulnerabilities of the CISA catalog.
+const cisaDateLayout = "2006-01-02"
+
+// ErrInvalidCISACatalog is returned by DownloadCISAKnownExploitsFeed, with WithCISACatalogValidation, when the
+// downloaded catalog doesn't have the expected structure, e.g. because CISA changed it. Unmarshaling such a catalog
+// would silently result in no known exploits.
+var ErrInvalidCISACatalog = errors.New("invalid cisa known exploited vulnerabilities catalog")
+
+// DownloadCISAKnownExploitsFeed downloads the CISA known exploited vulnerabilities feed.
+func DownloadCISAKnownExploitsFeed(vulnPath string, opts ...DownloadOption) error {
+	o := newDownloadOptions(opts)
+	if err := validateMinTLSVersion(o); err != nil {
+		return err
+	}
+	path := filepath.Join(vulnPath, cisaKnownExploitsFilename)
+
+	baseURL := cisaFeedsURL
+	if o.baseURL != "" {
+		if _, err := o.urlPolicy.Validate(o.baseURL); err != nil {
+			return err
+		}
+		baseURL = o.baseURL
+	}
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/" + cisaKnownExploitsFilename)
+	if err != nil {
+		return err
+	}
+
+	client := feedClient(fleethttp.NewClient(), o)
+	err = download.Download(client, u, path, o.fileOptions()...)
+	if err != nil {
+		return fmt.Errorf("download cisa known exploits: %w", err)
+	}
+
+	if o.validateCISA {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if err := validateCISACatalog(b); err != nil {
+			// removed so that LoadCVEMeta keeps the stored known exploits rather than loading an empty catalog
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			return fmt.Errorf("download cisa known exploits: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateCISACatalog checks that b is a catalog with the fields that LoadCVEMeta reads: a catalog version, a release
+// date, and a list of vulnerabilities, each with a CVE ID, whose length matches the count of the catalog.
+func validateCISACatalog(b []byte) error {
+	var catalog map[string]json.RawMessage
+	if err := json.Unmarshal(b, &catalog); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCISACatalog, err)
+	}
+	for _, field := range []string{"catalogVersion", "dateReleased", "count", "vulnerabilities"} {
+		if _, ok := catalog[field]; !ok {
+			return fmt.Errorf("%w: missing field %q", ErrInvalidCISACatalog, field)
+		}
+	}
+
+	var (
+		version         string
+		released        time.Time
+		count           int
+		vulnerabilities []map[string]json.RawMessage
+	)
+	for _, f := range []struct {
+		name  string
+		value interface{}
+	}{
+		{"catalogVersion", &version},
+		{"dateReleased", &released},
+		{"count", &count},
+		{"vulnerabilities", &vulnerabilities},
+	} {
+		if err := json.Unmarshal(catalog[f.name], f.value); err != nil {
+			return fmt.Errorf("%w: field %q: %v", ErrInvalidCISACatalog, f.name, err)
+		}
+	}
+	if version == "" {
+		return fmt.Errorf("%w: empty catalogVersion", ErrInvalidCISACatalog)
+	}
+	if count != len(vulnerabilities) {
+		return fmt.Errorf("%w: count is %d but there are %d vulnerabilities", ErrInvalidCISACatalog, count, len(vulnerabilities))
+	}
+
+	for i, vuln := range vulnerabilities {
+		var cveID string
+		if err := json.Unmarshal(vuln["cveID"], &cveID); err != nil || cveID == "" {
+			return fmt.Errorf("%w: vulnerability %d has no cveID", ErrInvalidCISACatalog, i)
+		}
+	}
+	return nil
+}
+
+type loadCVEMetaOptions struct {
+	sources      FeedSource
+	incremental  bool
+	provenance   bool
+	subscores    bool
+	workers      int
+	checkpoint   string
+	staleness    time.Duration
+	lastModified bool
+	matchFilter  bool
+	epssModels   bool
+	report       bool
+	quarantine   string
+	cveSources   []CVESource
+	fleetTrend   bool
+	lock         bool
+	lockWait     bool
+	tx           fleet.CVEMetaTx
+	products     bool
+	cwes         bool
+	skipEPSSOnly bool
+	prune        bool
+}
+
+// LoadCVEMetaOption configures the behavior of LoadCVEMeta.
+type LoadCVEMetaOption func(o *loadCVEMetaOptions)
+
+// WithFeedSources restricts LoadCVEMeta to the given set of feed sources. The feeds of any other source are not
+// read, even if present, and the fields they provide are left empty.
+func WithFeedSources(sources FeedSource) LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.sources = sources
+	}
+}
+
+// WithIncremental makes LoadCVEMeta apply the parsed feeds as a partial update, e.g. when only the "modified" NVD
+// feed was downloaded. The parsed CVEs are upserted without clearing the fields that were not parsed, and the CVEs
+// missing from the CISA catalog are not marked as not being known exploits.
+func WithIncremental() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.incremental = true
+	}
+}
+
+// WithProvenance makes LoadCVEMeta record, for every loaded CVE field, the name of the feed file the value was read
+// from and when it was loaded.
+func WithProvenance() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.provenance = true
+	}
+}
+
+// WithCVSSSubscores makes LoadCVEMeta also load the CVSS v3 exploitability and impact subscores and the vector
+// string of the CVEs.
+func WithCVSSSubscores() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.subscores = true
+	}
+}
+
+// WithLastModified makes LoadCVEMeta also load the date at which NIST last modified the record of the CVEs. Along with
+// WithIncremental and the "modified" NVD feed, it tells which CVEs changed and when.
+func WithLastModified() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.lastModified = true
+	}
+}
+
+// WithSoftwareMatchFilter makes LoadCVEMeta only save the metadata of the CVEs that could match the software of the
+// fleet, i.e. whose NVD configurations include the vendor and product of one of the software CPEs. The CVEs that are
+// not in the NVD feed, or that have no configuration yet, are skipped too. It saves space on deployments with a narrow
+// software inventory, but the metadata of a CVE is only saved once matching software is in the inventory.
+func WithSoftwareMatchFilter() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.matchFilter = true
+	}
+}
+
+// WithEPSSModelVersions makes LoadCVEMeta also save the EPSS scores tagged with the version of the EPSS model that
+// computed them, as read from the header of the feed. The scores of every model version loaded are kept side by side,
+// so that they can be compared after EPSS revises its model. The EPSS probability of the CVE metadata is still the
+// score of the current feed. Scores from a feed without a model version are not tagged.
+func WithEPSSModelVersions() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.epssModels = true
+	}
+}
+
+// WithAffectedProducts makes LoadCVEMeta also save the vendor and product of the CPEs of the NVD configurations of the
+// CVEs, so that the CVEs affecting a product can be listed whether or not it's installed, see
+// fleet.Datastore.CVEsByVendorProduct. The configurations that match any vendor or product are ignored.
+func WithAffectedProducts() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.products = true
+	}
+}
+
+// WithCWEs makes LoadCVEMeta also save the Common Weakness Enumeration (CWE) types of the CVEs, as read from the
+// problem types of the NVD feeds, so that the CVEs of a weakness can be listed, see fleet.Datastore.CVEsByCWE. The
+// NVD-CWE-Other and NVD-CWE-noinfo placeholders are ignored.
+func WithCWEs() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.cwes = true
+	}
+}
+
+// WithoutEPSSOnly makes LoadCVEMeta skip the CVEs whose only metadata is an EPSS score, i.e. that are in the EPSS
+// scores feed but not in the NVD feeds, the CISA catalog or the additional sources (see WithCVESources). These are
+// mostly CVEs that are yet to be analyzed and can't match any software, skipping them saves a lot of rows.
+func WithoutEPSSOnly() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.skipEPSSOnly = true
+	}
+}
+
+// WithPrune makes LoadCVEMeta delete the stored metadata of the CVEs that are no longer in any of the loaded feeds and
+// sources, e.g. because they were rejected by NVD, along with their provenance, EPSS model scores, products and CWEs.
+// Only full loads prune: the prune is skipped, with a warning, when the load is incremental, when it's restricted to
+// some of the feed sources, when a feed is missing or unreadable, or when the yearly NVD feeds of some years up to the
+// current one are missing.
+// It can't be combined with WithTx. The number of CVEs deleted is returned in the Pruned of the LoadCVEMetaResult.
+func WithPrune() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.prune = true
+	}
+}
+
+// WithReport makes LoadCVEMeta compute a LoadReport of the coverage of the loaded CVEs by the feeds, log it and return
+// it in the Report of the LoadCVEMetaResult.
+func WithReport() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.report = true
+	}
+}
+
+// WithEPSSQuarantine makes LoadCVEMeta skip the malformed rows of the EPSS scores feed instead of failing, and write
+// them to a CSV file at path for later inspection. The number of quarantined rows is returned in the
+// QuarantinedEPSSRows of the LoadCVEMetaResult.
+func WithEPSSQuarantine(path string) LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.quarantine = path
+	}
+}
+
+// WithCVESources makes LoadCVEMeta also load the metadata of the given sources, after the built-in feeds. The values
+// of the sources take precedence over those of the built-in feeds, and are loaded regardless of WithFeedSources. Their
+// provenance isn't recorded.
+func WithCVESources(sources ...CVESource) LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.cveSources = append(o.cveSources, sources...)
+	}
+}
+
+// WithFleetCVETrend makes LoadCVEMeta record a snapshot of the number of distinct CVEs affecting the hosts of the
+// fleet once the metadata is saved, one per day, so that their trend can be charted (see fleet.Datastore's
+// FleetCVETrend). A snapshot of the number of CVEs affecting each host is recorded along with it (see HostCVETrend).
+// Failing to record either the fleet or the host snapshots fails the load. The fleet is counted in the datastore, so
+// that it can't be combined with WithTx, whose metadata wouldn't be visible to the count yet.
+func WithFleetCVETrend() LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.fleetTrend = true
+	}
+}
+
+// WithLoadLock makes LoadCVEMeta hold the CVE metadata load lock of the datastore while it saves the metadata, so
+// that overlapping loads (e.g. from two Fleet instances) don't interleave their writes. If another load holds the
+// lock, LoadCVEMeta waits for it when wait is true, and fails with fleet.ErrCVEMetaLoadInProgress otherwise. It can't
+// be combined with WithTx, as the lock would be released before the transaction is committed.
+func WithLoadLock(wait bool) LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.lock = true
+		o.lockWait = wait
+	}
+}
+
+// WithTx makes LoadCVEMeta save the metadata in the transaction tx (see fleet.Datastore.WithCVEMetaTx) instead of
+// directly in the datastore, so that it is discarded if the transaction is rolled back. The writes use the context
+// passed to LoadCVEMeta, without the timeout LoadCVEMeta applies otherwise. It can't be combined with WithCheckpoint,
+// whose checkpoint would outlive a rolled back transaction.
+func WithTx(tx fleet.CVEMetaTx) LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.tx = tx
+	}
+}
+
+// WithParseWorkers makes LoadCVEMeta extract the metadata of the CVEs of each NVD feed using n concurrent workers.
+// The loaded metadata is the same regardless of the number of workers. Defaults to 1.
+func WithParseWorkers(n int) LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.workers = n
+	}
+}
+
+// WithCheckpoint makes LoadCVEMeta insert the metadata in batches and record the completed batches in a checkpoint
+// file at path. If a load fails, the next load of the same feeds resumes from the first batch that wasn't inserted.
+// The checkpoint is removed once a load succeeds.
+func WithCheckpoint(path string) LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.checkpoint = path
+	}
+}
+
+// WithStalenessThreshold makes LoadCVEMeta report the feed files last modified more than threshold ago, e.g. because
+// the feeds haven't been synced recently. Stale feeds are still loaded, they are only logged and returned in the
+// StaleFeeds of the LoadCVEMetaResult.
+func WithStalenessThreshold(threshold time.Duration) LoadCVEMetaOption {
+	return func(o *loadCVEMetaOptions) {
+		o.staleness = threshold
+	}
+}
+
+// cveProvenance collects the provenance of the CVE fields loaded by LoadCVEMeta. A nil *cveProvenance collects
+// nothing.
+type cveProvenance struct {
+	loadedAt time.Time
+	entries  []fleet.CVEMetaProvenance
+}
+
+func (p *cveProvenance) add(cve, field, source string) {
+	if p == nil {
+		return
+	}
+	p.entries = append(p.entries, fleet.CVEMetaProvenance{
+		CVE:      cve,
+		Field:    field,
+		Source:   source,
+		LoadedAt: p.loadedAt,
+	})
+}
+
+// nvdCVEMeta is the metadata of a CVE extracted from a NVD feed, along with the names of the fields that were set.
+type nvdCVEMeta struct {
+	meta   fleet.CVEMeta
+	fields []string
+	// cvssV2Only is whether the CVE only has a CVSS v2 score, which isn't loaded.
+	cvssV2Only bool
+	// products are the products affected by the CVE, only extracted with WithAffectedProducts.
+	products []fleet.CVEProduct
+	// cwes are the weaknesses of the CVE, only extracted with WithCWEs.
+	cwes []fleet.CVECWE
+}
+
+// extractNVDFeedMeta extracts the metadata of all the CVEs of the NVD feed, spreading the work over the number of
+// workers set in the options. The results are returned in no particular order.
+func extractNVDFeedMeta(logger log.Logger, dict cvefeed.Dictionary, o loadCVEMetaOptions) []nvdCVEMeta {
+	results := make([]nvdCVEMeta, 0, len(dict))
+
+	if o.workers <= 1 {
+		for cve, vuln := range dict {
+			if extracted, ok := extractNVDCVEMeta(logger, cve, vuln, o); ok {
+				results = append(results, extracted)
+			}
+		}
+		return results
+	}
+
+	cves := make(chan string)
+	extractedCh := make(chan nvdCVEMeta)
+
+	var wg sync.WaitGroup
+	for i := 0; i < o.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for cve := range cves {
+				// the dictionary is only read concurrently
+				if extracted, ok := extractNVDCVEMeta(logger, cve, dict[cve], o); ok {
+					extractedCh <- extracted
+				}
+			}
+		}()
+	}
+
+	go func() {
+		for cve := range dict {
+			cves <- cve
+		}
+		close(cves)
+		wg.Wait()
+		close(extractedCh)
+	}()
+
+	for extracted := range extractedCh {
+		results = append(results, extracted)
+	}
+	return results
+}
+
+// extractNVDCVEMeta extracts the metadata of a single CVE of a NVD feed. It returns false if the CVE can't be
+// processed.
+func extractNVDCVEMeta(logger log.Logger, cve string, v cvefeed.Vuln, o loadCVEMetaOptions) (nvdCVEMeta, bool) {
+	vuln, ok := v.(*feednvd.Vuln)
+	if !ok {
+		level.Error(logger).Log("msg", "unexpected type for Vuln interface", "cve", cve, "type", fmt.Sprintf("%T", v))
+		return nvdCVEMeta{}, false
+	}
+	schema := vuln.Schema()
+
+	extracted := nvdCVEMeta{
+		meta: fleet.CVEMeta{
+			CVE: cve,
+		},
+	}
+
+	// the impact is missing from the items that are yet to be analyzed
+	switch {
+	case schema.Impact == nil:
+	case schema.Impact.BaseMetricV3 != nil:
+		extracted.meta.CVSSScore = &schema.Impact.BaseMetricV3.CVSSV3.BaseScore
+		extracted.meta.CVSSSource = ptr.String(fleet.CVSSSourceNVD)
+		extracted.fields = append(extracted.fields, "cvss_score")
+
+		if o.subscores {
+			metricV3 := schema.Impact.BaseMetricV3
+			extracted.meta.CVSSExploitabilityScore = ptr.Float64(metricV3.ExploitabilityScore)
+			extracted.meta.CVSSImpactScore = ptr.Float64(metricV3.ImpactScore)
+			extracted.meta.CVSSVector = ptr.String(metricV3.CVSSV3.VectorString)
+			extracted.fields = append(extracted.fields, "cvss_exploitability_score", "cvss_impact_score", "cvss_vector")
+		}
+	case schema.Impact.BaseMetricV2 != nil:
+		extracted.cvssV2Only = true
+	}
+
+	if published, err := parseNVDDate(schema.PublishedDate); err != nil {
+		level.Error(logger).Log("msg", "failed to parse published data", "cve", cve, "published_date", schema.PublishedDate, "err", err)
+	} else {
+		extracted.meta.Published = &published
+		extracted.fields = append(extracted.fields, "published")
+	}
+
+	if o.lastModified {
+		// a date that can't be parsed is left unset, it must not fail the load
+		if lastModified, err := parseNVDDate(schema.LastModifiedDate); err != nil {
+			level.Error(logger).Log("msg", "failed to parse last modified date", "cve", cve, "last_modified_date", schema.LastModifiedDate, "err", err)
+		} else {
+			extracted.meta.LastModified = &lastModified
+			extracted.fields = append(extracted.fields, "last_modified")
+		}
+	}
+
+	if o.products && schema.Configurations != nil {
+		seen := make(map[softwareProduct]bool)
+		walkVulnerableCPEs(schema.Configurations.Nodes, func(cpe string) {
+			attr, err := wfn.Parse(cpe)
+			if err != nil {
+				level.Debug(logger).Log("msg", "skipping invalid configuration cpe", "cve", cve, "cpe", cpe, "err", err)
+				return
+			}
+			p := softwareProduct{vendor: attr.Vendor, product: attr.Product}
+			if isLogicalWFNValue(p.vendor) || isLogicalWFNValue(p.product) || seen[p] {
+				return
+			}
+			seen[p] = true
+			extracted.products = append(extracted.products, fleet.CVEProduct{CVE: cve, Vendor: p.vendor, Product: p.product})
+		})
+	}
+
+	if o.cwes && schema.CVE != nil && schema.CVE.Problemtype != nil {
+		seen := make(map[string]bool)
+		for _, data := range schema.CVE.Problemtype.ProblemtypeData {
+			if data == nil {
+				continue
+			}
+			for _, desc := range data.Description {
+				// NVD-CWE-Other and NVD-CWE-noinfo are not weaknesses of the CWE list
+				if desc == nil || !strings.HasPrefix(desc.Value, "CWE-") || seen[desc.Value] {
+					continue
+				}
+				seen[desc.Value] = true
+				extracted.cwes = append(extracted.cwes, fleet.CVECWE{CVE: cve, CWE: desc.Value})
+			}
+		}
+	}
+
+	return extracted, true
+}
+
+// walkVulnerableCPEs calls fn with the CPE of every vulnerable match of the configuration nodes and their children.
+// The CPEs of the platforms the vulnerable software runs on, and of the negated nodes, are skipped.
+func walkVulnerableCPEs(nodes []*feednvdschema.NVDCVEFeedJSON10DefNode, fn func(cpe string)) {
+	for _, node := range nodes {
+		if node == nil || node.Negate {
+			continue
+		}
+		for _, match := range node.CPEMatch {
+			if match != nil && match.Vulnerable {
+				fn(match.Cpe23Uri)
+			}
+		}
+		walkVulnerableCPEs(node.Children, fn)
+	}
+}
+
+// isLogicalWFNValue returns whether v is the ANY or NA value of a WFN attribute rather than an actual name.
+func isLogicalWFNValue(v string) bool {
+	return v == wfn.Any || v == wfn.NA || v == ""
+}
+
+// LoadCVEMeta loads the cvss scores, epss scores, and known exploits from the previously downloaded feeds and saves
+// them to the database.
+func LoadCVEMeta(ctx context.Context, logger log.Logger, vulnPath string, ds fleet.Datastore, opts ...LoadCVEMetaOption) error {
+	_, err := LoadCVEMetaWithResult(ctx, logger, vulnPath, ds, opts...)
+	return err
+}
+
+// LoadCVEMetaResult describes a successful LoadCVEMeta.
+type LoadCVEMetaResult struct {
+	// Loaded is the number of CVEs whose metadata was saved.
+	Loaded int
+	// StaleFeeds are the feed files that were loaded even though they are older than the staleness threshold set with
+	// WithStalenessThreshold. They don't make the load fail.
+	StaleFeeds []StaleFeed
+	// Report is the coverage of the loaded CVEs by the feeds, only set with WithReport.
+	Report *LoadReport
+	// QuarantinedEPSSRows is the number of malformed rows of the EPSS scores feed that were skipped, see
+	// WithEPSSQuarantine.
+	QuarantinedEPSSRows int
+	// SkippedFeeds are the NVD feed files that couldn't be read, e.g. because they are corrupt. They are skipped
+	// rather than making the whole load fail, and the metadata already stored for their CVEs is kept.
+	SkippedFeeds []string
+	// Pruned is the number of CVEs whose metadata was deleted because they are no longer in the feeds, see WithPrune.
+	Pruned int
+}
+
+// The reasons for which LoadCVEMeta skips a CVE, see LoadReport.Skipped.
+const (
+	// SkipReasonUnexpectedType is for the CVEs of the NVD feeds that couldn't be processed.
+	SkipReasonUnexpectedType = "unexpected_type"
+	// SkipReasonNoSoftwareMatch is for the CVEs that can't match the software of the fleet, see
+	// WithSoftwareMatchFilter.
+	SkipReasonNoSoftwareMatch = "no_software_match"
+	// SkipReasonEPSSOnly is for the CVEs whose only metadata is an EPSS score, see WithoutEPSSOnly.
+	SkipReasonEPSSOnly = "epss_only"
+)
+
+// LoadReport counts the CVEs processed by LoadCVEMeta and the feeds their metadata came from. A sudden drop of one of
+// the counts from one load to the next usually means that a feed download went wrong.
+type LoadReport struct {
+	// Processed is the number of distinct CVEs read from the feeds, including the skipped ones.
+	Processed int
+	// CVSSV3 is the number of saved CVEs with a CVSS v3 score.
+	CVSSV3 int
+	// UnscoredCVSSV2 is the number of saved CVEs without a CVSS score because they only have a CVSS v2 one. Only v3
+	// scores are loaded, there's no fallback to the v2 score.
+	UnscoredCVSSV2 int
+	// EPSS is the number of saved CVEs with an EPSS score.
+	EPSS int
+	// KnownExploit is the number of saved CVEs that are known exploits according to CISA.
+	KnownExploit int
+	// Skipped is the number of CVEs that were not saved, by reason (e.g. SkipReasonNoSoftwareMatch).
+	Skipped map[string]int
+}
+
+// StaleFeed is a feed file older than the staleness threshold.
+type StaleFeed struct {
+	Path    string
+	ModTime time.Time
+	Age     time.Duration
+}
+
+// LoadCVEMetaWithResult is LoadCVEMeta, but also returns the result of the load.
+func LoadCVEMetaWithResult(ctx context.Context, logger log.Logger, vulnPath string, ds fleet.Datastore, opts ...LoadCVEMetaOption) (*LoadCVEMetaResult, error) {
+	result := &LoadCVEMetaResult{}
+	if !license.IsPremium(ctx) {
+		level.Info(logger).Log("msg", "skipping cve_meta parsing due to license check")
+		return result, nil
+	}
+
+	var o loadCVEMetaOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.tx != nil && o.checkpoint != "" {
+		return nil, errors.New("a checkpoint can't be used with a transaction")
+	}
+	if o.tx != nil && o.prune {
+		return nil, errors.New("a prune can't be used with a transaction")
+	}
+	if o.tx != nil && o.fleetTrend {
+		return nil, errors.New("a fleet cve trend can't be recorded with a transaction")
+	}
+	if o.tx != nil && o.lock {
+		return nil, errors.New("a load lock can't be used with a transaction")
+	}
+
+	metaMap := make(map[string]fleet.CVEMeta)
+	// the feed files that were read, they identify the load when checkpointing
+	var feedFiles []string
+
+	// the CVEs that only have a CVSS v2 score and the CVEs that were skipped, for the report
+	cvssV2Only := make(map[string]bool)
+	skipped := make(map[string]string)
+
+	// the products affected by the CVEs, only with WithAffectedProducts
+	var cveProducts []fleet.CVEProduct
+	// the weaknesses of the CVEs, only with WithCWEs
+	var cveCWEs []fleet.CVECWE
+
+	var prov *cveProvenance
+	if o.provenance {
+		prov = &cveProvenance{loadedAt: time.Now().UTC()}
+	}
+
+	// the CVEs that could match the software of the fleet, when filtering on them
+	var matchable map[string]bool
+	var products map[softwareProduct]bool
+	if o.matchFilter {
+		var err error
+		products, err = listSoftwareProducts(ctx, ds)
+		if err != nil {
+			return nil, fmt.Errorf("list software products: %w", err)
+		}
+		matchable = make(map[string]bool)
+	}
+
+	// The epss and cisa files can be missing if their download failed, and NVD feed files can be corrupt. Rather than
+	// losing the data of the other feeds, the load carries on without them and keeps the values already stored for
+	// their fields.
+	var missingFeeds bool
+
+	// load cvss scores
+	if o.sources.Has(FeedSourceNVD) {
+		files, err := getNVDCVEFeedFiles(vulnPath)
+		if err != nil {
+			return nil, fmt.Errorf("get nvd cve feeds: %w", err)
+		}
+
+		for _, file := range files {
+
+			// Load json files one at a time. Attempting to load them all uses too much memory, > 1 GB.
+			dict, err := loadNVDCVEFeed(file)
+			if err != nil {
+				level.Error(logger).Log("msg", "skipping unreadable nvd feed", "path", file, "err", err)
+				result.SkippedFeeds = append(result.SkippedFeeds, file)
+				missingFeeds = true
+				continue
+			}
+			feedFiles = append(feedFiles, file)
+
+			if o.matchFilter {
+				for cve, vuln := range dict {
+					if vulnMatchesProducts(vuln, products) {
+						matchable[cve] = true
+					}
+				}
+			}
+
+			source := filepath.Base(file)
+			extractedCVEs := make(map[string]bool, len(dict))
+			for _, extracted := range extractNVDFeedMeta(logger, dict, o) {
+				metaMap[extracted.meta.CVE] = extracted.meta
+				cvssV2Only[extracted.meta.CVE] = extracted.cvssV2Only
+				cveProducts = append(cveProducts, extracted.products...)
+				cveCWEs = append(cveCWEs, extracted.cwes...)
+				extractedCVEs[extracted.meta.CVE] = true
+				for _, field := range extracted.fields {
+					prov.add(extracted.meta.CVE, field, source)
+				}
+			}
+			for cve := range dict {
+				if !extractedCVEs[cve] {
+					skipped[cve] = SkipReasonUnexpectedType
+				}
+			}
+		}
+	}
+
+	var cisaVersion *fleet.CISACatalogVersion
+	var modelScores []fleet.EPSSModelScore
+	// the CVEs only known from the EPSS scores so far
+	epssOnly := make(map[string]bool)
+
+	// load epss scores
+	if o.sources.Has(FeedSourceEPSS) {
+		path := epssScoresPath(vulnPath)
+
+		epssScores, quarantined, err := parseEPSSScoresFileWithQuarantine(path, o.quarantine)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			level.Warn(logger).Log("msg", "epss scores file not found, skipping epss scores", "path", path)
+			missingFeeds = true
+		case err != nil:
+			return nil, fmt.Errorf("parse epss scores: %w", err)
+		default:
+			feedFiles = append(feedFiles, path)
+		}
+		if quarantined > 0 {
+			level.Warn(logger).Log("msg", "quarantined malformed epss scores", "count", quarantined, "quarantine", o.quarantine)
+			result.QuarantinedEPSSRows = quarantined
+		}
+
+		for _, epssScore := range epssScores {
+			epssScore := epssScore // copy, don't take the address of loop variables
+			score, ok := metaMap[epssScore.CVE]
+			if !ok {
+				score.CVE = epssScore.CVE
+				epssOnly[epssScore.CVE] = true
+			}
+			score.EPSSProbability = &epssScore.Score
+			metaMap[epssScore.CVE] = score
+			prov.add(epssScore.CVE, "epss_probability", filepath.Base(path))
+
+			if o.epssModels && epssScore.ModelVersion != "" {
+				modelScores = append(modelScores, fleet.EPSSModelScore{
+					CVE:          epssScore.CVE,
+					ModelVersion: epssScore.ModelVersion,
+					Score:        epssScore.Score,
+				})
+			}
+		}
+		if o.epssModels && len(epssScores) > 0 && len(modelScores) == 0 {
+			level.Warn(logger).Log("msg", "epss scores file has no model version, skipping epss model scores", "path", path)
+		}
+	}
+
+	// load known exploits
+	if o.sources.Has(FeedSourceCISA) {
+		path := filepath.Join(vulnPath, cisaKnownExploitsFilename)
+		b, err := os.ReadFile(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			level.Warn(logger).Log("msg", "cisa known exploits file not found, skipping known exploits", "path", path)
+			missingFeeds = true
+		case err != nil:
+			return nil, err
+		default:
+			var catalog knownExploitedVulnerabilitiesCatalog
+			if err := json.Unmarshal(b, &catalog); err != nil {
+				return nil, fmt.Errorf("unmarshal cisa known exploited vulnerabilities catalog: %w", err)
+			}
+			version := catalog.version(time.Now().UTC())
+			cisaVersion = &version
+			feedFiles = append(feedFiles, path)
+
+			for _, vuln := range catalog.Vulnerabilities {
+				score, ok := metaMap[vuln.CVEID]
+				if !ok {
+					score.CVE = vuln.CVEID
+				}
+				score.CISAKnownExploit = ptr.Bool(true)
+				delete(epssOnly, vuln.CVEID)
+				prov.add(vuln.CVEID, "cisa_known_exploit", cisaKnownExploitsFilename)
+				for _, date := range []struct {
+					field string
+					value string
+					dst   **time.Time
+				}{
+					{"cisa_date_added", vuln.DateAdded, &score.CISADateAdded},
+					{"cisa_due_date", vuln.DueDate, &score.CISADueDate},
+				} {
+					if date.value == "" {
+						continue
+					}
+					parsed, err := time.Parse(cisaDateLayout, date.value)
+					if err != nil {
+						level.Warn(logger).Log("msg", "invalid cisa date", "cve", vuln.CVEID, "field", date.field, "value", date.value, "err", err)
+						continue
+					}
+					*date.dst = &parsed
+					prov.add(vuln.CVEID, date.field, cisaKnownExploitsFilename)
+				}
+				metaMap[vuln.CVEID] = score
+			}
+
+			// The catalog only contains "known" exploits, meaning all other CVEs should have known exploit set to false.
+			// This is skipped in incremental mode, where the parsed CVEs are only a subset of all the CVEs.
+			if !o.incremental {
+				for cve, meta := range metaMap {
+					if meta.CISAKnownExploit == nil {
+						meta.CISAKnownExploit = ptr.Bool(false)
+						prov.add(cve, "cisa_known_exploit", cisaKnownExploitsFilename)
+					}
+					metaMap[cve] = meta
+				}
+			}
+		}
+	}
+
+	// load the additional sources
+	var sourcesMeta []fleet.CVEMeta
+	for i, source := range o.cveSources {
+		metas, err := source.Load(ctx, vulnPath)
+		if err != nil {
+			return nil, fmt.Errorf("load CVE source %d (%T): %w", i, source, err)
+		}
+		for _, m := range metas {
+			meta := metaMap[m.CVE]
+			mergeCVEMeta(&meta, m)
+			metaMap[m.CVE] = meta
+			delete(epssOnly, m.CVE)
+		}
+		sourcesMeta = append(sourcesMeta, metas...)
+	}
+
+	if o.matchFilter {
+		for cve := range metaMap {
+			if !matchable[cve] {
+				delete(metaMap, cve)
+				skipped[cve] = SkipReasonNoSoftwareMatch
+			}
+		}
+	}
+	if o.skipEPSSOnly {
+		for cve := range epssOnly {
+			if _, ok := metaMap[cve]; ok {
+				delete(metaMap, cve)
+				skipped[cve] = SkipReasonEPSSOnly
+			}
+		}
+	}
+	if o.matchFilter || o.skipEPSSOnly {
+		// drop the rest of the data of the skipped CVEs
+		if prov != nil {
+			entries := prov.entries[:0]
+			for _, entry := range prov.entries {
+				if _, ok := metaMap[entry.CVE]; ok {
+					entries = append(entries, entry)
+				}
+			}
+			prov.entries = entries
+		}
+		scores := modelScores[:0]
+		for _, score := range modelScores {
+			if _, ok := metaMap[score.CVE]; ok {
+				scores = append(scores, score)
+			}
+		}
+		modelScores = scores
+		affected := cveProducts[:0]
+		for _, p := range cveProducts {
+			if _, ok := metaMap[p.CVE]; ok {
+				affected = append(affected, p)
+			}
+		}
+		cveProducts = affected
+		weaknesses := cveCWEs[:0]
+		for _, cwe := range cveCWEs {
+			if _, ok := metaMap[cwe.CVE]; ok {
+				weaknesses = append(weaknesses, cwe)
+			}
+		}
+		cveCWEs = weaknesses
+	}
+
+	if o.staleness > 0 {
+		staleFeeds, err := findStaleFeeds(feedFiles, o.staleness, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("check feeds staleness: %w", err)
+		}
+		for _, feed := range staleFeeds {
+			level.Warn(logger).Log("msg", "loading stale feed", "path", feed.Path, "age", feed.Age)
+		}
+		result.StaleFeeds = staleFeeds
+	}
+
+	if o.report {
+		result.Report = newLoadReport(metaMap, cvssV2Only, skipped)
+		level.Info(logger).Log(
+			"msg", "cve metadata load report",
+			"processed", result.Report.Processed,
+			"cvss_v3", result.Report.CVSSV3,
+			"unscored_cvss_v2", result.Report.UnscoredCVSSV2,
+			"epss", result.Report.EPSS,
+			"known_exploit", result.Report.KnownExploit,
+			"skipped_unexpected_type", result.Report.Skipped[SkipReasonUnexpectedType],
+			"skipped_no_software_match", result.Report.Skipped[SkipReasonNoSoftwareMatch],
+			"skipped_epss_only", result.Report.Skipped[SkipReasonEPSSOnly],
+		)
+	}
+
+	if len(metaMap) == 0 {
+		return result, nil
+	}
+
+	// convert to slice, sorted so that the inserts are the same from one load to the next
+	meta := make([]fleet.CVEMeta, 0, len(metaMap))
+	for _, score := range metaMap {
+		meta = append(meta, score)
+	}
+	sort.Slice(meta, func(i, j int) bool { return meta[i].CVE < meta[j].CVE })
+
+	var w fleet.CVEMetaWriter = ds
+	if o.tx != nil {
+		w = o.tx
+	}
+
+	var insertOpts []fleet.OptionalArg
+	if o.subscores {
+		insertOpts = append(insertOpts, fleet.WithCVSSSubscoresLoaded())
+	}
+	if o.lastModified {
+		insertOpts = append(insertOpts, fleet.WithLastModifiedLoaded())
+	}
+	insert := func(ctx context.Context, meta []fleet.CVEMeta) error {
+		return w.InsertCVEMeta(ctx, meta, insertOpts...)
+	}
+	insertName := "insert cve meta"
+	if o.incremental || missingFeeds {
+		insert, insertName = w.UpsertCVEMeta, "upsert cve meta"
+	}
+
+	if o.lock {
+		unlock, err := ds.LockCVEMetaLoad(ctx, o.lockWait)
+		if err != nil {
+			return nil, fmt.Errorf("lock cve meta load: %w", err)
+		}
+		defer unlock()
+	}
+
+	// every insert has its own timeout, so that a slow one doesn't leave the next ones without time. The inserts in a
+	// transaction are bounded by ctx only.
+	withInsertTimeout := func(insert func(ctx context.Context) error) error {
+		if o.tx != nil {
+			return insert(ctx)
+		}
+		insertCtx, cancel := context.WithTimeout(ctx, 1*time.Minute)
+		defer cancel()
+		return insert(insertCtx)
+	}
+
+	if o.checkpoint != "" {
+		key, err := cveMetaCheckpointKey(feedFiles, sourcesMeta, o)
+		if err != nil {
+			return nil, fmt.Errorf("compute checkpoint key: %w", err)
+		}
+		if err := withInsertTimeout(func(ctx context.Context) error {
+			return insertCVEMetaWithCheckpoint(ctx, logger, insert, meta, o.checkpoint, key)
+		}); err != nil {
+			return nil, fmt.Errorf("%s: %w", insertName, err)
+		}
+	} else if err := withInsertTimeout(func(ctx context.Context) error {
+		return insert(ctx, meta)
+	}); err != nil {
+		return nil, fmt.Errorf("%s: %w", insertName, err)
+	}
+
+	if prov != nil {
+		if err := withInsertTimeout(func(ctx context.Context) error {
+			return w.InsertCVEMetaProvenance(ctx, prov.entries)
+		}); err != nil {
+			return nil, fmt.Errorf("insert cve meta provenance: %w", err)
+		}
+	}
+
+	if len(modelScores) > 0 {
+		if err := withInsertTimeout(func(ctx context.Context) error {
+			return w.InsertEPSSModelScores(ctx, modelScores)
+		}); err != nil {
+			return nil, fmt.Errorf("insert epss model scores: %w", err)
+		}
+	}
+
+	if len(cveProducts) > 0 {
+		// the products are extracted concurrently, sorted so that the inserts are the same from one load to the next
+		sort.Slice(cveProducts, func(i, j int) bool {
+			a, b := cveProducts[i], cveProducts[j]
+			if a.CVE != b.CVE {
+				return a.CVE < b.CVE
+			}
+			if a.Vendor != b.Vendor {
+				return a.Vendor < b.Vendor
+			}
+			return a.Product < b.Product
+		})
+		if err := withInsertTimeout(func(ctx context.Context) error {
+			return w.InsertCVEProducts(ctx, cveProducts)
+		}); err != nil {
+			return nil, fmt.Errorf("insert cve products: %w", err)
+		}
+	}
+
+	if len(cveCWEs) > 0 {
+		// the CWEs are extracted concurrently, sorted so that the inserts are the same from one load to the next
+		sort.Slice(cveCWEs, func(i, j int) bool {
+			a, b := cveCWEs[i], cveCWEs[j]
+			if a.CVE != b.CVE {
+				return a.CVE < b.CVE
+			}
+			return a.CWE < b.CWE
+		})
+		if err := withInsertTimeout(func(ctx context.Context) error {
+			return w.InsertCVECWEs(ctx, cveCWEs)
+		}); err != nil {
+			return nil, fmt.Errorf("insert cve cwes: %w", err)
+		}
+	}
+
+	if o.prune {
+		if err := checkFullLoad(o, feedFiles, missingFeeds); err != nil {
+			level.Warn(logger).Log("msg", "skipping cve meta prune", "err", err)
+		} else {
+			// the CVEs skipped by the load are still in the feeds
+			current := make([]string, 0, len(metaMap)+len(skipped))
+			for cve := range metaMap {
+				current = append(current, cve)
+			}
+			for cve := range skipped {
+				if _, ok := metaMap[cve]; !ok {
+					current = append(current, cve)
+				}
+			}
+			n, err := ds.PruneCVEMeta(ctx, current)
+			if err != nil {
+				return nil, fmt.Errorf("prune cve meta: %w", err)
+			}
+			result.Pruned = n
+		}
+	}
+
+	// only recorded once all the metadata of all the feeds was inserted, so that a failed load, or one that skipped a
+	// missing or unreadable feed, doesn't look like a recent sync
+	if missingFeeds {
+		level.Warn(logger).Log("msg", "not recording cve sync of a load with missing feeds")
+	} else if err := w.RecordCVESync(ctx, time.Now().UTC(), len(meta)); err != nil {
+		return nil, fmt.Errorf("record cve sync: %w", err)
+	}
+	if cisaVersion != nil {
+		if err := w.RecordCISACatalogVersion(ctx, *cisaVersion); err != nil {
+			return nil, fmt.Errorf("record cisa catalog version: %w", err)
+		}
+	}
+	if o.fleetTrend {
+		count, err := ds.CountFleetCVEs(ctx, fleet.CountCVEsOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("count fleet cves: %w", err)
+		}
+		snapshotDate := time.Now().UTC()
+		if err := ds.RecordFleetCVECountSnapshot(ctx, snapshotDate, count); err != nil {
+			return nil, fmt.Errorf("record fleet cve count snapshot: %w", err)
+		}
+		if err := ds.RecordHostCVECountSnapshots(ctx, snapshotDate); err != nil {
+			return nil, fmt.Errorf("record host cve count snapshots: %w", err)
+		}
+	}
+
+	if o.checkpoint != "" {
+		if err := os.Remove(o.checkpoint); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("remove checkpoint: %w", err)
+		}
+	}
+
+	result.Loaded = len(meta)
+
+	return result, nil
+}
+
+// newLoadReport counts the coverage of the CVE metadata to save, along with the CVEs that were skipped, by reason.
+func newLoadReport(metaMap map[string]fleet.CVEMeta, cvssV2Only map[string]bool, skipped map[string]string) *LoadReport {
+	report := &LoadReport{
+		Processed: len(metaMap),
+		Skipped:   make(map[string]int),
+	}
+	for cve, meta := range metaMap {
+		if meta.CVSSScore != nil {
+			report.CVSSV3++
+		} else if cvssV2Only[cve] {
+			report.UnscoredCVSSV2++
+		}
+		if meta.EPSSProbability != nil {
+			report.EPSS++
+		}
+		if meta.CISAKnownExploit != nil && *meta.CISAKnownExploit {
+			report.KnownExploit++
+		}
+	}
+	for cve, reason := range skipped {
+		// a CVE skipped from one NVD feed may still have been loaded from another
+		if _, ok := metaMap[cve]; ok {
+			continue
+		}
+		report.Processed++
+		report.Skipped[reason]++
+	}
+	return report
+}
+
+// softwareProduct identifies a product by its CPE vendor and product.
+type softwareProduct struct {
+	vendor  string
+	product string
+}
+
+// listSoftwareProducts returns the products of the software CPEs of the fleet.
+func listSoftwareProducts(ctx context.Context, ds fleet.Datastore) (map[softwareProduct]bool, error) {
+	cpes, err := ds.ListSoftwareCPEs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	products := make(map[softwareProduct]bool, len(cpes))
+	for _, cpe := range cpes {
+		attr, err := wfn.Parse(cpe.CPE)
+		if err != nil {
+			return nil, fmt.Errorf("parse cpe %s: %w", cpe.CPE, err)
+		}
+		products[softwareProduct{vendor: attr.Vendor, product: attr.Product}] = true
+	}
+	return products, nil
+}
+
+// vulnMatchesProducts returns whether one of the CPEs of the vulnerability's configurations is for one of the
+// products. It doesn't check the versions, so the vulnerability could match but doesn't necessarily do.
+func vulnMatchesProducts(vuln cvefeed.Vuln, products map[softwareProduct]bool) bool {
+	for _, attr := range vuln.Config() {
+		if attr == nil {
+			continue
+		}
+		if attr.Vendor == wfn.Any || attr.Product == wfn.Any {
+			// matches any vendor or product
+			return true
+		}
+		if products[softwareProduct{vendor: attr.Vendor, product: attr.Product}] {
+			return true
+		}
+	}
+	return false
+}
+
+// findStaleFeeds returns the feed files that were last modified more than threshold before now.
+func findStaleFeeds(files []string, threshold time.Duration, now time.Time) ([]StaleFeed, error) {
+	var stale []StaleFeed
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, err
+		}
+		if age := now.Sub(info.ModTime()); age > threshold {
+			stale = append(stale, StaleFeed{
+				Path:    file,
+				ModTime: info.ModTime(),
+				Age:     age,
+			})
+		}
+	}
+	return stale, nil
 }
@@ -1,20 +1,230 @@
 package nvd
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"database/sql"
+	"encoding/base64"
+	"encoding/csv"
+	"errors"
+	"fmt"
 	"github.com/fleetdm/fleet/v4/server/contexts/license"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 
+	feednvd "github.com/facebookincubator/nvdtools/cvefeed/nvd"
+	"github.com/facebookincubator/nvdtools/cvefeed/nvd/schema"
+	"github.com/fleetdm/fleet/v4/pkg/download"
 	"github.com/fleetdm/fleet/v4/pkg/nettest"
 	"github.com/fleetdm/fleet/v4/server/fleet"
 	"github.com/fleetdm/fleet/v4/server/mock"
+	"github.com/fleetdm/fleet/v4/server/ptr"
 	"github.com/go-kit/kit/log"
 	"github.com/stretchr/testify/require"
 	"github.com/tj/assert"
+	"golang.org/x/crypto/blake2b"
 )
 
+func TestSyncVulnPathNotWritable(t *testing.T) {
+	t.Run("missing directory", func(t *testing.T) {
+		err := Sync(context.Background(), SyncOptions{VulnPath: filepath.Join(t.TempDir(), "missing")})
+		require.ErrorIs(t, err, ErrVulnPathNotWritable)
+	})
+
+	t.Run("not a directory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "file")
+		require.NoError(t, os.WriteFile(path, nil, 0o644))
+		err := Sync(context.Background(), SyncOptions{VulnPath: path})
+		require.ErrorIs(t, err, ErrVulnPathNotWritable)
+	})
+
+	t.Run("read-only directory", func(t *testing.T) {
+		if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+			t.Skip("directory permissions are not enforced")
+		}
+		path := t.TempDir()
+		require.NoError(t, os.Chmod(path, 0o500))
+		t.Cleanup(func() { os.Chmod(path, 0o755) }) //nolint:errcheck
+		err := Sync(context.Background(), SyncOptions{VulnPath: path})
+		require.ErrorIs(t, err, ErrVulnPathNotWritable)
+	})
+
+	t.Run("create missing directory", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "a", "b")
+		require.NoError(t, checkVulnPath(path, true))
+		require.DirExists(t, path)
+		entries, err := os.ReadDir(path)
+		require.NoError(t, err)
+		require.Empty(t, entries)
+	})
+}
+
+// newNVDMirror returns the file URL of a directory mirroring the NVD feeds of every year, with the test feed.
+func newNVDMirror(t *testing.T) string {
+	nvdFeed, err := os.ReadFile(filepath.Join("..", "testdata", "nvdcve-1.1-recent.json.gz"))
+	require.NoError(t, err)
+	gr, err := gzip.NewReader(bytes.NewReader(nvdFeed))
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	nvdMeta := fmt.Sprintf("lastModifiedDate:2023-03-21T03:00:01-04:00\r\nsha256:%X\r\n", sha256.Sum256(decompressed))
+
+	mirror := t.TempDir()
+	for year := firstNVDFeedYear; year <= time.Now().Year(); year++ {
+		require.NoError(t, os.WriteFile(filepath.Join(mirror, fmt.Sprintf("nvdcve-1.1-%d.json.gz", year)), nvdFeed, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(mirror, fmt.Sprintf("nvdcve-1.1-%d.meta", year)), []byte(nvdMeta), 0o644))
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(mirror) + "/"}).String()
+}
+
+func TestSyncStaged(t *testing.T) {
+	root := t.TempDir()
+	vulnPath := filepath.Join(root, "vulns")
+	require.NoError(t, os.Mkdir(vulnPath, 0o755))
+	require.NoError(t, os.Mkdir(filepath.Join(vulnPath, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(vulnPath, "sub", "previous.txt"), []byte("previous"), 0o644))
+
+	listFiles := func(dir string) []string {
+		var files []string
+		require.NoError(t, filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			require.NoError(t, err)
+			rel, err := filepath.Rel(dir, path)
+			require.NoError(t, err)
+			files = append(files, filepath.ToSlash(rel))
+			return nil
+		}))
+		return files
+	}
+	before := listFiles(vulnPath)
+
+	opts := SyncOptions{
+		VulnPath:         vulnPath,
+		CVEFeedPrefixURL: newNVDMirror(t),
+		Sources:          FeedSourceNVD,
+		URLPolicy:        URLPolicy{AllowFile: true},
+		Staged:           true,
+	}
+
+	// the NVD feed is downloaded but a later download fails, the live path is untouched
+	opts.CVESources = []CVESource{
+		&fakeCVESource{downloadFile: "extra.json"},
+		&fakeCVESource{downloadErr: errors.New("boom")},
+	}
+	err := Sync(context.Background(), opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "boom")
+	require.Equal(t, before, listFiles(vulnPath))
+	b, err := os.ReadFile(filepath.Join(vulnPath, "sub", "previous.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "previous", string(b))
+
+	// the staging directory is removed
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// once all the downloads succeed, the feeds are swapped in and the previous files are kept
+	opts.CVESources = []CVESource{&fakeCVESource{downloadFile: "extra.json"}}
+	require.NoError(t, Sync(context.Background(), opts))
+	require.FileExists(t, filepath.Join(vulnPath, "extra.json"))
+	b, err = os.ReadFile(filepath.Join(vulnPath, "sub", "previous.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "previous", string(b))
+	files, err := getNVDCVEFeedFiles(vulnPath)
+	require.NoError(t, err)
+	require.Len(t, files, time.Now().Year()-firstNVDFeedYear+1)
+
+	stat, err := os.Stat(vulnPath)
+	require.NoError(t, err)
+	require.True(t, stat.IsDir())
+	if runtime.GOOS != "windows" {
+		require.Equal(t, os.FileMode(0o755), stat.Mode().Perm())
+	}
+	entries, err = os.ReadDir(root)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "vulns", entries[0].Name())
+}
+
+func TestSyncAndRecord(t *testing.T) {
+	ctx := context.Background()
+	ds := new(mock.Store)
+	var attempts []fleet.SyncAttempt
+	ds.RecordSyncAttemptFunc = func(ctx context.Context, attempt *fleet.SyncAttempt) error {
+		attempts = append(attempts, *attempt)
+		return nil
+	}
+
+	opts := SyncOptions{
+		VulnPath:         t.TempDir(),
+		CVEFeedPrefixURL: newNVDMirror(t),
+		Sources:          FeedSourceNVD,
+		URLPolicy:        URLPolicy{AllowFile: true},
+		CVESources:       []CVESource{&fakeCVESource{downloadErr: errors.New("boom")}},
+	}
+	err := SyncAndRecord(ctx, ds, opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "boom")
+	require.True(t, ds.RecordSyncAttemptFuncInvoked)
+	require.Len(t, attempts, 1)
+	require.False(t, attempts[0].Success)
+	require.NotNil(t, attempts[0].Error)
+	require.Contains(t, *attempts[0].Error, "boom")
+	require.False(t, attempts[0].StartedAt.IsZero())
+	require.Len(t, attempts[0].Sources, 2)
+	require.Equal(t, fleet.SyncSourceResult{Source: "nvd", Success: true}, attempts[0].Sources[0])
+	require.Equal(t, "cve_source_0", attempts[0].Sources[1].Source)
+	require.False(t, attempts[0].Sources[1].Success)
+	require.Contains(t, attempts[0].Sources[1].Error, "boom")
+
+	opts.CVESources = []CVESource{&fakeCVESource{downloadFile: "extra.json"}}
+	require.NoError(t, SyncAndRecord(ctx, ds, opts))
+	require.Len(t, attempts, 2)
+	require.True(t, attempts[1].Success)
+	require.Nil(t, attempts[1].Error)
+	require.Equal(t, fleet.SyncSourceResults{
+		{Source: "nvd", Success: true},
+		{Source: "cve_source_0", Success: true},
+	}, attempts[1].Sources)
+
+	// the error of Sync is returned even if the attempt can't be recorded
+	ds.RecordSyncAttemptFunc = func(ctx context.Context, attempt *fleet.SyncAttempt) error {
+		return errors.New("db down")
+	}
+	opts.CVESources = []CVESource{&fakeCVESource{downloadErr: errors.New("boom")}}
+	err = SyncAndRecord(ctx, ds, opts)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "boom")
+	require.Contains(t, err.Error(), "db down")
+
+	// the context of the sync is passed to the downloads of the CVE sources
+	ds.RecordSyncAttemptFunc = func(ctx context.Context, attempt *fleet.SyncAttempt) error {
+		attempts = append(attempts, *attempt)
+		return nil
+	}
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	opts.CVESources = []CVESource{&fakeCVESource{downloadFile: "extra.json"}}
+	err = SyncAndRecord(canceledCtx, ds, opts)
+	require.ErrorIs(t, err, context.Canceled)
+	require.False(t, attempts[len(attempts)-1].Success)
+}
+
 func TestDownloadEPSSFeed(t *testing.T) {
 	nettest.Run(t)
 
@@ -26,6 +236,326 @@ func TestDownloadEPSSFeed(t *testing.T) {
 	assert.FileExists(t, filepath.Join(tempDir, strings.TrimSuffix(epssFilename, ".gz")))
 }
 
+// newEPSSFeedServer returns a test server serving the EPSS testdata feed, gzipped. If onRequest is not nil, it is
+// called with every request received by the server.
+func newEPSSFeedServer(t *testing.T, onRequest func(r *http.Request)) *httptest.Server {
+	csv, err := os.ReadFile(filepath.Join("../testdata", strings.TrimSuffix(epssFilename, ".gz")))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	_, err = gw.Write(csv)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if onRequest != nil {
+			onRequest(r)
+		}
+		if !strings.HasPrefix(r.URL.Path, "/epss_scores-") || !strings.HasSuffix(r.URL.Path, ".csv.gz") {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(buf.Bytes()) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestDownloadEPSSFeedKeepCompressed(t *testing.T) {
+	srv := newEPSSFeedServer(t, nil)
+	csvName := strings.TrimSuffix(epssFilename, ".gz")
+
+	t.Run("default", func(t *testing.T) {
+		tempDir := t.TempDir()
+		require.NoError(t, DownloadEPSSFeed(tempDir, WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true})))
+		require.FileExists(t, filepath.Join(tempDir, csvName))
+		require.NoFileExists(t, filepath.Join(tempDir, epssFilename))
+	})
+
+	t.Run("keep compressed", func(t *testing.T) {
+		tempDir := t.TempDir()
+		require.NoError(t, DownloadEPSSFeed(tempDir, WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true}), WithKeepCompressed()))
+		require.FileExists(t, filepath.Join(tempDir, csvName))
+		require.FileExists(t, filepath.Join(tempDir, epssFilename))
+
+		scores, err := parseEPSSScoresFile(filepath.Join(tempDir, csvName))
+		require.NoError(t, err)
+		expected, err := parseEPSSScoresFile(filepath.Join("../testdata", csvName))
+		require.NoError(t, err)
+		require.Equal(t, expected, scores)
+	})
+}
+
+func TestDownloadEPSSFeedCompressed(t *testing.T) {
+	srv := newEPSSFeedServer(t, nil)
+	csvName := strings.TrimSuffix(epssFilename, ".gz")
+	opts := []DownloadOption{WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true})}
+
+	extractedDir := t.TempDir()
+	require.NoError(t, DownloadEPSSFeed(extractedDir, opts...))
+	require.Equal(t, filepath.Join(extractedDir, csvName), epssScoresPath(extractedDir))
+
+	// a previously extracted feed is replaced by the compressed one
+	compressedDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(compressedDir, csvName), []byte("cve,epss,percentile\n"), 0o644))
+	require.NoError(t, DownloadEPSSFeed(compressedDir, append(opts, WithEPSSCompressed())...))
+	require.NoFileExists(t, filepath.Join(compressedDir, csvName))
+	require.FileExists(t, filepath.Join(compressedDir, epssFilename))
+	require.Equal(t, filepath.Join(compressedDir, epssFilename), epssScoresPath(compressedDir))
+
+	// the streamed scores are the same as the extracted ones
+	expected, err := parseEPSSScoresFile(epssScoresPath(extractedDir))
+	require.NoError(t, err)
+	require.NotEmpty(t, expected)
+	scores, err := parseEPSSScoresFile(epssScoresPath(compressedDir))
+	require.NoError(t, err)
+	require.Equal(t, expected, scores)
+
+	expectedSnapshots, err := parseEPSSSnapshotFile(epssScoresPath(extractedDir))
+	require.NoError(t, err)
+	snapshots, err := parseEPSSSnapshotFile(epssScoresPath(compressedDir))
+	require.NoError(t, err)
+	require.Equal(t, expectedSnapshots, snapshots)
+
+	// no feed at all
+	_, err = parseEPSSScoresFile(epssScoresPath(t.TempDir()))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDownloadEPSSFeedDate(t *testing.T) {
+	var paths []string
+	srv := newEPSSFeedServer(t, func(r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	})
+	tempDir := t.TempDir()
+	opts := []DownloadOption{WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true})}
+
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, DownloadEPSSFeed(tempDir, append(opts, WithEPSSDate(date))...))
+	require.Equal(t, []string{"/epss_scores-2024-01-15.csv.gz"}, paths)
+	require.Equal(t, "epss_scores-2024-01-15.csv", EPSSFeedFilename(date))
+	require.FileExists(t, filepath.Join(tempDir, "epss_scores-2024-01-15.csv"))
+
+	// the current scores and other dates coexist with it
+	require.NoError(t, DownloadEPSSFeed(tempDir, opts...))
+	require.NoError(t, DownloadEPSSFeed(tempDir, append(opts, WithEPSSDate(date.AddDate(0, 0, 1)))...))
+	require.Equal(t, []string{
+		"/epss_scores-2024-01-15.csv.gz",
+		"/" + epssFilename,
+		"/epss_scores-2024-01-16.csv.gz",
+	}, paths)
+	require.FileExists(t, filepath.Join(tempDir, "epss_scores-2024-01-15.csv"))
+	require.FileExists(t, filepath.Join(tempDir, "epss_scores-2024-01-16.csv"))
+	require.FileExists(t, filepath.Join(tempDir, EPSSFeedFilename(time.Time{})))
+
+	// today is fine, but not a date in the future
+	require.NoError(t, DownloadEPSSFeed(tempDir, append(opts, WithEPSSDate(time.Now().UTC()))...))
+	paths = nil
+	err := DownloadEPSSFeed(tempDir, append(opts, WithEPSSDate(time.Now().AddDate(0, 0, 2)))...)
+	require.ErrorContains(t, err, "in the future")
+	require.Empty(t, paths)
+}
+
+func TestDownloadEPSSFeedProgress(t *testing.T) {
+	srv := newEPSSFeedServer(t, nil)
+
+	for _, keepCompressed := range []bool{false, true} {
+		var downloaded []int64
+		opts := []DownloadOption{
+			WithBaseURL(srv.URL),
+			WithURLPolicy(URLPolicy{AllowHTTP: true}),
+			WithEPSSProgress(func(n, total int64) {
+				downloaded = append(downloaded, n)
+			}, 0),
+		}
+		if keepCompressed {
+			opts = append(opts, WithKeepCompressed())
+		}
+
+		require.NoError(t, DownloadEPSSFeed(t.TempDir(), opts...))
+		require.NotEmpty(t, downloaded)
+		require.Positive(t, downloaded[0])
+		for i := 1; i < len(downloaded); i++ {
+			require.Greater(t, downloaded[i], downloaded[i-1])
+		}
+	}
+
+	// the progress is optional
+	require.NoError(t, DownloadEPSSFeed(t.TempDir(), WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true})))
+}
+
+func TestDownloadEPSSFeedUserAgent(t *testing.T) {
+	var userAgents []string
+	srv := newEPSSFeedServer(t, func(r *http.Request) {
+		userAgents = append(userAgents, r.UserAgent())
+	})
+
+	require.NoError(t, DownloadEPSSFeed(t.TempDir(), WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true})))
+	require.Equal(t, []string{defaultUserAgent()}, userAgents)
+	require.True(t, strings.HasPrefix(userAgents[0], "fleet-vuln-sync/"))
+
+	userAgents = nil
+	require.NoError(t, DownloadEPSSFeed(t.TempDir(), WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true}), WithUserAgent("custom-agent/1.0")))
+	require.Equal(t, []string{"custom-agent/1.0"}, userAgents)
+}
+
+func TestURLPolicy(t *testing.T) {
+	var zero URLPolicy
+	_, err := zero.Validate("https://mirror.example.com/feeds")
+	require.NoError(t, err)
+	_, err = zero.Validate("http://mirror.example.com/feeds")
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	require.Contains(t, err.Error(), "https")
+	_, err = zero.Validate("ftp://mirror.example.com/feeds")
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+
+	allowHTTP := URLPolicy{AllowHTTP: true}
+	_, err = allowHTTP.Validate("http://mirror.internal:8080/feeds")
+	require.NoError(t, err)
+
+	allowlist := URLPolicy{AllowedHosts: []string{"mirror.example.com"}}
+	u, err := allowlist.Validate("https://MIRROR.example.com:8443/feeds")
+	require.NoError(t, err)
+	require.Equal(t, "/feeds", u.Path)
+	_, err = allowlist.Validate("https://evil.example.com/feeds")
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	require.Contains(t, err.Error(), "evil.example.com")
+
+	_, err = zero.Validate("file:///srv/feeds")
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	allowFile := URLPolicy{AllowFile: true, AllowedHosts: []string{"mirror.example.com"}}
+	_, err = allowFile.Validate("file:///srv/feeds")
+	require.NoError(t, err)
+	_, err = allowFile.Validate("file://mirror.example.com/srv/feeds")
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+
+	// the overridden URLs are validated before anything is downloaded
+	var requests int
+	srv := newEPSSFeedServer(t, func(r *http.Request) { requests++ })
+	err = DownloadEPSSFeed(t.TempDir(), WithBaseURL(srv.URL))
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	err = DownloadCPEDBFromGithub(t.TempDir(), "https://evil.example.com/cpe.sqlite.gz", WithURLPolicy(allowlist))
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	err = Sync(context.Background(), SyncOptions{VulnPath: t.TempDir(), CVEFeedPrefixURL: srv.URL, Sources: FeedSourceNVD})
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	require.Zero(t, requests)
+}
+
+func TestDownloadFeedsFromFileURL(t *testing.T) {
+	csv, err := os.ReadFile(filepath.Join("../testdata", strings.TrimSuffix(epssFilename, ".gz")))
+	require.NoError(t, err)
+	var gzCSV bytes.Buffer
+	gw := gzip.NewWriter(&gzCSV)
+	_, err = gw.Write(csv)
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+
+	nvdFeed, err := os.ReadFile(filepath.Join("..", "testdata", "nvdcve-1.1-recent.json.gz"))
+	require.NoError(t, err)
+	gr, err := gzip.NewReader(bytes.NewReader(nvdFeed))
+	require.NoError(t, err)
+	decompressed, err := io.ReadAll(gr)
+	require.NoError(t, err)
+	nvdMeta := fmt.Sprintf("lastModifiedDate:2023-03-21T03:00:01-04:00\r\nsha256:%X\r\n", sha256.Sum256(decompressed))
+
+	// a local directory with all the feeds, as staged for an air-gapped setup
+	mirror := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(mirror, epssFilename), gzCSV.Bytes(), 0o644))
+	for year := firstNVDFeedYear; year <= time.Now().Year(); year++ {
+		require.NoError(t, os.WriteFile(filepath.Join(mirror, fmt.Sprintf("nvdcve-1.1-%d.json.gz", year)), nvdFeed, 0o644))
+		require.NoError(t, os.WriteFile(filepath.Join(mirror, fmt.Sprintf("nvdcve-1.1-%d.meta", year)), []byte(nvdMeta), 0o644))
+	}
+	mirrorURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(mirror) + "/"}).String()
+	policy := WithURLPolicy(URLPolicy{AllowFile: true})
+
+	// file urls must be allowed
+	vulnPath := t.TempDir()
+	err = DownloadEPSSFeed(vulnPath, WithBaseURL(mirrorURL))
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	err = DownloadNVDCVEFeed(vulnPath, mirrorURL)
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+
+	require.NoError(t, DownloadEPSSFeed(vulnPath, WithBaseURL(mirrorURL), policy))
+	b, err := os.ReadFile(filepath.Join(vulnPath, strings.TrimSuffix(epssFilename, ".gz")))
+	require.NoError(t, err)
+	require.Equal(t, csv, b)
+
+	require.NoError(t, DownloadNVDCVEFeed(vulnPath, mirrorURL, policy))
+	files, err := getNVDCVEFeedFiles(vulnPath)
+	require.NoError(t, err)
+	require.Len(t, files, time.Now().Year()-firstNVDFeedYear+1)
+
+	// a missing local file fails the download
+	require.NoError(t, os.Remove(filepath.Join(mirror, epssFilename)))
+	err = DownloadEPSSFeed(vulnPath, WithBaseURL(mirrorURL), policy)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "404")
+}
+
+func TestDownloadFeedsRedirectToFileURL(t *testing.T) {
+	local := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(local, epssFilename), []byte("local file"), 0o644))
+	localURL := (&url.URL{Scheme: "file", Path: filepath.ToSlash(local) + "/" + epssFilename}).String()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, localURL, http.StatusFound)
+	}))
+	defer srv.Close()
+
+	// even if file urls are allowed, a remote feed can't redirect to one
+	vulnPath := t.TempDir()
+	err := DownloadEPSSFeed(vulnPath, WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true, AllowFile: true}))
+	require.ErrorIs(t, err, ErrURLNotAllowed)
+	require.NoFileExists(t, filepath.Join(vulnPath, strings.TrimSuffix(epssFilename, ".gz")))
+}
+
+func TestDownloadFeedsMinTLSVersion(t *testing.T) {
+	var requests int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	srv.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS10}
+	srv.StartTLS()
+	defer srv.Close()
+
+	// TLS 1.2 is required by default
+	err := DownloadEPSSFeed(t.TempDir(), WithBaseURL(srv.URL))
+	require.ErrorIs(t, err, ErrTLSVersionNotSupported)
+	require.Contains(t, err.Error(), "TLS 1.2")
+
+	err = Sync(context.Background(), SyncOptions{VulnPath: t.TempDir(), CVEFeedPrefixURL: srv.URL, Sources: FeedSourceNVD, MinTLSVersion: tls.VersionTLS13})
+	require.ErrorIs(t, err, ErrTLSVersionNotSupported)
+	require.Contains(t, err.Error(), "TLS 1.3")
+
+	// a lower minimum gets past the version negotiation, to fail on the self-signed certificate
+	err = DownloadEPSSFeed(t.TempDir(), WithBaseURL(srv.URL), WithMinTLSVersion(tls.VersionTLS10))
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrTLSVersionNotSupported)
+	require.Contains(t, err.Error(), "certificate")
+
+	err = DownloadEPSSFeed(t.TempDir(), WithBaseURL(srv.URL), WithMinTLSVersion(0x0999))
+	require.ErrorContains(t, err, "unsupported minimum tls version")
+	require.Zero(t, requests)
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	for version, want := range map[string]uint16{
+		"":    0,
+		"1.0": tls.VersionTLS10,
+		"1.2": tls.VersionTLS12,
+		"1.3": tls.VersionTLS13,
+	} {
+		got, err := ParseTLSVersion(version)
+		require.NoError(t, err)
+		require.Equal(t, want, got, version)
+	}
+	for _, version := range []string{"1", "TLS1.2", "2.0"} {
+		_, err := ParseTLSVersion(version)
+		require.Error(t, err, version)
+	}
+}
+
 func TestDownloadCISAKnownExploitsFeed(t *testing.T) {
 	nettest.Run(t)
 
@@ -37,14 +567,113 @@ func TestDownloadCISAKnownExploitsFeed(t *testing.T) {
 	assert.FileExists(t, filepath.Join(tempDir, cisaKnownExploitsFilename))
 }
 
+func TestDownloadCISAKnownExploitsFeedValidation(t *testing.T) {
+	valid, err := os.ReadFile(filepath.Join("../testdata", cisaKnownExploitsFilename))
+	require.NoError(t, err)
+
+	var catalog []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+cisaKnownExploitsFilename {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(catalog) //nolint:errcheck
+	}))
+	t.Cleanup(srv.Close)
+	opts := []DownloadOption{WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true})}
+	path := filepath.Join(t.TempDir(), cisaKnownExploitsFilename)
+
+	catalog = valid
+	require.NoError(t, DownloadCISAKnownExploitsFeed(filepath.Dir(path), append(opts, WithCISACatalogValidation())...))
+	require.FileExists(t, path)
+
+	for name, c := range map[string]string{
+		"renamed vulnerabilities": `{"catalogVersion": "2023.01.01", "dateReleased": "2023-01-01T00:00:00.000Z", "count": 1,
+			"knownExploits": [{"cveID": "CVE-2022-0001"}]}`,
+		"vulnerabilities not an array": `{"catalogVersion": "2023.01.01", "dateReleased": "2023-01-01T00:00:00.000Z", "count": 1,
+			"vulnerabilities": {"CVE-2022-0001": {}}}`,
+		"renamed cve id": `{"catalogVersion": "2023.01.01", "dateReleased": "2023-01-01T00:00:00.000Z", "count": 1,
+			"vulnerabilities": [{"cve": "CVE-2022-0001"}]}`,
+		"count mismatch": `{"catalogVersion": "2023.01.01", "dateReleased": "2023-01-01T00:00:00.000Z", "count": 2,
+			"vulnerabilities": [{"cveID": "CVE-2022-0001"}]}`,
+		"missing version": `{"dateReleased": "2023-01-01T00:00:00.000Z", "count": 1,
+			"vulnerabilities": [{"cveID": "CVE-2022-0001"}]}`,
+		"not an object": `[{"cveID": "CVE-2022-0001"}]`,
+	} {
+		catalog = []byte(c)
+
+		// without validation, the changed catalog is downloaded as is
+		require.NoError(t, DownloadCISAKnownExploitsFeed(filepath.Dir(path), opts...), name)
+		require.FileExists(t, path, name)
+
+		err := DownloadCISAKnownExploitsFeed(filepath.Dir(path), append(opts, WithCISACatalogValidation())...)
+		require.ErrorIs(t, err, ErrInvalidCISACatalog, name)
+		require.NoFileExists(t, path, name)
+	}
+}
+
+func TestDownloadCISAKnownExploitsFeedSignature(t *testing.T) {
+	catalog, err := os.ReadFile(filepath.Join("../testdata", cisaKnownExploitsFilename))
+	require.NoError(t, err)
+
+	// a minisign key and the prehashed signature of the catalog
+	keyID := []byte("fleetkey")
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	publicKey, err := download.ParseMinisignPublicKey(base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pub...)))
+	require.NoError(t, err)
+	hash := blake2b.Sum512(catalog)
+	sig := ed25519.Sign(priv, hash[:])
+	trustedComment := "file:" + cisaKnownExploitsFilename
+	signature := fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("ED"), keyID...), sig...)),
+		trustedComment,
+		base64.StdEncoding.EncodeToString(ed25519.Sign(priv, append(append([]byte{}, sig...), trustedComment...))),
+	)
+
+	var signed bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/"+cisaKnownExploitsFilename:
+			w.Write(catalog) //nolint:errcheck
+		case r.URL.Path == "/"+cisaKnownExploitsFilename+".minisig" && signed:
+			w.Write([]byte(signature)) //nolint:errcheck
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	opts := []DownloadOption{WithBaseURL(srv.URL), WithURLPolicy(URLPolicy{AllowHTTP: true}), WithSignatureKey(publicKey)}
+	path := filepath.Join(t.TempDir(), cisaKnownExploitsFilename)
+
+	// an unsigned feed isn't downloaded
+	err = DownloadCISAKnownExploitsFeed(filepath.Dir(path), opts...)
+	require.ErrorIs(t, err, download.ErrInvalidSignature)
+	require.NoFileExists(t, path)
+
+	signed = true
+	require.NoError(t, DownloadCISAKnownExploitsFeed(filepath.Dir(path), opts...))
+	require.FileExists(t, path)
+}
+
 func TestLoadCVEMeta(t *testing.T) {
 	ds := new(mock.Store)
 
 	var cveMeta []fleet.CVEMeta
-	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta) error {
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
 		cveMeta = x
 		return nil
 	}
+	var syncCount int
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		syncCount = cveCount
+		return nil
+	}
+	var cisaVersion fleet.CISACatalogVersion
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		cisaVersion = version
+		return nil
+	}
 
 	logger := log.NewNopLogger()
 	err := LoadCVEMeta(license.NewContext(context.Background(), &fleet.LicenseInfo{
@@ -63,11 +692,1157 @@ func TestLoadCVEMeta(t *testing.T) {
 	require.Equal(t, float64(7.2), *meta.CVSSScore)
 	require.Equal(t, float64(0.00885), *meta.EPSSProbability)
 	require.Equal(t, false, *meta.CISAKnownExploit)
+	require.Nil(t, meta.CISADueDate)
+	require.Nil(t, meta.CISADateAdded)
 
 	meta = metaMap["CVE-2022-22587"]
 	require.Equal(t, (*float64)(nil), meta.CVSSScore)
 	require.Equal(t, float64(0.01843), *meta.EPSSProbability)
 	require.Equal(t, true, *meta.CISAKnownExploit)
+	require.Equal(t, time.Date(2022, 2, 11, 0, 0, 0, 0, time.UTC), *meta.CISADueDate)
+	require.Equal(t, time.Date(2022, 1, 28, 0, 0, 0, 0, time.UTC), *meta.CISADateAdded)
+
+	require.True(t, ds.RecordCVESyncFuncInvoked)
+	require.Equal(t, len(cveMeta), syncCount)
+
+	require.True(t, ds.RecordCISACatalogVersionFuncInvoked)
+	require.Equal(t, "2022.06.02", cisaVersion.CatalogVersion)
+	require.NotNil(t, cisaVersion.DateReleased)
+	require.Equal(t, time.Date(2022, 6, 2, 17, 48, 15, 151500000, time.UTC), *cisaVersion.DateReleased)
+}
+
+func TestLoadCVEMetaSorted(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	load := func() []fleet.CVEMeta {
+		ds := new(mock.Store)
+		var metas []fleet.CVEMeta
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			metas = x
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+			return nil
+		}
+		require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds))
+		return metas
+	}
+
+	metas := load()
+	require.NotEmpty(t, metas)
+	require.True(t, sort.SliceIsSorted(metas, func(i, j int) bool { return metas[i].CVE < metas[j].CVE }))
+
+	// the order is the same from one load to the next
+	require.Equal(t, metas, load())
+}
+
+func TestLoadCVEMetaSoftwareMatchFilter(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	load := func(cpes []string, opts ...LoadCVEMetaOption) map[string]fleet.CVEMeta {
+		ds := new(mock.Store)
+		ds.ListSoftwareCPEsFunc = func(ctx context.Context) ([]fleet.SoftwareCPE, error) {
+			var softwareCPEs []fleet.SoftwareCPE
+			for i, cpe := range cpes {
+				softwareCPEs = append(softwareCPEs, fleet.SoftwareCPE{ID: uint(i + 1), SoftwareID: uint(i + 1), CPE: cpe})
+			}
+			return softwareCPEs, nil
+		}
+		metas := make(map[string]fleet.CVEMeta)
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			for _, m := range x {
+				metas[m.CVE] = m
+			}
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+			return nil
+		}
+		require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds, opts...))
+		return metas
+	}
+
+	// the filter is disabled by default
+	cpes := []string{"cpe:2.3:a:chshcms:cscms_music_portal_system:4.1:*:*:*:*:*:*:*"}
+	all := load(cpes)
+	require.Greater(t, len(all), 21)
+
+	// only the CVEs of the cscms music portal system are loaded, whatever the version
+	metas := load(cpes, WithSoftwareMatchFilter())
+	require.Len(t, metas, 21)
+	require.Contains(t, metas, "CVE-2022-29676")
+	// known exploit, but for other software
+	require.NotContains(t, metas, "CVE-2022-22587")
+	for cve, meta := range metas {
+		require.Equal(t, all[cve], meta)
+	}
+
+	// nothing can match without software
+	require.Empty(t, load(nil, WithSoftwareMatchFilter()))
+}
+
+func TestLoadCVEMetaAffectedProducts(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	// CVE-2022-0001 affects two versions of apache http_server, and apache tomcat when running on windows, which
+	// isn't vulnerable itself. CVE-2022-0002 has no configuration yet.
+	vulnPath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(vulnPath, "nvdcve-1.1-2022.json"), []byte(`{"CVE_Items": [
+		{
+			"cve": {"CVE_data_meta": {"ID": "CVE-2022-0001"}},
+			"configurations": {"nodes": [
+				{"operator": "OR", "cpe_match": [
+					{"vulnerable": true, "cpe23Uri": "cpe:2.3:a:apache:http_server:2.4.1:*:*:*:*:*:*:*"},
+					{"vulnerable": true, "cpe23Uri": "cpe:2.3:a:apache:http_server:2.4.2:*:*:*:*:*:*:*"}
+				]},
+				{"operator": "AND", "children": [
+					{"operator": "OR", "cpe_match": [{"vulnerable": true, "cpe23Uri": "cpe:2.3:a:apache:tomcat:9.0.0:*:*:*:*:*:*:*"}]},
+					{"operator": "OR", "cpe_match": [{"vulnerable": false, "cpe23Uri": "cpe:2.3:o:microsoft:windows:-:*:*:*:*:*:*:*"}]}
+				]}
+			]},
+			"impact": {"baseMetricV3": {"cvssV3": {"baseScore": 9.8}}},
+			"publishedDate": "2022-01-01T00:00Z"
+		},
+		{
+			"cve": {"CVE_data_meta": {"ID": "CVE-2022-0002"}},
+			"configurations": {"nodes": []},
+			"impact": {},
+			"publishedDate": "2022-01-01T00:00Z"
+		}
+	]}`), 0o644))
+
+	load := func(opts ...LoadCVEMetaOption) *mock.Store {
+		ds := new(mock.Store)
+		var metaCtx context.Context
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			metaCtx = ctx
+			return nil
+		}
+		ds.InsertCVEProductsFunc = func(ctx context.Context, products []fleet.CVEProduct) error {
+			// the products are inserted with their own timeout, the one of the cve meta insert is over
+			require.Error(t, metaCtx.Err())
+			require.NoError(t, ctx.Err())
+			_, ok := ctx.Deadline()
+			require.True(t, ok)
+			require.Equal(t, []fleet.CVEProduct{
+				{CVE: "CVE-2022-0001", Vendor: "apache", Product: "http_server"},
+				{CVE: "CVE-2022-0001", Vendor: "apache", Product: "tomcat"},
+			}, products)
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		opts = append(opts, WithFeedSources(FeedSourceNVD))
+		require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, opts...))
+		return ds
+	}
+
+	// not extracted by default
+	require.False(t, load().InsertCVEProductsFuncInvoked)
+	require.True(t, load(WithAffectedProducts()).InsertCVEProductsFuncInvoked)
+}
+
+func TestLoadCVEMetaCWEs(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	load := func(opts ...LoadCVEMetaOption) (*mock.Store, []fleet.CVECWE) {
+		ds := new(mock.Store)
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			return nil
+		}
+		var cwes []fleet.CVECWE
+		ds.InsertCVECWEsFunc = func(ctx context.Context, x []fleet.CVECWE) error {
+			cwes = x
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		opts = append(opts, WithFeedSources(FeedSourceNVD))
+		require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds, opts...))
+		return ds, cwes
+	}
+
+	// not extracted by default
+	ds, _ := load()
+	require.False(t, ds.InsertCVECWEsFuncInvoked)
+
+	ds, cwes := load(WithCWEs())
+	require.True(t, ds.InsertCVECWEsFuncInvoked)
+	require.True(t, sort.SliceIsSorted(cwes, func(i, j int) bool {
+		if cwes[i].CVE != cwes[j].CVE {
+			return cwes[i].CVE < cwes[j].CVE
+		}
+		return cwes[i].CWE < cwes[j].CWE
+	}))
+	require.Contains(t, cwes, fleet.CVECWE{CVE: "CVE-2022-30999", CWE: "CWE-79"})
+	// a CVE can have several weaknesses
+	require.Contains(t, cwes, fleet.CVECWE{CVE: "CVE-2022-31024", CWE: "CWE-284"})
+	require.Contains(t, cwes, fleet.CVECWE{CVE: "CVE-2022-31024", CWE: "CWE-346"})
+	for _, cwe := range cwes {
+		// the placeholders of NVD aren't weaknesses, e.g. the NVD-CWE-noinfo of CVE-2022-30190
+		require.NotEqual(t, "CVE-2022-30190", cwe.CVE)
+		require.True(t, strings.HasPrefix(cwe.CWE, "CWE-"), cwe.CWE)
+	}
+}
+
+func TestLoadCVEMetaReport(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	// CVE-2022-0001 has a CVSS v3 score, an EPSS score and is a known exploit, CVE-2022-0002 only has a CVSS v2 score
+	// and an EPSS score, CVE-2022-0003 has no score, and CVE-2022-0004 isn't in the NVD feed.
+	vulnPath := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(vulnPath, name), []byte(content), 0o644))
+	}
+	write("nvdcve-1.1-2022.json", `{"CVE_Items": [
+		{
+			"cve": {"CVE_data_meta": {"ID": "CVE-2022-0001"}},
+			"configurations": {"nodes": [{"operator": "OR", "cpe_match": [{"vulnerable": true, "cpe23Uri": "cpe:2.3:a:vendor:product:1.0:*:*:*:*:*:*:*"}]}]},
+			"impact": {"baseMetricV3": {"cvssV3": {"baseScore": 9.8}}},
+			"publishedDate": "2022-01-01T00:00Z"
+		},
+		{
+			"cve": {"CVE_data_meta": {"ID": "CVE-2022-0002"}},
+			"configurations": {"nodes": []},
+			"impact": {"baseMetricV2": {"cvssV2": {"baseScore": 5.0}}},
+			"publishedDate": "2022-01-01T00:00Z"
+		},
+		{
+			"cve": {"CVE_data_meta": {"ID": "CVE-2022-0003"}},
+			"configurations": {"nodes": []},
+			"impact": {},
+			"publishedDate": "2022-01-01T00:00Z"
+		}
+	]}`)
+	write(strings.TrimSuffix(epssFilename, ".gz"), `#model_version:v2023.03.01,score_date:2023-03-07T00:00:00+0000
+cve,epss,percentile
+CVE-2022-0001,0.9,0.99
+CVE-2022-0002,0.1,0.5
+CVE-2022-0004,0.2,0.6
+`)
+	write(cisaKnownExploitsFilename, `{
+		"catalogVersion": "2023.03.07",
+		"dateReleased": "2023-03-07T00:00:00.000Z",
+		"vulnerabilities": [{"cveID": "CVE-2022-0001"}, {"cveID": "CVE-2022-0004"}]
+	}`)
+
+	load := func(opts ...LoadCVEMetaOption) *LoadCVEMetaResult {
+		ds := new(mock.Store)
+		ds.ListSoftwareCPEsFunc = func(ctx context.Context) ([]fleet.SoftwareCPE, error) {
+			return []fleet.SoftwareCPE{{ID: 1, SoftwareID: 1, CPE: "cpe:2.3:a:vendor:product:2.0:*:*:*:*:*:*:*"}}, nil
+		}
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+			return nil
+		}
+		result, err := LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, ds, opts...)
+		require.NoError(t, err)
+		return result
+	}
+
+	// not reported by default
+	require.Nil(t, load().Report)
+
+	result := load(WithReport())
+	require.Equal(t, 4, result.Loaded)
+	require.Equal(t, &LoadReport{
+		Processed:      4,
+		CVSSV3:         1,
+		UnscoredCVSSV2: 1,
+		EPSS:           3,
+		KnownExploit:   2,
+		Skipped:        map[string]int{},
+	}, result.Report)
+
+	// only CVE-2022-0001 can match the software of the fleet
+	result = load(WithReport(), WithSoftwareMatchFilter())
+	require.Equal(t, 1, result.Loaded)
+	require.Equal(t, &LoadReport{
+		Processed:    4,
+		CVSSV3:       1,
+		EPSS:         1,
+		KnownExploit: 1,
+		Skipped:      map[string]int{SkipReasonNoSoftwareMatch: 3},
+	}, result.Report)
+}
+
+func TestLoadCVEMetaWithoutEPSSOnly(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	// CVE-2022-0001 is in the NVD feed, CVE-2022-0002 in the CISA catalog, CVE-2022-0003 in the additional source, and
+	// CVE-2022-0004 and CVE-2022-0005 only have an EPSS score.
+	vulnPath := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(vulnPath, name), []byte(content), 0o644))
+	}
+	write("nvdcve-1.1-2022.json", `{"CVE_Items": [
+		{
+			"cve": {"CVE_data_meta": {"ID": "CVE-2022-0001"}},
+			"configurations": {"nodes": []},
+			"impact": {"baseMetricV3": {"cvssV3": {"baseScore": 9.8}}},
+			"publishedDate": "2022-01-01T00:00Z"
+		}
+	]}`)
+	write(strings.TrimSuffix(epssFilename, ".gz"), `#model_version:v2023.03.01,score_date:2023-03-07T00:00:00+0000
+cve,epss,percentile
+CVE-2022-0001,0.9,0.99
+CVE-2022-0002,0.1,0.5
+CVE-2022-0003,0.2,0.6
+CVE-2022-0004,0.3,0.7
+CVE-2022-0005,0.4,0.8
+`)
+	write(cisaKnownExploitsFilename, `{
+		"catalogVersion": "2023.03.07",
+		"dateReleased": "2023-03-07T00:00:00.000Z",
+		"vulnerabilities": [{"cveID": "CVE-2022-0002"}]
+	}`)
+	source := &fakeCVESource{metas: []fleet.CVEMeta{{CVE: "CVE-2022-0003", CVSSScore: ptr.Float64(5.0)}}}
+
+	load := func(opts ...LoadCVEMetaOption) (map[string]fleet.CVEMeta, []fleet.EPSSModelScore, *LoadCVEMetaResult) {
+		ds := new(mock.Store)
+		metas := make(map[string]fleet.CVEMeta)
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			for _, m := range x {
+				metas[m.CVE] = m
+			}
+			return nil
+		}
+		var modelScores []fleet.EPSSModelScore
+		ds.InsertEPSSModelScoresFunc = func(ctx context.Context, scores []fleet.EPSSModelScore) error {
+			modelScores = scores
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+			return nil
+		}
+		opts = append(opts, WithCVESources(source), WithEPSSModelVersions(), WithReport())
+		result, err := LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, ds, opts...)
+		require.NoError(t, err)
+		return metas, modelScores, result
+	}
+
+	metas, modelScores, result := load()
+	require.Len(t, metas, 5)
+	require.Len(t, modelScores, 5)
+	require.Empty(t, result.Report.Skipped)
+
+	metas, modelScores, result = load(WithoutEPSSOnly())
+	require.Len(t, metas, 3)
+	require.Equal(t, 0.9, *metas["CVE-2022-0001"].EPSSProbability)
+	require.True(t, *metas["CVE-2022-0002"].CISAKnownExploit)
+	require.Equal(t, 0.1, *metas["CVE-2022-0002"].EPSSProbability)
+	require.Equal(t, 5.0, *metas["CVE-2022-0003"].CVSSScore)
+	require.Equal(t, 0.2, *metas["CVE-2022-0003"].EPSSProbability)
+	require.NotContains(t, metas, "CVE-2022-0004")
+	require.NotContains(t, metas, "CVE-2022-0005")
+	require.Len(t, modelScores, 3)
+	for _, score := range modelScores {
+		require.Contains(t, metas, score.CVE)
+	}
+	require.Equal(t, 3, result.Loaded)
+	require.Equal(t, map[string]int{SkipReasonEPSSOnly: 2}, result.Report.Skipped)
+	require.Equal(t, 5, result.Report.Processed)
+}
+
+func TestLoadCVEMetaSkipsCorruptFeed(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	feed := func(cve string, score float64) string {
+		return fmt.Sprintf(`{"CVE_Items": [{
+			"cve": {"CVE_data_meta": {"ID": %q}},
+			"configurations": {"nodes": []},
+			"impact": {"baseMetricV3": {"cvssV3": {"baseScore": %v}}},
+			"publishedDate": "2022-01-01T00:00Z"
+		}]}`, cve, score)
+	}
+	vulnPath := t.TempDir()
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(vulnPath, name), []byte(content), 0o644))
+	}
+	write("nvdcve-1.1-2021.json", feed("CVE-2021-0001", 7.5))
+	write("nvdcve-1.1-2022.json", feed("CVE-2022-0001", 9.8))
+
+	var ds *mock.Store
+	load := func() ([]fleet.CVEMeta, *LoadCVEMetaResult) {
+		var saved []fleet.CVEMeta
+		ds = new(mock.Store)
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			saved = x
+			return nil
+		}
+		ds.UpsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta) error {
+			saved = x
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		result, err := LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD))
+		require.NoError(t, err)
+		return saved, result
+	}
+
+	want, result := load()
+	require.Len(t, want, 2)
+	require.Empty(t, result.SkippedFeeds)
+	require.True(t, ds.RecordCVESyncFuncInvoked)
+
+	// a truncated feed file is skipped, the others still load
+	corrupt := filepath.Join(vulnPath, "nvdcve-1.1-2020.json")
+	write(filepath.Base(corrupt), `{"CVE_Items": [{"cve": {"CVE_data_meta": {"ID": "CVE-2020-`)
+
+	got, result := load()
+	require.Equal(t, want, got)
+	require.Equal(t, 2, result.Loaded)
+	require.Equal(t, []string{corrupt}, result.SkippedFeeds)
+	// the load is partial, so it's not recorded as a sync
+	require.False(t, ds.RecordCVESyncFuncInvoked)
+}
+
+func TestLoadCVEMetaFleetCVETrend(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	vulnPath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(vulnPath, "nvdcve-1.1-2022.json"), []byte(`{"CVE_Items": [{
+		"cve": {"CVE_data_meta": {"ID": "CVE-2022-0001"}},
+		"configurations": {"nodes": []},
+		"impact": {"baseMetricV3": {"cvssV3": {"baseScore": 9.8}}},
+		"publishedDate": "2022-01-01T00:00Z"
+	}]}`), 0o644))
+
+	ds := new(mock.Store)
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.CountFleetCVEsFunc = func(ctx context.Context, opts fleet.CountCVEsOptions) (int, error) {
+		return 42, nil
+	}
+	var snapshotDate time.Time
+	var snapshotCount int
+	ds.RecordFleetCVECountSnapshotFunc = func(ctx context.Context, date time.Time, cveCount int) error {
+		snapshotDate, snapshotCount = date, cveCount
+		return nil
+	}
+	var hostsSnapshotDate time.Time
+	ds.RecordHostCVECountSnapshotsFunc = func(ctx context.Context, date time.Time) error {
+		hostsSnapshotDate = date
+		return nil
+	}
+
+	// not recorded by default
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD)))
+	require.False(t, ds.RecordFleetCVECountSnapshotFuncInvoked)
+	require.False(t, ds.RecordHostCVECountSnapshotsFuncInvoked)
+
+	before := time.Now().UTC()
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD), WithFleetCVETrend()))
+	require.True(t, ds.CountFleetCVEsFuncInvoked)
+	require.True(t, ds.RecordFleetCVECountSnapshotFuncInvoked)
+	require.Equal(t, 42, snapshotCount)
+	require.WithinRange(t, snapshotDate, before, time.Now().UTC())
+	// the hosts are snapshotted along with the fleet
+	require.True(t, ds.RecordHostCVECountSnapshotsFuncInvoked)
+	require.Equal(t, snapshotDate, hostsSnapshotDate)
+
+	ds.RecordFleetCVECountSnapshotFunc = func(ctx context.Context, date time.Time, cveCount int) error {
+		return errors.New("boom")
+	}
+	err := LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD), WithFleetCVETrend())
+	require.ErrorContains(t, err, "record fleet cve count snapshot")
+
+	// the count wouldn't see the metadata saved in the transaction
+	err = LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD), WithFleetCVETrend(), WithTx(fakeCVEMetaTx{new(mock.Store)}))
+	require.Error(t, err)
+}
+
+// fakeCVEMetaTx is a fleet.CVEMetaTx saving the metadata with the functions of its mock store.
+type fakeCVEMetaTx struct {
+	*mock.Store
+}
+
+func (tx fakeCVEMetaTx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return nil, errors.New("not implemented")
+}
+
+func TestLoadCVEMetaTx(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	vulnPath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(vulnPath, "nvdcve-1.1-2022.json"), []byte(`{"CVE_Items": [{
+		"cve": {"CVE_data_meta": {"ID": "CVE-2022-0001"}},
+		"configurations": {"nodes": []},
+		"impact": {"baseMetricV3": {"cvssV3": {"baseScore": 9.8}}},
+		"publishedDate": "2022-01-01T00:00Z"
+	}]}`), 0o644))
+
+	ds := new(mock.Store)
+	tx := fakeCVEMetaTx{new(mock.Store)}
+	var inserted []fleet.CVEMeta
+	tx.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		inserted = x
+		// no timeout is added to the context of the transaction
+		_, ok := ctx.Deadline()
+		require.False(t, ok)
+		return nil
+	}
+	tx.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error { return nil }
+
+	// the metadata is only saved in the transaction
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD), WithTx(tx)))
+	require.False(t, ds.InsertCVEMetaFuncInvoked)
+	require.False(t, ds.RecordCVESyncFuncInvoked)
+	require.True(t, tx.InsertCVEMetaFuncInvoked)
+	require.True(t, tx.RecordCVESyncFuncInvoked)
+	require.Len(t, inserted, 1)
+	require.Equal(t, "CVE-2022-0001", inserted[0].CVE)
+
+	// a checkpoint would outlive a rolled back transaction
+	tx.InsertCVEMetaFuncInvoked = false
+	err := LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD), WithTx(tx),
+		WithCheckpoint(filepath.Join(t.TempDir(), "checkpoint")))
+	require.Error(t, err)
+	require.False(t, tx.InsertCVEMetaFuncInvoked)
+}
+
+func TestLoadCVEMetaLoadLock(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	vulnPath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(vulnPath, "nvdcve-1.1-2022.json"), []byte(`{"CVE_Items": [{
+		"cve": {"CVE_data_meta": {"ID": "CVE-2022-0001"}},
+		"configurations": {"nodes": []},
+		"impact": {"baseMetricV3": {"cvssV3": {"baseScore": 9.8}}},
+		"publishedDate": "2022-01-01T00:00Z"
+	}]}`), 0o644))
+
+	var locked, wait bool
+	ds := new(mock.Store)
+	ds.LockCVEMetaLoadFunc = func(ctx context.Context, w bool) (func(), error) {
+		wait, locked = w, true
+		return func() { locked = false }, nil
+	}
+
+	// not locked by default
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error { return nil }
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error { return nil }
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD)))
+	require.False(t, ds.LockCVEMetaLoadFuncInvoked)
+
+	// the metadata is saved while holding the lock, which is released once the load is done
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		require.True(t, locked)
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		require.True(t, locked)
+		return nil
+	}
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD), WithLoadLock(true)))
+	require.True(t, ds.LockCVEMetaLoadFuncInvoked)
+	require.True(t, wait)
+	require.False(t, locked)
+
+	// the load fails without saving anything if another load holds the lock
+	ds.InsertCVEMetaFuncInvoked = false
+	ds.LockCVEMetaLoadFunc = func(ctx context.Context, w bool) (func(), error) {
+		return nil, fleet.ErrCVEMetaLoadInProgress
+	}
+	err := LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD), WithLoadLock(false))
+	require.ErrorIs(t, err, fleet.ErrCVEMetaLoadInProgress)
+	require.False(t, ds.InsertCVEMetaFuncInvoked)
+
+	// the lock would be released before the transaction is committed
+	ds.LockCVEMetaLoadFuncInvoked = false
+	err = LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds, WithFeedSources(FeedSourceNVD), WithLoadLock(true), WithTx(fakeCVEMetaTx{new(mock.Store)}))
+	require.Error(t, err)
+	require.False(t, ds.LockCVEMetaLoadFuncInvoked)
+}
+
+// fakeCVESource is a CVESource that loads fixed metadata. Its download writes an empty downloadFile, if set, or fails
+// with downloadErr, or with the error of its context if it's done.
+type fakeCVESource struct {
+	metas        []fleet.CVEMeta
+	vulnPath     string
+	downloadFile string
+	downloadErr  error
+}
+
+func (s *fakeCVESource) Download(ctx context.Context, vulnPath string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.downloadErr != nil {
+		return s.downloadErr
+	}
+	if s.downloadFile != "" {
+		return os.WriteFile(filepath.Join(vulnPath, s.downloadFile), nil, 0o644)
+	}
+	return nil
+}
+
+func (s *fakeCVESource) Load(ctx context.Context, vulnPath string) ([]fleet.CVEMeta, error) {
+	s.vulnPath = vulnPath
+	return s.metas, nil
+}
+
+func TestLoadCVEMetaCVESources(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	load := func(opts ...LoadCVEMetaOption) map[string]fleet.CVEMeta {
+		ds := new(mock.Store)
+		metas := make(map[string]fleet.CVEMeta)
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			for _, m := range x {
+				metas[m.CVE] = m
+			}
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+			return nil
+		}
+		require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds, opts...))
+		return metas
+	}
+
+	builtin := load()
+	require.NotContains(t, builtin, "CVE-2099-0001")
+
+	source := &fakeCVESource{metas: []fleet.CVEMeta{
+		// only known to the source
+		{CVE: "CVE-2099-0001", CVSSScore: ptr.Float64(9.9), CISAKnownExploit: ptr.Bool(true)},
+		// overrides the cvss score of the nvd feed, keeps the other fields
+		{CVE: "CVE-2022-29676", CVSSScore: ptr.Float64(1.0)},
+	}}
+	metas := load(WithCVESources(source))
+	require.Equal(t, "../testdata", source.vulnPath)
+	require.Len(t, metas, len(builtin)+1)
+
+	meta := metas["CVE-2099-0001"]
+	require.Equal(t, 9.9, *meta.CVSSScore)
+	require.True(t, *meta.CISAKnownExploit)
+	require.Nil(t, meta.EPSSProbability)
+
+	meta = metas["CVE-2022-29676"]
+	require.Equal(t, 1.0, *meta.CVSSScore)
+	// the source of the score is unknown
+	require.Equal(t, fleet.CVSSSourceNVD, *builtin["CVE-2022-29676"].CVSSSource)
+	require.Nil(t, meta.CVSSSource)
+	require.Equal(t, *builtin["CVE-2022-29676"].EPSSProbability, *meta.EPSSProbability)
+	require.Equal(t, *builtin["CVE-2022-29676"].CISAKnownExploit, *meta.CISAKnownExploit)
+}
+
+func TestLoadCVEMetaIncremental(t *testing.T) {
+	ds := new(mock.Store)
+
+	var cveMeta []fleet.CVEMeta
+	ds.UpsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta) error {
+		cveMeta = x
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+
+	err := LoadCVEMeta(license.NewContext(context.Background(), &fleet.LicenseInfo{
+		Tier: "premium",
+	}), log.NewNopLogger(), "../testdata", ds, WithIncremental())
+	require.NoError(t, err)
+	require.True(t, ds.UpsertCVEMetaFuncInvoked)
+	require.False(t, ds.InsertCVEMetaFuncInvoked)
+
+	metaMap := make(map[string]fleet.CVEMeta)
+	for _, meta := range cveMeta {
+		metaMap[meta.CVE] = meta
+	}
+
+	// cves missing from the cisa catalog are not marked as not exploited
+	meta := metaMap["CVE-2022-29676"]
+	require.Equal(t, float64(7.2), *meta.CVSSScore)
+	require.Nil(t, meta.CISAKnownExploit)
+
+	meta = metaMap["CVE-2022-22587"]
+	require.Equal(t, true, *meta.CISAKnownExploit)
+}
+
+func TestLoadCVEMetaProvenance(t *testing.T) {
+	ds := new(mock.Store)
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		return nil
+	}
+	var provenance []fleet.CVEMetaProvenance
+	ds.InsertCVEMetaProvenanceFunc = func(ctx context.Context, x []fleet.CVEMetaProvenance) error {
+		provenance = x
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	// not recorded by default
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds))
+	require.False(t, ds.InsertCVEMetaProvenanceFuncInvoked)
+
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds, WithProvenance()))
+	require.True(t, ds.InsertCVEMetaProvenanceFuncInvoked)
+
+	sources := func(cve string) map[string]string {
+		res := make(map[string]string)
+		for _, p := range provenance {
+			if p.CVE == cve {
+				require.False(t, p.LoadedAt.IsZero())
+				res[p.Field] = p.Source
+			}
+		}
+		return res
+	}
+
+	require.Equal(t, map[string]string{
+		"cvss_score":         "nvdcve-1.1-recent.json.gz",
+		"published":          "nvdcve-1.1-recent.json.gz",
+		"epss_probability":   "epss_scores-current.csv",
+		"cisa_known_exploit": cisaKnownExploitsFilename,
+	}, sources("CVE-2022-29676"))
+
+	// not in the nvd feed
+	require.Equal(t, map[string]string{
+		"epss_probability":   "epss_scores-current.csv",
+		"cisa_known_exploit": cisaKnownExploitsFilename,
+		"cisa_date_added":    cisaKnownExploitsFilename,
+		"cisa_due_date":      cisaKnownExploitsFilename,
+	}, sources("CVE-2022-22587"))
+}
+
+func TestLoadCVEMetaCVSSSubscores(t *testing.T) {
+	ds := new(mock.Store)
+	var metas []fleet.CVEMeta
+	// whether the datastore was told that the subscores were loaded
+	var subscoresLoaded bool
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		metas = x
+		subscoresLoaded = false
+		for _, opt := range opts {
+			if _, ok := opt().(fleet.CVSSSubscoresLoaded); ok {
+				subscoresLoaded = true
+			}
+		}
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	find := func(cve string) fleet.CVEMeta {
+		for _, m := range metas {
+			if m.CVE == cve {
+				return m
+			}
+		}
+		t.Fatalf("%s not loaded", cve)
+		return fleet.CVEMeta{}
+	}
+
+	// not loaded by default
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds))
+	meta := find("CVE-2022-29676")
+	require.NotNil(t, meta.CVSSScore)
+	require.Nil(t, meta.CVSSExploitabilityScore)
+	require.Nil(t, meta.CVSSImpactScore)
+	require.Nil(t, meta.CVSSVector)
+	require.False(t, subscoresLoaded)
+
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds, WithCVSSSubscores()))
+	require.True(t, subscoresLoaded)
+	meta = find("CVE-2022-29676")
+	require.NotNil(t, meta.CVSSExploitabilityScore)
+	require.Equal(t, 1.2, *meta.CVSSExploitabilityScore)
+	require.NotNil(t, meta.CVSSImpactScore)
+	require.Equal(t, 5.9, *meta.CVSSImpactScore)
+	require.NotNil(t, meta.CVSSVector)
+	require.Equal(t, "CVSS:3.1/AV:N/AC:L/PR:H/UI:N/S:U/C:H/I:H/A:H", *meta.CVSSVector)
+
+	// not in the nvd feed, so there's nothing to extract
+	meta = find("CVE-2022-22587")
+	require.Nil(t, meta.CVSSExploitabilityScore)
+	require.Nil(t, meta.CVSSImpactScore)
+	require.Nil(t, meta.CVSSVector)
+}
+
+func TestLoadCVEMetaCVSSSource(t *testing.T) {
+	ds := new(mock.Store)
+	metas := make(map[string]fleet.CVEMeta)
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		for _, m := range x {
+			metas[m.CVE] = m
+		}
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds, WithFeedSources(FeedSourceNVD)))
+	require.NotEmpty(t, metas)
+
+	// the scores of the 1.1 feeds are those assigned by NVD
+	meta := metas["CVE-2022-29676"]
+	require.Equal(t, 7.2, *meta.CVSSScore)
+	require.Equal(t, fleet.CVSSSourceNVD, *meta.CVSSSource)
+	for _, meta := range metas {
+		if meta.CVSSScore != nil {
+			require.NotNil(t, meta.CVSSSource, meta.CVE)
+			require.Equal(t, fleet.CVSSSourceNVD, *meta.CVSSSource, meta.CVE)
+		}
+	}
+
+	// yet to be analyzed, so there's no score nor source
+	meta = metas["CVE-2021-42887"]
+	require.Nil(t, meta.CVSSScore)
+	require.Nil(t, meta.CVSSSource)
+}
+
+func TestLoadCVEMetaLastModified(t *testing.T) {
+	ds := new(mock.Store)
+	var metas []fleet.CVEMeta
+	// whether the datastore was told that the last modified dates were loaded
+	var lastModifiedLoaded bool
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		metas = x
+		lastModifiedLoaded = false
+		for _, opt := range opts {
+			if _, ok := opt().(fleet.LastModifiedLoaded); ok {
+				lastModifiedLoaded = true
+			}
+		}
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	find := func(cve string) fleet.CVEMeta {
+		for _, m := range metas {
+			if m.CVE == cve {
+				return m
+			}
+		}
+		t.Fatalf("%s not loaded", cve)
+		return fleet.CVEMeta{}
+	}
+
+	// not loaded by default
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds))
+	require.Nil(t, find("CVE-2022-29676").LastModified)
+	require.False(t, lastModifiedLoaded)
+
+	require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds, WithLastModified()))
+	require.True(t, lastModifiedLoaded)
+	meta := find("CVE-2022-29676")
+	require.NotNil(t, meta.LastModified)
+	require.True(t, time.Date(2022, 5, 28, 2, 31, 0, 0, time.UTC).Equal(*meta.LastModified))
+
+	// a date that can't be parsed is left unset, the item has no impact yet
+	vuln := feednvd.ToVuln(&schema.NVDCVEFeedJSON10DefCVEItem{
+		Configurations:   &schema.NVDCVEFeedJSON10DefConfigurations{},
+		PublishedDate:    "2022-05-26T14:15Z",
+		LastModifiedDate: "not a date",
+	})
+	extracted, ok := extractNVDCVEMeta(log.NewNopLogger(), "CVE-2022-0001", vuln, loadCVEMetaOptions{lastModified: true})
+	require.True(t, ok)
+	require.NotNil(t, extracted.meta.Published)
+	require.Nil(t, extracted.meta.LastModified)
+	require.NotContains(t, extracted.fields, "last_modified")
+	require.Nil(t, extracted.meta.CVSSScore)
+}
+
+func TestLoadCVEMetaMissingOptionalFeeds(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	// copies the test feeds to a new directory, except the excluded file
+	feedsWithout := func(excluded string) string {
+		dir := t.TempDir()
+		for _, name := range []string{"nvdcve-1.1-recent.json.gz", "epss_scores-current.csv", cisaKnownExploitsFilename} {
+			if name == excluded {
+				continue
+			}
+			b, err := os.ReadFile(filepath.Join("../testdata", name))
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), b, 0o644))
+		}
+		return dir
+	}
+
+	load := func(vulnPath string) map[string]fleet.CVEMeta {
+		ds := new(mock.Store)
+		metas := make(map[string]fleet.CVEMeta)
+		ds.UpsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta) error {
+			for _, m := range x {
+				metas[m.CVE] = m
+			}
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+			return nil
+		}
+
+		require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), vulnPath, ds))
+		// the stored values of the missing feed are kept
+		require.True(t, ds.UpsertCVEMetaFuncInvoked)
+		require.False(t, ds.InsertCVEMetaFuncInvoked)
+		// a partial load doesn't advance the sync timestamp
+		require.False(t, ds.RecordCVESyncFuncInvoked)
+		return metas
+	}
+
+	metas := load(feedsWithout("epss_scores-current.csv"))
+	meta, ok := metas["CVE-2022-29676"]
+	require.True(t, ok)
+	require.NotNil(t, meta.CVSSScore)
+	require.NotNil(t, meta.Published)
+	require.Nil(t, meta.EPSSProbability)
+	require.NotNil(t, meta.CISAKnownExploit)
+	require.False(t, *meta.CISAKnownExploit)
+	meta, ok = metas["CVE-2022-22587"]
+	require.True(t, ok)
+	require.NotNil(t, meta.CISAKnownExploit)
+	require.True(t, *meta.CISAKnownExploit)
+
+	metas = load(feedsWithout(cisaKnownExploitsFilename))
+	meta, ok = metas["CVE-2022-29676"]
+	require.True(t, ok)
+	require.NotNil(t, meta.CVSSScore)
+	require.NotNil(t, meta.EPSSProbability)
+	for _, m := range metas {
+		require.Nil(t, m.CISAKnownExploit, m.CVE)
+	}
+}
+
+func TestLoadCVEMetaStaleFeeds(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	vulnPath := t.TempDir()
+	for _, name := range []string{"nvdcve-1.1-recent.json.gz", "epss_scores-current.csv", cisaKnownExploitsFilename} {
+		b, err := os.ReadFile(filepath.Join("../testdata", name))
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(vulnPath, name), b, 0o644))
+	}
+	// the epss feed wasn't synced for a week
+	oldFeed := filepath.Join(vulnPath, "epss_scores-current.csv")
+	weekAgo := time.Now().Add(-7 * 24 * time.Hour)
+	require.NoError(t, os.Chtimes(oldFeed, weekAgo, weekAgo))
+
+	newDS := func() *mock.Store {
+		ds := new(mock.Store)
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+			return nil
+		}
+		return ds
+	}
+
+	ds := newDS()
+	result, err := LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, ds, WithStalenessThreshold(24*time.Hour))
+	require.NoError(t, err)
+	// the stale feed is still loaded
+	require.True(t, ds.InsertCVEMetaFuncInvoked)
+	require.True(t, ds.RecordCVESyncFuncInvoked)
+	require.NotZero(t, result.Loaded)
+	require.Len(t, result.StaleFeeds, 1)
+	require.Equal(t, oldFeed, result.StaleFeeds[0].Path)
+	require.WithinDuration(t, weekAgo, result.StaleFeeds[0].ModTime, time.Second)
+	require.Greater(t, result.StaleFeeds[0].Age, 24*time.Hour)
+
+	// no feed is older than the threshold
+	result, err = LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, newDS(), WithStalenessThreshold(30*24*time.Hour))
+	require.NoError(t, err)
+	require.Empty(t, result.StaleFeeds)
+
+	// staleness isn't checked without a threshold
+	result, err = LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, newDS())
+	require.NoError(t, err)
+	require.Empty(t, result.StaleFeeds)
+}
+
+func TestLoadCVEMetaParseWorkers(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	load := func(workers int) (map[string]fleet.CVEMeta, map[fleet.CVEMetaProvenance]bool) {
+		ds := new(mock.Store)
+		metas := make(map[string]fleet.CVEMeta)
+		ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+			for _, m := range x {
+				metas[m.CVE] = m
+			}
+			return nil
+		}
+		provenance := make(map[fleet.CVEMetaProvenance]bool)
+		ds.InsertCVEMetaProvenanceFunc = func(ctx context.Context, x []fleet.CVEMetaProvenance) error {
+			for _, p := range x {
+				p.LoadedAt = time.Time{}
+				provenance[p] = true
+			}
+			return nil
+		}
+		ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+			return nil
+		}
+		ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+			return nil
+		}
+
+		require.NoError(t, LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds,
+			WithParseWorkers(workers), WithCVSSSubscores(), WithProvenance()))
+		return metas, provenance
+	}
+
+	sequentialMetas, sequentialProvenance := load(1)
+	require.NotEmpty(t, sequentialMetas)
+	require.NotEmpty(t, sequentialProvenance)
+
+	concurrentMetas, concurrentProvenance := load(8)
+	require.Equal(t, sequentialMetas, concurrentMetas)
+	require.Equal(t, sequentialProvenance, concurrentProvenance)
+}
+
+func BenchmarkLoadCVEMeta(b *testing.B) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	ds := new(mock.Store)
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+
+	for _, workers := range []int{1, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := LoadCVEMeta(ctx, log.NewNopLogger(), "../testdata", ds, WithParseWorkers(workers)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCVEMetaFailedInsertNotRecorded(t *testing.T) {
+	ds := new(mock.Store)
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		return errors.New("insert failed")
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+
+	err := LoadCVEMeta(license.NewContext(context.Background(), &fleet.LicenseInfo{
+		Tier: "premium",
+	}), log.NewNopLogger(), "../testdata", ds)
+	require.Error(t, err)
+	require.True(t, ds.InsertCVEMetaFuncInvoked)
+	require.False(t, ds.RecordCVESyncFuncInvoked)
+	require.False(t, ds.RecordCISACatalogVersionFuncInvoked)
+}
+
+func TestCISACatalogChanged(t *testing.T) {
+	ctx := context.Background()
+	ds := new(mock.Store)
+
+	released := time.Date(2022, 6, 2, 17, 48, 15, 151500000, time.UTC)
+	var last *fleet.CISACatalogVersion
+	ds.LastCISACatalogVersionFunc = func(ctx context.Context) (*fleet.CISACatalogVersion, error) {
+		if last == nil {
+			return nil, &mock.Error{Message: "not found"}
+		}
+		return last, nil
+	}
+
+	// never loaded
+	changed, err := CISACatalogChanged(ctx, ds, "../testdata")
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// same version
+	last = &fleet.CISACatalogVersion{CatalogVersion: "2022.06.02", DateReleased: &released, LoadedAt: time.Now()}
+	changed, err = CISACatalogChanged(ctx, ds, "../testdata")
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	// the catalog on disk has a bumped version
+	vulnPath := t.TempDir()
+	b, err := os.ReadFile(filepath.Join("../testdata", cisaKnownExploitsFilename))
+	require.NoError(t, err)
+	b = bytes.Replace(b, []byte(`"catalogVersion": "2022.06.02"`), []byte(`"catalogVersion": "2022.06.03"`), 1)
+	require.NoError(t, os.WriteFile(filepath.Join(vulnPath, cisaKnownExploitsFilename), b, 0o644))
+
+	changed, err = CISACatalogChanged(ctx, ds, vulnPath)
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// same version, released again
+	later := released.Add(time.Hour)
+	last = &fleet.CISACatalogVersion{CatalogVersion: "2022.06.02", DateReleased: &later, LoadedAt: time.Now()}
+	changed, err = CISACatalogChanged(ctx, ds, "../testdata")
+	require.NoError(t, err)
+	require.True(t, changed)
+
+	// no catalog on disk
+	_, err = CISACatalogChanged(ctx, ds, t.TempDir())
+	require.Error(t, err)
 }
 
 func TestDownloadCPETranslations(t *testing.T) {
@@ -80,3 +1855,309 @@ func TestDownloadCPETranslations(t *testing.T) {
 
 	assert.FileExists(t, filepath.Join(tempDir, cpeTranslationsFilename))
 }
+
+func TestParseNVDDate(t *testing.T) {
+	cases := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2022-05-16T17:15Z", time.Date(2022, 5, 16, 17, 15, 0, 0, time.UTC)},
+		{"2022-05-16T17:15:42Z", time.Date(2022, 5, 16, 17, 15, 42, 0, time.UTC)},
+		{"2022-05-16T17:15:42.123", time.Date(2022, 5, 16, 17, 15, 42, 123000000, time.UTC)},
+		{"2022-05-16", time.Date(2022, 5, 16, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		got, err := parseNVDDate(c.in)
+		require.NoError(t, err, c.in)
+		require.True(t, c.want.Equal(got), c.in)
+	}
+
+	_, err := parseNVDDate("16/05/2022")
+	require.Error(t, err)
+}
+
+func TestFeedSourceHas(t *testing.T) {
+	all := []FeedSource{FeedSourceCPE, FeedSourceNVD, FeedSourceEPSS, FeedSourceCISA}
+
+	// an empty set means all sources
+	for _, src := range all {
+		require.True(t, FeedSource(0).Has(src))
+		require.True(t, FeedSourceAll.Has(src))
+	}
+
+	set := FeedSourceCPE | FeedSourceNVD
+	require.True(t, set.Has(FeedSourceCPE))
+	require.True(t, set.Has(FeedSourceNVD))
+	require.False(t, set.Has(FeedSourceEPSS))
+	require.False(t, set.Has(FeedSourceCISA))
+}
+
+func TestLoadEPSSSnapshot(t *testing.T) {
+	ds := new(mock.Store)
+
+	var snapshots []fleet.EPSSSnapshot
+	ds.InsertEPSSSnapshotsFunc = func(ctx context.Context, x []fleet.EPSSSnapshot) error {
+		snapshots = x
+		return nil
+	}
+
+	logger := log.NewNopLogger()
+
+	// not loaded without a premium license
+	require.NoError(t, LoadEPSSSnapshot(context.Background(), logger, "../testdata", ds))
+	require.False(t, ds.InsertEPSSSnapshotsFuncInvoked)
+
+	err := LoadEPSSSnapshot(license.NewContext(context.Background(), &fleet.LicenseInfo{
+		Tier: "premium",
+	}), logger, "../testdata", ds)
+	require.NoError(t, err)
+	require.True(t, ds.InsertEPSSSnapshotsFuncInvoked)
+
+	byCVE := make(map[string]fleet.EPSSSnapshot)
+	for _, s := range snapshots {
+		byCVE[s.CVE] = s
+	}
+	snapshot := byCVE["CVE-2022-22587"]
+	require.Equal(t, time.Date(2022, 6, 3, 0, 0, 0, 0, time.UTC), snapshot.SnapshotDate)
+	require.Equal(t, 0.01843, snapshot.Score)
+	require.Equal(t, 0.75481, snapshot.Percentile)
+}
+
+func TestParseEPSSScoresFileModelVersion(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "with_header.csv")
+	require.NoError(t, os.WriteFile(path, []byte(`#model_version:v2023.03.01,score_date:2023-03-07T00:00:00+0000
+cve,epss,percentile
+CVE-2022-0001,0.1,0.5
+CVE-2022-0002,0.2,0.6
+`), 0o644))
+	scores, err := parseEPSSScoresFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []epssScore{
+		{CVE: "CVE-2022-0001", Score: 0.1, ModelVersion: "v2023.03.01"},
+		{CVE: "CVE-2022-0002", Score: 0.2, ModelVersion: "v2023.03.01"},
+	}, scores)
+
+	// the model version is left empty when the feed has no header comment
+	path = filepath.Join(dir, "without_header.csv")
+	require.NoError(t, os.WriteFile(path, []byte(`cve,epss,percentile
+CVE-2022-0001,0.1,0.5
+`), 0o644))
+	scores, err = parseEPSSScoresFile(path)
+	require.NoError(t, err)
+	require.Equal(t, []epssScore{{CVE: "CVE-2022-0001", Score: 0.1}}, scores)
+
+	scores, err = parseEPSSScoresFile(filepath.Join("../testdata", strings.TrimSuffix(epssFilename, ".gz")))
+	require.NoError(t, err)
+	require.NotEmpty(t, scores)
+	require.Equal(t, "v2022.01.01", scores[0].ModelVersion)
+}
+
+func TestParseEPSSScoresFileQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "scores.csv")
+	quarantinePath := filepath.Join(dir, "quarantine.csv")
+
+	require.NoError(t, os.WriteFile(path, []byte(`#model_version:v2023.03.01,score_date:2023-03-07T00:00:00+0000
+cve,epss,percentile
+CVE-2022-0001,0.1,0.5
+CVE-2022-0002,not a score,0.5
+CVE-2022-0003,0.3
+CVE-2022-0004,0"4,0.5
+CVE-2022-0005,0.5,0.6
+`), 0o644))
+
+	// malformed rows fail the parsing by default
+	_, err := parseEPSSScoresFile(path)
+	require.Error(t, err)
+
+	scores, quarantined, err := parseEPSSScoresFileWithQuarantine(path, quarantinePath)
+	require.NoError(t, err)
+	require.Equal(t, 3, quarantined)
+	require.Equal(t, []epssScore{
+		{CVE: "CVE-2022-0001", Score: 0.1, ModelVersion: "v2023.03.01"},
+		{CVE: "CVE-2022-0005", Score: 0.5, ModelVersion: "v2023.03.01"},
+	}, scores)
+
+	f, err := os.Open(quarantinePath)
+	require.NoError(t, err)
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 4)
+	require.Equal(t, []string{"line", "error", "row"}, rows[0])
+	// the line numbers are those of the feed file
+	require.Equal(t, "4", rows[1][0])
+	require.Contains(t, rows[1][1], "parse epss score")
+	require.Equal(t, "CVE-2022-0002,not a score,0.5", rows[1][2])
+	require.Equal(t, "5", rows[2][0])
+	require.Equal(t, "CVE-2022-0003,0.3", rows[2][2])
+	require.Equal(t, "6", rows[3][0])
+
+	// the quarantine of a previous parsing doesn't outlive a parsing without malformed rows
+	require.NoError(t, os.WriteFile(path, []byte("cve,epss,percentile\nCVE-2022-0001,0.1,0.5\n"), 0o644))
+	scores, quarantined, err = parseEPSSScoresFileWithQuarantine(path, quarantinePath)
+	require.NoError(t, err)
+	require.Zero(t, quarantined)
+	require.Len(t, scores, 1)
+	require.NoFileExists(t, quarantinePath)
+}
+
+func TestLoadCVEMetaEPSSQuarantine(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+
+	vulnPath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(vulnPath, strings.TrimSuffix(epssFilename, ".gz")), []byte(`cve,epss,percentile
+CVE-2022-0001,0.1,0.5
+CVE-2022-0002,not a score,0.5
+`), 0o644))
+
+	ds := new(mock.Store)
+	var metas []fleet.CVEMeta
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		metas = x
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+
+	opts := []LoadCVEMetaOption{WithFeedSources(FeedSourceEPSS)}
+	_, err := LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, ds, opts...)
+	require.Error(t, err)
+
+	quarantinePath := filepath.Join(t.TempDir(), "quarantine.csv")
+	result, err := LoadCVEMetaWithResult(ctx, log.NewNopLogger(), vulnPath, ds, append(opts, WithEPSSQuarantine(quarantinePath))...)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.QuarantinedEPSSRows)
+	require.FileExists(t, quarantinePath)
+	require.Len(t, metas, 1)
+	require.Equal(t, "CVE-2022-0001", metas[0].CVE)
+}
+
+func TestLoadCVEMetaEPSSModelVersions(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+	logger := log.NewNopLogger()
+
+	ds := new(mock.Store)
+	var cveMeta []fleet.CVEMeta
+	ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+		cveMeta = x
+		return nil
+	}
+	var modelScores []fleet.EPSSModelScore
+	ds.InsertEPSSModelScoresFunc = func(ctx context.Context, x []fleet.EPSSModelScore) error {
+		modelScores = x
+		return nil
+	}
+	ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+		return nil
+	}
+	ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+		return nil
+	}
+
+	// the model scores are not saved by default
+	require.NoError(t, LoadCVEMeta(ctx, logger, "../testdata", ds))
+	require.False(t, ds.InsertEPSSModelScoresFuncInvoked)
+
+	require.NoError(t, LoadCVEMeta(ctx, logger, "../testdata", ds, WithEPSSModelVersions()))
+	require.True(t, ds.InsertEPSSModelScoresFuncInvoked)
+
+	var found bool
+	for _, score := range modelScores {
+		require.Equal(t, "v2022.01.01", score.ModelVersion)
+		if score.CVE == "CVE-2022-22587" {
+			found = true
+			require.Equal(t, 0.01843, score.Score)
+		}
+	}
+	require.True(t, found)
+
+	// the current score is still loaded in the cve metadata
+	for _, meta := range cveMeta {
+		if meta.CVE == "CVE-2022-22587" {
+			require.Equal(t, 0.01843, *meta.EPSSProbability)
+		}
+	}
+}
+
+func TestLoadCVEMetaFeedSources(t *testing.T) {
+	ctx := license.NewContext(context.Background(), &fleet.LicenseInfo{Tier: "premium"})
+	logger := log.NewNopLogger()
+
+	feedFiles := map[FeedSource]string{
+		FeedSourceNVD:  "nvdcve-1.1-recent.json.gz",
+		FeedSourceEPSS: strings.TrimSuffix(epssFilename, ".gz"),
+		FeedSourceCISA: cisaKnownExploitsFilename,
+	}
+
+	// every combination of the sources read by LoadCVEMeta, the CPE source is always set so that the set is never
+	// empty (which would mean all sources).
+	for mask := FeedSource(0); mask <= FeedSourceNVD|FeedSourceEPSS|FeedSourceCISA; mask += FeedSourceNVD {
+		sources := FeedSourceCPE | mask
+
+		t.Run(fmt.Sprintf("sources=%04b", sources), func(t *testing.T) {
+			// only the feeds of the enabled sources are present on disk
+			vulnPath := t.TempDir()
+			for src, name := range feedFiles {
+				if !sources.Has(src) {
+					continue
+				}
+				b, err := os.ReadFile(filepath.Join("../testdata", name))
+				require.NoError(t, err)
+				require.NoError(t, os.WriteFile(filepath.Join(vulnPath, name), b, 0o644))
+			}
+
+			ds := new(mock.Store)
+			var cveMeta []fleet.CVEMeta
+			ds.InsertCVEMetaFunc = func(ctx context.Context, x []fleet.CVEMeta, opts ...fleet.OptionalArg) error {
+				cveMeta = x
+				return nil
+			}
+			ds.RecordCVESyncFunc = func(ctx context.Context, syncedAt time.Time, cveCount int) error {
+				return nil
+			}
+			ds.RecordCISACatalogVersionFunc = func(ctx context.Context, version fleet.CISACatalogVersion) error {
+				return nil
+			}
+
+			err := LoadCVEMeta(ctx, logger, vulnPath, ds, WithFeedSources(sources))
+			require.NoError(t, err)
+
+			if mask == 0 {
+				require.False(t, ds.InsertCVEMetaFuncInvoked)
+				return
+			}
+			require.True(t, ds.InsertCVEMetaFuncInvoked)
+
+			metaMap := make(map[string]fleet.CVEMeta)
+			for _, meta := range cveMeta {
+				metaMap[meta.CVE] = meta
+				if !sources.Has(FeedSourceNVD) {
+					require.Nil(t, meta.CVSSScore)
+					require.Nil(t, meta.Published)
+				}
+				if !sources.Has(FeedSourceEPSS) {
+					require.Nil(t, meta.EPSSProbability)
+				}
+				if !sources.Has(FeedSourceCISA) {
+					require.Nil(t, meta.CISAKnownExploit)
+				} else {
+					require.NotNil(t, meta.CISAKnownExploit)
+				}
+			}
+
+			if sources.Has(FeedSourceNVD) {
+				require.Equal(t, float64(7.2), *metaMap["CVE-2022-29676"].CVSSScore)
+			}
+			if sources.Has(FeedSourceEPSS) {
+				require.Equal(t, float64(0.01843), *metaMap["CVE-2022-22587"].EPSSProbability)
+			}
+			if sources.Has(FeedSourceCISA) {
+				require.True(t, *metaMap["CVE-2022-22587"].CISAKnownExploit)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Package vulnerabilities holds the logic shared by the vulnerability sources and reports.
+package vulnerabilities
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fleetdm/fleet/v4/server/fleet"
+)
+
+// RiskTier is the prioritization tier of a CVE, combining its severity and its likelihood of exploitation.
+type RiskTier string
+
+const (
+	RiskTierCritical RiskTier = "critical"
+	RiskTierHigh     RiskTier = "high"
+	RiskTierMedium   RiskTier = "medium"
+	RiskTierLow      RiskTier = "low"
+	// RiskTierUnknown is the tier of the CVEs without a CVSS score nor an EPSS probability.
+	RiskTierUnknown RiskTier = "unknown"
+)
+
+// RiskThreshold is the minimum CVSS score and EPSS probability of a CVE in a tier. Both must be met.
+type RiskThreshold struct {
+	MinCVSSScore       float64
+	MinEPSSProbability float64
+}
+
+// RiskThresholds are the thresholds of the tiers above RiskTierLow. Each tier's thresholds must be greater than or
+// equal to those of the tier below it.
+type RiskThresholds struct {
+	Critical RiskThreshold
+	High     RiskThreshold
+	Medium   RiskThreshold
+}
+
+// Validate checks that the thresholds are within the range of the CVSS scores (0 to 10) and EPSS probabilities (0 to
+// 1), and that they don't decrease from one tier to the next.
+func (t RiskThresholds) Validate() error {
+	tiers := []struct {
+		tier      RiskTier
+		threshold RiskThreshold
+	}{
+		{RiskTierMedium, t.Medium},
+		{RiskTierHigh, t.High},
+		{RiskTierCritical, t.Critical},
+	}
+
+	var prev RiskThreshold
+	for _, tt := range tiers {
+		if tt.threshold.MinCVSSScore < 0 || tt.threshold.MinCVSSScore > 10 {
+			return fmt.Errorf("%s: cvss score threshold out of range: %v", tt.tier, tt.threshold.MinCVSSScore)
+		}
+		if tt.threshold.MinEPSSProbability < 0 || tt.threshold.MinEPSSProbability > 1 {
+			return fmt.Errorf("%s: epss probability threshold out of range: %v", tt.tier, tt.threshold.MinEPSSProbability)
+		}
+		if tt.threshold.MinCVSSScore < prev.MinCVSSScore || tt.threshold.MinEPSSProbability < prev.MinEPSSProbability {
+			return fmt.Errorf("%s: %w", tt.tier, errDecreasingRiskThreshold)
+		}
+		prev = tt.threshold
+	}
+	return nil
+}
+
+var errDecreasingRiskThreshold = errors.New("threshold lower than the tier below")
+
+// ClassifyRisk returns the highest tier whose thresholds are met by the CVE, or RiskTierLow if none are. A missing
+// CVSS score or EPSS probability counts as 0, so it only meets thresholds of 0. CVEs with neither are
+// RiskTierUnknown.
+func ClassifyRisk(meta fleet.CVEMeta, thresholds RiskThresholds) RiskTier {
+	if meta.CVSSScore == nil && meta.EPSSProbability == nil {
+		return RiskTierUnknown
+	}
+
+	var cvss, epss float64
+	if meta.CVSSScore != nil {
+		cvss = *meta.CVSSScore
+	}
+	if meta.EPSSProbability != nil {
+		epss = *meta.EPSSProbability
+	}
+
+	meets := func(t RiskThreshold) bool {
+		return cvss >= t.MinCVSSScore && epss >= t.MinEPSSProbability
+	}
+	switch {
+	case meets(thresholds.Critical):
+		return RiskTierCritical
+	case meets(thresholds.High):
+		return RiskTierHigh
+	case meets(thresholds.Medium):
+		return RiskTierMedium
+	default:
+		return RiskTierLow
+	}
+}
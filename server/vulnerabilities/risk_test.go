@@ -0,0 +1,71 @@
+package vulnerabilities
+
+import (
+	"testing"
+
+	"github.com/fleetdm/fleet/v4/server/fleet"
+	"github.com/fleetdm/fleet/v4/server/ptr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyRisk(t *testing.T) {
+	thresholds := RiskThresholds{
+		Critical: RiskThreshold{MinCVSSScore: 9.0, MinEPSSProbability: 0.5},
+		High:     RiskThreshold{MinCVSSScore: 7.0, MinEPSSProbability: 0.1},
+		Medium:   RiskThreshold{MinCVSSScore: 4.0},
+	}
+	require.NoError(t, thresholds.Validate())
+
+	cases := []struct {
+		name string
+		cvss *float64
+		epss *float64
+		want RiskTier
+	}{
+		{"no metadata", nil, nil, RiskTierUnknown},
+		{"critical at the thresholds", ptr.Float64(9.0), ptr.Float64(0.5), RiskTierCritical},
+		{"critical above the thresholds", ptr.Float64(10.0), ptr.Float64(1.0), RiskTierCritical},
+		{"critical score, epss just below", ptr.Float64(9.0), ptr.Float64(0.4999), RiskTierHigh},
+		{"critical epss, score just below", ptr.Float64(8.9), ptr.Float64(0.5), RiskTierHigh},
+		{"high at the thresholds", ptr.Float64(7.0), ptr.Float64(0.1), RiskTierHigh},
+		{"high score, epss just below", ptr.Float64(7.0), ptr.Float64(0.0999), RiskTierMedium},
+		{"high score, no epss", ptr.Float64(9.8), nil, RiskTierMedium},
+		{"high epss, score just below", ptr.Float64(6.9), ptr.Float64(0.9), RiskTierMedium},
+		{"medium at the threshold", ptr.Float64(4.0), ptr.Float64(0), RiskTierMedium},
+		{"medium score just below", ptr.Float64(3.9), ptr.Float64(0.9), RiskTierLow},
+		{"no score", nil, ptr.Float64(0.9), RiskTierLow},
+		{"zero score", ptr.Float64(0), nil, RiskTierLow},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := ClassifyRisk(fleet.CVEMeta{CVE: "cve-1", CVSSScore: c.cvss, EPSSProbability: c.epss}, thresholds)
+			require.Equal(t, c.want, got)
+		})
+	}
+}
+
+func TestRiskThresholdsValidate(t *testing.T) {
+	require.NoError(t, RiskThresholds{}.Validate())
+
+	cases := []struct {
+		name       string
+		thresholds RiskThresholds
+	}{
+		{"cvss above 10", RiskThresholds{Critical: RiskThreshold{MinCVSSScore: 10.1}}},
+		{"negative cvss", RiskThresholds{Medium: RiskThreshold{MinCVSSScore: -1}}},
+		{"epss above 1", RiskThresholds{Critical: RiskThreshold{MinEPSSProbability: 1.1}}},
+		{"decreasing cvss", RiskThresholds{
+			Critical: RiskThreshold{MinCVSSScore: 7},
+			High:     RiskThreshold{MinCVSSScore: 9},
+		}},
+		{"decreasing epss", RiskThresholds{
+			High:   RiskThreshold{MinEPSSProbability: 0.1},
+			Medium: RiskThreshold{MinEPSSProbability: 0.2},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			require.Error(t, c.thresholds.Validate())
+		})
+	}
+}
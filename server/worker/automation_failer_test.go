@@ -18,7 +18,7 @@ import (
 
 func TestJiraFailer(t *testing.T) {
 	ds := new(mock.Store)
-	ds.HostsByCVEFunc = func(ctx context.Context, cve string) ([]*fleet.HostShort, error) {
+	ds.HostsByCVEFunc = func(ctx context.Context, cve string, opts fleet.HostsByCVEOptions) ([]*fleet.HostShort, error) {
 		return []*fleet.HostShort{{ID: 1, Hostname: "test"}}, nil
 	}
 	ds.AppConfigFunc = func(ctx context.Context) (*fleet.AppConfig, error) {
@@ -89,7 +89,7 @@ func TestJiraFailer(t *testing.T) {
 
 func TestZendeskFailer(t *testing.T) {
 	ds := new(mock.Store)
-	ds.HostsByCVEFunc = func(ctx context.Context, cve string) ([]*fleet.HostShort, error) {
+	ds.HostsByCVEFunc = func(ctx context.Context, cve string, opts fleet.HostsByCVEOptions) ([]*fleet.HostShort, error) {
 		return []*fleet.HostShort{{ID: 1, Hostname: "test"}}, nil
 	}
 	ds.AppConfigFunc = func(ctx context.Context) (*fleet.AppConfig, error) {
@@ -267,7 +267,7 @@ func (j *Jira) runVuln(ctx context.Context, cli JiraClient, args jiraArgs) error
 			CVE: args.CVE,
 		}
 	}
-	hosts, err := j.Datastore.HostsByCVE(ctx, vargs.CVE)
+	hosts, err := j.Datastore.HostsByCVE(ctx, vargs.CVE, fleet.HostsByCVEOptions{})
 	if err != nil {
 		return ctxerr.Wrap(ctx, err, "find hosts by cve")
 	}
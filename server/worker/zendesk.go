@@ -269,7 +269,7 @@ func (z *Zendesk) runVuln(ctx context.Context, cli ZendeskClient, args zendeskAr
 			CVE: args.CVE,
 		}
 	}
-	hosts, err := z.Datastore.HostsByCVE(ctx, vargs.CVE)
+	hosts, err := z.Datastore.HostsByCVE(ctx, vargs.CVE, fleet.HostsByCVEOptions{})
 	if err != nil {
 		return ctxerr.Wrap(ctx, err, "find hosts by cve")
 	}
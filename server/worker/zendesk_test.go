@@ -22,7 +22,7 @@ import (
 
 func TestZendeskRun(t *testing.T) {
 	ds := new(mock.Store)
-	ds.HostsByCVEFunc = func(ctx context.Context, cve string) ([]*fleet.HostShort, error) {
+	ds.HostsByCVEFunc = func(ctx context.Context, cve string, opts fleet.HostsByCVEOptions) ([]*fleet.HostShort, error) {
 		return []*fleet.HostShort{
 			{
 				ID:       1,